@@ -0,0 +1,276 @@
+package redi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
+)
+
+// AdminPathPrefix is the path under which the admin API is served
+const AdminPathPrefix = "/_redi/admin"
+
+// setupHealthChecks registers the liveness and readiness endpoints
+func (s *Server) setupHealthChecks() {
+	s.router.HandleFunc("/healthz", withRouteInfo("health", s.handleHealthz)).Methods("GET", "HEAD")
+	s.router.HandleFunc("/readyz", withRouteInfo("health", s.handleReadyz)).Methods("GET", "HEAD")
+}
+
+// handleHealthz reports that the process is alive
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can serve traffic: routes must be
+// scanned and, when pre-building on start, the pre-build must have finished
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, checks := s.readiness()
+	status := http.StatusOK
+	body := map[string]interface{}{"status": "ready", "checks": checks}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		body["status"] = "not ready"
+	}
+	writeJSON(w, status, body)
+}
+
+// readiness returns whether the server is ready and the state of each check
+func (s *Server) readiness() (bool, map[string]string) {
+	ready := true
+	checks := map[string]string{"routes": "ok", "prebuild": "disabled"}
+
+	if !s.routesReady.Load() {
+		ready = false
+		checks["routes"] = "pending"
+	}
+
+	if s.prebuildOnStart {
+		switch {
+		case !s.prebuildDone.Load():
+			ready = false
+			checks["prebuild"] = "pending"
+		case s.prebuildErr.Load() != nil:
+			// Components are still compiled on demand, so a failed pre-build
+			// doesn't keep the server out of rotation
+			checks["prebuild"] = "failed: " + s.prebuildErr.Load().(string)
+		default:
+			checks["prebuild"] = "ok"
+		}
+	}
+
+	for _, site := range s.siteServers() {
+		if siteReady, siteChecks := site.readiness(); !siteReady {
+			ready = false
+			for name, state := range siteChecks {
+				if state == "pending" {
+					checks[name] = "pending"
+				}
+			}
+		}
+	}
+
+	return ready, checks
+}
+
+// IsReady reports whether the server is ready to serve traffic
+func (s *Server) IsReady() bool {
+	ready, _ := s.readiness()
+	return ready
+}
+
+// setupAdmin registers the authenticated admin API
+func (s *Server) setupAdmin() {
+	s.router.HandleFunc(AdminPathPrefix, s.adminOnly(s.handleAdminIndex)).Methods("GET")
+	s.router.HandleFunc(AdminPathPrefix+"/routes", s.adminOnly(s.handleAdminRoutes)).Methods("GET")
+	s.router.HandleFunc(AdminPathPrefix+"/sessions", s.adminOnly(s.handleAdminSessions)).Methods("GET")
+	s.router.HandleFunc(AdminPathPrefix+"/sessions", s.adminOnly(s.handleAdminEvictSessions)).Methods("DELETE")
+	s.router.HandleFunc(AdminPathPrefix+"/sessions/{id}", s.adminOnly(s.handleAdminEvictSession)).Methods("DELETE")
+	s.router.HandleFunc(AdminPathPrefix+"/cache", s.adminOnly(s.handleAdminCache)).Methods("GET")
+	s.router.HandleFunc(AdminPathPrefix+"/cache", s.adminOnly(s.handleAdminClearCache)).Methods("DELETE")
+	s.router.HandleFunc(AdminPathPrefix+"/prebuild", s.adminOnly(s.handleAdminPrebuild)).Methods("GET")
+	s.router.HandleFunc(AdminPathPrefix+"/response-cache", s.adminOnly(s.handleAdminResponseCache)).Methods("GET")
+	s.router.HandleFunc(AdminPathPrefix+"/response-cache", s.adminOnly(s.handleAdminPurgeResponseCache)).Methods("DELETE")
+	logging.Info("Admin API enabled", "path", AdminPathPrefix)
+}
+
+// adminOnly requires the admin bearer token
+func (s *Server) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return withRouteInfo("admin", func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="redi admin"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "unauthorized"})
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
+	})
+}
+
+// handleAdminIndex returns a summary of the server state
+func (s *Server) handleAdminIndex(w http.ResponseWriter, r *http.Request) {
+	ready, checks := s.readiness()
+	summary := map[string]interface{}{
+		"version":  s.version,
+		"port":     s.port,
+		"ready":    ready,
+		"checks":   checks,
+		"routes":   len(s.current().routes),
+		"sessions": len(s.jsEnginePool().SessionIDs()),
+		"cache":    s.enableCache,
+	}
+	if !s.startTime.IsZero() {
+		summary["startTime"] = s.startTime.Format(time.RFC3339)
+		summary["uptime"] = time.Since(s.startTime).Round(time.Second).String()
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleAdminRoutes lists the registered routes
+func (s *Server) handleAdminRoutes(w http.ResponseWriter, r *http.Request) {
+	state := s.current()
+	routes := make([]map[string]interface{}, 0, len(state.routes))
+	for _, route := range state.routes {
+		routes = append(routes, map[string]interface{}{
+			"path":      route.Path,
+			"file":      route.FilePath,
+			"type":      route.FileType,
+			"dynamic":   route.IsDynamic,
+			"index":     route.IsIndex,
+			"paramName": route.ParamName,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"routes": routes})
+}
+
+// handleAdminSessions lists the JavaScript sessions bound to an engine
+func (s *Server) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	pool := s.jsEnginePool()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": pool.SessionIDs(),
+		"pool":     pool.Stats(),
+		"programs": handlers.RouteProgramStats(),
+	})
+}
+
+// handleAdminEvictSessions releases all session engines
+func (s *Server) handleAdminEvictSessions(w http.ResponseWriter, r *http.Request) {
+	evicted := s.jsEnginePool().ReleaseAllSessionEngines()
+	logging.Info("Evicted JavaScript sessions", "count", evicted)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"evicted": evicted})
+}
+
+// handleAdminEvictSession releases the engine of one session
+func (s *Server) handleAdminEvictSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	pool := s.jsEnginePool()
+
+	found := false
+	for _, sessionID := range pool.SessionIDs() {
+		if sessionID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": "session not found"})
+		return
+	}
+
+	pool.ReleaseSessionEngine(id)
+	logging.Info("Evicted JavaScript session", "session", id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"evicted": 1})
+}
+
+// handleAdminCache returns cache statistics
+func (s *Server) handleAdminCache(w http.ResponseWriter, r *http.Request) {
+	state := s.current()
+	body := map[string]interface{}{"enabled": state.cacheManager != nil}
+	if state.cacheManager != nil {
+		body["manager"] = state.cacheManager.GetStats()
+	}
+	if state.svelteCache != nil {
+		body["svelte"] = state.svelteCache.GetStats()
+	}
+	if state.handlerManager != nil && state.handlerManager.svelteHandler != nil {
+		body["compilers"] = state.handlerManager.svelteHandler.CompilerStats()
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// handleAdminPrebuild returns the progress of the Svelte pre-build and the
+// outcome of each component compiled so far
+func (s *Server) handleAdminPrebuild(w http.ResponseWriter, r *http.Request) {
+	precompiler := s.precompiler.Load()
+	if precompiler == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": s.prebuildOnStart, "started": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": true,
+		"started": true,
+		"report":  precompiler.Report(),
+	})
+}
+
+// handleAdminResponseCache returns the usage of the rendered response cache
+func (s *Server) handleAdminResponseCache(w http.ResponseWriter, r *http.Request) {
+	responseCache := s.responseCache.Load()
+	if responseCache == nil {
+		writeJSON(w, http.StatusOK, middleware.ResponseCacheStats{})
+		return
+	}
+	writeJSON(w, http.StatusOK, responseCache.Stats())
+}
+
+// handleAdminPurgeResponseCache removes the cached responses with the tags
+// given as tag query parameters, or all of them without any
+func (s *Server) handleAdminPurgeResponseCache(w http.ResponseWriter, r *http.Request) {
+	purged := 0
+	if responseCache := s.responseCache.Load(); responseCache != nil {
+		if tags := r.URL.Query()["tag"]; len(tags) > 0 {
+			purged = responseCache.Purge(tags...)
+		} else {
+			purged = responseCache.Clear()
+		}
+	}
+	logging.Info("Response cache purged via admin API", "tags", strings.Join(r.URL.Query()["tag"], ","), "purged", purged)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"purged": purged})
+}
+
+// handleAdminClearCache clears the persistent and in-memory compile caches
+func (s *Server) handleAdminClearCache(w http.ResponseWriter, r *http.Request) {
+	state := s.current()
+	if state.cacheManager != nil {
+		if err := state.cacheManager.Clear(); err != nil {
+			logging.Error("Failed to clear cache", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+			return
+		}
+	}
+	if state.handlerManager != nil && state.handlerManager.svelteHandler != nil {
+		state.handlerManager.svelteHandler.ClearCache()
+	}
+	logging.Info("Cache cleared via admin API")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"cleared": true})
+}
+
+// jsEnginePool returns the JavaScript engine pool used by the server's routes
+func (s *Server) jsEnginePool() *handlers.JSEnginePool {
+	return handlers.GetJSEnginePool(s.fs, s.version)
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,182 @@
+package redi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/middleware"
+)
+
+func setupAdminServer(t *testing.T) *Server {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/index.html", []byte(`<h1>Home</h1>`))
+	memFS.WriteFile("routes/api/counter.js", []byte(`var count = 0;
+exports.get = function(req, res) {
+    count++;
+    res.json({ count: count });
+};`))
+
+	server := &Server{
+		router:     mux.NewRouter(),
+		port:       8080,
+		fs:         memFS,
+		routesDir:  "routes",
+		adminToken: "secret",
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	return server
+}
+
+func adminRequest(server *Server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	server := setupAdminServer(t)
+
+	if w := adminRequest(server, "GET", "/healthz", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected /healthz 200, got %d", w.Code)
+	}
+	if w := adminRequest(server, "GET", "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after routes are scanned, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Not ready while the pre-build is running
+	server.prebuildOnStart = true
+	w := adminRequest(server, "GET", "/readyz", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 during pre-build, got %d", w.Code)
+	}
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Checks["prebuild"] != "pending" {
+		t.Errorf("Expected prebuild check pending, got %q", body.Checks["prebuild"])
+	}
+
+	server.prebuildDone.Store(true)
+	if w := adminRequest(server, "GET", "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after pre-build, got %d", w.Code)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	server := setupAdminServer(t)
+
+	// Authentication is required
+	if w := adminRequest(server, "GET", AdminPathPrefix+"/routes", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", w.Code)
+	}
+	if w := adminRequest(server, "GET", AdminPathPrefix+"/routes", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with wrong token, got %d", w.Code)
+	}
+
+	// Routes
+	w := adminRequest(server, "GET", AdminPathPrefix+"/routes", "secret")
+	var routes struct {
+		Routes []map[string]interface{} `json:"routes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(routes.Routes) != 2 {
+		t.Errorf("Expected 2 routes, got %d", len(routes.Routes))
+	}
+
+	// A JS request binds a session engine
+	adminRequest(server, "GET", "/api/counter", "")
+	w = adminRequest(server, "GET", AdminPathPrefix+"/sessions", "secret")
+	var sessions struct {
+		Sessions []string `json:"sessions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions.Sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %v", sessions.Sessions)
+	}
+
+	// Evict it
+	w = adminRequest(server, "DELETE", AdminPathPrefix+"/sessions/"+sessions.Sessions[0], "secret")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 evicting session, got %d", w.Code)
+	}
+	if ids := server.jsEnginePool().SessionIDs(); len(ids) != 0 {
+		t.Errorf("Expected no sessions after eviction, got %v", ids)
+	}
+	if w := adminRequest(server, "DELETE", AdminPathPrefix+"/sessions/unknown", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %d", w.Code)
+	}
+
+	// Cache
+	if w := adminRequest(server, "GET", AdminPathPrefix+"/cache", "secret"); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for cache stats, got %d", w.Code)
+	}
+	if w := adminRequest(server, "DELETE", AdminPathPrefix+"/cache", "secret"); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 clearing cache, got %d", w.Code)
+	}
+
+	// Pre-build progress
+	w = adminRequest(server, "GET", AdminPathPrefix+"/prebuild", "secret")
+	var prebuild struct {
+		Started bool `json:"started"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &prebuild)
+	if w.Code != http.StatusOK || prebuild.Started {
+		t.Errorf("Expected a pre-build that hasn't started, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminResponseCache(t *testing.T) {
+	server := setupAdminServer(t)
+	server.SetResponseCacheConfig(&middleware.ResponseCacheConfig{
+		Routes: []middleware.ResponseCacheRule{
+			{Path: "/", ResponseCachePolicy: middleware.ResponseCachePolicy{MaxAge: time.Minute, Tags: []string{"pages"}}},
+		},
+	})
+	handler := server.applyMiddleware(server.router)
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	w := adminRequest(server, "GET", AdminPathPrefix+"/response-cache", "secret")
+	var stats middleware.ResponseCacheStats
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != http.StatusOK || stats.Entries != 1 || stats.Hits != 1 {
+		t.Errorf("Expected one cached page served once, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = adminRequest(server, "DELETE", AdminPathPrefix+"/response-cache?tag=pages", "secret")
+	var purge struct {
+		Purged int `json:"purged"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &purge)
+	if w.Code != http.StatusOK || purge.Purged != 1 {
+		t.Errorf("Expected the page to be purged by tag, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminAPIDisabledWithoutToken(t *testing.T) {
+	server := setupAdminServer(t)
+	server.adminToken = ""
+	server.router = mux.NewRouter()
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+
+	if w := adminRequest(server, "GET", AdminPathPrefix, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when admin API is disabled, got %d", w.Code)
+	}
+}
@@ -0,0 +1,511 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rediwo/redi/internal/filelock"
+)
+
+// ErrReadOnly is returned when writing to a read-only cache backend
+var ErrReadOnly = errors.New("cache backend is read-only")
+
+// CacheBackend stores the files of the compilation cache: the index
+// snapshot, the entry metadata files and the compiled blobs. Names are
+// slash-separated and relative to the cache directory, e.g.
+// cache/svelte/entries/ab/abcd.json.
+type CacheBackend interface {
+	// Init prepares the backend for use
+	Init() error
+	ReadFile(name string) ([]byte, error)
+	// WriteFile replaces name atomically, creating its directories
+	WriteFile(name string, data []byte) error
+	Remove(name string) error
+	Stat(name string) (fs.FileInfo, error)
+	// Touch sets the modification time of name to now
+	Touch(name string) error
+	// Walk calls fn for every file under dir; a missing dir has no files
+	Walk(dir string, fn func(name string, info fs.FileInfo)) error
+	// Lock takes the lock guarding the index snapshot and cleanups, which
+	// may be shared with other processes, and returns its release function
+	Lock() (func(), error)
+	// Clear removes every file of the cache
+	Clear() error
+	ReadOnly() bool
+}
+
+// layoutDirs are the directories of the cache layout
+var layoutDirs = []string{
+	"cache/svelte/compiled",
+	"cache/svelte/entries",
+	"cache/svelte/runtime",
+	"cache/svelte/deps",
+}
+
+// DiskBackend stores the cache in a directory, usually .redi under the
+// project root. It can be shared by several processes.
+type DiskBackend struct {
+	dir string
+}
+
+// NewDiskBackend creates a backend storing the cache in dir
+func NewDiskBackend(dir string) *DiskBackend {
+	return &DiskBackend{dir: dir}
+}
+
+// Dir returns the directory of the cache
+func (b *DiskBackend) Dir() string {
+	return b.dir
+}
+
+func (b *DiskBackend) path(name string) string {
+	return filepath.Join(b.dir, filepath.FromSlash(name))
+}
+
+func (b *DiskBackend) Init() error {
+	for _, dir := range layoutDirs {
+		if err := os.MkdirAll(b.path(dir), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *DiskBackend) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(b.path(name))
+}
+
+func (b *DiskBackend) WriteFile(name string, data []byte) error {
+	p := b.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(p, data)
+}
+
+func (b *DiskBackend) Remove(name string) error {
+	return os.Remove(b.path(name))
+}
+
+func (b *DiskBackend) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(b.path(name))
+}
+
+func (b *DiskBackend) Touch(name string) error {
+	now := time.Now()
+	return os.Chtimes(b.path(name), now, now)
+}
+
+func (b *DiskBackend) Walk(dir string, fn func(name string, info fs.FileInfo)) error {
+	return walkFiles(b.path(dir), func(p string, info fs.FileInfo) {
+		rel, err := filepath.Rel(b.dir, p)
+		if err != nil {
+			return
+		}
+		fn(filepath.ToSlash(rel), info)
+	})
+}
+
+func (b *DiskBackend) Lock() (func(), error) {
+	if err := os.MkdirAll(b.path("cache"), 0755); err != nil {
+		return nil, err
+	}
+	return filelock.Lock(b.path(lockName))
+}
+
+// Clear removes the cache files, leaving the rest of the directory, such as
+// the kv store in .redi/kv, and the lock file, which may be held
+func (b *DiskBackend) Clear() error {
+	entries, err := os.ReadDir(b.path("cache"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if "cache/"+entry.Name() == lockName {
+			continue
+		}
+		if err := os.RemoveAll(b.path("cache/" + entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *DiskBackend) ReadOnly() bool {
+	return false
+}
+
+// MemoryBackend keeps the cache in memory. It is used when there is no
+// writable directory, e.g. for sites served from an embedded filesystem,
+// and in tests.
+type MemoryBackend struct {
+	mu     sync.RWMutex
+	lockMu sync.Mutex
+	files  map[string]*memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{files: make(map[string]*memoryFile)}
+}
+
+func (b *MemoryBackend) Init() error {
+	return nil
+}
+
+func (b *MemoryBackend) ReadFile(name string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	file, ok := b.files[name]
+	if !ok {
+		return nil, notExist("read", name)
+	}
+	return append([]byte(nil), file.data...), nil
+}
+
+func (b *MemoryBackend) WriteFile(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files[name] = &memoryFile{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (b *MemoryBackend) Remove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.files[name]; !ok {
+		return notExist("remove", name)
+	}
+	delete(b.files, name)
+	return nil
+}
+
+func (b *MemoryBackend) Stat(name string) (fs.FileInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	file, ok := b.files[name]
+	if !ok {
+		return nil, notExist("stat", name)
+	}
+	return memoryFileInfo{name: path.Base(name), size: int64(len(file.data)), modTime: file.modTime}, nil
+}
+
+func (b *MemoryBackend) Touch(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	file, ok := b.files[name]
+	if !ok {
+		return notExist("touch", name)
+	}
+	file.modTime = time.Now()
+	return nil
+}
+
+func (b *MemoryBackend) Walk(dir string, fn func(name string, info fs.FileInfo)) error {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	b.mu.RLock()
+	var names []string
+	infos := make(map[string]fs.FileInfo)
+	for name, file := range b.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+			infos[name] = memoryFileInfo{name: path.Base(name), size: int64(len(file.data)), modTime: file.modTime}
+		}
+	}
+	b.mu.RUnlock()
+
+	// fn may use the backend
+	sort.Strings(names)
+	for _, name := range names {
+		fn(name, infos[name])
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Lock() (func(), error) {
+	b.lockMu.Lock()
+	return b.lockMu.Unlock, nil
+}
+
+func (b *MemoryBackend) Clear() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files = make(map[string]*memoryFile)
+	return nil
+}
+
+func (b *MemoryBackend) ReadOnly() bool {
+	return false
+}
+
+// memoryFileInfo describes a file of a MemoryBackend
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return i.size }
+func (i memoryFileInfo) Mode() fs.FileMode  { return 0444 }
+func (i memoryFileInfo) ModTime() time.Time { return i.modTime }
+func (i memoryFileInfo) IsDir() bool        { return false }
+func (i memoryFileInfo) Sys() interface{}   { return nil }
+
+// EmbeddedBackend serves a cache built ahead of time from a read-only
+// filesystem, such as the .redi directory embedded into a binary by
+// redi-build --prebuild. Writes fail with ErrReadOnly.
+type EmbeddedBackend struct {
+	fsys fs.FS
+}
+
+// NewEmbeddedBackend creates a read-only backend over fsys, whose root is
+// the cache directory
+func NewEmbeddedBackend(fsys fs.FS) *EmbeddedBackend {
+	return &EmbeddedBackend{fsys: fsys}
+}
+
+func (b *EmbeddedBackend) Init() error {
+	return nil
+}
+
+func (b *EmbeddedBackend) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(b.fsys, name)
+}
+
+func (b *EmbeddedBackend) WriteFile(name string, data []byte) error {
+	return ErrReadOnly
+}
+
+func (b *EmbeddedBackend) Remove(name string) error {
+	return ErrReadOnly
+}
+
+func (b *EmbeddedBackend) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(b.fsys, name)
+}
+
+func (b *EmbeddedBackend) Touch(name string) error {
+	return ErrReadOnly
+}
+
+func (b *EmbeddedBackend) Walk(dir string, fn func(name string, info fs.FileInfo)) error {
+	return fs.WalkDir(b.fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fn(name, info)
+		return nil
+	})
+}
+
+func (b *EmbeddedBackend) Lock() (func(), error) {
+	// Nothing changes, so there is nothing to guard
+	return func() {}, nil
+}
+
+func (b *EmbeddedBackend) Clear() error {
+	return ErrReadOnly
+}
+
+func (b *EmbeddedBackend) ReadOnly() bool {
+	return true
+}
+
+// OverlayBackend layers a writable backend over a read-only one, so a
+// server can start from an embedded cache and keep what it compiles later.
+// Reads fall through to the lower backend; writes only affect the upper one.
+// Removed and cleared files of the lower backend are recorded in the upper
+// one and hidden until the lower backend is replaced, e.g. by a new build
+// with a different embedded cache.
+type OverlayBackend struct {
+	upper CacheBackend
+	lower CacheBackend
+	// lowerID identifies the contents of the lower backend
+	lowerID string
+
+	mu        sync.RWMutex
+	whiteouts overlayWhiteouts
+}
+
+// overlayWhiteouts are the files of the lower backend hidden by an overlay
+type overlayWhiteouts struct {
+	Lower   string          `json:"lower"`             // Hash of the lower index they apply to
+	Cleared bool            `json:"cleared,omitempty"` // All of them
+	Names   map[string]bool `json:"names,omitempty"`
+}
+
+// NewOverlayBackend creates a backend reading from upper, then lower, and
+// writing to upper
+func NewOverlayBackend(upper, lower CacheBackend) *OverlayBackend {
+	return &OverlayBackend{upper: upper, lower: lower}
+}
+
+func (b *OverlayBackend) Init() error {
+	if err := b.upper.Init(); err != nil {
+		return err
+	}
+	index, err := b.lower.ReadFile(indexName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	b.lowerID = hashOf(index)
+
+	data, err := b.upper.ReadFile(whiteoutsName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var whiteouts overlayWhiteouts
+	if err := json.Unmarshal(data, &whiteouts); err != nil {
+		return err
+	}
+	if whiteouts.Lower != b.lowerID {
+		// They hid the files of a lower backend that was replaced since
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.whiteouts = whiteouts
+	return nil
+}
+
+// hidden reports whether name of the lower backend was removed
+func (b *OverlayBackend) hidden(name string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.whiteouts.Cleared || b.whiteouts.Names[name]
+}
+
+// saveWhiteouts writes the hidden files to the upper backend. b.mu must be
+// held.
+func (b *OverlayBackend) saveWhiteouts() error {
+	b.whiteouts.Lower = b.lowerID
+	data, err := json.Marshal(b.whiteouts)
+	if err != nil {
+		return err
+	}
+	return b.upper.WriteFile(whiteoutsName, data)
+}
+
+func (b *OverlayBackend) ReadFile(name string) ([]byte, error) {
+	data, err := b.upper.ReadFile(name)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		if b.hidden(name) {
+			return nil, err
+		}
+		return b.lower.ReadFile(name)
+	}
+	return data, err
+}
+
+func (b *OverlayBackend) WriteFile(name string, data []byte) error {
+	return b.upper.WriteFile(name, data)
+}
+
+func (b *OverlayBackend) Remove(name string) error {
+	err := b.upper.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if b.hidden(name) {
+		return err
+	}
+	if _, lowerErr := b.lower.Stat(name); lowerErr != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.whiteouts.Names == nil {
+		b.whiteouts.Names = make(map[string]bool)
+	}
+	b.whiteouts.Names[name] = true
+	return b.saveWhiteouts()
+}
+
+func (b *OverlayBackend) Stat(name string) (fs.FileInfo, error) {
+	info, err := b.upper.Stat(name)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		if b.hidden(name) {
+			return nil, err
+		}
+		return b.lower.Stat(name)
+	}
+	return info, err
+}
+
+func (b *OverlayBackend) Touch(name string) error {
+	if _, err := b.upper.Stat(name); err != nil {
+		// Files of the lower backend never change, so they need no refresh
+		return nil
+	}
+	return b.upper.Touch(name)
+}
+
+func (b *OverlayBackend) Walk(dir string, fn func(name string, info fs.FileInfo)) error {
+	seen := make(map[string]bool)
+	err := b.upper.Walk(dir, func(name string, info fs.FileInfo) {
+		seen[name] = true
+		fn(name, info)
+	})
+	if err != nil {
+		return err
+	}
+	return b.lower.Walk(dir, func(name string, info fs.FileInfo) {
+		if !seen[name] && !b.hidden(name) {
+			fn(name, info)
+		}
+	})
+}
+
+func (b *OverlayBackend) Lock() (func(), error) {
+	return b.upper.Lock()
+}
+
+func (b *OverlayBackend) Clear() error {
+	if err := b.upper.Clear(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.whiteouts = overlayWhiteouts{Cleared: true}
+	return b.saveWhiteouts()
+}
+
+func (b *OverlayBackend) ReadOnly() bool {
+	return b.upper.ReadOnly()
+}
+
+// notExist returns the error for a missing file of an in-memory backend
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
@@ -1,9 +1,17 @@
 package cache
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rediwo/redi/filesystem"
 )
@@ -80,6 +88,20 @@ func TestCacheManager(t *testing.T) {
 	if stats.TotalEntries != 1 {
 		t.Errorf("Expected 1 total entry, got %d", stats.TotalEntries)
 	}
+
+	// Clearing keeps the other files of .redi, such as the kv store
+	kvLog := filepath.Join(tmpDir, ".redi", "kv", "data.log")
+	os.MkdirAll(filepath.Dir(kvLog), 0755)
+	os.WriteFile(kvLog, []byte("[]\n"), 0644)
+	if err := manager.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := manager.GetEntry(key); exists {
+		t.Error("Expected the entry to be cleared")
+	}
+	if _, err := os.Stat(kvLog); err != nil {
+		t.Errorf("Expected the kv store to survive a cache clear: %v", err)
+	}
 }
 
 func TestSvelteCache(t *testing.T) {
@@ -156,4 +178,644 @@ func TestSvelteCache(t *testing.T) {
 	if stats["misses"].(int64) != 1 {
 		t.Errorf("Expected 1 miss, got %v", stats["misses"])
 	}
-}
\ No newline at end of file
+}
+
+func newTestManager(t *testing.T, config *CacheConfig) *CacheManager {
+	t.Helper()
+	config.RootDir = t.TempDir()
+	config.Enabled = true
+	manager := NewCacheManager(config)
+	manager.SetFileSystem(filesystem.NewOSFileSystem(config.RootDir))
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize cache: %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	return manager
+}
+
+func storeEntry(t *testing.T, manager *CacheManager, key string, data []byte, accessed time.Time) {
+	t.Helper()
+	blob, size, err := manager.WriteBlob(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetEntry(key, &CacheEntry{Path: key + ".svelte", Hash: key, Size: size, Blob: blob, AccessTime: accessed})
+}
+
+// collectBlob ages a blob past the grace period, runs Cleanup and reports
+// whether the blob was deleted
+func collectBlob(t *testing.T, manager *CacheManager, blob string) bool {
+	t.Helper()
+	name := manager.diskPath(blobName(blob))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(name, old, old)
+	if _, _, err := manager.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := os.Stat(name)
+	return os.IsNotExist(err)
+}
+
+func TestCacheManagerEvictsLRU(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{MaxSize: 250})
+	now := time.Now()
+	for i, key := range []string{"aa01", "aa02", "aa03"} {
+		storeEntry(t, manager, key, bytes.Repeat([]byte(key), 25), now.Add(time.Duration(i-2)*time.Minute))
+	}
+
+	if _, ok := manager.GetEntry("aa01"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if _, err := os.Stat(manager.GetCachePath("aa01")); !os.IsNotExist(err) {
+		t.Error("Expected the evicted entry's file to be deleted")
+	}
+	if !collectBlob(t, manager, hashOf(bytes.Repeat([]byte("aa01"), 25))) {
+		t.Error("Expected the evicted entry's data to be collected")
+	}
+	for _, key := range []string{"aa02", "aa03"} {
+		if _, ok := manager.GetEntry(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+	if stats := manager.GetStats(); stats.TotalSize > 250 {
+		t.Errorf("Expected the cache to be within MaxSize, got %d bytes", stats.TotalSize)
+	}
+}
+
+func TestCacheManagerTTL(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{TTL: time.Hour})
+	storeEntry(t, manager, "bb01", []byte("{}"), time.Now())
+	if _, ok := manager.GetEntry("bb01"); !ok {
+		t.Fatal("Expected a fresh entry")
+	}
+
+	manager.index.Entries["bb01"].Created = time.Now().Add(-2 * time.Hour)
+	if _, ok := manager.GetEntry("bb01"); ok {
+		t.Error("Expected an expired entry to be missing")
+	}
+	if _, err := os.Stat(manager.GetCachePath("bb01")); !os.IsNotExist(err) {
+		t.Error("Expected the expired entry's file to be deleted")
+	}
+	if !collectBlob(t, manager, hashOf([]byte("{}"))) {
+		t.Error("Expected the expired entry's data to be collected")
+	}
+}
+
+func TestCacheManagerCompression(t *testing.T) {
+	data := []byte(strings.Repeat(`{"js": "console.log('hello')"}`, 100))
+	for _, algorithm := range []string{CompressionZstd, CompressionGzip} {
+		t.Run(algorithm, func(t *testing.T) {
+			manager := newTestManager(t, &CacheConfig{CompressCache: true, Compression: algorithm})
+			blob, size, err := manager.WriteBlob(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size >= int64(len(data)) {
+				t.Errorf("Expected compressed data, got %d of %d bytes", size, len(data))
+			}
+			read, err := manager.ReadBlob(blob)
+			if err != nil || !bytes.Equal(read, data) {
+				t.Errorf("Expected the data back, got %q (%v)", read, err)
+			}
+		})
+	}
+
+	// Uncompressed entries stay readable when compression is turned on
+	manager := newTestManager(t, &CacheConfig{})
+	blob, _, _ := manager.WriteBlob(data)
+	manager.config.CompressCache = true
+	if read, err := manager.ReadBlob(blob); err != nil || !bytes.Equal(read, data) {
+		t.Errorf("Expected uncompressed data to be read as is, got %v", err)
+	}
+}
+
+func TestCacheManagerCleanup(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{TTL: time.Hour})
+	storeEntry(t, manager, "dd01", []byte(`{"a": 1}`), time.Now())
+	storeEntry(t, manager, "dd02", []byte(`{"b": 2}`), time.Now())
+	manager.index.Entries["dd02"].Created = time.Now().Add(-2 * time.Hour)
+
+	// An old blob no entry uses and a blob whose entry is still being stored
+	orphan := manager.diskPath(blobName(hashOf([]byte("orphan"))))
+	os.MkdirAll(filepath.Dir(orphan), 0755)
+	os.WriteFile(orphan, []byte("orphan"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(orphan, old, old)
+	pending := manager.diskPath(blobName(hashOf([]byte("pending"))))
+	os.MkdirAll(filepath.Dir(pending), 0755)
+	os.WriteFile(pending, []byte("pending"), 0644)
+
+	entries, orphans, err := manager.Cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != 1 || orphans != 1 {
+		t.Errorf("Expected 1 expired entry and 1 orphan, got %d and %d", entries, orphans)
+	}
+	for path, exists := range map[string]bool{
+		manager.GetCachePath("dd01"): true,
+		manager.GetCachePath("dd02"): false,
+		orphan:                       false,
+		pending:                      true,
+	} {
+		if _, err := os.Stat(path); (err == nil) != exists {
+			t.Errorf("Expected %s to exist: %v", path, exists)
+		}
+	}
+}
+
+func TestCacheManagerJanitor(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{TTL: time.Hour, JanitorInterval: 10 * time.Millisecond})
+	storeEntry(t, manager, "ee01", []byte("{}"), time.Now())
+	manager.mu.Lock()
+	manager.index.Entries["ee01"].Created = time.Now().Add(-2 * time.Hour)
+	manager.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(manager.GetCachePath("ee01")); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the janitor to remove the expired entry")
+}
+
+func TestDependencyGraph(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	for _, name := range []string{"routes/page.svelte", "routes/Card.svelte", "routes/data.json", "routes/other.svelte"} {
+		fs.WriteFile(name, []byte(name))
+	}
+	backend := NewMemoryBackend()
+	graph := NewDependencyGraph(fs, backend, graphName)
+	graph.Record("routes/page.svelte", []string{"routes/Card.svelte"})
+	graph.Record("routes/Card.svelte", []string{"routes/data.json"})
+	graph.Record("routes/other.svelte", []string{"routes/data.json"})
+
+	if dependents := graph.Dependents("routes/data.json"); strings.Join(dependents, ",") != "routes/Card.svelte,routes/other.svelte,routes/page.svelte" {
+		t.Errorf("Expected transitive importers, got %v", dependents)
+	}
+	if changed, known := graph.Changed("routes/page.svelte"); !known || len(changed) != 0 {
+		t.Errorf("Expected nothing to have changed, got %v %v", changed, known)
+	}
+	if _, known := graph.Changed("routes/unknown.svelte"); known {
+		t.Error("Expected an unrecorded component to be unknown")
+	}
+
+	// The graph is persisted when saved
+	if _, err := backend.ReadFile(graphName); err == nil {
+		t.Error("Expected the graph to be written by Save only")
+	}
+	if err := graph.Save(); err != nil {
+		t.Fatal(err)
+	}
+	graph = NewDependencyGraph(fs, backend, graphName)
+	if importers := graph.Importers("routes/data.json"); len(importers) != 2 {
+		t.Errorf("Expected the importers to be loaded, got %v", importers)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	fs.WriteFile("routes/data.json", []byte("{}"))
+	if changed, _ := graph.Changed("routes/page.svelte"); len(changed) != 1 || changed[0] != "routes/data.json" {
+		t.Errorf("Expected the changed asset, got %v", changed)
+	}
+
+	// Dropping an import removes the reverse edge
+	graph.Record("routes/other.svelte", nil)
+	if importers := graph.Importers("routes/data.json"); len(importers) != 1 || importers[0] != "routes/Card.svelte" {
+		t.Errorf("Expected other.svelte to be removed from the importers, got %v", importers)
+	}
+}
+
+func TestSvelteCacheInvalidateDependents(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{})
+	fs := filesystem.NewOSFileSystem(manager.rootDir)
+	files := map[string]string{
+		"page.svelte": "<Card />",
+		"Card.svelte": "<p>card</p>",
+		"data.json":   "{}",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(manager.rootDir, name), []byte(content), 0644)
+	}
+	sc := NewSvelteCache(manager, fs)
+	for _, name := range []string{"page.svelte", "Card.svelte"} {
+		if err := sc.Set(name, []byte(files[name]), "config", &SvelteCacheEntry{Path: name, JavaScript: "js"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sc.Graph().Record("page.svelte", []string{"Card.svelte"})
+	sc.Graph().Record("Card.svelte", []string{"data.json"})
+
+	if err := sc.InvalidateDependents("data.json"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"page.svelte", "Card.svelte"} {
+		if _, found := sc.Get(name, []byte(files[name]), "config"); found {
+			t.Errorf("Expected %s to be invalidated", name)
+		}
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(manager.cacheDir, "cache", "svelte", "deps", "graph.json")); err != nil {
+		t.Errorf("Expected the graph to be saved with the cache: %v", err)
+	}
+}
+
+func TestCacheIndexRebuild(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{})
+	storeEntry(t, manager, "ff01", []byte("one"), time.Now())
+	storeEntry(t, manager, "ff02", []byte("two"), time.Now())
+	manager.Close()
+
+	// A crash while the old layout wrote the index could leave it truncated
+	os.WriteFile(manager.diskPath(indexName), []byte(`{"version": "2.0", "entr`), 0644)
+
+	rebuilt := NewCacheManager(&CacheConfig{RootDir: manager.rootDir, Enabled: true})
+	if err := rebuilt.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer rebuilt.Close()
+	for key, data := range map[string]string{"ff01": "one", "ff02": "two"} {
+		entry, ok := rebuilt.GetEntry(key)
+		if !ok {
+			t.Fatalf("Expected %s to be rebuilt from its metadata file", key)
+		}
+		if read, err := rebuilt.ReadBlob(entry.Blob); err != nil || string(read) != data {
+			t.Errorf("Expected %q for %s, got %q (%v)", data, key, read, err)
+		}
+	}
+	if stats := rebuilt.GetStats(); stats.TotalEntries != 2 {
+		t.Errorf("Expected 2 entries, got %d", stats.TotalEntries)
+	}
+	if _, err := os.Stat(rebuilt.diskPath(indexName)); err != nil {
+		t.Errorf("Expected the index to be written again: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(rebuilt.diskPath(indexName)), "*.tmp"))
+	if len(matches) > 0 {
+		t.Errorf("Expected no temporary files to be left, got %v", matches)
+	}
+}
+
+func TestCacheSharedBetweenManagers(t *testing.T) {
+	first := newTestManager(t, &CacheConfig{})
+	second := NewCacheManager(&CacheConfig{RootDir: first.rootDir, Enabled: true})
+	if err := second.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	// An entry stored by one process is found by the other
+	storeEntry(t, first, "gg01", []byte("shared"), time.Now())
+	if _, ok := second.GetEntry("gg01"); !ok {
+		t.Error("Expected the other manager's entry to be found on disk")
+	}
+
+	// Cleaning up in one doesn't collect the other's data
+	storeEntry(t, second, "gg02", []byte("second"), time.Now())
+	if _, _, err := first.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := first.GetEntry("gg02")
+	if !ok {
+		t.Fatal("Expected cleanup to pick up the other manager's entries")
+	}
+	if _, err := first.ReadBlob(entry.Blob); err != nil {
+		t.Errorf("Expected the other manager's data to be kept: %v", err)
+	}
+
+	first.saveIndex()
+	second.saveIndex()
+	var index CacheIndex
+	data, _ := os.ReadFile(first.diskPath(indexName))
+	if err := json.Unmarshal(data, &index); err != nil || len(index.Entries) != 2 {
+		t.Errorf("Expected a complete index snapshot, got %d entries (%v)", len(index.Entries), err)
+	}
+}
+
+func TestCacheContentAddressedBlobs(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{})
+	storeEntry(t, manager, "hh01", []byte("same output"), time.Now())
+	storeEntry(t, manager, "hh02", []byte("same output"), time.Now())
+
+	blob := hashOf([]byte("same output"))
+	report, err := manager.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entries != 2 || report.Blobs != 1 || !report.OK() {
+		t.Errorf("Expected 2 entries sharing 1 blob, got %+v", report)
+	}
+
+	manager.RemoveEntry("hh01")
+	if collectBlob(t, manager, blob) {
+		t.Error("Expected a blob still in use to be kept")
+	}
+	manager.RemoveEntry("hh02")
+	if _, err := os.Stat(manager.diskPath(blobName(blob))); err != nil {
+		t.Error("Expected an unused blob to be left for cleanup")
+	}
+	if !collectBlob(t, manager, blob) {
+		t.Error("Expected an unused blob to be collected")
+	}
+}
+
+func TestCacheVerifyAndRepair(t *testing.T) {
+	manager := newTestManager(t, &CacheConfig{})
+	storeEntry(t, manager, "ii01", []byte("good"), time.Now())
+	storeEntry(t, manager, "ii02", []byte("bad"), time.Now())
+	os.WriteFile(manager.diskPath(blobName(hashOf([]byte("bad")))), []byte("flipped"), 0644)
+
+	report, err := manager.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || len(report.Broken) != 1 || report.Broken[0] != "ii02" {
+		t.Fatalf("Expected the corrupt blob to be reported, got %+v", report)
+	}
+	if entry, _ := manager.GetEntry("ii02"); entry != nil {
+		if _, err := manager.ReadBlob(entry.Blob); err == nil {
+			t.Error("Expected reading a corrupt blob to fail")
+		}
+	}
+
+	if removed, err := manager.Repair(report); err != nil || removed != 1 {
+		t.Errorf("Expected 1 entry to be removed, got %d (%v)", removed, err)
+	}
+	if report, _ := manager.Verify(); !report.OK() || report.Entries != 1 {
+		t.Errorf("Expected a consistent cache after repair, got %+v", report)
+	}
+}
+
+func TestCacheMemoryBackend(t *testing.T) {
+	root := t.TempDir()
+	manager := NewCacheManager(&CacheConfig{RootDir: root, Enabled: true, Backend: NewMemoryBackend()})
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	storeEntry(t, manager, "jj01", []byte("output"), time.Now())
+	entry, ok := manager.GetEntry("jj01")
+	if !ok {
+		t.Fatal("Expected the entry to be stored in memory")
+	}
+	if data, err := manager.ReadBlob(entry.Blob); err != nil || string(data) != "output" {
+		t.Errorf("Expected the blob to be readable, got %q %v", data, err)
+	}
+	if report, err := manager.Verify(); err != nil || report.Entries != 1 || !report.OK() {
+		t.Errorf("Expected a consistent cache, got %+v %v", report, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".redi")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written to disk")
+	}
+}
+
+func TestCacheEmbeddedBackend(t *testing.T) {
+	// Build a cache ahead of time, as redi-build --prebuild does
+	root := t.TempDir()
+	content := []byte(`<h1>Hello</h1>`)
+	os.WriteFile(filepath.Join(root, "page.svelte"), content, 0644)
+	fs := filesystem.NewOSFileSystem(root)
+	builder := NewCacheManager(&CacheConfig{RootDir: root, Enabled: true})
+	if err := builder.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSvelteCache(builder, fs).Set("page.svelte", content, "config", &SvelteCacheEntry{JavaScript: "compiled"}); err != nil {
+		t.Fatal(err)
+	}
+	builder.Close()
+
+	embedded := NewEmbeddedBackend(os.DirFS(filepath.Join(root, ".redi")))
+	manager := NewCacheManager(&CacheConfig{Enabled: true, Backend: embedded, JanitorInterval: time.Millisecond})
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if !manager.ReadOnly() {
+		t.Error("Expected an embedded cache to be read-only")
+	}
+
+	svelteCache := NewSvelteCache(manager, fs)
+	cached, ok := svelteCache.Get("page.svelte", content, "config")
+	if !ok || cached.JavaScript != "compiled" {
+		t.Fatalf("Expected the prebuilt component to be served, got %+v", cached)
+	}
+
+	// New components aren't stored and nothing is removed
+	if err := svelteCache.Set("other.svelte", content, "config", &SvelteCacheEntry{}); err != nil {
+		t.Errorf("Expected storing in a read-only cache to be skipped, got %v", err)
+	}
+	if _, _, err := manager.WriteBlob([]byte("x")); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	manager.RemovePath("page.svelte")
+	if err := manager.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svelteCache.Get("page.svelte", content, "config"); !ok {
+		t.Error("Expected the embedded entry to survive removal")
+	}
+}
+
+func TestCacheOverlayBackend(t *testing.T) {
+	lower := NewMemoryBackend()
+	base := NewCacheManager(&CacheConfig{Enabled: true, Backend: lower})
+	base.Initialize()
+	storeEntry(t, base, "kk01", []byte("prebuilt"), time.Now())
+	base.Close()
+
+	upper := NewMemoryBackend()
+	manager := NewCacheManager(&CacheConfig{Enabled: true, Backend: NewOverlayBackend(upper, lower)})
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	if _, ok := manager.GetEntry("kk01"); !ok {
+		t.Error("Expected entries of the lower backend to be served")
+	}
+	storeEntry(t, manager, "kk02", []byte("compiled later"), time.Now())
+	if _, err := upper.Stat(entryName("kk02")); err != nil {
+		t.Error("Expected new entries to be written to the upper backend")
+	}
+	if _, err := lower.Stat(entryName("kk02")); err == nil {
+		t.Error("Expected the lower backend to be left alone")
+	}
+	if stats := manager.GetStats(); stats.TotalEntries != 2 {
+		t.Errorf("Expected 2 entries, got %d", stats.TotalEntries)
+	}
+
+	// Removed entries of the lower backend stay removed after a restart
+	manager.RemoveEntry("kk01")
+	manager.Close()
+	manager = NewCacheManager(&CacheConfig{Enabled: true, Backend: NewOverlayBackend(upper, lower)})
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if _, ok := manager.GetEntry("kk01"); ok {
+		t.Error("Expected a removed entry of the lower backend to stay hidden")
+	}
+	if _, ok := manager.GetEntry("kk02"); !ok {
+		t.Error("Expected entries of the upper backend to be kept")
+	}
+
+	if err := manager.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lower.Stat(entryName("kk01")); err != nil {
+		t.Error("Expected the lower backend to be left alone by a clear")
+	}
+	if stats := manager.GetStats(); stats.TotalEntries != 0 {
+		t.Errorf("Expected no entries after a clear, got %d", stats.TotalEntries)
+	}
+	manager.Close()
+
+	// A new lower backend, e.g. of a new build, isn't hidden by the clear
+	base = NewCacheManager(&CacheConfig{Enabled: true, Backend: lower})
+	base.Initialize()
+	storeEntry(t, base, "kk03", []byte("rebuilt"), time.Now())
+	base.Close()
+	manager = NewCacheManager(&CacheConfig{Enabled: true, Backend: NewOverlayBackend(upper, lower)})
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if _, ok := manager.GetEntry("kk03"); !ok {
+		t.Error("Expected entries of a replaced lower backend to be served")
+	}
+}
+
+// remoteCacheServer is an in-process remote cache with the ac/ and cas/
+// layout of bazel-remote, which rejects blobs not matching their hash
+type remoteCacheServer struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests int
+	fail     bool
+}
+
+func newRemoteCacheServer(t *testing.T) (*remoteCacheServer, *httptest.Server) {
+	remote := &remoteCacheServer{files: make(map[string][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote.mu.Lock()
+		defer remote.mu.Unlock()
+		remote.requests++
+		if remote.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := remote.files[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			if blob, ok := strings.CutPrefix(r.URL.Path, "/cas/"); ok && hashOf(data) != blob {
+				http.Error(w, "hash mismatch", http.StatusBadRequest)
+				return
+			}
+			remote.files[r.URL.Path] = data
+		}
+	}))
+	t.Cleanup(server.Close)
+	return remote, server
+}
+
+func newRemoteSvelteCache(t *testing.T, url string) (*CacheManager, *SvelteCache) {
+	t.Helper()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "page.svelte"), []byte(`<h1>Hello</h1>`), 0644)
+	fs := filesystem.NewOSFileSystem(root)
+	manager := NewCacheManager(&CacheConfig{RootDir: root, Enabled: true, Remote: &RemoteConfig{URL: url}})
+	manager.SetFileSystem(fs)
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	return manager, NewSvelteCache(manager, fs)
+}
+
+func TestRemoteCache(t *testing.T) {
+	remote, server := newRemoteCacheServer(t)
+	content := []byte(`<h1>Hello</h1>`)
+
+	// A component compiled on one machine is uploaded
+	ci, ciCache := newRemoteSvelteCache(t, server.URL)
+	if _, ok := ciCache.Get("page.svelte", content, "config"); ok {
+		t.Fatal("Expected a miss in an empty cache")
+	}
+	if err := ciCache.Set("page.svelte", content, "config", &SvelteCacheEntry{JavaScript: "compiled"}); err != nil {
+		t.Fatal(err)
+	}
+	ci.Close()
+	if len(remote.files) != 2 {
+		t.Fatalf("Expected the entry and its blob to be uploaded, got %v", len(remote.files))
+	}
+
+	// and served to another one, which keeps it locally
+	dev, devCache := newRemoteSvelteCache(t, server.URL)
+	cached, ok := devCache.Get("page.svelte", content, "config")
+	if !ok || cached.JavaScript != "compiled" {
+		t.Fatalf("Expected the component from the remote cache, got %+v", cached)
+	}
+	if stats := dev.GetStats(); stats.TotalEntries != 1 || stats.Remote.Hits != 1 {
+		t.Errorf("Expected a remote hit stored locally, got %+v", stats)
+	}
+	requests := remote.requests
+	if _, ok := devCache.Get("page.svelte", content, "config"); !ok || remote.requests != requests {
+		t.Error("Expected the second lookup to be served locally")
+	}
+}
+
+func TestRemoteCacheIntegrity(t *testing.T) {
+	remote, server := newRemoteCacheServer(t)
+	content := []byte(`<h1>Hello</h1>`)
+	ci, ciCache := newRemoteSvelteCache(t, server.URL)
+	ciCache.Set("page.svelte", content, "config", &SvelteCacheEntry{JavaScript: "compiled"})
+	ci.Close()
+
+	for name := range remote.files {
+		if strings.HasPrefix(name, "/cas/") {
+			remote.files[name] = []byte("tampered")
+		}
+	}
+	dev, devCache := newRemoteSvelteCache(t, server.URL)
+	if _, ok := devCache.Get("page.svelte", content, "config"); ok {
+		t.Fatal("Expected a corrupt blob to be rejected")
+	}
+	if stats := dev.GetStats(); stats.TotalEntries != 0 || stats.Remote.Errors != 1 {
+		t.Errorf("Expected nothing stored and an error counted, got %+v", stats.Remote)
+	}
+}
+
+func TestRemoteCacheUnavailable(t *testing.T) {
+	remote, server := newRemoteCacheServer(t)
+	remote.fail = true
+	content := []byte(`<h1>Hello</h1>`)
+	manager, svelteCache := newRemoteSvelteCache(t, server.URL)
+
+	compiled, err := svelteCache.CompileWithCache("page.svelte", content, "config", func() (*SvelteCacheEntry, error) {
+		return &SvelteCacheEntry{JavaScript: "compiled locally"}, nil
+	})
+	if err != nil || compiled.JavaScript != "compiled locally" {
+		t.Fatalf("Expected a local compile, got %+v %v", compiled, err)
+	}
+	if _, ok := svelteCache.Get("page.svelte", content, "config"); !ok {
+		t.Error("Expected the local cache to work without the remote")
+	}
+
+	// The remote is skipped for a while after failing
+	requests := remote.requests
+	svelteCache.Get("other.svelte", content, "config")
+	manager.Close()
+	if remote.requests != requests {
+		t.Errorf("Expected no requests while backing off, got %d", remote.requests-requests)
+	}
+}
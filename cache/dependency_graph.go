@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rediwo/redi/filesystem"
+)
+
+// DependencyGraph records which files each component imports, including
+// assets such as JSON and CSS, and the reverse edges from each file to its
+// importers. Each file's modification time is recorded with its node when a
+// component importing it, or the file itself, was last recorded, so a
+// change since then can be found without recompiling. Changes are written
+// to the backend by Save, which the cache runs with its index.
+type DependencyGraph struct {
+	mu    sync.RWMutex
+	fs      filesystem.FileSystem
+	backend CacheBackend // Where the graph is persisted; nil keeps it in memory
+	name    string
+	nodes   map[string]*dependencyNode
+	dirty   bool // Changed since the last save
+}
+
+type dependencyNode struct {
+	ModTime      time.Time `json:"modTime"`
+	Dependencies []string  `json:"dependencies,omitempty"`
+	Importers    []string  `json:"importers,omitempty"`
+}
+
+// NewDependencyGraph creates a graph stored as name in backend, loading it
+// when it exists. A nil backend keeps the graph in memory.
+func NewDependencyGraph(fs filesystem.FileSystem, backend CacheBackend, name string) *DependencyGraph {
+	g := &DependencyGraph{
+		fs:      fs,
+		backend: backend,
+		name:    name,
+		nodes:   make(map[string]*dependencyNode),
+	}
+	if backend != nil {
+		if data, err := backend.ReadFile(name); err == nil {
+			var nodes map[string]*dependencyNode
+			if json.Unmarshal(data, &nodes) == nil && nodes != nil {
+				g.nodes = nodes
+			}
+		}
+	}
+	return g
+}
+
+// Record sets the files path imports and the modification times of path and
+// its dependencies as they are now
+func (g *DependencyGraph) Record(path string, dependencies []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node := g.node(path)
+	for _, dep := range node.Dependencies {
+		if depNode, ok := g.nodes[dep]; ok {
+			depNode.Importers = without(depNode.Importers, path)
+		}
+	}
+	node.Dependencies = unique(dependencies)
+	node.ModTime = g.modTime(path)
+	for _, dep := range node.Dependencies {
+		depNode := g.node(dep)
+		depNode.Importers = unique(append(depNode.Importers, path))
+		depNode.ModTime = g.modTime(dep)
+	}
+	g.dirty = true
+}
+
+// Remove drops path and its edges from the graph
+func (g *DependencyGraph) Remove(path string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node, ok := g.nodes[path]
+	if !ok {
+		return
+	}
+	for _, dep := range node.Dependencies {
+		if depNode, ok := g.nodes[dep]; ok {
+			depNode.Importers = without(depNode.Importers, path)
+		}
+	}
+	for _, importer := range node.Importers {
+		if importerNode, ok := g.nodes[importer]; ok {
+			importerNode.Dependencies = without(importerNode.Dependencies, path)
+		}
+	}
+	delete(g.nodes, path)
+	g.dirty = true
+}
+
+// Dependencies returns the files path imports directly
+func (g *DependencyGraph) Dependencies(path string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if node, ok := g.nodes[path]; ok {
+		return append([]string(nil), node.Dependencies...)
+	}
+	return nil
+}
+
+// Importers returns the components that import path directly
+func (g *DependencyGraph) Importers(path string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if node, ok := g.nodes[path]; ok {
+		return append([]string(nil), node.Importers...)
+	}
+	return nil
+}
+
+// Dependents returns every component that imports path directly or through
+// other components
+func (g *DependencyGraph) Dependents(path string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := map[string]bool{path: true}
+	var dependents []string
+	queue := []string{path}
+	for len(queue) > 0 {
+		node, ok := g.nodes[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		for _, importer := range node.Importers {
+			if !seen[importer] {
+				seen[importer] = true
+				dependents = append(dependents, importer)
+				queue = append(queue, importer)
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// Changed returns the files among path and everything it imports, directly
+// or indirectly, that were modified or removed since they were recorded. It
+// reports false when path hasn't been recorded, so the graph can't tell.
+func (g *DependencyGraph) Changed(path string) ([]string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if _, ok := g.nodes[path]; !ok {
+		return nil, false
+	}
+	var changed []string
+	seen := map[string]bool{path: true}
+	queue := []string{path}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		node := g.nodes[current]
+		if !g.modTime(current).Equal(node.ModTime) {
+			changed = append(changed, current)
+		}
+		for _, dep := range node.Dependencies {
+			if _, ok := g.nodes[dep]; ok && !seen[dep] {
+				seen[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return changed, true
+}
+
+// Save writes the graph to its backend if it changed since the last save
+func (g *DependencyGraph) Save() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.backend == nil || !g.dirty {
+		return nil
+	}
+	data, err := json.Marshal(g.nodes)
+	if err != nil {
+		return err
+	}
+	if err := g.backend.WriteFile(g.name, data); err != nil {
+		return err
+	}
+	g.dirty = false
+	return nil
+}
+
+// node returns the node for path, creating it
+func (g *DependencyGraph) node(path string) *dependencyNode {
+	node, ok := g.nodes[path]
+	if !ok {
+		node = &dependencyNode{}
+		g.nodes[path] = node
+	}
+	return node
+}
+
+// modTime returns the modification time of path, or the zero time when it
+// doesn't exist
+func (g *DependencyGraph) modTime(path string) time.Time {
+	stat, err := g.fs.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// unique returns the sorted distinct values
+func unique(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	result := sorted[:1]
+	for _, value := range sorted[1:] {
+		if value != result[len(result)-1] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// without returns values without value
+func without(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
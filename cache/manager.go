@@ -4,15 +4,47 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
 )
 
+// Compression algorithms for stored cache entries
+const (
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+)
+
+// Defaults used by the server for its compilation cache
+const (
+	DefaultMaxSize         = 500 * 1024 * 1024
+	DefaultJanitorInterval = 10 * time.Minute
+)
+
+// evictionTarget is the fraction of MaxSize that eviction frees space down
+// to, so that a full cache doesn't evict on every write
+const evictionTarget = 0.9
+
+// orphanGracePeriod protects files that are written but not yet indexed
+// from the janitor
+const orphanGracePeriod = time.Minute
+
+// indexVersion is the version of the on-disk layout. Entries are stored as
+// one metadata file per key under svelte/entries, pointing to
+// content-addressed blobs under svelte/compiled; metadata.json is a
+// snapshot of the entries that is rebuilt from them when it is missing,
+// corrupt or out of date.
+const indexVersion = "2.0"
+
 // CacheManager manages the cache system
 type CacheManager struct {
 	rootDir   string // Project root directory
@@ -21,6 +53,14 @@ type CacheManager struct {
 	mu        sync.RWMutex
 	index     *CacheIndex
 	config    *CacheConfig
+	backend   CacheBackend
+	remote    *RemoteCache // Shared cache consulted on misses (optional)
+	blobRefs  map[string]int // Entries referencing each blob
+	// flushers write state kept with the cache, such as the dependency
+	// graph, whenever the index is saved
+	flushers  []func() error
+	stopJanitor chan struct{}
+	janitorDone chan struct{}
 }
 
 // CacheConfig represents cache configuration
@@ -28,9 +68,18 @@ type CacheConfig struct {
 	RootDir       string        // Project root directory
 	CacheDir      string        // Custom cache directory (optional)
 	Enabled       bool          // Whether cache is enabled
-	MaxSize       int64         // Maximum cache size in bytes
-	TTL           time.Duration // Cache expiration time
+	MaxSize       int64         // Maximum cache size in bytes; least recently used entries are evicted
+	TTL           time.Duration // Cache expiration time, from when an entry is stored (0 never expires)
 	CompressCache bool          // Whether to compress cache
+	Compression   string        // zstd (default) or gzip when CompressCache is set
+	// JanitorInterval is how often expired entries and orphaned files are
+	// removed in the background (0 disables the janitor)
+	JanitorInterval time.Duration
+	// Backend stores the cache (nil stores it on disk in CacheDir)
+	Backend CacheBackend
+	// Remote is a cache shared over HTTP, consulted when an entry isn't
+	// stored locally and given the entries compiled locally (optional)
+	Remote *RemoteConfig
 }
 
 // CacheIndex represents the cache index
@@ -50,7 +99,9 @@ type CacheEntry struct {
 	Hash         string    `json:"hash"`         // Content MD5
 	ConfigHash   string    `json:"configHash"`   // Config hash
 	Size         int64     `json:"size"`
+	Blob         string    `json:"blob,omitempty"` // SHA-256 of the stored data
 	ModTime      time.Time `json:"modTime"`
+	Created      time.Time `json:"created"`
 	AccessTime   time.Time `json:"accessTime"`
 	AccessCount  int       `json:"accessCount"`
 	Priority     float64   `json:"priority"`     // Compilation priority
@@ -63,6 +114,7 @@ type CacheStats struct {
 	HitRate        float64       `json:"hitRate"`
 	AvgCompileTime time.Duration `json:"avgCompileTime"`
 	TopAccessed    []string      `json:"topAccessed"`
+	Remote         *RemoteStats  `json:"remote,omitempty"`
 }
 
 // NewCacheManager creates a new cache manager
@@ -70,16 +122,27 @@ func NewCacheManager(config *CacheConfig) *CacheManager {
 	if config.CacheDir == "" {
 		config.CacheDir = filepath.Join(config.RootDir, ".redi")
 	}
+	backend := config.Backend
+	if backend == nil {
+		backend = NewDiskBackend(config.CacheDir)
+	}
+	var remote *RemoteCache
+	if config.Remote != nil && config.Remote.URL != "" && !backend.ReadOnly() {
+		remote = NewRemoteCache(config.Remote)
+	}
 	
 	return &CacheManager{
 		rootDir:  config.RootDir,
 		cacheDir: config.CacheDir,
 		config:   config,
+		backend:  backend,
+		remote:   remote,
 		index: &CacheIndex{
-			Version:  "1.0",
+			Version:  indexVersion,
 			Created:  time.Now(),
 			Entries:  make(map[string]*CacheEntry),
 		},
+		blobRefs: make(map[string]int),
 	}
 }
 
@@ -94,44 +157,55 @@ func (cm *CacheManager) Initialize() error {
 		return nil
 	}
 
-	// Create cache directory
-	if err := os.MkdirAll(cm.cacheDir, 0755); err != nil {
+	if err := cm.backend.Init(); err != nil {
 		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// Create subdirectories
-	dirs := []string{
-		filepath.Join(cm.cacheDir, "cache", "svelte", "compiled"),
-		filepath.Join(cm.cacheDir, "cache", "svelte", "runtime"),
-		filepath.Join(cm.cacheDir, "cache", "svelte", "deps"),
-	}
-
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create cache subdirectory %s: %w", dir, err)
-		}
-	}
-
-	// Load existing index
-	if err := cm.loadIndex(); err != nil {
+	// Load the snapshot and reconcile it with the entries on disk, which
+	// other processes may have changed
+	cm.mu.Lock()
+	if err := cm.loadIndex(); err != nil || cm.index.Version != indexVersion {
 		// If index doesn't exist or is corrupted, create new one
 		cm.index = &CacheIndex{
-			Version:     "1.0",
+			Version:     indexVersion,
 			RediVersion: cm.getRediVersion(),
 			Created:     time.Now(),
 			Entries:     make(map[string]*CacheEntry),
 		}
-		return cm.saveIndex()
+	}
+	added, dropped, err := cm.sync()
+	cm.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to read cache entries: %w", err)
+	}
+	if added > 0 || dropped > 0 {
+		logging.Debug("Synchronized cache index with entries on disk", "added", added, "dropped", dropped)
+	}
+	if cm.backend.ReadOnly() {
+		return nil
+	}
+	if err := cm.saveIndex(); err != nil {
+		return err
 	}
 
+	cm.startJanitor()
 	return nil
 }
 
+// ReadOnly reports whether the cache can only serve entries stored ahead of
+// time, such as a cache embedded into the binary
+func (cm *CacheManager) ReadOnly() bool {
+	return cm.backend.ReadOnly()
+}
+
+// Backend returns the backend storing the cache
+func (cm *CacheManager) Backend() CacheBackend {
+	return cm.backend
+}
+
 // loadIndex loads the cache index from disk
 func (cm *CacheManager) loadIndex() error {
-	indexPath := filepath.Join(cm.cacheDir, "cache", "metadata.json")
-	
-	data, err := os.ReadFile(indexPath)
+	data, err := cm.backend.ReadFile(indexName)
 	if err != nil {
 		return err
 	}
@@ -140,75 +214,498 @@ func (cm *CacheManager) loadIndex() error {
 	if err := json.Unmarshal(data, &index); err != nil {
 		return err
 	}
+	if index.Entries == nil {
+		index.Entries = make(map[string]*CacheEntry)
+	}
 
 	cm.index = &index
 	return nil
 }
 
-// saveIndex saves the cache index to disk
+// saveIndex writes a snapshot of the cache index. The snapshot replaces the
+// old one atomically while holding the cache lock, so a crash or another
+// process never leaves a partly written index.
 func (cm *CacheManager) saveIndex() error {
+	if cm.backend.ReadOnly() {
+		return nil
+	}
 	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
 	cm.index.LastUpdated = time.Now()
-	
 	data, err := json.MarshalIndent(cm.index, "", "  ")
+	cm.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	indexPath := filepath.Join(cm.cacheDir, "cache", "metadata.json")
-	return os.WriteFile(indexPath, data, 0644)
+	unlock, err := cm.backend.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return cm.backend.WriteFile(indexName, data)
 }
 
-// GetEntry retrieves a cache entry
-func (cm *CacheManager) GetEntry(key string) (*CacheEntry, bool) {
+// Close persists the cache index so entries added since the last save
+// survive a restart
+func (cm *CacheManager) Close() error {
+	if !cm.config.Enabled || cm.index == nil {
+		return nil
+	}
+	cm.stopJanitorLoop()
+	if cm.remote != nil {
+		cm.remote.Wait()
+	}
+	cm.flush()
+	return cm.saveIndex()
+}
+
+// Save persists the cache index while the manager stays in use
+func (cm *CacheManager) Save() error {
+	if !cm.config.Enabled || cm.index == nil {
+		return nil
+	}
+	cm.flush()
+	return cm.saveIndex()
+}
+
+// addFlusher registers fn to write state kept with the cache on Save,
+// Close and every janitor run
+func (cm *CacheManager) addFlusher(fn func() error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.flushers = append(cm.flushers, fn)
+}
+
+// flush runs the registered flushers
+func (cm *CacheManager) flush() {
 	cm.mu.RLock()
-	defer cm.mu.RUnlock()
+	flushers := cm.flushers
+	cm.mu.RUnlock()
+	for _, fn := range flushers {
+		if err := fn(); err != nil {
+			logging.Warn("Failed to save cache state", "error", err)
+		}
+	}
+}
 
+// GetEntry retrieves a cache entry. Entries stored by other processes since
+// the index was loaded are picked up from disk, and entries missing locally
+// are downloaded from the remote cache when there is one. Entries older than
+// the TTL are removed along with their data and reported as missing.
+func (cm *CacheManager) GetEntry(key string) (*CacheEntry, bool) {
+	cm.mu.Lock()
+	entry, exists := cm.getEntry(key)
+	cm.mu.Unlock()
+	if exists || cm.remote == nil {
+		return entry, exists
+	}
+	return cm.fetchRemote(key)
+}
+
+// getEntry retrieves a locally stored entry; the caller holds the lock
+func (cm *CacheManager) getEntry(key string) (*CacheEntry, bool) {
 	entry, exists := cm.index.Entries[key]
-	if exists {
-		entry.AccessTime = time.Now()
-		entry.AccessCount++
+	if !exists {
+		if entry, exists = cm.readEntry(key); !exists {
+			return nil, false
+		}
+		cm.addEntry(key, entry)
+	}
+	if cm.expired(entry, time.Now()) {
+		cm.removeEntry(key)
+		return nil, false
 	}
-	return entry, exists
+	entry.AccessTime = time.Now()
+	entry.AccessCount++
+	return entry, true
 }
 
-// SetEntry sets a cache entry
+// SetEntry sets a cache entry and writes its metadata file. The entry and
+// its blob are uploaded to the remote cache in the background.
 func (cm *CacheManager) SetEntry(key string, entry *CacheEntry) error {
+	if err := cm.setEntry(key, entry); err != nil {
+		return err
+	}
+	if cm.remote != nil && entry.Blob != "" {
+		if blob, err := cm.backend.ReadFile(blobName(entry.Blob)); err == nil {
+			cm.remote.Upload(key, entry, blob)
+		}
+	}
+	return nil
+}
+
+// fetchRemote downloads an entry from the remote cache and stores it
+// locally
+func (cm *CacheManager) fetchRemote(key string) (*CacheEntry, bool) {
+	entry, blob, ok := cm.remote.Get(key)
+	if !ok {
+		return nil, false
+	}
+	name := blobName(entry.Blob)
+	if _, err := cm.backend.Stat(name); err != nil {
+		if err := cm.backend.WriteFile(name, blob); err != nil {
+			logging.Warn("Failed to store remote cache entry", "key", key, "error", err)
+			return nil, false
+		}
+	}
+
+	// The key covers the content of the source, so the entry is valid for
+	// the local copy whatever its modification time
+	now := time.Now()
+	entry.ModTime = now
+	if cm.fs != nil {
+		if stat, err := cm.fs.Stat(entry.Path); err == nil {
+			entry.ModTime = stat.ModTime()
+		}
+	}
+	entry.Created = now
+	entry.AccessTime = now
+	entry.AccessCount = 1
+	if err := cm.setEntry(key, entry); err != nil {
+		logging.Warn("Failed to store remote cache entry", "key", key, "error", err)
+		return nil, false
+	}
+	return entry, true
+}
+
+// setEntry stores an entry locally
+func (cm *CacheManager) setEntry(key string, entry *CacheEntry) error {
+	if cm.backend.ReadOnly() {
+		return ErrReadOnly
+	}
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	if entry.Created.IsZero() {
+		entry.Created = time.Now()
+	}
+	if err := cm.writeEntry(key, entry); err != nil {
+		return err
+	}
+	if _, exists := cm.index.Entries[key]; exists {
+		cm.dropEntry(key)
+	}
+	cm.addEntry(key, entry)
+
+	// Check if we need to evict entries
+	if cm.config.MaxSize > 0 && cm.index.TotalSize > cm.config.MaxSize {
+		cm.evictLRU(key)
+	}
+
+	return nil
+}
+
+// RemovePath removes the entries compiled from path, whatever their
+// content hash, and returns how many were removed
+func (cm *CacheManager) RemovePath(path string) int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	removed := 0
+	for key, entry := range cm.index.Entries {
+		if entry.Path == path {
+			cm.removeEntry(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// RemoveEntry removes a cache entry and its data
+func (cm *CacheManager) RemoveEntry(key string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.removeEntry(key)
+}
+
+// removeEntry removes an entry and its metadata file; the caller holds the
+// lock. Its blob may be shared with entries of other processes, so it is
+// left for Cleanup, which collects unused blobs under the backend lock
+// after a sync. Read-only backends keep their files, so only the index
+// forgets the entry.
+func (cm *CacheManager) removeEntry(key string) {
+	if _, exists := cm.index.Entries[key]; !exists {
+		return
+	}
+	cm.dropEntry(key)
+	if cm.backend.ReadOnly() {
+		return
+	}
+	cm.backend.Remove(entryName(key))
+}
+
+// addEntry adds an entry to the index and its totals
+func (cm *CacheManager) addEntry(key string, entry *CacheEntry) {
 	cm.index.Entries[key] = entry
 	cm.index.EntryCount = len(cm.index.Entries)
-	
-	// Update total size
+	cm.index.TotalSize += entry.Size
+	if entry.Blob != "" {
+		cm.blobRefs[entry.Blob]++
+	}
+}
+
+// dropEntry removes an entry from the index and its totals only
+func (cm *CacheManager) dropEntry(key string) {
+	entry := cm.index.Entries[key]
+	delete(cm.index.Entries, key)
+	cm.index.EntryCount = len(cm.index.Entries)
+	cm.index.TotalSize -= entry.Size
+	if entry.Blob != "" {
+		if cm.blobRefs[entry.Blob]--; cm.blobRefs[entry.Blob] <= 0 {
+			delete(cm.blobRefs, entry.Blob)
+		}
+	}
+}
+
+// updateTotals recomputes the entry count, total size and blob references
+func (cm *CacheManager) updateTotals() {
+	cm.index.EntryCount = len(cm.index.Entries)
 	cm.index.TotalSize = 0
+	cm.blobRefs = make(map[string]int)
 	for _, e := range cm.index.Entries {
 		cm.index.TotalSize += e.Size
+		if e.Blob != "" {
+			cm.blobRefs[e.Blob]++
+		}
 	}
+}
 
-	// Check if we need to evict entries
-	if cm.config.MaxSize > 0 && cm.index.TotalSize > cm.config.MaxSize {
-		cm.evictLRU()
+// expired reports whether an entry has outlived the TTL
+func (cm *CacheManager) expired(entry *CacheEntry, now time.Time) bool {
+	if cm.config.TTL <= 0 {
+		return false
 	}
+	created := entry.Created
+	if created.IsZero() {
+		// Entries indexed before creation times were recorded
+		created = entry.AccessTime
+	}
+	return now.Sub(created) > cm.config.TTL
+}
 
-	return nil
+// evictLRU removes the least recently used entries, fewest accesses first
+// among equally old ones, until the cache is below its eviction target. The
+// entry being stored is kept.
+func (cm *CacheManager) evictLRU(keep string) {
+	keys := make([]string, 0, len(cm.index.Entries))
+	for key := range cm.index.Entries {
+		if key != keep {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := cm.index.Entries[keys[i]], cm.index.Entries[keys[j]]
+		if !a.AccessTime.Equal(b.AccessTime) {
+			return a.AccessTime.Before(b.AccessTime)
+		}
+		return a.AccessCount < b.AccessCount
+	})
+
+	target := int64(float64(cm.config.MaxSize) * evictionTarget)
+	evicted := 0
+	for _, key := range keys {
+		if cm.index.TotalSize <= target {
+			break
+		}
+		cm.removeEntry(key)
+		evicted++
+	}
+	if evicted > 0 {
+		logging.Debug("Evicted cache entries", "count", evicted, "size", cm.index.TotalSize, "maxSize", cm.config.MaxSize)
+	}
 }
 
-// evictLRU evicts least recently used entries
-func (cm *CacheManager) evictLRU() {
-	// Simple LRU implementation
-	// TODO: Implement proper LRU eviction
+// WriteBlob stores data, compressed when configured, under its SHA-256 and
+// returns the hash and stored size. Identical data is stored once.
+func (cm *CacheManager) WriteBlob(data []byte) (string, int64, error) {
+	if cm.backend.ReadOnly() {
+		return "", 0, ErrReadOnly
+	}
+	if cm.config.CompressCache {
+		compressed, err := compress(cm.config.Compression, data)
+		if err != nil {
+			return "", 0, err
+		}
+		data = compressed
+	}
+
+	blob := hashOf(data)
+	name := blobName(blob)
+	if _, err := cm.backend.Stat(name); err == nil {
+		// Refresh the blob so the janitor of another process doesn't
+		// collect it before the entry using it is written
+		cm.backend.Touch(name)
+		return blob, int64(len(data)), nil
+	}
+	if err := cm.backend.WriteFile(name, data); err != nil {
+		return "", 0, fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return blob, int64(len(data)), nil
 }
 
-// Clear clears all cache
-func (cm *CacheManager) Clear() error {
+// ReadBlob reads a blob, checks it against its hash and decompresses it.
+// Compressed data is recognised by its header, so entries stay readable
+// when the compression setting changes.
+func (cm *CacheManager) ReadBlob(blob string) ([]byte, error) {
+	data, err := cm.backend.ReadFile(blobName(blob))
+	if err != nil {
+		return nil, err
+	}
+	if hashOf(data) != blob {
+		return nil, fmt.Errorf("cache blob %s is corrupt", blob)
+	}
+	return decompress(data)
+}
+
+// Cleanup picks up entries written by other processes, removes expired
+// entries and entries whose blob is gone, evicts entries over MaxSize, and
+// deletes blobs no entry uses and leftover temporary files. It returns the
+// number of entries and orphaned files removed. A read-only cache is left
+// as it is.
+func (cm *CacheManager) Cleanup() (int, int, error) {
+	if cm.backend.ReadOnly() {
+		return 0, 0, nil
+	}
+	unlock, err := cm.backend.Lock()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	// Remove cache directory
-	if err := os.RemoveAll(cm.cacheDir); err != nil {
+	if _, _, err := cm.sync(); err != nil {
+		return 0, 0, err
+	}
+
+	now := time.Now()
+	entries := 0
+	for key, entry := range cm.index.Entries {
+		if cm.expired(entry, now) {
+			cm.removeEntry(key)
+			entries++
+			continue
+		}
+		if entry.Blob == "" {
+			continue
+		}
+		if _, err := cm.backend.Stat(blobName(entry.Blob)); errors.Is(err, fs.ErrNotExist) {
+			cm.removeEntry(key)
+			entries++
+		}
+	}
+	if cm.config.MaxSize > 0 && cm.index.TotalSize > cm.config.MaxSize {
+		before := len(cm.index.Entries)
+		cm.evictLRU("")
+		entries += before - len(cm.index.Entries)
+	}
+
+	orphans := 0
+	remove := func(name string, info fs.FileInfo) {
+		if now.Sub(info.ModTime()) >= orphanGracePeriod && cm.backend.Remove(name) == nil {
+			orphans++
+		}
+	}
+	err = cm.backend.Walk(blobDir, func(name string, info fs.FileInfo) {
+		// Files from before content addressing are named after their key
+		if cm.blobRefs[path.Base(name)] == 0 {
+			remove(name, info)
+		}
+	})
+	if err != nil {
+		return entries, orphans, err
+	}
+	err = cm.backend.Walk(entryDir, func(name string, info fs.FileInfo) {
+		if strings.HasSuffix(name, tempSuffix) {
+			remove(name, info)
+		}
+	})
+	return entries, orphans, err
+}
+
+// sync reconciles the index with the entry files on disk: entries written
+// by other processes are added and entries whose file is gone are dropped.
+// The caller holds the lock.
+func (cm *CacheManager) sync() (int, int, error) {
+	onDisk := make(map[string]bool)
+	added := 0
+	err := cm.backend.Walk(entryDir, func(name string, info fs.FileInfo) {
+		key, ok := strings.CutSuffix(path.Base(name), ".json")
+		if !ok {
+			return
+		}
+		onDisk[key] = true
+		if _, exists := cm.index.Entries[key]; exists {
+			return
+		}
+		if entry, ok := cm.readEntry(key); ok {
+			cm.index.Entries[key] = entry
+			added++
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dropped := 0
+	for key := range cm.index.Entries {
+		if !onDisk[key] {
+			delete(cm.index.Entries, key)
+			dropped++
+		}
+	}
+	cm.updateTotals()
+	return added, dropped, nil
+}
+
+// startJanitor runs Cleanup periodically, saves the index when it removed
+// anything and runs the flushers
+func (cm *CacheManager) startJanitor() {
+	if cm.config.JanitorInterval <= 0 || cm.stopJanitor != nil {
+		return
+	}
+	cm.stopJanitor = make(chan struct{})
+	cm.janitorDone = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(cm.config.JanitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				entries, orphans, err := cm.Cleanup()
+				if err != nil {
+					logging.Warn("Cache cleanup failed", "error", err)
+				}
+				if entries > 0 || orphans > 0 {
+					logging.Info("Cache cleanup", "entries", entries, "orphans", orphans)
+					cm.saveIndex()
+				}
+				cm.flush()
+			}
+		}
+	}(cm.stopJanitor, cm.janitorDone)
+}
+
+// stopJanitorLoop stops the janitor and waits for a running cleanup
+func (cm *CacheManager) stopJanitorLoop() {
+	if cm.stopJanitor == nil {
+		return
+	}
+	close(cm.stopJanitor)
+	<-cm.janitorDone
+	cm.stopJanitor, cm.janitorDone = nil, nil
+}
+
+// Clear clears all cache. A read-only cache is reloaded instead, which
+// forgets the access statistics.
+func (cm *CacheManager) Clear() error {
+	cm.stopJanitorLoop()
+
+	if err := cm.clear(); err != nil {
 		return err
 	}
 
@@ -216,20 +713,77 @@ func (cm *CacheManager) Clear() error {
 	return cm.Initialize()
 }
 
+// clear removes the files and entries of the cache, holding the backend
+// lock like Cleanup
+func (cm *CacheManager) clear() error {
+	if !cm.backend.ReadOnly() {
+		unlock, err := cm.backend.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	var err error
+	if !cm.backend.ReadOnly() {
+		err = cm.backend.Clear()
+	}
+	cm.index = &CacheIndex{Version: indexVersion, Created: time.Now(), Entries: make(map[string]*CacheEntry)}
+	cm.updateTotals()
+	return err
+}
+
 // GetStats returns cache statistics
 func (cm *CacheManager) GetStats() *CacheStats {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
-	// Calculate hit rate and other stats
-	// TODO: Implement proper statistics tracking
-	
-	return &CacheStats{
+	entries := make([]*CacheEntry, 0, len(cm.index.Entries))
+	for _, entry := range cm.index.Entries {
+		if entry.AccessCount > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].AccessCount != entries[j].AccessCount {
+			return entries[i].AccessCount > entries[j].AccessCount
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	topAccessed := []string{}
+	for _, entry := range entries {
+		if len(topAccessed) == 10 {
+			break
+		}
+		topAccessed = append(topAccessed, entry.Path)
+	}
+
+	stats := &CacheStats{
 		TotalEntries: cm.index.EntryCount,
 		TotalSize:    cm.index.TotalSize,
-		HitRate:      0.0, // TODO: Track hits/misses
-		TopAccessed:  []string{}, // TODO: Track top accessed
+		HitRate:      0.0, // Hits and misses are tracked by SvelteCache
+		TopAccessed:  topAccessed,
+	}
+	if cm.remote != nil {
+		remote := cm.remote.Stats()
+		stats.Remote = &remote
+	}
+	return stats
+}
+
+// AccessCounts returns how often the entries compiled from each path were
+// used
+func (cm *CacheManager) AccessCounts() map[string]int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, entry := range cm.index.Entries {
+		counts[entry.Path] += entry.AccessCount
 	}
+	return counts
 }
 
 // generateCacheKey generates a cache key from path and content
@@ -248,11 +802,8 @@ func (cm *CacheManager) getRediVersion() string {
 	return "1.0.0"
 }
 
-// GetCachePath returns the full path for a cache key
+// GetCachePath returns the path of the metadata file for a cache key when
+// the cache is stored on disk
 func (cm *CacheManager) GetCachePath(key string) string {
-	// Use first 2 chars as subdirectory for better file distribution
-	if len(key) >= 2 {
-		return filepath.Join(cm.cacheDir, "cache", "svelte", "compiled", key[:2], key+".json")
-	}
-	return filepath.Join(cm.cacheDir, "cache", "svelte", "compiled", key+".json")
+	return cm.diskPath(entryName(key))
 }
\ No newline at end of file
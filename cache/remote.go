@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rediwo/redi/logging"
+)
+
+// DefaultRemoteTimeout limits each request to a remote cache
+const DefaultRemoteTimeout = 5 * time.Second
+
+// remoteBackoff is how long a remote cache is skipped after a request to it
+// failed, so an unreachable server doesn't slow every compilation down
+const remoteBackoff = 30 * time.Second
+
+// maxRemoteUploads limits the uploads running at the same time
+const maxRemoteUploads = 4
+
+// errRemoteMiss reports a key the remote cache doesn't have
+var errRemoteMiss = errors.New("not in remote cache")
+
+// RemoteConfig configures a cache shared between machines over HTTP. Entry
+// metadata is stored at ac/<SHA-256 of the cache key> and compiled output at
+// cas/<SHA-256 of the data>, the layout of bazel-remote's HTTP API (run it
+// with --disable_http_ac_validation). Any file server accepting GET and PUT
+// works as well.
+type RemoteConfig struct {
+	URL      string            // Base URL of the cache
+	Headers  map[string]string // Sent with every request, e.g. Authorization
+	Timeout  time.Duration     // Per request (default: DefaultRemoteTimeout)
+	ReadOnly bool              // Only download; nothing compiled here is uploaded
+}
+
+// RemoteStats counts the requests to a remote cache
+type RemoteStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Uploads int64 `json:"uploads"`
+	Errors  int64 `json:"errors"`
+}
+
+// RemoteCache downloads entries missing from the local cache and uploads
+// the ones compiled locally
+type RemoteCache struct {
+	config      *RemoteConfig
+	baseURL     string
+	client      *http.Client
+	uploads     sync.WaitGroup
+	uploadSlots chan struct{}
+	failedAt    atomic.Int64 // Unix nanoseconds of the last failure
+	hits        atomic.Int64
+	misses      atomic.Int64
+	uploaded    atomic.Int64
+	failures    atomic.Int64
+}
+
+// remoteEntry is the metadata stored for a key
+type remoteEntry struct {
+	Path       string `json:"path"`
+	Hash       string `json:"hash"`
+	ConfigHash string `json:"configHash"`
+	Blob       string `json:"blob"`
+	Size       int64  `json:"size"`
+}
+
+// NewRemoteCache creates a client for the remote cache in config
+func NewRemoteCache(config *RemoteConfig) *RemoteCache {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRemoteTimeout
+	}
+	return &RemoteCache{
+		config:      config,
+		baseURL:     strings.TrimSuffix(config.URL, "/"),
+		client:      &http.Client{Timeout: timeout},
+		uploadSlots: make(chan struct{}, maxRemoteUploads),
+	}
+}
+
+// Get downloads the entry for key and its compiled output, checking the
+// output against its hash. It reports false on a miss, when the remote is
+// unavailable or when what it returned doesn't check out.
+func (r *RemoteCache) Get(key string) (*CacheEntry, []byte, bool) {
+	if r.backingOff() {
+		return nil, nil, false
+	}
+
+	data, err := r.request(http.MethodGet, "ac/"+remoteKey(key), nil)
+	if err != nil {
+		r.failed(key, err)
+		return nil, nil, false
+	}
+	var meta remoteEntry
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Hash != key || !validBlob(meta.Blob) {
+		r.failed(key, fmt.Errorf("invalid entry"))
+		return nil, nil, false
+	}
+	blob, err := r.request(http.MethodGet, "cas/"+meta.Blob, nil)
+	if err != nil {
+		r.failed(key, err)
+		return nil, nil, false
+	}
+	if hashOf(blob) != meta.Blob {
+		r.failed(key, fmt.Errorf("blob %s is corrupt", meta.Blob))
+		return nil, nil, false
+	}
+
+	r.hits.Add(1)
+	entry := &CacheEntry{
+		Path:       meta.Path,
+		Hash:       key,
+		ConfigHash: meta.ConfigHash,
+		Blob:       meta.Blob,
+		Size:       int64(len(blob)),
+	}
+	return entry, blob, true
+}
+
+// Upload stores the entry for key and its compiled output in the
+// background; Wait waits for the uploads
+func (r *RemoteCache) Upload(key string, entry *CacheEntry, blob []byte) {
+	if r.config.ReadOnly || r.backingOff() {
+		return
+	}
+	meta, err := json.Marshal(&remoteEntry{
+		Path:       entry.Path,
+		Hash:       key,
+		ConfigHash: entry.ConfigHash,
+		Blob:       entry.Blob,
+		Size:       entry.Size,
+	})
+	if err != nil {
+		return
+	}
+
+	r.uploads.Add(1)
+	go func() {
+		defer r.uploads.Done()
+		r.uploadSlots <- struct{}{}
+		defer func() { <-r.uploadSlots }()
+
+		// The output goes first, so an entry is never visible without it
+		if _, err := r.request(http.MethodPut, "cas/"+entry.Blob, blob); err != nil {
+			r.failed(key, err)
+			return
+		}
+		if _, err := r.request(http.MethodPut, "ac/"+remoteKey(key), meta); err != nil {
+			r.failed(key, err)
+			return
+		}
+		r.uploaded.Add(1)
+	}()
+}
+
+// Wait waits for the running uploads
+func (r *RemoteCache) Wait() {
+	r.uploads.Wait()
+}
+
+// Stats returns the request counts
+func (r *RemoteCache) Stats() RemoteStats {
+	return RemoteStats{
+		Hits:    r.hits.Load(),
+		Misses:  r.misses.Load(),
+		Uploads: r.uploaded.Load(),
+		Errors:  r.failures.Load(),
+	}
+}
+
+// request sends a request for path and returns the response body
+func (r *RemoteCache) request(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, r.baseURL+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range r.config.Headers {
+		req.Header.Set(name, value)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		io.Copy(io.Discard, resp.Body)
+		return nil, errRemoteMiss
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// failed counts a failed request; errors other than a miss make the cache
+// skip the remote for a while
+func (r *RemoteCache) failed(key string, err error) {
+	if errors.Is(err, errRemoteMiss) {
+		r.misses.Add(1)
+		return
+	}
+	r.failures.Add(1)
+	r.failedAt.Store(time.Now().UnixNano())
+	logging.Warn("Remote cache request failed", "url", r.baseURL, "key", key, "error", err)
+}
+
+// backingOff reports whether a request failed too recently to try again
+func (r *RemoteCache) backingOff() bool {
+	failedAt := r.failedAt.Load()
+	return failedAt != 0 && time.Since(time.Unix(0, failedAt)) < remoteBackoff
+}
+
+// remoteKey returns the name of an entry in the remote cache. Cache keys are
+// hashed again to the SHA-256 names content-addressed caches expect.
+func remoteKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// validBlob reports whether blob is a hex SHA-256
+func validBlob(blob string) bool {
+	if len(blob) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(blob)
+	return err == nil
+}
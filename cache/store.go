@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// tempSuffix marks files being written; they are renamed into place when
+// complete
+const tempSuffix = ".tmp"
+
+// VerifyReport is the result of checking the cache on disk
+type VerifyReport struct {
+	Entries  int      `json:"entries"`
+	Blobs    int      `json:"blobs"`
+	BlobSize int64    `json:"blobSize"`
+	Orphans  int      `json:"orphans"` // Blobs no entry uses
+	Problems []string `json:"problems"`
+	Broken   []string `json:"broken"` // Keys of entries that can't be served
+}
+
+// OK reports whether no problems were found
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Names of the cache files within the backend
+const (
+	indexName = "cache/metadata.json"
+	entryDir  = "cache/svelte/entries"
+	blobDir   = "cache/svelte/compiled"
+	graphName = "cache/svelte/deps/graph.json"
+	lockName  = "cache/index.lock"
+	// whiteoutsName lists the files of the lower backend of an overlay
+	// that were removed, in its upper backend
+	whiteoutsName = "cache/whiteouts.json"
+)
+
+// entryName returns the name of the metadata file of an entry
+func entryName(key string) string {
+	return shardedName(entryDir, key+".json")
+}
+
+// blobName returns the name of a blob
+func blobName(blob string) string {
+	return shardedName(blobDir, blob)
+}
+
+// shardedName spreads files over subdirectories named after the first two
+// characters of their name
+func shardedName(dir, name string) string {
+	if len(name) >= 2 {
+		return path.Join(dir, name[:2], name)
+	}
+	return path.Join(dir, name)
+}
+
+// diskPath returns where a file of the cache is when it is stored on disk
+func (cm *CacheManager) diskPath(name string) string {
+	return filepath.Join(cm.cacheDir, filepath.FromSlash(name))
+}
+
+// readEntry reads the metadata file of an entry
+func (cm *CacheManager) readEntry(key string) (*CacheEntry, bool) {
+	data, err := cm.backend.ReadFile(entryName(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// writeEntry writes the metadata file of an entry
+func (cm *CacheManager) writeEntry(key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := cm.backend.WriteFile(entryName(key), data); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so readers see either the old or the new content
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// walkFiles calls fn for every file under dir; a missing dir has no files
+func walkFiles(dir string, fn func(path string, info fs.FileInfo)) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+		fn(path, info)
+		return nil
+	})
+}
+
+// Verify checks the cache on disk: that the index snapshot and every entry
+// can be read, and that every blob an entry uses exists and matches its
+// hash. Problems are reported; Repair removes the broken entries.
+func (cm *CacheManager) Verify() (*VerifyReport, error) {
+	report := &VerifyReport{Problems: []string{}, Broken: []string{}}
+
+	if data, err := cm.backend.ReadFile(indexName); err == nil {
+		var index CacheIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("index snapshot is unreadable and will be rebuilt: %v", err))
+		}
+	}
+
+	refs := make(map[string]bool)
+	err := cm.backend.Walk(entryDir, func(name string, info fs.FileInfo) {
+		key, ok := strings.CutSuffix(path.Base(name), ".json")
+		if !ok {
+			return
+		}
+		report.Entries++
+		entry, ok := cm.readEntry(key)
+		if !ok {
+			report.Problems = append(report.Problems, fmt.Sprintf("entry %s is unreadable", key))
+			report.Broken = append(report.Broken, key)
+			return
+		}
+		if entry.Blob == "" {
+			return
+		}
+		refs[entry.Blob] = true
+		problem := ""
+		data, err := cm.backend.ReadFile(blobName(entry.Blob))
+		switch {
+		case err != nil:
+			problem = "is missing"
+		case hashOf(data) != entry.Blob:
+			problem = "is corrupt"
+		default:
+			if _, err := decompress(data); err != nil {
+				problem = fmt.Sprintf("can't be decompressed: %v", err)
+			}
+		}
+		if problem != "" {
+			report.Problems = append(report.Problems, fmt.Sprintf("entry %s (%s): blob %s %s", key, entry.Path, entry.Blob, problem))
+			report.Broken = append(report.Broken, key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cm.backend.Walk(blobDir, func(name string, info fs.FileInfo) {
+		report.Blobs++
+		report.BlobSize += info.Size()
+		if !refs[path.Base(name)] {
+			report.Orphans++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Repair removes the broken entries found by Verify, along with blobs that
+// only they use, so the components are compiled again
+func (cm *CacheManager) Repair(report *VerifyReport) (int, error) {
+	unlock, err := cm.backend.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for _, key := range report.Broken {
+		if _, indexed := cm.index.Entries[key]; indexed {
+			cm.removeEntry(key)
+		} else {
+			cm.backend.Remove(entryName(key))
+		}
+	}
+	return len(report.Broken), nil
+}
+
+// hashOf returns the hex SHA-256 of data
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -3,13 +3,11 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/dop251/goja"
 	"github.com/rediwo/redi/filesystem"
 )
 
@@ -22,6 +20,7 @@ type SvelteCache struct {
 	misses          int64
 	totalCompileTime time.Duration
 	compileCount    int64
+	graph           *DependencyGraph
 }
 
 // SvelteCacheEntry represents a cached Svelte component
@@ -52,9 +51,21 @@ type SvelteCacheEntry struct {
 
 // NewSvelteCache creates a new Svelte cache instance
 func NewSvelteCache(manager *CacheManager, fs filesystem.FileSystem) *SvelteCache {
+	// A read-only cache was built from files that can't change since, and
+	// their recorded modification times needn't match the ones served, so
+	// its graph is kept in memory
+	var backend CacheBackend
+	if manager.config.Enabled && !manager.ReadOnly() {
+		backend = manager.backend
+	}
+	graph := NewDependencyGraph(fs, backend, graphName)
+	if backend != nil {
+		manager.addFlusher(graph.Save)
+	}
 	return &SvelteCache{
 		manager: manager,
 		fs:      fs,
+		graph:   graph,
 	}
 }
 
@@ -74,8 +85,7 @@ func (sc *SvelteCache) Get(path string, content []byte, configHash string) (*Sve
 	}
 
 	// Load cached data
-	cachePath := sc.manager.GetCachePath(key)
-	data, err := os.ReadFile(cachePath)
+	data, err := sc.manager.ReadBlob(entry.Blob)
 	if err != nil {
 		sc.misses++
 		return nil, false
@@ -110,6 +120,12 @@ func (sc *SvelteCache) Set(path string, content []byte, configHash string, compi
 	sc.totalCompileTime += compiled.CompileTime
 	sc.compileCount++
 
+	// Components missing from a read-only cache are compiled for every
+	// process; the handler keeps them in memory
+	if sc.manager.ReadOnly() {
+		return nil
+	}
+
 	// Generate cache key
 	key := sc.manager.GenerateCacheKey(path, content, configHash)
 	
@@ -119,16 +135,10 @@ func (sc *SvelteCache) Set(path string, content []byte, configHash string, compi
 		return fmt.Errorf("failed to serialize cache entry: %w", err)
 	}
 
-	// Create cache directory if needed
-	cachePath := sc.manager.GetCachePath(key)
-	cacheDir := filepath.Dir(cachePath)
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
-	}
-
-	// Write cache file
-	if err := os.WriteFile(cachePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
+	// Write cache file, compressed when configured
+	blob, size, err := sc.manager.WriteBlob(data)
+	if err != nil {
+		return err
 	}
 
 	// Get file info
@@ -142,19 +152,20 @@ func (sc *SvelteCache) Set(path string, content []byte, configHash string, compi
 		Path:        path,
 		Hash:        key,
 		ConfigHash:  configHash,
-		Size:        int64(len(data)),
+		Size:        size,
+		Blob:        blob,
 		ModTime:     stat.ModTime(),
 		AccessTime:  time.Now(),
 		AccessCount: 1,
 		Priority:    sc.calculatePriority(path),
 	}
 
+	// The entry's metadata file is written right away; the index snapshot
+	// is saved by the janitor and on Close
 	if err := sc.manager.SetEntry(key, entry); err != nil {
 		return fmt.Errorf("failed to update cache index: %w", err)
 	}
-
-	// Save index
-	return sc.manager.saveIndex()
+	return nil
 }
 
 // CompileWithCache compiles a Svelte component with caching
@@ -232,29 +243,29 @@ func (sc *SvelteCache) calculatePriority(path string) float64 {
 	return priority
 }
 
+// Graph returns the persisted dependency graph of the cached components
+func (sc *SvelteCache) Graph() *DependencyGraph {
+	return sc.graph
+}
+
 // InvalidatePath invalidates cache for a specific path
 func (sc *SvelteCache) InvalidatePath(path string) error {
-	// TODO: Implement path-based invalidation
-	// This would need to track reverse mapping from paths to cache keys
+	sc.manager.RemovePath(path)
 	return nil
 }
 
-// InvalidateDependents invalidates cache for components that depend on a path
+// InvalidateDependents invalidates cache for components that depend on a
+// path, directly or through other components
 func (sc *SvelteCache) InvalidateDependents(path string) error {
-	// TODO: Implement dependency-based invalidation
-	// This would need to maintain a dependency graph
+	for _, dependent := range sc.graph.Dependents(path) {
+		if err := sc.InvalidatePath(dependent); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Precompile attempts to precompile a component and cache it
-func (sc *SvelteCache) Precompile(path string, content []byte, configHash string, vm *goja.Runtime) error {
-	// Check if already cached
-	if _, found := sc.Get(path, content, configHash); found {
-		return nil
-	}
-
-	// TODO: Implement actual precompilation using the VM
-	// This would involve calling the Svelte compiler
-	
-	return nil
-}
\ No newline at end of file
+// AccessCounts returns how often the cached components were used, by path
+func (sc *SvelteCache) AccessCounts() map[string]int {
+	return sc.manager.AccessCounts()
+}
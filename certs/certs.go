@@ -0,0 +1,243 @@
+// Package certs loads TLS certificates and generates self-signed development
+// certificates.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Pair is a certificate and private key file pair in PEM format
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// LoadTLSConfig loads the certificate pairs into a TLS configuration. With
+// several pairs the certificate is selected by SNI from the client hello.
+func LoadTLSConfig(pairs []Pair) (*tls.Config, error) {
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no TLS certificates configured")
+	}
+
+	certificates := make([]tls.Certificate, 0, len(pairs))
+	for _, pair := range pairs {
+		certificate, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate %s: %w", pair.CertFile, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return &tls.Config{
+		Certificates: certificates,
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// DevHosts are the names covered by the development certificate
+var DevHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// Development certificate file names inside the certificate directory
+const (
+	DevCAFile   = "ca.pem"
+	DevCAKey    = "ca-key.pem"
+	DevCertFile = "cert.pem"
+	DevKeyFile  = "key.pem"
+)
+
+// renewBefore regenerates certificates that expire within this window
+const renewBefore = 7 * 24 * time.Hour
+
+// EnsureDevCertificate returns a certificate for hosts signed by a local
+// development CA, both cached in dir. Existing files are reused while they are
+// valid and cover all hosts, so the CA only has to be trusted once.
+func EnsureDevCertificate(dir string, hosts []string) (Pair, error) {
+	pair := Pair{CertFile: filepath.Join(dir, DevCertFile), KeyFile: filepath.Join(dir, DevKeyFile)}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return pair, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	caCert, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		return pair, err
+	}
+
+	if validLeaf(pair.CertFile, caCert, hosts) {
+		return pair, nil
+	}
+
+	if err := createLeaf(pair, caCert, caKey, hosts); err != nil {
+		return pair, err
+	}
+	return pair, nil
+}
+
+// loadOrCreateCA loads the development CA or creates a new one
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certFile := filepath.Join(dir, DevCAFile)
+	keyFile := filepath.Join(dir, DevCAKey)
+
+	if cert, err := readCertificate(certFile); err == nil && time.Until(cert.NotAfter) > renewBefore {
+		if key, err := readPrivateKey(keyFile); err == nil {
+			return cert, key, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{Organization: []string{"redi development CA"}, CommonName: "redi development CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	if err := writeCertificate(certFile, der); err != nil {
+		return nil, nil, err
+	}
+	if err := writePrivateKey(keyFile, key); err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// validLeaf reports whether the certificate in file is signed by ca, not
+// about to expire and valid for all hosts
+func validLeaf(file string, ca *x509.Certificate, hosts []string) bool {
+	cert, err := readCertificate(file)
+	if err != nil || time.Until(cert.NotAfter) < renewBefore {
+		return false
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if err := cert.VerifyHostname(host); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// createLeaf issues a server certificate for hosts signed by the CA
+func createLeaf(pair Pair, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{Organization: []string{"redi development certificate"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		// Browsers reject leaf certificates valid for more than 825 days
+		NotAfter:    time.Now().AddDate(0, 0, 825),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(template.DNSNames) > 0 {
+		template.Subject.CommonName = template.DNSNames[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	if err := writeCertificate(pair.CertFile, der); err != nil {
+		return err
+	}
+	return writePrivateKey(pair.KeyFile, key)
+}
+
+func newSerialNumber() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
+
+func readCertificate(file string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func readPrivateKey(file string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected private key type in %s", file)
+	}
+	return ecKey, nil
+}
+
+func writeCertificate(file string, der []byte) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate %s: %w", file, err)
+	}
+	return nil
+}
+
+func writePrivateKey(file string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write private key %s: %w", file, err)
+	}
+	return nil
+}
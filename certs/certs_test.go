@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureDevCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	pair, err := EnsureDevCertificate(dir, DevHosts)
+	if err != nil {
+		t.Fatalf("EnsureDevCertificate failed: %v", err)
+	}
+	first, _ := os.ReadFile(pair.CertFile)
+
+	cert, err := readCertificate(pair.CertFile)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	for _, host := range DevHosts {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("Certificate not valid for %s: %v", host, err)
+		}
+	}
+
+	// Cached files are reused
+	if _, err := EnsureDevCertificate(dir, DevHosts); err != nil {
+		t.Fatalf("Second EnsureDevCertificate failed: %v", err)
+	}
+	second, _ := os.ReadFile(pair.CertFile)
+	if !bytes.Equal(first, second) {
+		t.Error("Expected cached certificate to be reused")
+	}
+
+	// A new host reissues the leaf but keeps the CA
+	caBefore, _ := os.ReadFile(filepath.Join(dir, DevCAFile))
+	if _, err := EnsureDevCertificate(dir, []string{"localhost", "app.test"}); err != nil {
+		t.Fatalf("EnsureDevCertificate with new host failed: %v", err)
+	}
+	caAfter, _ := os.ReadFile(filepath.Join(dir, DevCAFile))
+	third, _ := os.ReadFile(pair.CertFile)
+	if bytes.Equal(first, third) {
+		t.Error("Expected certificate to be reissued for new host")
+	}
+	if !bytes.Equal(caBefore, caAfter) {
+		t.Error("Expected CA to be kept")
+	}
+}
+
+func TestLoadTLSConfigSNIAndHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	pairA, err := EnsureDevCertificate(filepath.Join(dir, "a"), []string{"a.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairB, err := EnsureDevCertificate(filepath.Join(dir, "b"), []string{"b.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig, err := LoadTLSConfig([]Pair{pairA, pairB})
+	if err != nil {
+		t.Fatalf("LoadTLSConfig failed: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	for _, caDir := range []string{"a", "b"} {
+		ca, _ := os.ReadFile(filepath.Join(dir, caDir, DevCAFile))
+		roots.AppendCertsFromPEM(ca)
+	}
+
+	for _, host := range []string{"a.test", "b.test"} {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: host},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request with SNI %s failed: %v", host, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.TLS.PeerCertificates[0].VerifyHostname(host) != nil {
+			t.Errorf("Expected certificate for %s", host)
+		}
+		if string(body) != "HTTP/2.0" {
+			t.Errorf("Expected HTTP/2.0, got %s", body)
+		}
+	}
+}
+
+func TestLoadTLSConfigErrors(t *testing.T) {
+	if _, err := LoadTLSConfig(nil); err == nil {
+		t.Error("Expected error without certificates")
+	}
+	if _, err := LoadTLSConfig([]Pair{{CertFile: "missing.pem", KeyFile: "missing-key.pem"}}); err == nil {
+		t.Error("Expected error for missing files")
+	}
+}
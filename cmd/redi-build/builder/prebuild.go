@@ -0,0 +1,32 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rediwo/redi"
+)
+
+// prebuildSite compiles the Svelte components of the site in dir into its
+// .redi cache, so the binary built from it starts without compiling
+func prebuildSite(dir string) error {
+	// Start from an empty cache rather than the one of the source tree
+	cacheDir := filepath.Join(dir, ".redi")
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return err
+	}
+
+	server := redi.NewServer(dir, 0)
+	if err := server.PreBuild(0); err != nil {
+		return err
+	}
+
+	// The lock file is only used while the cache is written
+	os.Remove(filepath.Join(cacheDir, "cache", "index.lock"))
+	if _, err := os.Stat(filepath.Join(cacheDir, "cache")); err != nil {
+		return fmt.Errorf("no cache was written: %w", err)
+	}
+	fmt.Printf("Prebuilt Svelte components into: %s\n", cacheDir)
+	return nil
+}
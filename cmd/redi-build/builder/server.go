@@ -52,6 +52,13 @@ func (s *ServerBuilder) Build(config Config) error {
 		return NewBuildError("failed to copy root directory", err)
 	}
 	
+	// Compile the Svelte components into the copy's cache
+	if config.Prebuild {
+		if err := prebuildSite(targetDir); err != nil {
+			return NewBuildError("failed to prebuild Svelte components", err)
+		}
+	}
+	
 	// Prepare template data
 	moduleName := config.Output
 	if config.AppName != "" {
@@ -76,6 +83,7 @@ func (s *ServerBuilder) Build(config Config) error {
 		RediVersion:     s.getRediVersion(),
 		IsSourceInstall: s.isSourceInstall(),
 		ReplaceDir:      s.getReplaceDir(),
+		Prebuild:        config.Prebuild,
 	}
 	
 	// Generate main.go
@@ -31,4 +31,5 @@ type TemplateData struct {
 	IsSourceInstall bool
 	ReplaceDir     string
 	ScriptName     string   // For CLI builder - script filename
+	Prebuild       bool     // Whether RootDir/.redi/cache holds a prebuilt cache to embed
 }
\ No newline at end of file
@@ -11,6 +11,7 @@ type Config struct {
 	Extensions  []string
 	ConfigFile  string
 	ScriptPath  string   // For CLI builder - main JavaScript file
+	Prebuild    bool     // Compile the Svelte components at build time and embed the cache
 }
 
 // Builder interface for different build types
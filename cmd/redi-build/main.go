@@ -67,6 +67,7 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  %s cli --script=main.js --output=mycli\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s server --root=mysite --output=myserver\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s standalone --root=mysite --output=myapp\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s standalone --root=mysite --output=myapp --prebuild\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s app --root=mysite --output=myapp --name=\"My App\"\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s cli --script=app.js --ext=orm,auth --output=mycli\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s server --config=build.yaml\n", os.Args[0])
@@ -79,11 +80,13 @@ func buildServer() {
 	var output string
 	var extensions string
 	var configFile string
+	var prebuild bool
 	
 	serverFlags.StringVar(&root, "root", "", "Root directory to include")
 	serverFlags.StringVar(&output, "output", "redi-server", "Output directory name")
 	serverFlags.StringVar(&extensions, "ext", "", "Extension modules (comma-separated)")
 	serverFlags.StringVar(&configFile, "config", "", "Configuration file (YAML)")
+	serverFlags.BoolVar(&prebuild, "prebuild", false, "Compile Svelte components at build time and embed them in the binary")
 	
 	serverFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Build server application project\n\n")
@@ -104,6 +107,7 @@ func buildServer() {
 		Output:     output,
 		Extensions: parseExtensions(extensions),
 		ConfigFile: configFile,
+		Prebuild:   prebuild,
 	})
 	
 	serverBuilder := builder.NewServerBuilder()
@@ -126,11 +130,13 @@ func buildStandalone() {
 	var output string
 	var extensions string
 	var configFile string
+	var prebuild bool
 	
 	standaloneFlags.StringVar(&root, "root", "", "Root directory to embed")
 	standaloneFlags.StringVar(&output, "output", "redi-standalone", "Output directory name")
 	standaloneFlags.StringVar(&extensions, "ext", "", "Extension modules (comma-separated)")
 	standaloneFlags.StringVar(&configFile, "config", "", "Configuration file (YAML)")
+	standaloneFlags.BoolVar(&prebuild, "prebuild", false, "Compile Svelte components at build time and embed them in the binary")
 	
 	standaloneFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Build standalone executable project\n\n")
@@ -151,6 +157,7 @@ func buildStandalone() {
 		Output:     output,
 		Extensions: parseExtensions(extensions),
 		ConfigFile: configFile,
+		Prebuild:   prebuild,
 	})
 	
 	standaloneBuilder := builder.NewStandaloneBuilder()
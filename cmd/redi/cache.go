@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rediwo/redi/cache"
+	"github.com/rediwo/redi/middleware"
+)
+
+// runCacheCommand runs redi cache verify|gc|stats against the compilation
+// cache of a site. It is safe to run while a server uses the cache.
+func runCacheCommand(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cache verify|gc|stats --root=mysite [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  verify  Check that every cached component can be read (--repair removes broken ones)\n")
+		fmt.Fprintf(os.Stderr, "  gc      Remove expired and unused entries and files (--max-size, --ttl)\n")
+		fmt.Fprintf(os.Stderr, "  stats   Show the size and most used entries of the cache\n")
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("cache "+command, flag.ExitOnError)
+	var root string
+	var repair bool
+	var maxSize string
+	var ttl time.Duration
+	flags.StringVar(&root, "root", ".", "Root directory of the site")
+	switch command {
+	case "verify":
+		flags.BoolVar(&repair, "repair", false, "Remove broken entries so they are compiled again")
+	case "gc":
+		flags.StringVar(&maxSize, "max-size", "", "Evict least recently used entries above this size, e.g. 200MB")
+		flags.DurationVar(&ttl, "ttl", 0, "Remove entries older than this")
+	case "stats":
+	default:
+		usage()
+		return 2
+	}
+	flags.Usage = func() {
+		usage()
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	config := &cache.CacheConfig{RootDir: root, Enabled: true, TTL: ttl}
+	if maxSize != "" {
+		size, err := middleware.ParseByteSize(maxSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --max-size: %v\n", err)
+			return 2
+		}
+		config.MaxSize = size
+	}
+	if _, err := os.Stat(filepath.Join(root, ".redi", "cache")); err != nil {
+		fmt.Fprintf(os.Stderr, "No compilation cache in %s\n", root)
+		return 1
+	}
+	manager := cache.NewCacheManager(config)
+	if err := manager.Initialize(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer manager.Close()
+
+	switch command {
+	case "verify":
+		report, err := manager.Verify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, problem := range report.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		fmt.Printf("%d entries, %d blobs (%s), %d unused\n", report.Entries, report.Blobs, formatSize(report.BlobSize), report.Orphans)
+		if report.OK() {
+			fmt.Printf("Cache is consistent\n")
+			return 0
+		}
+		if repair {
+			removed, err := manager.Repair(report)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Removed %d broken entries\n", removed)
+			return 0
+		}
+		fmt.Printf("%d problems found (run with --repair to remove broken entries)\n", len(report.Problems))
+		return 1
+
+	case "gc":
+		entries, orphans, err := manager.Cleanup()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		stats := manager.GetStats()
+		fmt.Printf("Removed %d entries and %d unused files; %d entries (%s) left\n", entries, orphans, stats.TotalEntries, formatSize(stats.TotalSize))
+		return 0
+
+	case "stats":
+		stats := manager.GetStats()
+		report, err := manager.Verify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("  Entries:  %d (%s)\n", stats.TotalEntries, formatSize(stats.TotalSize))
+		fmt.Printf("  Blobs:    %d (%s on disk, %d unused)\n", report.Blobs, formatSize(report.BlobSize), report.Orphans)
+		if len(report.Problems) > 0 {
+			fmt.Printf("  Problems: %d (run redi cache verify)\n", len(report.Problems))
+		}
+		if len(stats.TopAccessed) > 0 {
+			fmt.Printf("  Most used:\n")
+			for _, path := range stats.TopAccessed {
+				fmt.Printf("    %s\n", path)
+			}
+		}
+		return 0
+	}
+	return 2
+}
+
+// formatSize formats a byte count for people
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rediwo/redi"
+	"github.com/rediwo/redi/server"
+)
+
+// exitNotRunning is the LSB exit code for "program is not running"
+const exitNotRunning = 3
+
+// runDaemonCommand runs the status, stop and restart subcommands for a server
+// started in background mode with --log
+func runDaemonCommand(command string, args []string) int {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var logFile string
+	var timeout time.Duration
+	flags.StringVar(&logFile, "log", "", "Log file the background server was started with")
+	flags.DurationVar(&timeout, "timeout", redi.DefaultShutdownTimeout+5*time.Second, "How long to wait for the server to stop or restart")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s --log=server.log [--timeout=15s]\n\n", os.Args[0], command)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if logFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --log is required\n\n")
+		flags.Usage()
+		return 2
+	}
+
+	switch command {
+	case "status":
+		status, err := server.ReadDaemonStatus(logFile)
+		if err != nil {
+			return reportNotRunning(status, err)
+		}
+		fmt.Printf("redi is running\n")
+		printDaemonStatus(status)
+		return 0
+
+	case "stop":
+		status, err := server.StopDaemon(logFile, timeout)
+		if errors.Is(err, server.ErrNotRunning) {
+			return reportNotRunning(status, err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return 1
+		}
+		fmt.Printf("redi stopped (PID %d)\n", status.PID)
+		return 0
+
+	case "restart":
+		status, err := server.RestartDaemon(logFile, timeout)
+		if errors.Is(err, server.ErrNotRunning) {
+			return reportNotRunning(status, err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("redi restarted\n")
+		printDaemonStatus(status)
+		return 0
+	}
+	return 2
+}
+
+// runLogsCommand prints the log of a server started in background mode,
+// and keeps printing it with -f until interrupted
+func runLogsCommand(args []string) int {
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	var logFile string
+	var lines int
+	var follow bool
+	flags.StringVar(&logFile, "log", "", "Log file the background server was started with")
+	flags.IntVar(&lines, "n", 50, "Number of lines to print from the end of the log")
+	flags.BoolVar(&follow, "f", false, "Keep printing new output, across log rotations")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s logs --log=server.log [-n=50] [-f]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if logFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --log is required\n\n")
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := server.TailLog(ctx, os.Stdout, logFile, lines, follow); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// reportNotRunning prints why no server was found
+func reportNotRunning(status *server.DaemonStatus, err error) int {
+	if !errors.Is(err, server.ErrNotRunning) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if status != nil && status.Stale {
+		fmt.Printf("redi is not running (removed stale PID file for PID %d)\n", status.PID)
+	} else {
+		fmt.Printf("redi is not running\n")
+	}
+	return exitNotRunning
+}
+
+// printDaemonStatus prints the details of a running server
+func printDaemonStatus(status *server.DaemonStatus) {
+	fmt.Printf("  PID:     %d\n", status.PID)
+	if status.Port != 0 {
+		fmt.Printf("  Port:    %d (%s)\n", status.Port, status.URL())
+		fmt.Printf("  Root:    %s\n", status.Root)
+		fmt.Printf("  Version: %s\n", status.Version)
+		fmt.Printf("  Uptime:  %s\n", status.Uptime())
+	}
+	fmt.Printf("  Log:     %s\n", status.LogFile)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/rediwo/redi"
 	"github.com/rediwo/redi/runtime"
 	"github.com/rediwo/redi/server"
 )
@@ -23,6 +25,18 @@ func main() {
 		return
 	}
 
+	// Manage a server started in background mode
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "status", "stop", "restart":
+			os.Exit(runDaemonCommand(os.Args[1], os.Args[2:]))
+		case "logs":
+			os.Exit(runLogsCommand(os.Args[2:]))
+		case "cache":
+			os.Exit(runCacheCommand(os.Args[2:]))
+		}
+	}
+
 	var root string
 	var port int
 	var version bool
@@ -33,9 +47,26 @@ func main() {
 	var clearCache bool
 	var prebuild bool
 	var prebuildParallel int
+	var prebuildReport string
 	var logLevel string
 	var logFormat string
 	var logQuiet bool
+	var defaultLocale string
+	var devMode bool
+	var accessLog string
+	var enableMetrics bool
+	var adminToken string
+	var tlsCert string
+	var tlsKey string
+	var devTLS bool
+	var httpRedirectPort int
+	var shutdownTimeout time.Duration
+	var logMaxSize int64
+	var logMaxAge time.Duration
+	var logMaxBackups int
+	var configFile string
+	var environment string
+	var virtualHosts []redi.VirtualHost
 
 	flag.StringVar(&root, "root", "", "Root directory containing public and routes folders")
 	flag.IntVar(&port, "port", 8080, "Port to serve on")
@@ -47,37 +78,97 @@ func main() {
 	flag.BoolVar(&clearCache, "clear-cache", false, "Clear existing cache and exit")
 	flag.BoolVar(&prebuild, "prebuild", false, "Pre-compile all Svelte components before starting server")
 	flag.IntVar(&prebuildParallel, "prebuild-parallel", 4, "Number of parallel workers for pre-building (default: 4)")
+	flag.StringVar(&prebuildReport, "prebuild-report", "", "Write a JSON report of the pre-build to this file")
 	flag.StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
 	flag.StringVar(&logFormat, "log-format", "text", "Log format (text, json)")
 	flag.BoolVar(&logQuiet, "quiet", false, "Quiet mode (only ERROR and FATAL messages)")
+	flag.Int64Var(&logMaxSize, "log-max-size", 0, "Rotate the --log file when it exceeds this many megabytes (0 disables)")
+	flag.DurationVar(&logMaxAge, "log-max-age", 0, "Rotate the --log file after this long, e.g. 24h (0 disables)")
+	flag.IntVar(&logMaxBackups, "log-max-backups", 0, "Number of rotated log files to keep (0 keeps all)")
+	flag.StringVar(&defaultLocale, "default-locale", "", "Fallback locale for catalogs in locales/ (default: en if available)")
+	flag.StringVar(&accessLog, "access-log", "off", "Access log format (common, combined, json, off)")
+	flag.BoolVar(&enableMetrics, "metrics", false, "Serve Prometheus metrics at /metrics")
+	flag.StringVar(&adminToken, "admin-token", "", "Bearer token enabling the /_redi/admin API (default: $REDI_ADMIN_TOKEN)")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file, comma-separated for several certificates (SNI)")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file(s) matching --tls-cert")
+	flag.BoolVar(&devTLS, "dev-tls", false, "Serve HTTPS with a self-signed localhost certificate cached in .redi/tls")
+	flag.IntVar(&httpRedirectPort, "http-redirect-port", 0, "Plain HTTP port that redirects to HTTPS (0 disables)")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", redi.DefaultShutdownTimeout, "How long to drain in-flight requests on SIGINT/SIGTERM")
+	flag.BoolVar(&devMode, "dev", false, "Development mode (show stack traces and source excerpts on error pages)")
+	flag.StringVar(&configFile, "config", "", "Project config file (default: redi.yaml, redi.yml or redi.json in --root)")
+	flag.Func("vhost", "Serve another site for some hosts: host[,*.host...]=dir (repeatable)", func(value string) error {
+		vhost, err := redi.ParseVirtualHost(value)
+		if err != nil {
+			return err
+		}
+		virtualHosts = append(virtualHosts, vhost)
+		return nil
+	})
+	flag.StringVar(&environment, "env", "", "Project config section to apply: development or production (default: $REDI_ENV, else development with --dev, else production)")
 
 	// Custom usage message
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Redi Frontend Server - Dynamic web serving with JavaScript, Markdown, and templates\n\n")
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s status|stop|restart --log=server.log [--timeout=15s]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s logs --log=server.log [-n=50] [-f]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s cache verify|gc|stats --root=mysite\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --port=8080          # Run in foreground\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --log=server.log     # Run in background (like nohup)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --log=server.log --log-max-size=100 --log-max-backups=5\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s status --log=server.log            # Show PID, port and uptime\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s stop --log=server.log              # Stop gracefully\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s logs --log=server.log -f           # Follow the log\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --cache              # Enable compilation cache\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --clear-cache        # Clear cache and exit\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s cache verify --root=mysite         # Check the cache for corrupt entries\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --prebuild           # Pre-compile all Svelte components\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --prebuild --port=8080  # Pre-build then start server\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --prebuild --prebuild-report=build.json  # Pre-build and write a report\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --log-level=debug    # Enable debug logging\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --log-format=json    # Use JSON log format\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --root=mysite --quiet              # Quiet mode (errors only)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --default-locale=de  # Fall back to German translations\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --dev                # Detailed error pages for development\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --access-log=combined # Log every request (Combined Log Format)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --metrics            # Expose Prometheus metrics at /metrics\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --port=8443 --dev-tls  # Local HTTPS with a self-signed certificate\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --port=443 --tls-cert=cert.pem --tls-key=key.pem --http-redirect-port=80\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=mysite --env=development    # Apply the development section of redi.yaml\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --root=main --vhost=blog.example.com=blog --vhost='*.shop.example.com=shop'\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --version                          # Show version\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nLogging:\n")
 		fmt.Fprintf(os.Stderr, "  Levels: debug, info, warn, error\n")
 		fmt.Fprintf(os.Stderr, "  Formats: text (colored), json\n")
 		fmt.Fprintf(os.Stderr, "\nWhen using --log, the server runs in background mode and all output\n")
 		fmt.Fprintf(os.Stderr, "is redirected to the log file. A PID file (.pid) is also created.\n")
-		fmt.Fprintf(os.Stderr, "Use 'kill $(cat logfile.pid)' to stop the background server.\n")
+		fmt.Fprintf(os.Stderr, "Use '%s status|stop|restart|logs --log=logfile' to manage the background server.\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Rotate its log with --log-max-size, --log-max-age and --log-max-backups.\n")
+		fmt.Fprintf(os.Stderr, "\nProject config:\n")
+		fmt.Fprintf(os.Stderr, "  Settings are read from redi.yaml in the root directory, overridden by\n")
+		fmt.Fprintf(os.Stderr, "  the development/production section, then REDI_* environment variables\n")
+		fmt.Fprintf(os.Stderr, "  (e.g. REDI_PORT), then flags given on the command line.\n")
+		fmt.Fprintf(os.Stderr, "\nSignals:\n")
+		fmt.Fprintf(os.Stderr, "  SIGINT, SIGTERM  Drain in-flight requests (--shutdown-timeout) and stop\n")
+		fmt.Fprintf(os.Stderr, "  SIGHUP           Reload routes, locale catalogs and redi.yaml\n")
+		fmt.Fprintf(os.Stderr, "  SIGUSR2          Restart, handing the listening sockets to the new process\n")
 	}
 
 	flag.Parse()
 
+	// Read the admin token from the environment only now, so it isn't shown
+	// as the default by --help
+	adminTokenSet := false
+	flag.Visit(func(f *flag.Flag) {
+		adminTokenSet = adminTokenSet || f.Name == "admin-token"
+	})
+	if !adminTokenSet {
+		adminToken = os.Getenv("REDI_ADMIN_TOKEN")
+	}
+
 	if version {
 		versionProvider := runtime.NewVersionProvider(Version)
 		fmt.Printf("redi version %s\n", versionProvider.GetVersion())
@@ -97,7 +188,8 @@ func main() {
 
 	// Handle cache clearing
 	if clearCache {
-		cachePath := root + "/.redi"
+		// Only the compilation cache; .redi also holds the kv store
+		cachePath := root + "/.redi/cache"
 		if err := os.RemoveAll(cachePath); err != nil {
 			fmt.Fprintf(os.Stderr, "Error clearing cache: %v\n", err)
 			os.Exit(1)
@@ -123,11 +215,32 @@ func main() {
 		EnableCache: enableCache,
 		Prebuild:    prebuild,
 		PrebuildParallel: prebuildParallel,
+		PrebuildReport: prebuildReport,
 		OnlyPrebuild: onlyPrebuild,
 		LogLevel:    logLevel,
 		LogFormat:   logFormat,
 		LogQuiet:    logQuiet,
+		DefaultLocale: defaultLocale,
+		DevMode:     devMode,
+		AccessLog:   accessLog,
+		EnableMetrics: enableMetrics,
+		AdminToken:  adminToken,
+		TLSCert:     tlsCert,
+		TLSKey:      tlsKey,
+		DevTLS:      devTLS,
+		HTTPRedirectPort: httpRedirectPort,
+		ShutdownTimeout: shutdownTimeout,
+		LogMaxSize:  logMaxSize * 1024 * 1024,
+		LogMaxAge:   logMaxAge,
+		LogMaxBackups: logMaxBackups,
+		ConfigFile:  configFile,
+		Environment: environment,
+		VirtualHosts: virtualHosts,
+		ExplicitFlags: map[string]bool{},
 	}
+	flag.Visit(func(f *flag.Flag) {
+		config.ExplicitFlags[f.Name] = true
+	})
 
 	launcher := server.NewLauncher()
 	if err := launcher.Start(config); err != nil {
@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"errors"
+	"io"
 	"io/fs"
 	"path/filepath"
 	"strings"
@@ -303,7 +304,7 @@ func (m *memoryFile) Stat() (fs.FileInfo, error) {
 
 func (m *memoryFile) Read(p []byte) (int, error) {
 	if m.pos >= len(m.data) {
-		return 0, errors.New("EOF")
+		return 0, io.EOF
 	}
 	
 	n := copy(p, m.data[m.pos:])
@@ -0,0 +1,417 @@
+package redi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/cache"
+	rediHandlers "github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/i18n"
+	"github.com/rediwo/redi/logging"
+)
+
+// DefaultShutdownTimeout is how long in-flight requests may take to finish
+// when the server is stopped
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Environment variables used to hand the listening sockets to a restarted
+// process. Inherited sockets start at file descriptor 3 in the order of the
+// addresses listed in REDI_LISTENERS.
+const (
+	listenersEnv = "REDI_LISTENERS"
+	readyFDEnv   = "REDI_READY_FD"
+)
+
+// restartReadyTimeout bounds how long Restart waits for the new process
+const restartReadyTimeout = 30 * time.Second
+
+// restartSettleDelay gives connections accepted just before the handoff time
+// to send their request; net/http drops requests read after Shutdown starts
+const restartSettleDelay = 500 * time.Millisecond
+
+var (
+	inheritedOnce      sync.Once
+	inheritedMutex     sync.Mutex
+	inheritedListeners map[string]net.Listener
+)
+
+// SetShutdownTimeout sets how long Stop waits for in-flight requests to finish
+// before closing the remaining connections
+func (s *Server) SetShutdownTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until
+// ctx is done, then stops the JavaScript engines and persists the cache index
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.redirectServer != nil {
+		s.redirectServer.Shutdown(ctx)
+	}
+	if s.httpServer != nil {
+		// Listeners already closed by a restart are not an error
+		if err = s.httpServer.Shutdown(ctx); errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
+		if err != nil {
+			logging.Warn("Drain timed out, closing remaining connections", "error", err)
+			s.httpServer.Close()
+		}
+	}
+
+	// A background pre-build stops after the components being compiled
+	if precompiler := s.precompiler.Load(); precompiler != nil {
+		precompiler.Stop()
+	}
+	// A reload in progress finishes before its cache is closed
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	rediHandlers.StopJSEnginePool(s.fs, s.version)
+	if sitesErr := s.closeSites(); sitesErr != nil && err == nil {
+		err = sitesErr
+	}
+
+	if s.cacheManager != nil {
+		if cacheErr := s.cacheManager.Close(); cacheErr != nil {
+			logging.Error("Failed to persist cache index", "error", cacheErr)
+			if err == nil {
+				err = cacheErr
+			}
+		}
+	}
+
+	logging.Info("Server stopped")
+	return err
+}
+
+// Reload rescans routes and locale catalogs and swaps in a new router without
+// dropping connections, for the main site and every virtual host, and
+// rebuilds the middleware with the current settings. On failure the previous
+// routes of that site stay active.
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	err := s.reloadRoutes()
+	for _, site := range s.siteServers() {
+		if siteErr := site.reloadRoutes(); siteErr != nil {
+			logging.Error("Failed to reload virtual host", "root", site.fs.GetRoot(), "error", siteErr)
+			if err == nil {
+				err = siteErr
+			}
+		}
+	}
+	// Responses rendered from the previous files are stale; a rebuilt
+	// chain starts with an empty response cache
+	if s.chain.Load() != nil {
+		s.buildChain()
+	} else if responseCache := s.responseCache.Load(); responseCache != nil {
+		responseCache.Clear()
+	}
+	return err
+}
+
+// siteState is what a site serves requests with: its router and the
+// handlers, routes and caches the router was built with. Reload builds a
+// new state and publishes it at once, so a request never sees half of a
+// reload, and the replaced state is closed once its requests are done.
+type siteState struct {
+	router         *mux.Router
+	handlerManager *HandlerManager
+	routes         []Route
+	cacheManager   *cache.CacheManager
+	svelteCache    *cache.SvelteCache
+
+	refs      atomic.Int64 // Requests using the state
+	retired   atomic.Bool  // Replaced by a reload
+	closeOnce sync.Once
+}
+
+// publish makes the routes set up last the active state and returns the
+// state it replaced, if any
+func (s *Server) publish() *siteState {
+	return s.active.Swap(&siteState{
+		router:         s.router,
+		handlerManager: s.handlerManager,
+		routes:         s.routes,
+		cacheManager:   s.cacheManager,
+		svelteCache:    s.svelteCache,
+	})
+}
+
+// current returns the active state. Before the server starts it is the
+// state being set up.
+func (s *Server) current() *siteState {
+	if state := s.active.Load(); state != nil {
+		return state
+	}
+	return &siteState{
+		router:         s.router,
+		handlerManager: s.handlerManager,
+		routes:         s.routes,
+		cacheManager:   s.cacheManager,
+		svelteCache:    s.svelteCache,
+	}
+}
+
+// acquire returns the active state and keeps it open until release
+func (s *Server) acquire() *siteState {
+	for {
+		state := s.current()
+		state.refs.Add(1)
+		// A state replaced before it was acquired may already be closed
+		if s.active.Load() == state || s.active.Load() == nil {
+			return state
+		}
+		state.release()
+	}
+}
+
+// serveActive serves a request with the active state
+func (s *Server) serveActive(w http.ResponseWriter, r *http.Request) {
+	state := s.acquire()
+	defer state.release()
+	state.router.ServeHTTP(w, r)
+}
+
+// release ends a use of the state and closes it when it was the last use
+// of a replaced state
+func (st *siteState) release() {
+	if st.refs.Add(-1) == 0 && st.retired.Load() {
+		st.closeOnce.Do(st.close)
+	}
+}
+
+// retire marks a replaced state and closes it once no request uses it
+func (st *siteState) retire() {
+	st.retired.Store(true)
+	if st.refs.Load() == 0 {
+		st.closeOnce.Do(st.close)
+	}
+}
+
+// close persists and closes the state's cache
+func (st *siteState) close() {
+	if st.cacheManager != nil {
+		st.cacheManager.Close()
+	}
+}
+
+// reloadRoutes rebuilds the routes of one site
+func (s *Server) reloadRoutes() error {
+	if err := i18n.ForFileSystem(s.fs).Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.Warn("Failed to reload locale catalogs", "error", err)
+	}
+
+	// Persist the current cache index so the new manager reads it; the
+	// current one keeps serving until the new routes are live
+	if s.cacheManager != nil {
+		s.cacheManager.Save()
+	}
+
+	oldRouter, oldHandlerManager, oldRoutes := s.router, s.handlerManager, s.routes
+	oldCacheManager, oldSvelteCache := s.cacheManager, s.svelteCache
+	s.router = mux.NewRouter()
+	s.cacheManager, s.svelteCache = nil, nil
+	if err := s.setupRoutes(); err != nil {
+		if s.cacheManager != nil {
+			s.cacheManager.Close()
+		}
+		s.router, s.handlerManager, s.routes = oldRouter, oldHandlerManager, oldRoutes
+		s.cacheManager, s.svelteCache = oldCacheManager, oldSvelteCache
+		return err
+	}
+
+	// The old cache is closed once the requests using it are done
+	if old := s.publish(); old != nil {
+		old.retire()
+	} else if oldCacheManager != nil {
+		oldCacheManager.Close()
+	}
+	logging.Info("Configuration reloaded", "routes", len(s.routes))
+	return nil
+}
+
+// Restart starts a new copy of the current process that takes over the
+// listening sockets, and returns once it is serving. The caller should then
+// shut this server down, so no connection is refused during the handoff.
+func (s *Server) Restart() error {
+	var files []*os.File
+	var addrs []string
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	listeners := map[string]net.Listener{}
+	if s.listener != nil {
+		listeners[s.httpServer.Addr] = s.listener
+	}
+	if s.redirectListener != nil {
+		listeners[s.redirectServer.Addr] = s.redirectListener
+	}
+	for addr, listener := range listeners {
+		tcpListener, ok := listener.(*net.TCPListener)
+		if !ok {
+			return fmt.Errorf("cannot hand off listener of type %T", listener)
+		}
+		file, err := tcpListener.File()
+		if err != nil {
+			return fmt.Errorf("failed to duplicate listener: %w", err)
+		}
+		files = append(files, file)
+		addrs = append(addrs, addr)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("server is not listening")
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyWriter)
+	cmd.Env = append(restartEnv(os.Environ()),
+		listenersEnv+"="+strings.Join(addrs, ","),
+		fmt.Sprintf("%s=%d", readyFDEnv, 3+len(files)))
+
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(readyReader).ReadString('\n')
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("new process exited before it was ready")
+		}
+	case <-time.After(restartReadyTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("new process not ready after %s", restartReadyTimeout)
+	}
+
+	// The new process outlives this one
+	logging.Info("Handed off listeners to new process", "pid", cmd.Process.Pid)
+	cmd.Process.Release()
+
+	// Stop accepting so every new connection goes to the new process
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	time.Sleep(restartSettleDelay)
+	return nil
+}
+
+// restartEnv drops handoff variables inherited from an earlier restart
+func restartEnv(env []string) []string {
+	result := make([]string, 0, len(env))
+	for _, entry := range env {
+		if strings.HasPrefix(entry, listenersEnv+"=") || strings.HasPrefix(entry, readyFDEnv+"=") {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// listen returns the listener inherited for addr, or opens a new one
+func listen(addr string) (net.Listener, error) {
+	inheritedOnce.Do(loadInheritedListeners)
+
+	inheritedMutex.Lock()
+	listener, ok := inheritedListeners[addr]
+	delete(inheritedListeners, addr)
+	inheritedMutex.Unlock()
+
+	if ok {
+		logging.Info("Using inherited listener", "address", addr)
+		return listener, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// loadInheritedListeners picks up the sockets passed by Restart
+func loadInheritedListeners() {
+	inheritedListeners = make(map[string]net.Listener)
+
+	value := os.Getenv(listenersEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(listenersEnv)
+
+	for i, addr := range strings.Split(value, ",") {
+		file := os.NewFile(uintptr(3+i), "listener-"+addr)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			logging.Error("Failed to use inherited listener", "address", addr, "error", err)
+			continue
+		}
+		inheritedListeners[addr] = listener
+	}
+}
+
+// notifyReady tells the process that started this one through Restart that
+// the listeners are in use, and closes inherited listeners nobody claimed
+func notifyReady() {
+	inheritedOnce.Do(loadInheritedListeners)
+
+	inheritedMutex.Lock()
+	for addr, listener := range inheritedListeners {
+		listener.Close()
+		delete(inheritedListeners, addr)
+	}
+	inheritedMutex.Unlock()
+
+	value := os.Getenv(readyFDEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(readyFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+	file := os.NewFile(uintptr(fd), "ready")
+	fmt.Fprintln(file, "ready")
+	file.Close()
+}
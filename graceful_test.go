@@ -0,0 +1,159 @@
+package redi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+	rediHandlers "github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/middleware"
+)
+
+func TestServerReload(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/index.html", []byte(`<h1>Home</h1>`))
+
+	server := &Server{
+		router:    mux.NewRouter(),
+		port:      8080,
+		fs:        memFS,
+		routesDir: "routes",
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	server.publish()
+
+	serve := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.serveActive(w, req)
+		return w.Code
+	}
+
+	if code := serve("/about"); code != http.StatusNotFound {
+		t.Fatalf("Expected 404 before the route exists, got %d", code)
+	}
+
+	memFS.WriteFile("routes/about.html", []byte(`<h1>About</h1>`))
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if code := serve("/about"); code != http.StatusOK {
+		t.Errorf("Expected 200 after reload, got %d", code)
+	}
+	if len(server.routes) != 2 {
+		t.Errorf("Expected 2 routes after reload, got %d", len(server.routes))
+	}
+}
+
+func TestServerShutdownStopsEnginePool(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	server := &Server{
+		router:    mux.NewRouter(),
+		port:      8080,
+		fs:        memFS,
+		routesDir: "routes",
+	}
+
+	pool := rediHandlers.GetJSEnginePool(memFS, "")
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if rediHandlers.GetJSEnginePool(memFS, "") == pool {
+		t.Error("Expected the engine pool to be stopped and replaced")
+	}
+}
+
+func TestServerReloadDuringRequests(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/index.html", []byte(`<h1>Home</h1>`))
+
+	server := &Server{
+		router:    mux.NewRouter(),
+		port:      8080,
+		fs:        memFS,
+		routesDir: "routes",
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	server.publish()
+
+	// A request in flight keeps the state it started with
+	state := server.acquire()
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if server.current() == state || !state.retired.Load() {
+		t.Fatal("Expected the reload to replace the state")
+	}
+	w := httptest.NewRecorder()
+	state.router.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the replaced routes to keep serving, got %d", w.Code)
+	}
+	state.release()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				w := httptest.NewRecorder()
+				server.serveActive(w, httptest.NewRequest("GET", "/", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("Expected 200 during reloads, got %d", w.Code)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := server.Reload(); err != nil {
+			t.Errorf("Reload failed: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestServerReloadRebuildsMiddleware(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/index.html", []byte(`<h1>Home</h1>`))
+
+	server := &Server{
+		router:    mux.NewRouter(),
+		port:      8080,
+		fs:        memFS,
+		routesDir: "routes",
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	server.publish()
+	server.buildChain()
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.serveChain(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	if frame := serve().Header().Get("X-Frame-Options"); frame != "" {
+		t.Fatalf("Expected no security headers before the reload, got %q", frame)
+	}
+
+	server.SetSecurityConfig(&middleware.SecurityConfig{FrameOptions: "DENY"})
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if frame := serve().Header().Get("X-Frame-Options"); frame != "DENY" {
+		t.Errorf("Expected the reloaded security settings to apply, got %q", frame)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"github.com/rediwo/redi/filesystem"
 	"github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/middleware"
 	"github.com/gorilla/mux"
 )
 
@@ -33,9 +34,17 @@ func NewHandlerManagerWithVersion(fs filesystem.FileSystem, version string) *Han
 
 // NewHandlerManagerWithServer creates a HandlerManager with server access for route registration
 func NewHandlerManagerWithServer(fs filesystem.FileSystem, version string, router *mux.Router, routesDir string) *HandlerManager {
-	// Create template config with Vimesh Style enabled
-	templateConfig := handlers.DefaultTemplateConfig()
-	templateConfig.VimeshStyle.Enable = true
+	return NewHandlerManagerWithConfig(fs, version, router, routesDir, nil, nil)
+}
+
+// NewHandlerManagerWithConfig creates a HandlerManager with custom template and
+// Svelte settings; nil selects the defaults
+func NewHandlerManagerWithConfig(fs filesystem.FileSystem, version string, router *mux.Router, routesDir string, templateConfig *handlers.TemplateConfig, svelteConfig *handlers.SvelteConfig) *HandlerManager {
+	if templateConfig == nil {
+		// Create template config with Vimesh Style enabled
+		templateConfig = handlers.DefaultTemplateConfig()
+		templateConfig.VimeshStyle.Enable = true
+	}
 	
 	templateHandler := handlers.NewTemplateHandlerWithRouter(fs, templateConfig, router)
 	
@@ -45,19 +54,35 @@ func NewHandlerManagerWithServer(fs filesystem.FileSystem, version string, route
 	// Set error handler on JavaScript handler
 	jsHandler.SetErrorHandler(errorHandler)
 	
-	// Create Svelte config
-	svelteConfig := handlers.DefaultSvelteConfig()
+	if svelteConfig == nil {
+		svelteConfig = handlers.DefaultSvelteConfig()
+	}
+	svelteHandler := handlers.NewSvelteHandlerWithRouterAndRoutesDir(fs, svelteConfig, router, routesDir)
+	svelteHandler.SetErrorHandler(errorHandler)
 	
 	return &HandlerManager{
 		fs:              fs,
 		jsHandler:       jsHandler,
 		templateHandler: templateHandler,
-		svelteHandler:   handlers.NewSvelteHandlerWithRouterAndRoutesDir(fs, svelteConfig, router, routesDir),
+		svelteHandler:   svelteHandler,
 		errorHandler:    errorHandler,
 		routesDir:       routesDir,
 	}
 }
 
+// SetDevMode enables detailed error pages for all handlers
+func (hm *HandlerManager) SetDevMode(devMode bool) {
+	if hm.errorHandler != nil {
+		hm.errorHandler.SetDevMode(devMode)
+	}
+}
+
+// SetRateLimitConfig sets the defaults for rate limits declared by
+// JavaScript routes
+func (hm *HandlerManager) SetRateLimitConfig(config *middleware.RateLimitConfig) {
+	hm.jsHandler.SetRateLimitConfig(config)
+}
+
 // RegisterAdditionalRoutes registers any additional routes that handlers need
 func (hm *HandlerManager) RegisterAdditionalRoutes(router *mux.Router) {
 	if hm.svelteHandler != nil {
@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
 )
 
 // ErrorHandler handles HTTP errors with custom error pages
@@ -18,6 +22,7 @@ type ErrorHandler struct {
 	templateHandler *TemplateHandler
 	cache          map[int]*template.Template
 	routesDir      string
+	devMode        bool
 }
 
 // NewErrorHandler creates a new error handler
@@ -48,6 +53,42 @@ type ErrorData struct {
 	Path        string
 	Method      string
 	RequestID   string
+	Details     *ErrorDetails // Only set in development mode
+}
+
+// ErrorDetails describes an error for the development error page
+type ErrorDetails struct {
+	Kind       string
+	Error      string
+	File       string
+	Line       int
+	Column     int
+	Frame      string
+	Source     []SourceLine
+	Stack      []StackFrame
+	Query      string
+	RemoteAddr string
+	Headers    http.Header
+}
+
+// SourceLine is one line of a source excerpt
+type SourceLine struct {
+	Number    int
+	Text      string
+	Highlight bool
+}
+
+// sourceContextLines is the number of lines shown around the failing line
+const sourceContextLines = 3
+
+// SetDevMode enables detailed error pages with stack traces and source excerpts
+func (eh *ErrorHandler) SetDevMode(devMode bool) {
+	eh.devMode = devMode
+}
+
+// DevMode reports whether detailed error pages are enabled
+func (eh *ErrorHandler) DevMode() bool {
+	return eh.devMode
 }
 
 // ServeError serves an error response with the given status code and message
@@ -62,6 +103,7 @@ func (eh *ErrorHandler) ServeError(w http.ResponseWriter, r *http.Request, statu
 		Message:    message,
 		Path:       r.URL.Path,
 		Method:     r.Method,
+		RequestID:  middleware.RequestIDFromContext(r.Context()),
 	}
 	
 	// Buffer the response to ensure proper gzip handling
@@ -232,10 +274,250 @@ func (eh *ErrorHandler) Handle404(w http.ResponseWriter, r *http.Request) {
 
 // Handle500 is a convenience method for 500 errors
 func (eh *ErrorHandler) Handle500(w http.ResponseWriter, r *http.Request, err error) {
-	message := "An internal server error occurred."
 	if err != nil {
-		// In production, you might want to hide error details
-		message = fmt.Sprintf("Internal Server Error: %v", err)
+		logging.Error("Internal server error", "path", r.URL.Path, "error", err, "request_id", middleware.RequestIDFromContext(r.Context()))
+		if eh.devMode {
+			eh.serveDevError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	eh.ServeError(w, r, http.StatusInternalServerError, "An internal server error occurred.")
+}
+
+// HandleError serves the error page for a handler error. The status is derived
+// from the error type. In development mode server errors are shown with their
+// stack trace and source excerpt; in production the message is sanitized.
+func (eh *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusForError(err)
+	if status < http.StatusInternalServerError {
+		message := http.StatusText(status)
+		if eh.devMode {
+			message = err.Error()
+		}
+		eh.ServeError(w, r, status, message)
+		return
+	}
+	eh.Handle500(w, r, err)
+}
+
+// serveDevError renders the development error page
+func (eh *ErrorHandler) serveDevError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	errorData := ErrorData{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Message:    err.Error(),
+		Path:       r.URL.Path,
+		Method:     r.Method,
+		RequestID:  middleware.RequestIDFromContext(r.Context()),
+		Details:    eh.errorDetails(r, err),
+	}
+
+	var buf bytes.Buffer
+	if execErr := devErrorTemplate.Execute(&buf, errorData); execErr != nil {
+		log.Printf("Error rendering development error page: %v", execErr)
+		buf.Reset()
+		eh.writeSimpleError(&buf, errorData)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// redactedHeaders are the request headers whose values the development
+// error page hides, since a page shared to report a bug would leak them
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// errorDetails collects the location, source excerpt and stack of an error
+func (eh *ErrorHandler) errorDetails(r *http.Request, err error) *ErrorDetails {
+	details := &ErrorDetails{
+		Kind:       "Error",
+		Error:      err.Error(),
+		Query:      r.URL.RawQuery,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    redactHeaders(r.Header),
+	}
+
+	var compileErr *CompileError
+	var execErr *ExecutionError
+	var notFound *NotFoundError
+	var timeout *TimeoutError
+
+	switch {
+	case errors.As(err, &compileErr):
+		details.Kind = "Compile Error"
+		details.Error = compileErr.Message
+		details.File = compileErr.Path
+		details.Line = compileErr.Line
+		details.Column = compileErr.Column
+		details.Frame = compileErr.Frame
+	case errors.As(err, &execErr):
+		details.Kind = "Runtime Error"
+		details.Error = execErr.Message
+		details.File = execErr.Path
+		details.Stack = execErr.Stack
+		// Point at the innermost frame that has readable source
+		for _, frame := range execErr.Stack {
+			if _, statErr := eh.fs.Stat(frame.File); statErr == nil {
+				details.File = frame.File
+				details.Line = frame.Line
+				details.Column = frame.Column
+				break
+			}
+		}
+	case errors.As(err, &notFound):
+		details.Kind = "Not Found"
+		details.File = notFound.Path
+	case errors.As(err, &timeout):
+		details.Kind = "Timeout"
+		details.File = timeout.Path
+	}
+
+	if details.Line > 0 && details.Frame == "" {
+		details.Source = eh.sourceExcerpt(details.File, details.Line)
+	}
+	return details
+}
+
+// redactHeaders returns a copy of header with the values of the
+// redactedHeaders replaced
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if values := redacted.Values(name); len(values) > 0 {
+			redacted.Set(name, "[redacted]")
+		}
+	}
+	return redacted
+}
+
+// sourceExcerpt returns the lines around line in file, or nil if unreadable
+func (eh *ErrorHandler) sourceExcerpt(file string, line int) []SourceLine {
+	content, err := eh.fs.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if line > len(lines) {
+		return nil
 	}
-	eh.ServeError(w, r, http.StatusInternalServerError, message)
-}
\ No newline at end of file
+
+	start := max(line-sourceContextLines, 1)
+	end := min(line+sourceContextLines, len(lines))
+	excerpt := make([]SourceLine, 0, end-start+1)
+	for n := start; n <= end; n++ {
+		excerpt = append(excerpt, SourceLine{
+			Number:    n,
+			Text:      lines[n-1],
+			Highlight: n == line,
+		})
+	}
+	return excerpt
+}
+
+// devErrorTemplate is the development error page
+var devErrorTemplate = template.Must(template.New("dev-error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Status}} {{.Details.Kind}}</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            margin: 0;
+            padding: 40px;
+            background-color: #1e1e1e;
+            color: #ddd;
+        }
+        h1 {
+            font-size: 14px;
+            font-weight: normal;
+            color: #ff6b6b;
+            text-transform: uppercase;
+            letter-spacing: 1px;
+            margin: 0 0 10px 0;
+        }
+        h2 {
+            font-size: 22px;
+            margin: 0 0 10px 0;
+            color: #fff;
+            white-space: pre-wrap;
+        }
+        h3 {
+            font-size: 14px;
+            color: #999;
+            margin: 30px 0 10px 0;
+        }
+        .location {
+            font-family: Consolas, Monaco, monospace;
+            color: #9cdcfe;
+        }
+        pre, .source {
+            font-family: Consolas, Monaco, monospace;
+            font-size: 13px;
+            background-color: #252526;
+            border-radius: 4px;
+            padding: 12px 0;
+            margin: 0;
+            overflow-x: auto;
+        }
+        pre {
+            padding: 12px;
+        }
+        .source div {
+            white-space: pre;
+            padding: 0 12px;
+        }
+        .source .highlight {
+            background-color: #5a1d1d;
+        }
+        .source .number {
+            display: inline-block;
+            width: 40px;
+            color: #777;
+            text-align: right;
+            margin-right: 12px;
+        }
+        table {
+            border-collapse: collapse;
+            font-family: Consolas, Monaco, monospace;
+            font-size: 13px;
+        }
+        td {
+            padding: 2px 12px 2px 0;
+            vertical-align: top;
+        }
+        td:first-child {
+            color: #999;
+        }
+    </style>
+</head>
+<body>
+    <h1>{{.Status}} {{.Details.Kind}}</h1>
+    <h2>{{.Details.Error}}</h2>
+    {{if .Details.File}}<div class="location">{{.Details.File}}{{if .Details.Line}}:{{.Details.Line}}:{{.Details.Column}}{{end}}</div>{{end}}
+    {{if .Details.Frame}}
+    <h3>Source</h3>
+    <pre>{{.Details.Frame}}</pre>
+    {{else if .Details.Source}}
+    <h3>Source</h3>
+    <div class="source">{{range .Details.Source}}<div{{if .Highlight}} class="highlight"{{end}}><span class="number">{{.Number}}</span>{{.Text}}</div>{{end}}</div>
+    {{end}}
+    {{if .Details.Stack}}
+    <h3>Stack Trace</h3>
+    <table>{{range .Details.Stack}}<tr><td>{{if .Function}}{{.Function}}{{else}}&lt;anonymous&gt;{{end}}</td><td>{{.File}}:{{.Line}}:{{.Column}}</td></tr>{{end}}</table>
+    {{end}}
+    <h3>Request</h3>
+    <table>
+        <tr><td>Method</td><td>{{.Method}}</td></tr>
+        <tr><td>Path</td><td>{{.Path}}</td></tr>
+        {{if .Details.Query}}<tr><td>Query</td><td>{{.Details.Query}}</td></tr>{{end}}
+        {{if .RequestID}}<tr><td>Request ID</td><td>{{.RequestID}}</td></tr>{{end}}
+        <tr><td>Remote Address</td><td>{{.Details.RemoteAddr}}</td></tr>
+        {{range $name, $values := .Details.Headers}}<tr><td>{{$name}}</td><td>{{range $values}}{{.}} {{end}}</td></tr>{{end}}
+    </table>
+</body>
+</html>`))
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rediwo/redi/filesystem"
+)
+
+func TestJSEngine_CompileErrorPosition(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("broken.js", []byte("exports.get = function(req, res) {\n  res.send('ok'\n};\n"))
+
+	engine, err := GetJSEnginePool(fs, "").GetEngineForSession("compile-test")
+	if err != nil {
+		t.Fatalf("Failed to get engine: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/broken", nil)
+	w := httptest.NewRecorder()
+	err = engine.ExecuteHTTPMethod(req, w, Route{FilePath: "broken.js"})
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("Expected CompileError, got %T: %v", err, err)
+	}
+	if compileErr.Path != "broken.js" {
+		t.Errorf("Expected path broken.js, got %s", compileErr.Path)
+	}
+	if compileErr.Line != 3 {
+		t.Errorf("Expected error on line 3, got %d (%v)", compileErr.Line, compileErr)
+	}
+	if StatusForError(err) != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", StatusForError(err))
+	}
+}
+
+func TestJSEngine_ExecutionErrorStack(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("throws.js", []byte("function fail() {\n  throw new Error('boom');\n}\nexports.get = function(req, res) {\n  fail();\n};\n"))
+
+	engine, err := GetJSEnginePool(fs, "").GetEngineForSession("execution-test")
+	if err != nil {
+		t.Fatalf("Failed to get engine: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/throws", nil)
+	w := httptest.NewRecorder()
+	err = engine.ExecuteHTTPMethod(req, w, Route{FilePath: "throws.js"})
+
+	var execErr *ExecutionError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("Expected ExecutionError, got %T: %v", err, err)
+	}
+	if execErr.Message != "Error: boom" {
+		t.Errorf("Expected message 'Error: boom', got %q", execErr.Message)
+	}
+	if len(execErr.Stack) == 0 {
+		t.Fatal("Expected stack frames")
+	}
+	top := execErr.Stack[0]
+	if top.File != "throws.js" || top.Line != 2 || top.Function != "fail" {
+		t.Errorf("Expected top frame fail at throws.js:2, got %+v", top)
+	}
+}
+
+func TestJSEngine_NotFoundError(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+
+	engine, err := GetJSEnginePool(fs, "").GetEngineForSession("missing-test")
+	if err != nil {
+		t.Fatalf("Failed to get engine: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/missing", nil)
+	w := httptest.NewRecorder()
+	err = engine.ExecuteHTTPMethod(req, w, Route{FilePath: "missing.js"})
+
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected NotFoundError, got %T: %v", err, err)
+	}
+	if StatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", StatusForError(err))
+	}
+}
+
+func TestErrorHandler_DevMode(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("routes/throws.js", []byte("exports.get = function(req, res) {\n  var x = 1;\n  throw new Error('secret failure');\n};\n"))
+
+	errorHandler := NewErrorHandlerWithRoutesDir(fs, nil, "routes")
+	errorHandler.SetDevMode(true)
+	handler := NewJavaScriptHandler(fs)
+	handler.SetErrorHandler(errorHandler)
+
+	req := httptest.NewRequest("GET", "/throws", nil)
+	req.Header.Set("Cookie", "session=secret-session")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	handler.Handle(Route{FilePath: "routes/throws.js"})(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, secret := range []string{"secret-session", "secret-token"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Expected the dev error page to redact %q", secret)
+		}
+	}
+	if req.Header.Get("Cookie") != "session=secret-session" {
+		t.Error("Expected the request headers to be left alone")
+	}
+	expected := []string{
+		"[redacted]",
+		"<td>Accept-Language</td><td>de </td>",
+		"Runtime Error",
+		"secret failure",
+		"routes/throws.js:3:",
+		"throw new Error(&#39;secret failure&#39;);",
+		`class="highlight"`,
+		"Stack Trace",
+	}
+	for _, text := range expected {
+		if !strings.Contains(body, text) {
+			t.Errorf("Expected dev error page to contain %q, got: %s", text, body)
+		}
+	}
+}
+
+func TestErrorHandler_ProductionSanitized(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("routes/throws.js", []byte("exports.get = function(req, res) {\n  throw new Error('secret failure');\n};\n"))
+	fs.WriteFile("routes/5xx.html", []byte(`<h1>{{.Status}}</h1><p>{{.Message}}</p>`))
+
+	errorHandler := NewErrorHandlerWithRoutesDir(fs, nil, "routes")
+	handler := NewJavaScriptHandler(fs)
+	handler.SetErrorHandler(errorHandler)
+
+	req := httptest.NewRequest("GET", "/throws", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(Route{FilePath: "routes/throws.js"})(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "secret failure") {
+		t.Errorf("Production error page leaked error details: %s", body)
+	}
+	if !strings.Contains(body, "<h1>500</h1><p>An internal server error occurred.</p>") {
+		t.Errorf("Expected 5xx template output, got: %s", body)
+	}
+}
+
+func TestSvelteHandler_CompileErrorPosition(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	handler := NewSvelteHandler(fs)
+
+	source := "<script>\n  let count = 0;\n</script>\n\n<div>{count</div>\n"
+	_, err := handler.compileSvelte(source, "Broken.svelte")
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("Expected CompileError, got %T: %v", err, err)
+	}
+	if compileErr.Line != 5 {
+		t.Errorf("Expected error on line 5, got %d (%v)", compileErr.Line, compileErr)
+	}
+	if compileErr.Column < 1 {
+		t.Errorf("Expected a 1-based column, got %d", compileErr.Column)
+	}
+	if compileErr.Frame == "" {
+		t.Error("Expected a code frame from the Svelte compiler")
+	}
+	if strings.HasSuffix(compileErr.Message, ")") {
+		t.Errorf("Expected position suffix to be stripped from message, got %q", compileErr.Message)
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	js "github.com/dop251/goja"
+)
+
+// parseErrorPattern matches goja parser messages such as "file.js: Line 3:1 Unexpected token }"
+var parseErrorPattern = regexp.MustCompile(`^(?:.*?: )?Line (\d+):(\d+) (.*)$`)
+
+// StackFrame is a single frame of a JavaScript stack trace
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// NotFoundError indicates that the file backing a route does not exist
+type NotFoundError struct {
+	Path string
+	Err  error
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("file not found: %s", e.Path)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// CompileError indicates that JavaScript or Svelte source failed to compile
+type CompileError struct {
+	Path    string
+	Message string
+	Line    int
+	Column  int
+	Frame   string // Compiler-provided code frame, if any
+	Err     error
+}
+
+func (e *CompileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("failed to compile %s:%d:%d: %s", e.Path, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("failed to compile %s: %s", e.Path, e.Message)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// ExecutionError indicates that a JavaScript exception was thrown
+type ExecutionError struct {
+	Path    string
+	Message string
+	Stack   []StackFrame
+	Err     error
+}
+
+func (e *ExecutionError) Error() string {
+	if len(e.Stack) > 0 {
+		top := e.Stack[0]
+		return fmt.Sprintf("failed to execute %s: %s (at %s:%d:%d)", e.Path, e.Message, top.File, top.Line, top.Column)
+	}
+	return fmt.Sprintf("failed to execute %s: %s", e.Path, e.Message)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// MethodNotAllowedError indicates that a route does not export a handler for the method
+type MethodNotAllowedError struct {
+	Method string
+}
+
+func (e *MethodNotAllowedError) Error() string {
+	return fmt.Sprintf("method_not_allowed:%s", e.Method)
+}
+
+// TimeoutError indicates that a handler did not respond in time
+type TimeoutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request timeout after %s in %s", e.Timeout, e.Path)
+}
+
+// RequestTooLargeError indicates that a request body exceeded the route's limit
+type RequestTooLargeError struct {
+	Path  string
+	Limit int64
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("request body larger than %d bytes for %s", e.Limit, e.Path)
+}
+
+// StatusForError maps a handler error to its HTTP status code
+func StatusForError(err error) int {
+	var notFound *NotFoundError
+	var methodNotAllowed *MethodNotAllowedError
+	var timeout *TimeoutError
+	var tooLarge *RequestTooLargeError
+
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &methodNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.As(err, &timeout):
+		return http.StatusRequestTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newNotFoundError wraps err as a NotFoundError if it reports a missing file
+func newNotFoundError(path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return &NotFoundError{Path: path, Err: err}
+	}
+	return err
+}
+
+// newCompileError converts a goja compile error into a CompileError.
+// lineOffset and columnOffset correct for code prepended by module wrappers;
+// columnOffset only applies to the first line.
+func newCompileError(path string, err error, lineOffset, columnOffset int) *CompileError {
+	compileErr := &CompileError{Path: path, Message: err.Error(), Err: err}
+
+	var syntaxErr *js.CompilerSyntaxError
+	if errors.As(err, &syntaxErr) {
+		compileErr.Message = syntaxErr.Message
+		if syntaxErr.File != nil {
+			position := syntaxErr.File.Position(syntaxErr.Offset)
+			compileErr.Line, compileErr.Column = adjustPosition(position.Line, position.Column, lineOffset, columnOffset)
+		} else if match := parseErrorPattern.FindStringSubmatch(syntaxErr.Message); match != nil {
+			// Parser errors only carry their position in the message
+			line, _ := strconv.Atoi(match[1])
+			column, _ := strconv.Atoi(match[2])
+			compileErr.Line, compileErr.Column = adjustPosition(line, column, lineOffset, columnOffset)
+			compileErr.Message = match[3]
+		}
+	}
+	return compileErr
+}
+
+// newExecutionError converts a goja exception into an ExecutionError with a
+// stack trace. Frames in path are adjusted for the module wrapper offsets.
+func newExecutionError(path string, err error, lineOffset, columnOffset int) *ExecutionError {
+	execErr := &ExecutionError{Path: path, Message: err.Error(), Err: err}
+
+	var exception *js.Exception
+	if !errors.As(err, &exception) {
+		return execErr
+	}
+
+	if value := exception.Value(); value != nil {
+		if obj, ok := value.(*js.Object); ok {
+			if message := obj.Get("message"); message != nil && !js.IsUndefined(message) {
+				execErr.Message = message.String()
+				if name := obj.Get("name"); name != nil && !js.IsUndefined(name) {
+					execErr.Message = name.String() + ": " + execErr.Message
+				}
+			}
+		} else {
+			execErr.Message = value.String()
+		}
+	}
+
+	for _, frame := range exception.Stack() {
+		position := frame.Position()
+		if position.Line == 0 {
+			continue // Native Go frames have no source position
+		}
+		line, column := position.Line, position.Column
+		if frame.SrcName() == path {
+			line, column = adjustPosition(line, column, lineOffset, columnOffset)
+		}
+		execErr.Stack = append(execErr.Stack, StackFrame{
+			Function: frame.FuncName(),
+			File:     frame.SrcName(),
+			Line:     line,
+			Column:   column,
+		})
+	}
+	return execErr
+}
+
+// adjustPosition maps a position in wrapped source back to the original file
+func adjustPosition(line, column, lineOffset, columnOffset int) (int, int) {
+	if line == lineOffset+1 {
+		column -= columnOffset
+		if column < 1 {
+			column = 1
+		}
+	}
+	line -= lineOffset
+	if line < 1 {
+		line = 1
+	}
+	return line, column
+}
+
+// newSvelteCompileError extracts line, column and code frame from a Svelte
+// CompileError thrown by the compiler
+func newSvelteCompileError(path string, err error, vm *js.Runtime) *CompileError {
+	compileErr := &CompileError{Path: path, Message: err.Error(), Err: err}
+
+	var exception *js.Exception
+	if !errors.As(err, &exception) || vm == nil {
+		return compileErr
+	}
+	obj, ok := exception.Value().(*js.Object)
+	if !ok {
+		return compileErr
+	}
+
+	if message := obj.Get("message"); message != nil && !js.IsUndefined(message) {
+		// Svelte appends " (line:column)" to the message; the position is reported separately
+		msg := message.String()
+		if idx := strings.LastIndex(msg, " ("); idx > 0 && strings.HasSuffix(msg, ")") {
+			msg = msg[:idx]
+		}
+		compileErr.Message = msg
+	}
+	if start := obj.Get("start"); start != nil && !js.IsUndefined(start) && !js.IsNull(start) {
+		startObj := start.ToObject(vm)
+		if line := startObj.Get("line"); line != nil && !js.IsUndefined(line) {
+			compileErr.Line = int(line.ToInteger())
+		}
+		if column := startObj.Get("column"); column != nil && !js.IsUndefined(column) {
+			// Svelte columns are zero-based
+			compileErr.Column = int(column.ToInteger()) + 1
+		}
+	}
+	if frame := obj.Get("frame"); frame != nil && !js.IsUndefined(frame) {
+		compileErr.Frame = frame.String()
+	}
+	return compileErr
+}
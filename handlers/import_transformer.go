@@ -95,6 +95,33 @@ func (it *ImportTransformer) TransformImports(jsCode string, currentPath string,
 	return jsCode, componentImports
 }
 
+// AssetDependencies returns the files that the non-component imports in
+// source resolve to, such as JSON, CSS and JavaScript modules
+func (it *ImportTransformer) AssetDependencies(source string, currentPath string, componentExtensions []string) []string {
+	importRegex := regexp.MustCompile(`import\s+(?:{[^}]+}|\w+)\s+from\s+["']([^"']+)["'];?`)
+	var assets []string
+	for _, match := range importRegex.FindAllStringSubmatch(source, -1) {
+		importPath := match[1]
+		if isLibraryImport(importPath) {
+			continue
+		}
+		isComponent := false
+		for _, ext := range componentExtensions {
+			if strings.HasSuffix(importPath, ext) {
+				isComponent = true
+				break
+			}
+		}
+		if isComponent {
+			continue
+		}
+		if assetPath, _ := it.ResolveAssetPath(importPath, currentPath); assetPath != "" {
+			assets = append(assets, assetPath)
+		}
+	}
+	return assets
+}
+
 // isLibraryImport checks if an import path is a node_modules library
 func isLibraryImport(importPath string) bool {
 	// Library imports don't start with . or /
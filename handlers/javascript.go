@@ -3,11 +3,15 @@ package handlers
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
 
 	_ "github.com/rediwo/redi/modules"
 )
@@ -42,6 +46,9 @@ type JavaScriptHandler struct {
 	fs           filesystem.FileSystem
 	version      string
 	errorHandler *ErrorHandler
+	rateLimit    *middleware.RateLimitConfig
+	// Limiters for routes with a rateLimit config, by file and rate
+	limiters     sync.Map
 }
 
 func NewJavaScriptHandler(fs filesystem.FileSystem) *JavaScriptHandler {
@@ -59,11 +66,24 @@ func (jh *JavaScriptHandler) SetErrorHandler(eh *ErrorHandler) {
 	jh.errorHandler = eh
 }
 
+// SetRateLimitConfig sets the default key and proxy trust for the rate
+// limits that routes declare in their config export
+func (jh *JavaScriptHandler) SetRateLimitConfig(config *middleware.RateLimitConfig) {
+	jh.rateLimit = config
+}
+
 func (jh *JavaScriptHandler) Handle(route Route) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the engine pool
 		pool := GetJSEnginePool(jh.fs, jh.version)
 
+		// Refused requests must not get an engine of their own, so the
+		// rate limit is checked first once an engine has read the config
+		config, known := jh.routeConfig(route)
+		if known && !jh.allowRequest(w, r, route, config) {
+			return
+		}
+
 		// Generate session ID for this client
 		sessionID := generateSessionID(r)
 
@@ -77,36 +97,101 @@ func (jh *JavaScriptHandler) Handle(route Route) http.HandlerFunc {
 		// Note: We don't return the engine to pool immediately since it's session-bound
 		// Session engines are managed by the pool and cleaned up separately
 
+		if !known {
+			config, err := engine.RouteConfig(route.FilePath)
+			if err != nil {
+				jh.handleError(w, r, route, err)
+				return
+			}
+			if !jh.allowRequest(w, r, route, config) {
+				return
+			}
+		}
+
 		// Execute the HTTP method handler
 		if err := engine.ExecuteHTTPMethod(r, w, route); err != nil {
-			// Handle different types of errors appropriately
-			errMsg := err.Error()
-			if strings.Contains(errMsg, "failed to read file") || strings.Contains(errMsg, "failed to stat file") || strings.Contains(errMsg, "no such file") || strings.Contains(errMsg, "file does not exist") {
-				if jh.errorHandler != nil {
-					jh.errorHandler.ServeError(w, r, http.StatusNotFound, fmt.Sprintf("JavaScript file not found: %s", route.FilePath))
-				} else {
-					http.Error(w, fmt.Sprintf("JavaScript file not found: %s (Path: %s, Method: %s)", route.FilePath, r.URL.Path, r.Method), http.StatusNotFound)
-				}
-			} else if strings.Contains(errMsg, "failed to compile") || strings.Contains(errMsg, "parsing error") {
-				if jh.errorHandler != nil {
-					jh.errorHandler.Handle500(w, r, fmt.Errorf("JavaScript syntax error in %s: %v", route.FilePath, err))
-				} else {
-					http.Error(w, fmt.Sprintf("JavaScript syntax error in %s: %v", route.FilePath, err), http.StatusInternalServerError)
-				}
-			} else if methodName, found := strings.CutPrefix(errMsg, "method_not_allowed:"); found {
-				message := fmt.Sprintf("Method %s not allowed for %s", strings.ToUpper(methodName), r.URL.Path)
-				if jh.errorHandler != nil {
-					jh.errorHandler.ServeError(w, r, http.StatusMethodNotAllowed, message)
-				} else {
-					http.Error(w, message, http.StatusMethodNotAllowed)
-				}
-			} else {
-				if jh.errorHandler != nil {
-					jh.errorHandler.Handle500(w, r, fmt.Errorf("JavaScript execution error in %s: %v", route.FilePath, err))
-				} else {
-					http.Error(w, fmt.Sprintf("JavaScript execution error in %s: %v", route.FilePath, err), http.StatusInternalServerError)
-				}
-			}
+			jh.handleError(w, r, route, err)
+		}
+	}
+}
+
+// routeConfig returns the config export of the current version of a route,
+// if an engine has already run it
+func (jh *JavaScriptHandler) routeConfig(route Route) (*RouteConfig, bool) {
+	info, err := jh.fs.Stat(route.FilePath)
+	if err != nil {
+		return nil, false
+	}
+	return routePrograms.routeConfig(jh.fs, route.FilePath, info)
+}
+
+// allowRequest applies the route's rateLimit config. It writes the response
+// and returns false when the request is refused.
+func (jh *JavaScriptHandler) allowRequest(w http.ResponseWriter, r *http.Request, route Route, config *RouteConfig) bool {
+	if config.RateLimit.IsZero() {
+		return true
+	}
+
+	key, trustProxy := config.RateLimitKey, false
+	if jh.rateLimit != nil {
+		if key == "" {
+			key = jh.rateLimit.Key
+		}
+		trustProxy = jh.rateLimit.TrustProxy
+	}
+	id := fmt.Sprintf("%s|%s|%d", route.FilePath, config.RateLimit, config.Burst)
+	limiter, ok := jh.limiters.Load(id)
+	if !ok {
+		limiter, _ = jh.limiters.LoadOrStore(id, middleware.NewRateLimiter(config.RateLimit, config.Burst))
+	}
+	if middleware.AllowRequest(w, r, limiter.(*middleware.RateLimiter), key, trustProxy) {
+		return true
+	}
+
+	logging.Debug("Rate limit exceeded", "path", r.URL.Path, "rate", config.RateLimit.String())
+	if jh.errorHandler != nil {
+		jh.errorHandler.ServeError(w, r, http.StatusTooManyRequests, "Too many requests, please try again later")
+	} else {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	}
+	return false
+}
+
+// handleError writes the response for an error returned by a route handler
+func (jh *JavaScriptHandler) handleError(w http.ResponseWriter, r *http.Request, route Route, err error) {
+	var notFound *NotFoundError
+	var methodNotAllowed *MethodNotAllowedError
+	var timeout *TimeoutError
+	var tooLarge *RequestTooLargeError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		if jh.errorHandler != nil {
+			jh.errorHandler.ServeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+		} else {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		}
+	case errors.As(err, &timeout):
+		// The engine has already answered with 408 or a partial response
+		logging.Warn("JavaScript handler timed out", "path", route.FilePath, "timeout", timeout.Timeout)
+	case errors.As(err, &notFound):
+		if jh.errorHandler != nil {
+			jh.errorHandler.ServeError(w, r, http.StatusNotFound, fmt.Sprintf("JavaScript file not found: %s", route.FilePath))
+		} else {
+			http.Error(w, fmt.Sprintf("JavaScript file not found: %s (Path: %s, Method: %s)", route.FilePath, r.URL.Path, r.Method), http.StatusNotFound)
+		}
+	case errors.As(err, &methodNotAllowed):
+		message := fmt.Sprintf("Method %s not allowed for %s", strings.ToUpper(methodNotAllowed.Method), r.URL.Path)
+		if jh.errorHandler != nil {
+			jh.errorHandler.ServeError(w, r, http.StatusMethodNotAllowed, message)
+		} else {
+			http.Error(w, message, http.StatusMethodNotAllowed)
+		}
+	default:
+		if jh.errorHandler != nil {
+			jh.errorHandler.HandleError(w, r, err)
+		} else {
+			http.Error(w, fmt.Sprintf("JavaScript error in %s: %v", route.FilePath, err), http.StatusInternalServerError)
 		}
 	}
 }
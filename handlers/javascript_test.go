@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/middleware"
 )
 
 func TestJavaScriptHandler_Handle_API(t *testing.T) {
@@ -325,4 +326,112 @@ func TestJavaScriptHandler_Handle_RenderWithLayout(t *testing.T) {
 	if !strings.Contains(body, "Page content here") {
 		t.Errorf("Expected page content, got: %s", body)
 	}
-}
\ No newline at end of file
+}
+
+func TestJavaScriptHandler_RouteConfig(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("login.js", []byte(`export const config = { rateLimit: '2/m', maxBodySize: '16B' };
+
+export function post(req, res) {
+	res.json({ length: req.body.length });
+}
+`))
+
+	handler := NewJavaScriptHandler(fs)
+	route := Route{FilePath: "login.js"}
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler.Handle(route)(w, req)
+		return w
+	}
+
+	if w := post("user=a"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"length":6`) {
+		t.Fatalf("Expected the first request to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post(strings.Repeat("x", 17)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body over maxBodySize, got %d", w.Code)
+	}
+	w := post("user=a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 after the rate limit, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Errorf("Expected Retry-After and X-RateLimit-Limit headers, got %v", w.Header())
+	}
+
+	// Refused clients don't get a session engine
+	pool := GetJSEnginePool(fs, handler.version)
+	sessions := len(pool.SessionIDs())
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("user=a"))
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.Handle(route)(httptest.NewRecorder(), req)
+	if got := len(pool.SessionIDs()); got != sessions {
+		t.Errorf("Expected no session engine for a refused request, got %d sessions instead of %d", got, sessions)
+	}
+}
+
+func TestJavaScriptHandler_ResponseCache(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("posts.js", []byte(`export const config = { cache: { maxAge: '1m', tags: ['posts'] } };
+let renders = 0;
+export function get(req, res) {
+	renders++;
+	res.json({ renders });
+}
+`))
+	fs.WriteFile("post.js", []byte(`let renders = 0;
+export function get(req, res) {
+	renders++;
+	res.cache({ maxAge: 60, staleWhileRevalidate: '1h', tags: 'posts' });
+	res.json({ renders });
+}
+export function post(req, res) {
+	res.json({ purged: res.purge('posts') });
+}
+`))
+
+	handler := NewJavaScriptHandler(fs)
+	cache := middleware.NewResponseCache(middleware.DefaultResponseCacheConfig())
+	posts := cache.Middleware(handler.Handle(Route{FilePath: "posts.js"}))
+	post := cache.Middleware(handler.Handle(Route{FilePath: "post.js"}))
+	serve := func(h http.Handler, method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := serve(posts, "GET", "/posts"); !strings.Contains(w.Body.String(), `"renders":1`) {
+			t.Errorf("Expected the config export to cache /posts, got %q", w.Body.String())
+		}
+		if w := serve(post, "GET", "/post"); !strings.Contains(w.Body.String(), `"renders":1`) {
+			t.Errorf("Expected res.cache to cache /post, got %q", w.Body.String())
+		}
+	}
+	if w := serve(post, "GET", "/post"); w.Header().Get("Cache-Control") != "public, max-age=60, stale-while-revalidate=3600" {
+		t.Errorf("Expected Cache-Control from res.cache, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	if w := serve(post, "POST", "/post"); !strings.Contains(w.Body.String(), `"purged":2`) {
+		t.Fatalf("Expected res.purge to remove both responses, got %q", w.Body.String())
+	}
+	if w := serve(posts, "GET", "/posts"); !strings.Contains(w.Body.String(), `"renders":2`) {
+		t.Errorf("Expected /posts to render again after the purge, got %q", w.Body.String())
+	}
+}
+
+func TestJavaScriptHandler_InvalidRouteConfig(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("bad.js", []byte(`exports.config = { rateLimit: 'often' };
+exports.get = function(req, res) { res.send('ok'); };
+`))
+
+	w := httptest.NewRecorder()
+	NewJavaScriptHandler(fs).Handle(Route{FilePath: "bad.js"})(w, httptest.NewRequest("GET", "/bad", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "invalid config export") {
+		t.Errorf("Expected an invalid config error, got %d: %s", w.Code, w.Body.String())
+	}
+}
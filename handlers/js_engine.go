@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	js "github.com/dop251/goja"
@@ -16,14 +21,47 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/i18n"
+	"github.com/rediwo/redi/middleware"
+	"github.com/rediwo/redi/registry"
 )
 
+// Route modules are wrapped in a CommonJS-style function before compilation
+const (
+	moduleWrapperPrefix = "(function(exports, require, module, __filename, __dirname) {"
+	moduleWrapperSuffix = "\nreturn exports;\n})"
+)
+
+// requestTimeout is the maximum time a route handler may take to respond
+const requestTimeout = 10 * time.Second
+
+// DefaultMaxBodySize limits the request body read for JavaScript routes that
+// don't set maxBodySize in their config
+const DefaultMaxBodySize = 10 << 20
+
+// routeExportRegex matches ES-style exports at the top level of a route
+// module, e.g. export const config = {...}
+var routeExportRegex = regexp.MustCompile(`(?m)^export\s+((?:const|let|var|function|async\s+function)\s+(\w+))`)
+
 // CachedModule represents a cached JavaScript module
 type CachedModule struct {
 	Exports      *js.Object
+	Config       *RouteConfig
 	LastModified time.Time
 }
 
+// RouteConfig is the config export of a JavaScript route:
+//
+//	export const config = { rateLimit: '10/m', rateLimitKey: 'ip', maxBodySize: '1MB' }
+//	export const config = { cache: { maxAge: '5m', staleWhileRevalidate: '1h', tags: ['posts'] } }
+type RouteConfig struct {
+	RateLimit    middleware.Rate
+	Burst        int
+	RateLimitKey string // ip, session or header:Name
+	MaxBodySize  int64
+	Cache        *middleware.ResponseCachePolicy // nil leaves GET responses uncached
+}
+
 // SharedJSEngine manages a shared JavaScript environment with module caching
 type SharedJSEngine struct {
 	fs           filesystem.FileSystem
@@ -48,6 +86,20 @@ type JSEnginePool struct {
 	// Session-based engine allocation
 	sessionEngines map[string]*SharedJSEngine
 	sessionMutex   sync.RWMutex
+	// Engine for hooks called by the server, started on first use
+	hookEngine *SharedJSEngine
+	// Counters for pool statistics
+	checkedOut       int64
+	temporaryCreated int64
+}
+
+// PoolStats is a snapshot of JavaScript engine pool usage
+type PoolStats struct {
+	Size             int   `json:"size"`             // Configured number of pooled engines
+	Available        int   `json:"available"`        // Idle engines in the pool
+	InUse            int   `json:"inUse"`            // Engines checked out or bound to a session
+	SessionBound     int   `json:"sessionBound"`     // Engines bound to a client session
+	TemporaryCreated int64 `json:"temporaryCreated"` // Engines created because the pool was empty
 }
 
 var (
@@ -116,6 +168,7 @@ func (pool *JSEnginePool) initPool() {
 func (pool *JSEnginePool) GetEngine() (*SharedJSEngine, error) {
 	select {
 	case engine := <-pool.available:
+		atomic.AddInt64(&pool.checkedOut, 1)
 		return engine, nil
 	default:
 		// No engines available, create a new temporary one
@@ -127,6 +180,8 @@ func (pool *JSEnginePool) GetEngine() (*SharedJSEngine, error) {
 		if err := engine.Start(); err != nil {
 			return nil, fmt.Errorf("failed to create temporary engine: %v", err)
 		}
+		atomic.AddInt64(&pool.temporaryCreated, 1)
+		atomic.AddInt64(&pool.checkedOut, 1)
 		return engine, nil
 	}
 }
@@ -165,6 +220,7 @@ func (pool *JSEnginePool) GetEngineForSession(sessionID string) (*SharedJSEngine
 		if err := engine.Start(); err != nil {
 			return nil, fmt.Errorf("failed to create session engine: %v", err)
 		}
+		atomic.AddInt64(&pool.temporaryCreated, 1)
 	}
 
 	// Assign this engine to the session
@@ -190,11 +246,35 @@ func (pool *JSEnginePool) ReleaseSessionEngine(sessionID string) {
 	}
 }
 
+// SessionIDs returns the IDs of all sessions that have a bound engine
+func (pool *JSEnginePool) SessionIDs() []string {
+	pool.sessionMutex.RLock()
+	defer pool.sessionMutex.RUnlock()
+
+	ids := make([]string, 0, len(pool.sessionEngines))
+	for id := range pool.sessionEngines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ReleaseAllSessionEngines releases the engines of all sessions and returns
+// how many were released
+func (pool *JSEnginePool) ReleaseAllSessionEngines() int {
+	ids := pool.SessionIDs()
+	for _, id := range ids {
+		pool.ReleaseSessionEngine(id)
+	}
+	return len(ids)
+}
+
 // ReturnEngine returns an engine to the pool
 func (pool *JSEnginePool) ReturnEngine(engine *SharedJSEngine) {
 	if engine == nil {
 		return
 	}
+	atomic.AddInt64(&pool.checkedOut, -1)
 	
 	select {
 	case pool.available <- engine:
@@ -205,6 +285,42 @@ func (pool *JSEnginePool) ReturnEngine(engine *SharedJSEngine) {
 	}
 }
 
+// Stats returns a snapshot of the pool usage
+func (pool *JSEnginePool) Stats() PoolStats {
+	pool.sessionMutex.RLock()
+	sessionBound := len(pool.sessionEngines)
+	pool.sessionMutex.RUnlock()
+
+	return PoolStats{
+		Size:             pool.poolSize,
+		Available:        len(pool.available),
+		InUse:            sessionBound + int(atomic.LoadInt64(&pool.checkedOut)),
+		SessionBound:     sessionBound,
+		TemporaryCreated: atomic.LoadInt64(&pool.temporaryCreated),
+	}
+}
+
+// HookEngine returns the engine kept for hooks the server calls on every
+// request, such as the onRequest hooks of proxy rules, so they don't take
+// engines from the pool. Its calls run one at a time on its event loop.
+func (pool *JSEnginePool) HookEngine() (*SharedJSEngine, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.hookEngine != nil {
+		return pool.hookEngine, nil
+	}
+	engine := &SharedJSEngine{
+		fs:          pool.fs,
+		version:     pool.version,
+		moduleCache: make(map[string]*CachedModule),
+	}
+	if err := engine.Start(); err != nil {
+		return nil, fmt.Errorf("failed to create hook engine: %v", err)
+	}
+	pool.hookEngine = engine
+	return engine, nil
+}
+
 // Stop stops all engines in the pool
 func (pool *JSEnginePool) Stop() {
 	pool.mutex.Lock()
@@ -221,6 +337,39 @@ func (pool *JSEnginePool) Stop() {
 	}
 	
 	pool.engines = nil
+
+	if pool.hookEngine != nil {
+		pool.hookEngine.Stop()
+		pool.hookEngine = nil
+	}
+
+	// Stop the engines bound to sessions
+	pool.sessionMutex.Lock()
+	for id, engine := range pool.sessionEngines {
+		engine.Stop()
+		delete(pool.sessionEngines, id)
+	}
+	pool.sessionMutex.Unlock()
+}
+
+// StopJSEnginePool stops the engine pool of the given filesystem, if any, and
+// forgets it and its compiled route modules so a later GetJSEnginePool call
+// starts a fresh pool. Modules then release what they held for it, such as
+// open kv stores.
+func StopJSEnginePool(fs filesystem.FileSystem, version string) {
+	key := fmt.Sprintf("%T-%p-%s", fs, fs, version)
+
+	poolMutex.Lock()
+	pool, exists := globalPools[key]
+	delete(globalPools, key)
+	poolMutex.Unlock()
+
+	routePrograms.forget(fs)
+	requirePrograms.forget(fs)
+	if exists {
+		pool.Stop()
+	}
+	registry.ShutdownAllModules(fs)
 }
 
 // Start initializes the shared JavaScript engine
@@ -249,6 +398,7 @@ func (engine *SharedJSEngine) Start() error {
 			return
 		}
 		engine.registry = registry
+		vm.Set("require", requireFiles(vm, vmManager, requireModule, "routes"))
 
 		// Set up console
 		consoleObj, err := requireModule.Require("console")
@@ -297,7 +447,7 @@ func (engine *SharedJSEngine) loadOrGetModule(filePath string) (*js.Object, erro
 	// Get file modification time first
 	info, err := engine.fs.Stat(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat file %s (filesystem type: %T): %v", filePath, engine.fs, err)
+		return nil, newNotFoundError(filePath, fmt.Errorf("failed to stat file %s (filesystem type: %T): %w", filePath, engine.fs, err))
 	}
 	
 	// Check if module is already cached
@@ -312,34 +462,26 @@ func (engine *SharedJSEngine) loadOrGetModule(filePath string) (*js.Object, erro
 	}
 	engine.cacheMutex.RUnlock()
 
-	// Read the file
-	content, err := engine.fs.ReadFile(filePath)
+	// Compiled modules are shared by all engines
+	program, err := routePrograms.load(engine.fs, filePath, info)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s (filesystem type: %T): %v", filePath, engine.fs, err)
+		return nil, err
 	}
 
 	// Load module in the shared event loop
-	result := make(chan *js.Object, 1)
+	result := make(chan *CachedModule, 1)
 	errChan := make(chan error, 1)
 
 	engine.eventLoop.RunOnLoop(func(vm *js.Runtime) {
-		// Create module wrapper
-		moduleCode := fmt.Sprintf(`
-			(function(exports, require, module, __filename, __dirname) {
-				%s
-				return exports;
-			})
-		`, string(content))
-
 		// Create module objects
 		exports := vm.NewObject()
 		module := vm.NewObject()
 		module.Set("exports", exports)
 
 		// Execute the module wrapper
-		fn, err := vm.RunString(moduleCode)
+		fn, err := vm.RunProgram(program)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to compile module %s: %v", filePath, err)
+			errChan <- newExecutionError(filePath, err, 0, len(moduleWrapperPrefix))
 			return
 		}
 
@@ -356,7 +498,7 @@ func (engine *SharedJSEngine) loadOrGetModule(filePath string) (*js.Object, erro
 				vm.ToValue(filePath),
 				vm.ToValue(basePath))
 			if err != nil {
-				errChan <- fmt.Errorf("failed to execute module %s: %v", filePath, err)
+				errChan <- newExecutionError(filePath, err, 0, len(moduleWrapperPrefix))
 				return
 			}
 
@@ -366,20 +508,24 @@ func (engine *SharedJSEngine) loadOrGetModule(filePath string) (*js.Object, erro
 			}
 		}
 
-		result <- exports
+		config, err := parseRouteConfig(exports.Get("config"))
+		if err != nil {
+			errChan <- &ExecutionError{Path: filePath, Message: "invalid config export: " + err.Error(), Err: err}
+			return
+		}
+		routePrograms.setConfig(engine.fs, filePath, program, config)
+		result <- &CachedModule{Exports: exports, Config: config}
 	})
 
 	// Wait for module loading to complete
 	select {
-	case exports := <-result:
+	case module := <-result:
 		// Cache the module using the modification time we got earlier
+		module.LastModified = info.ModTime()
 		engine.cacheMutex.Lock()
-		engine.moduleCache[filePath] = &CachedModule{
-			Exports:      exports,
-			LastModified: info.ModTime(),
-		}
+		engine.moduleCache[filePath] = module
 		engine.cacheMutex.Unlock()
-		return exports, nil
+		return module.Exports, nil
 	case err := <-errChan:
 		return nil, err
 	case <-time.After(10 * time.Second):
@@ -387,6 +533,228 @@ func (engine *SharedJSEngine) loadOrGetModule(filePath string) (*js.Object, erro
 	}
 }
 
+// requiredModule is a file loaded with require by an engine and the
+// program it ran
+type requiredModule struct {
+	program *js.Program
+	module  *js.Object
+}
+
+// requireFiles returns the require function of an engine. Files are run from
+// the compiled programs shared by all engines, and run again once they
+// change; other names go to the require registry.
+func requireFiles(vm *js.Runtime, vmManager *VMManager, requireModule *require.RequireModule, basePath string) func(js.FunctionCall) js.Value {
+	resolvePath := vmManager.createPathResolver(basePath)
+	modules := make(map[string]*requiredModule)
+	throw := func(err error) {
+		if _, ok := err.(*js.Exception); !ok {
+			panic(vm.NewGoError(err))
+		}
+		panic(err)
+	}
+
+	return func(call js.FunctionCall) js.Value {
+		name := call.Argument(0).String()
+		if !isModuleFilePath(name) {
+			exports, err := requireModule.Require(name)
+			if err != nil {
+				throw(err)
+			}
+			return exports
+		}
+
+		// Relative names are resolved from the file of the caller
+		start := ""
+		if !filepath.IsAbs(name) {
+			start = "."
+			if frames := vm.CaptureCallStack(2, nil); len(frames) == 2 {
+				start = filepath.Dir(frames[1].SrcName())
+			}
+		}
+		filePath, err := vmManager.resolveModuleFile(basePath, resolvePath(start, name))
+		if err != nil {
+			throw(require.InvalidModuleError)
+		}
+		info, err := vmManager.fs.Stat(filePath)
+		if err != nil {
+			throw(err)
+		}
+		program, err := requirePrograms.load(vmManager.fs, filePath, info)
+		if err != nil {
+			throw(err)
+		}
+		if cached, exists := modules[filePath]; exists && cached.program == program {
+			return cached.module.Get("exports")
+		}
+
+		// The module is known before it runs, so cycles get its exports so far
+		exports := vm.NewObject()
+		module := vm.NewObject()
+		module.Set("exports", exports)
+		modules[filePath] = &requiredModule{program: program, module: module}
+		fn, err := vm.RunProgram(program)
+		if err == nil {
+			callable, _ := js.AssertFunction(fn)
+			_, err = callable(exports, exports, vm.Get("require"), module, vm.ToValue(filePath), vm.ToValue(filepath.Dir(filePath)))
+		}
+		if err != nil {
+			delete(modules, filePath)
+			throw(err)
+		}
+		return module.Get("exports")
+	}
+}
+
+// isModuleFilePath reports whether a require name refers to a file rather
+// than a native module or a package
+func isModuleFilePath(name string) bool {
+	return name == "." || name == ".." || filepath.IsAbs(name) ||
+		strings.HasPrefix(name, "/") || strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")
+}
+
+// transformRouteExports turns top-level ES-style exports into assignments to
+// exports, appended after the source so line numbers are unchanged
+func transformRouteExports(source string) string {
+	matches := routeExportRegex.FindAllStringSubmatch(source, -1)
+	if len(matches) == 0 {
+		return source
+	}
+	var result strings.Builder
+	result.WriteString(routeExportRegex.ReplaceAllString(source, "$1"))
+	result.WriteString("\n;")
+	for _, match := range matches {
+		fmt.Fprintf(&result, "exports.%s = %s;", match[2], match[2])
+	}
+	return result.String()
+}
+
+// parseRouteConfig reads a route's config export
+func parseRouteConfig(value js.Value) (*RouteConfig, error) {
+	config := &RouteConfig{}
+	if value == nil || js.IsUndefined(value) || js.IsNull(value) {
+		return config, nil
+	}
+	settings, ok := value.Export().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config must be an object")
+	}
+
+	if rate, ok := settings["rateLimit"]; ok {
+		parsed, err := middleware.ParseRate(fmt.Sprint(rate))
+		if err != nil {
+			return nil, err
+		}
+		config.RateLimit = parsed
+	}
+	if burst, ok := settings["burst"]; ok {
+		count, ok := burst.(int64)
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("burst must be a positive integer")
+		}
+		config.Burst = int(count)
+	}
+	if key, ok := settings["rateLimitKey"].(string); ok {
+		if !middleware.ValidRateLimitKey(key) {
+			return nil, fmt.Errorf("rateLimitKey must be ip, session or header:Name, got %q", key)
+		}
+		config.RateLimitKey = key
+	}
+	switch size := settings["maxBodySize"].(type) {
+	case nil:
+	case int64:
+		config.MaxBodySize = size
+	case string:
+		parsed, err := middleware.ParseByteSize(size)
+		if err != nil {
+			return nil, err
+		}
+		config.MaxBodySize = parsed
+	default:
+		return nil, fmt.Errorf("maxBodySize must be a number of bytes or a size such as '1MB'")
+	}
+	if options, ok := settings["cache"]; ok {
+		policy, err := parseCachePolicy(options)
+		if err != nil {
+			return nil, err
+		}
+		config.Cache = &policy
+	}
+	return config, nil
+}
+
+// parseCachePolicy reads the cache options of a config export or of
+// res.cache: { maxAge, staleWhileRevalidate, tags }. Durations are seconds
+// or strings such as '5m'.
+func parseCachePolicy(value interface{}) (middleware.ResponseCachePolicy, error) {
+	policy := middleware.ResponseCachePolicy{}
+	options, ok := value.(map[string]interface{})
+	if !ok {
+		return policy, fmt.Errorf("cache must be an object such as { maxAge: '5m' }")
+	}
+
+	var err error
+	if policy.MaxAge, err = parseCacheDuration("maxAge", options["maxAge"]); err != nil {
+		return policy, err
+	}
+	if policy.MaxAge <= 0 {
+		return policy, fmt.Errorf("cache.maxAge must be positive")
+	}
+	if policy.StaleWhileRevalidate, err = parseCacheDuration("staleWhileRevalidate", options["staleWhileRevalidate"]); err != nil {
+		return policy, err
+	}
+	switch tags := options["tags"].(type) {
+	case nil:
+	case string:
+		policy.Tags = []string{tags}
+	case []interface{}:
+		for _, tag := range tags {
+			name, ok := tag.(string)
+			if !ok || name == "" {
+				return policy, fmt.Errorf("cache.tags must be strings")
+			}
+			policy.Tags = append(policy.Tags, name)
+		}
+	default:
+		return policy, fmt.Errorf("cache.tags must be an array of strings")
+	}
+	return policy, nil
+}
+
+// parseCacheDuration reads a duration given in seconds or as a string such
+// as '5m'
+func parseCacheDuration(name string, value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if v >= 0 {
+			return time.Duration(v) * time.Second, nil
+		}
+	case float64:
+		if v >= 0 {
+			return time.Duration(v * float64(time.Second)), nil
+		}
+	case string:
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("cache.%s must be a number of seconds or a duration such as '5m'", name)
+}
+
+// RouteConfig returns the config export of a route module, loading it if needed
+func (engine *SharedJSEngine) RouteConfig(filePath string) (*RouteConfig, error) {
+	if _, err := engine.loadOrGetModule(filePath); err != nil {
+		return nil, err
+	}
+	engine.cacheMutex.RLock()
+	defer engine.cacheMutex.RUnlock()
+	if cached, exists := engine.moduleCache[filePath]; exists && cached.Config != nil {
+		return cached.Config, nil
+	}
+	return &RouteConfig{}, nil
+}
+
 // ExecuteHTTPMethod executes an HTTP method handler from a JavaScript module
 func (engine *SharedJSEngine) ExecuteHTTPMethod(r *http.Request, w http.ResponseWriter, route Route) error {
 	if !engine.started {
@@ -412,11 +780,22 @@ func (engine *SharedJSEngine) ExecuteHTTPMethod(r *http.Request, w http.Response
 	handler := exports.Get(httpMethod)
 	if handler == nil || js.IsUndefined(handler) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		return fmt.Errorf("method_not_allowed:%s", httpMethod)
+		return &MethodNotAllowedError{Method: httpMethod}
 	}
 
 	// Create request object
-	reqObj := engine.createRequestObject(r, route)
+	config, err := engine.RouteConfig(route.FilePath)
+	if err != nil {
+		return err
+	}
+	if config.Cache != nil {
+		// Only GET responses are stored
+		middleware.CacheResponse(r, *config.Cache)
+	}
+	reqObj, err := engine.createRequestObject(w, r, route, config.MaxBodySize)
+	if err != nil {
+		return err
+	}
 
 	// Track response
 	responseSent := false
@@ -424,7 +803,7 @@ func (engine *SharedJSEngine) ExecuteHTTPMethod(r *http.Request, w http.Response
 	done := make(chan error, 1)
 
 	// Create response object
-	resObj := engine.createResponseObject(w, &responseSent, &responseMutex, func() {
+	resObj := engine.createResponseObject(w, r, &responseSent, &responseMutex, func() {
 		done <- nil
 	}, route)
 
@@ -432,7 +811,7 @@ func (engine *SharedJSEngine) ExecuteHTTPMethod(r *http.Request, w http.Response
 	engine.eventLoop.RunOnLoop(func(vm *js.Runtime) {
 		defer func() {
 			if recovered := recover(); recovered != nil {
-				done <- fmt.Errorf("JavaScript execution error: %v", recovered)
+				done <- &ExecutionError{Path: route.FilePath, Message: fmt.Sprint(recovered)}
 			}
 		}()
 
@@ -449,7 +828,7 @@ func (engine *SharedJSEngine) ExecuteHTTPMethod(r *http.Request, w http.Response
 		if callable, ok := js.AssertFunction(handler); ok {
 			_, err := callable(js.Undefined(), vm.ToValue(reqObj), vm.ToValue(resObj), nextFunc)
 			if err != nil {
-				done <- fmt.Errorf("failed to execute %s handler: %v", httpMethod, err)
+				done <- newExecutionError(route.FilePath, err, 0, len(moduleWrapperPrefix))
 				return
 			}
 		}
@@ -459,18 +838,80 @@ func (engine *SharedJSEngine) ExecuteHTTPMethod(r *http.Request, w http.Response
 	select {
 	case err := <-done:
 		return err
-	case <-time.After(10 * time.Second):
+	case <-time.After(requestTimeout):
 		responseMutex.Lock()
 		if !responseSent {
+			responseSent = true
 			http.Error(w, "Request timeout", http.StatusRequestTimeout)
 		}
 		responseMutex.Unlock()
-		return fmt.Errorf("request timeout")
+		return &TimeoutError{Path: route.FilePath, Timeout: requestTimeout}
 	}
 }
 
-// createRequestObject creates a request object for JavaScript
-func (engine *SharedJSEngine) createRequestObject(r *http.Request, route Route) map[string]interface{} {
+// CallExport calls the function a module exports as name with arg and
+// returns its result converted to Go values. A returned promise is awaited.
+// It returns nil when the module doesn't export the function.
+func (engine *SharedJSEngine) CallExport(filePath, name string, arg interface{}) (interface{}, error) {
+	if !engine.started {
+		return nil, fmt.Errorf("JavaScript engine not started")
+	}
+	exports, err := engine.loadOrGetModule(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	type callResult struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan callResult, 1)
+	engine.eventLoop.RunOnLoop(func(vm *js.Runtime) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- callResult{err: &ExecutionError{Path: filePath, Message: fmt.Sprint(recovered)}}
+			}
+		}()
+
+		callable, ok := js.AssertFunction(exports.Get(name))
+		if !ok {
+			done <- callResult{}
+			return
+		}
+		value, err := callable(js.Undefined(), vm.ToValue(arg))
+		if err != nil {
+			done <- callResult{err: newExecutionError(filePath, err, 0, len(moduleWrapperPrefix))}
+			return
+		}
+
+		promise, ok := value.Export().(*js.Promise)
+		if !ok {
+			done <- callResult{value: value.Export()}
+			return
+		}
+		then, _ := js.AssertFunction(vm.ToValue(promise).ToObject(vm).Get("then"))
+		then(vm.ToValue(promise),
+			vm.ToValue(func(call js.FunctionCall) js.Value {
+				done <- callResult{value: call.Argument(0).Export()}
+				return js.Undefined()
+			}),
+			vm.ToValue(func(call js.FunctionCall) js.Value {
+				done <- callResult{err: &ExecutionError{Path: filePath, Message: call.Argument(0).String()}}
+				return js.Undefined()
+			}))
+	})
+
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-time.After(requestTimeout):
+		return nil, &TimeoutError{Path: filePath, Timeout: requestTimeout}
+	}
+}
+
+// createRequestObject creates a request object for JavaScript. The body is
+// read up to maxBodySize bytes (DefaultMaxBodySize when zero).
+func (engine *SharedJSEngine) createRequestObject(w http.ResponseWriter, r *http.Request, route Route, maxBodySize int64) (map[string]interface{}, error) {
 	vars := mux.Vars(r)
 
 	reqObj := map[string]interface{}{
@@ -480,19 +921,44 @@ func (engine *SharedJSEngine) createRequestObject(r *http.Request, route Route)
 		"query":   r.URL.RawQuery,
 		"headers": r.Header,
 		"params":  vars,
+		"locale":  engine.requestLocale(r),
+		"id":      middleware.RequestIDFromContext(r.Context()),
 	}
 
 	// Add body for non-GET requests
-	if r.Method != "GET" && r.Method != "HEAD" {
-		body, _ := io.ReadAll(r.Body)
+	if r.Method != "GET" && r.Method != "HEAD" && r.Body != nil {
+		if maxBodySize <= 0 {
+			maxBodySize = DefaultMaxBodySize
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, &RequestTooLargeError{Path: route.FilePath, Limit: tooLarge.Limit}
+			}
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
 		reqObj["body"] = string(body)
 	}
 
-	return reqObj
+	return reqObj, nil
+}
+
+// requestLocale returns the locale resolved for the request by the i18n
+// routing, falling back to detection for routes mounted without a prefix
+func (engine *SharedJSEngine) requestLocale(r *http.Request) string {
+	if locale := i18n.LocaleFromContext(r.Context()); locale != "" {
+		return locale
+	}
+	translator := i18n.ForFileSystem(engine.fs)
+	if !translator.Enabled() {
+		return ""
+	}
+	return translator.Detect(r)
 }
 
 // createResponseObject creates a response object
-func (engine *SharedJSEngine) createResponseObject(w http.ResponseWriter, responseSent *bool, responseMutex *sync.Mutex, onResponse func(), route Route) map[string]interface{} {
+func (engine *SharedJSEngine) createResponseObject(w http.ResponseWriter, r *http.Request, responseSent *bool, responseMutex *sync.Mutex, onResponse func(), route Route) map[string]interface{} {
 	statusCode := 200
 
 	return map[string]interface{}{
@@ -538,7 +1004,7 @@ func (engine *SharedJSEngine) createResponseObject(w http.ResponseWriter, respon
 			*responseSent = true
 
 			// Auto-find template file based on JS file path
-			err := engine.renderTemplate(route, data, w, statusCode)
+			err := engine.renderLocalizedTemplate(r.Context(), route, data, w, statusCode, engine.requestLocale(r))
 			if err != nil {
 				// Log the error instead of sending HTTP error (which would cause duplicate WriteHeader)
 				fmt.Printf("Template rendering error: %v\n", err)
@@ -553,12 +1019,31 @@ func (engine *SharedJSEngine) createResponseObject(w http.ResponseWriter, respon
 		"setHeader": func(key, value string) {
 			w.Header().Set(key, value)
 		},
+		// cache stores this response in the response cache; it must be
+		// called before the response is sent
+		"cache": func(options map[string]interface{}) bool {
+			policy, err := parseCachePolicy(options)
+			if err != nil {
+				panic(engine.vm.NewTypeError(err.Error()))
+			}
+			return middleware.CacheResponse(r, policy)
+		},
+		// purge removes the cached responses with any of the given tags
+		"purge": func(tags ...string) int {
+			return middleware.PurgeResponses(r, tags...)
+		},
 	}
 }
 
 
 // renderTemplate finds and renders the template file corresponding to the JS file
 func (engine *SharedJSEngine) renderTemplate(route Route, data interface{}, w http.ResponseWriter, statusCode int) error {
+	return engine.renderLocalizedTemplate(context.Background(), route, data, w, statusCode, "")
+}
+
+// renderLocalizedTemplate renders the route template using locale for {{t}}
+// and the request context for {{csrfToken}} and {{cspNonce}}
+func (engine *SharedJSEngine) renderLocalizedTemplate(ctx context.Context, route Route, data interface{}, w http.ResponseWriter, statusCode int, locale string) error {
 	// Convert .js file path to template file path
 	templatePath := engine.findTemplatePath(route.FilePath)
 	if templatePath == "" {
@@ -580,7 +1065,7 @@ func (engine *SharedJSEngine) renderTemplate(route Route, data interface{}, w ht
 	}
 
 	// Render the template
-	return templateHandler.RenderTemplate(templatePath, string(templateContent), data, w)
+	return templateHandler.renderTemplate(ctx, templatePath, string(templateContent), data, w, locale)
 }
 
 
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	js "github.com/dop251/goja"
 	"github.com/rediwo/redi/filesystem"
 )
 
@@ -356,4 +357,114 @@ func TestSharedJSEngine_ConcurrentAccess(t *testing.T) {
 			t.Errorf("Request %d timed out", i)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestSharedJSEngine_SharedPrograms(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("routes/api.js", []byte(`exports.get = function(req, res) { res.json({version: 1}); };`))
+	defer routePrograms.forget(fs)
+
+	if ready := WarmRoutePrograms(fs, []string{"routes/api.js", "routes/missing.js"}); ready != 1 {
+		t.Fatalf("Expected 1 warmed route, got %d", ready)
+	}
+	warmed := routePrograms.programs[programKey(fs, "routes/api.js")].program
+
+	// Every engine runs the program compiled at startup
+	for i := 0; i < 2; i++ {
+		engine := &SharedJSEngine{fs: fs, version: "test", moduleCache: make(map[string]*CachedModule)}
+		if err := engine.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Stop()
+		if _, err := engine.loadOrGetModule("routes/api.js"); err != nil {
+			t.Fatal(err)
+		}
+		if program := routePrograms.programs[programKey(fs, "routes/api.js")].program; program != warmed {
+			t.Errorf("Engine %d compiled the route again", i)
+		}
+	}
+
+	// A changed route is compiled again
+	time.Sleep(10 * time.Millisecond)
+	fs.WriteFile("routes/api.js", []byte(`exports.get = function(req, res) { res.json({version: 2}); };`))
+	info, _ := fs.Stat("routes/api.js")
+	program, err := routePrograms.load(fs, "routes/api.js", info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program == warmed {
+		t.Error("Expected a changed route to be compiled again")
+	}
+
+	routePrograms.forget(fs)
+	if _, ok := routePrograms.programs[programKey(fs, "routes/api.js")]; ok {
+		t.Error("Expected the programs of a filesystem to be forgotten")
+	}
+}
+
+func TestSharedJSEngine_RequirePrograms(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("routes/api.js", []byte(`var util = require('./lib/util');
+exports.get = function(req, res) { res.json({version: util.version}); };`))
+	fs.WriteFile("routes/lib/util.js", []byte(`module.exports = { version: 1, limit: require('../data.json').limit };`))
+	fs.WriteFile("routes/data.json", []byte(`{"limit": 5}`))
+	defer StopJSEnginePool(fs, "test")
+
+	run := func(engine *SharedJSEngine, script string) js.Value {
+		t.Helper()
+		result := make(chan js.Value, 1)
+		errs := make(chan error, 1)
+		engine.eventLoop.RunOnLoop(func(vm *js.Runtime) {
+			value, err := vm.RunString(script)
+			if err != nil {
+				errs <- err
+				return
+			}
+			result <- value
+		})
+		select {
+		case value := <-result:
+			return value
+		case err := <-errs:
+			t.Fatalf("Script error: %v", err)
+		}
+		return nil
+	}
+
+	// Required files are compiled once for all engines
+	misses := requirePrograms.misses.Load()
+	var engines []*SharedJSEngine
+	for i := 0; i < 2; i++ {
+		engine := &SharedJSEngine{fs: fs, version: "test", moduleCache: make(map[string]*CachedModule)}
+		if err := engine.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Stop()
+		if _, err := engine.loadOrGetModule("routes/api.js"); err != nil {
+			t.Fatal(err)
+		}
+		engines = append(engines, engine)
+	}
+	compiled := requirePrograms.programs[programKey(fs, "routes/lib/util.js")]
+	if compiled == nil || requirePrograms.programs[programKey(fs, "routes/data.json")] == nil {
+		t.Fatal("Expected the required files to be compiled into the shared cache")
+	}
+	if compiles := requirePrograms.misses.Load() - misses; compiles != 2 {
+		t.Errorf("Expected util.js and data.json to be compiled once, got %d compiles", compiles)
+	}
+	if got := run(engines[1], `require('./lib/util').limit`).ToInteger(); got != 5 {
+		t.Errorf("Expected the limit from data.json, got %d", got)
+	}
+
+	// A changed file is compiled and run again
+	time.Sleep(10 * time.Millisecond)
+	fs.WriteFile("routes/lib/util.js", []byte(`module.exports = { version: 2 };`))
+	if got := run(engines[0], `require('./lib/util').version`).ToInteger(); got != 2 {
+		t.Errorf("Expected the changed module, got version %d", got)
+	}
+	if requirePrograms.programs[programKey(fs, "routes/lib/util.js")].program == compiled.program {
+		t.Error("Expected a changed file to be compiled again")
+	}
+
+	run(engines[0], `try { require('./missing'); throw 'loaded'; } catch (e) { if (e === 'loaded') throw e; }`)
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/rediwo/redi/metrics"
+)
+
+// Svelte compiler metrics, shared by all handlers in the process
+var (
+	svelteCompiles = metrics.NewCounterVec("redi_svelte_compiles_total",
+		"Total number of Svelte component compilations.", "result")
+	svelteCompileDuration = metrics.NewHistogramVec("redi_svelte_compile_duration_seconds",
+		"Svelte component compilation time in seconds.",
+		[]float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+)
+
+func init() {
+	metrics.Default.Register(svelteCompiles, svelteCompileDuration)
+}
+
+// observeSvelteCompile records the outcome and duration of a compilation
+func observeSvelteCompile(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	svelteCompiles.WithLabelValues(result).Inc()
+	svelteCompileDuration.WithLabelValues().Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	js "github.com/dop251/goja"
+
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
+)
+
+// routePrograms holds the compiled route modules of the process. A goja
+// program can be run by any number of runtimes, so each route is compiled
+// once and shared by all engines of its pool, including the engines started
+// for new sessions.
+var routePrograms = &programCache{programs: make(map[string]*routeProgram), compile: compileRouteModule}
+
+// requirePrograms holds the compiled files loaded with require, shared the
+// same way
+var requirePrograms = &programCache{programs: make(map[string]*routeProgram), compile: compileRequiredModule}
+
+// ProgramCacheStats is a snapshot of compiled route module usage
+type ProgramCacheStats struct {
+	Programs int   `json:"programs"` // Compiled route modules
+	Hits     int64 `json:"hits"`     // Loads that reused a compiled module
+	Misses   int64 `json:"misses"`   // Loads that compiled the module
+}
+
+// routeProgram is a compiled route module and the file it was compiled from
+type routeProgram struct {
+	modTime time.Time
+	size    int64
+	hash    string // SHA-256 of the source
+	program *js.Program
+	config  *RouteConfig // The config export, once an engine ran the program
+}
+
+type programCache struct {
+	mu       sync.RWMutex
+	programs map[string]*routeProgram
+	compile  func(filePath string, content []byte) (*js.Program, error)
+	hits     atomic.Int64
+	misses   atomic.Int64
+}
+
+// compileRouteModule compiles the module wrapper of a route. The source
+// starts on the wrapper's first line so that reported line numbers match
+// the file.
+func compileRouteModule(filePath string, content []byte) (*js.Program, error) {
+	program, err := js.Compile(filePath, moduleWrapperPrefix+transformRouteExports(string(content))+moduleWrapperSuffix, false)
+	if err != nil {
+		return nil, newCompileError(filePath, err, 0, len(moduleWrapperPrefix))
+	}
+	return program, nil
+}
+
+// compileRequiredModule compiles a file loaded with require into the same
+// wrapper without the return, as the module sets module.exports itself.
+// JSON files export their parsed content.
+func compileRequiredModule(filePath string, content []byte) (*js.Program, error) {
+	source := string(content)
+	if path.Ext(filePath) == ".json" {
+		source = "module.exports = JSON.parse('" + template.JSEscapeString(source) + "')"
+	}
+	return js.Compile(filePath, moduleWrapperPrefix+source+"\n})", false)
+}
+
+// programKey identifies a file of a filesystem, as several sites may have
+// routes at the same path
+func programKey(fsys filesystem.FileSystem, filePath string) string {
+	return fmt.Sprintf("%T-%p:%s", fsys, fsys, filePath)
+}
+
+// load returns the compiled module wrapper of the file at filePath, whose
+// current stat is info. The file is only read when its modification time or
+// size changed, and only compiled again when its content did.
+func (c *programCache) load(fsys filesystem.FileSystem, filePath string, info fs.FileInfo) (*js.Program, error) {
+	key := programKey(fsys, filePath)
+	c.mu.RLock()
+	cached := c.programs[key]
+	c.mu.RUnlock()
+	if cached != nil && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		c.hits.Add(1)
+		return cached.program, nil
+	}
+
+	content, err := fsys.ReadFile(filePath)
+	if err != nil {
+		return nil, newNotFoundError(filePath, fmt.Errorf("failed to read file %s (filesystem type: %T): %w", filePath, fsys, err))
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	entry := &routeProgram{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	if cached != nil && cached.hash == hash {
+		// Touched but unchanged
+		c.hits.Add(1)
+		entry.program, entry.config = cached.program, cached.config
+	} else {
+		program, err := c.compile(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		c.misses.Add(1)
+		entry.program = program
+	}
+
+	c.mu.Lock()
+	c.programs[key] = entry
+	c.mu.Unlock()
+	return entry.program, nil
+}
+
+// setConfig records the config export of the route compiled into program
+func (c *programCache) setConfig(fsys filesystem.FileSystem, filePath string, program *js.Program, config *RouteConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached := c.programs[programKey(fsys, filePath)]; cached != nil && cached.program == program {
+		cached.config = config
+	}
+}
+
+// routeConfig returns the config export of the route at filePath, whose
+// current stat is info, once an engine has run that version of it
+func (c *programCache) routeConfig(fsys filesystem.FileSystem, filePath string, info fs.FileInfo) (*RouteConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cached := c.programs[programKey(fsys, filePath)]
+	if cached == nil || cached.config == nil || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+		return nil, false
+	}
+	return cached.config, true
+}
+
+// forget drops the compiled modules of fsys
+func (c *programCache) forget(fsys filesystem.FileSystem) {
+	prefix := programKey(fsys, "")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.programs {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.programs, key)
+		}
+	}
+}
+
+// WarmRoutePrograms compiles the route modules in files ahead of their first
+// request and returns how many are ready. Modules that fail to compile are
+// skipped; the error is reported when the route is requested.
+func WarmRoutePrograms(fsys filesystem.FileSystem, files []string) int {
+	start := time.Now()
+	ready := 0
+	for _, filePath := range files {
+		info, err := fsys.Stat(filePath)
+		if err != nil {
+			continue
+		}
+		if _, err := routePrograms.load(fsys, filePath, info); err != nil {
+			logging.Debug("Skipped warming route module", "file", filePath, "error", err)
+			continue
+		}
+		ready++
+	}
+	if len(files) > 0 {
+		logging.Debug("Compiled JavaScript routes", "count", ready, "duration", time.Since(start).Round(time.Millisecond).String())
+	}
+	return ready
+}
+
+// RouteProgramStats returns the usage of the compiled route modules
+func RouteProgramStats() ProgramCacheStats {
+	routePrograms.mu.RLock()
+	programs := len(routePrograms.programs)
+	routePrograms.mu.RUnlock()
+	return ProgramCacheStats{
+		Programs: programs,
+		Hits:     routePrograms.hits.Load(),
+		Misses:   routePrograms.misses.Load(),
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/rediwo/redi/cache"
 	"github.com/rediwo/redi/filesystem"
 	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
 	"github.com/rediwo/redi/utils"
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/css"
@@ -55,6 +56,9 @@ type SvelteConfig struct {
 	// Vimesh Style settings
 	VimeshStyle     *utils.VimeshStyleConfig // Vimesh Style configuration
 	VimeshStylePath string                   // Path for Vimesh Style resource (default: "/svelte/vimesh-style.js")
+
+	// Compiler settings
+	CompilerPoolSize int // Compiler runtimes compiling in parallel (default: number of CPUs)
 }
 
 // DefaultSvelteConfig returns default Svelte settings
@@ -77,11 +81,8 @@ func DefaultSvelteConfig() *SvelteConfig {
 
 type SvelteHandler struct {
 	fs                  filesystem.FileSystem
-	vm                  *goja.Runtime
-	compileFunc         goja.Callable
-	initialized         bool
+	compilers           *svelteCompilerPool // Compiler runtimes, so components compile in parallel
 	templateHandler     *TemplateHandler
-	mu                  sync.Mutex
 	cache               map[string]*CachedResult
 	cacheMu             sync.RWMutex
 	config              *SvelteConfig
@@ -100,6 +101,8 @@ type SvelteHandler struct {
 	importTransformer   *ImportTransformer        // Common import handling
 	routesDir           string                    // Routes directory path
 	persistentCache     *cache.SvelteCache        // Persistent disk cache
+	deps                *cache.DependencyGraph    // Component and asset imports, persisted with the disk cache
+	errorHandler        *ErrorHandler             // Renders compile errors, if set
 }
 
 type CachedResult struct {
@@ -152,8 +155,14 @@ func NewSvelteHandlerWithConfig(fs filesystem.FileSystem, config *SvelteConfig)
 	m.Add("application/javascript", jsMinifier)
 	m.AddFunc("text/css", css.Minify)
 
+	poolSize := 0
+	if config != nil {
+		poolSize = config.CompilerPoolSize
+	}
+
 	return &SvelteHandler{
 		fs:                fs,
+		compilers:         newSvelteCompilerPool(poolSize),
 		templateHandler:   NewTemplateHandler(fs),
 		cache:             make(map[string]*CachedResult),
 		config:            config,
@@ -161,6 +170,7 @@ func NewSvelteHandlerWithConfig(fs filesystem.FileSystem, config *SvelteConfig)
 		componentRegistry: make(map[string]*ComponentInfo),
 		importTransformer: NewImportTransformer(fs),
 		routesDir:         "routes", // Default value
+		deps:              cache.NewDependencyGraph(fs, nil, ""),
 	}
 }
 
@@ -182,6 +192,34 @@ func NewSvelteHandlerWithRouterAndRoutesDir(fs filesystem.FileSystem, config *Sv
 // SetPersistentCache sets the persistent cache for the handler
 func (sh *SvelteHandler) SetPersistentCache(cache *cache.SvelteCache) {
 	sh.persistentCache = cache
+	if cache != nil {
+		sh.deps = cache.Graph()
+	}
+}
+
+// ClearCache drops all compiled pages and components held in memory
+func (sh *SvelteHandler) ClearCache() {
+	sh.cacheMu.Lock()
+	sh.cache = make(map[string]*CachedResult)
+	sh.cacheMu.Unlock()
+
+	sh.registryMu.Lock()
+	sh.componentRegistry = make(map[string]*ComponentInfo)
+	sh.registryMu.Unlock()
+}
+
+// SetErrorHandler sets the error handler used to render compile errors
+func (sh *SvelteHandler) SetErrorHandler(eh *ErrorHandler) {
+	sh.errorHandler = eh
+}
+
+// serveError writes a compile or dependency error for a page request
+func (sh *SvelteHandler) serveError(w http.ResponseWriter, r *http.Request, prefix string, err error) {
+	if sh.errorHandler != nil {
+		sh.errorHandler.HandleError(w, r, err)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", prefix, err), http.StatusInternalServerError)
 }
 
 // generateConfigHash generates a hash of the current configuration for cache invalidation
@@ -813,149 +851,77 @@ func (sh *SvelteHandler) getComponentInfo(componentPath string) (*ComponentInfo,
 	sh.componentRegistry[componentPath] = info
 	sh.registryMu.Unlock()
 
+	// Record the component and asset imports for change detection
+	dependencies := append([]string(nil), info.Dependencies...)
+	dependencies = append(dependencies, sh.importTransformer.AssetDependencies(contentStr, componentPath, []string{".svelte"})...)
+	sh.deps.Record(componentPath, dependencies)
+
 	return info, nil
 }
 
-func (sh *SvelteHandler) initializeCompiler() error {
-	if sh.initialized {
-		return nil
-	}
-
-	sh.vm = goja.New()
-	sh.vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
-
-	// Provide required globals for Svelte compiler
-	sh.vm.Set("global", sh.vm.GlobalObject())
-	sh.vm.Set("window", sh.vm.GlobalObject())
-
-	_, err := sh.vm.RunString(`
-		// Polyfill performance.now() for Svelte compiler
-		if (typeof performance === 'undefined') {
-			performance = {
-				now: function() {
-					return Date.now();
-				}
-			};
-		}
-		
-		// Polyfill console if needed
-		if (typeof console === 'undefined') {
-			console = {
-				log: function() {},
-				warn: function() {},
-				error: function() {}
-			};
-		}
-		
-		// Polyfill btoa for base64 encoding
-		if (typeof btoa === 'undefined') {
-			btoa = function(str) {
-				var chars = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=';
-				var encoded = '';
-				var c1, c2, c3;
-				var e1, e2, e3, e4;
-				
-				for (var i = 0; i < str.length; ) {
-					c1 = str.charCodeAt(i++);
-					c2 = str.charCodeAt(i++);
-					c3 = str.charCodeAt(i++);
-					
-					e1 = c1 >> 2;
-					e2 = ((c1 & 3) << 4) | (c2 >> 4);
-					e3 = ((c2 & 15) << 2) | (c3 >> 6);
-					e4 = c3 & 63;
-					
-					if (isNaN(c2)) {
-						e3 = e4 = 64;
-					} else if (isNaN(c3)) {
-						e4 = 64;
-					}
-					
-					encoded += chars.charAt(e1) + chars.charAt(e2) + chars.charAt(e3) + chars.charAt(e4);
-				}
-				
-				return encoded;
-			};
-		}
-		
-		// Polyfill atob for base64 decoding
-		if (typeof atob === 'undefined') {
-			atob = function(str) {
-				var chars = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=';
-				var decoded = '';
-				var c1, c2, c3;
-				var e1, e2, e3, e4;
-				
-				str = str.replace(/[^A-Za-z0-9\+\/\=]/g, '');
-				
-				for (var i = 0; i < str.length; ) {
-					e1 = chars.indexOf(str.charAt(i++));
-					e2 = chars.indexOf(str.charAt(i++));
-					e3 = chars.indexOf(str.charAt(i++));
-					e4 = chars.indexOf(str.charAt(i++));
-					
-					c1 = (e1 << 2) | (e2 >> 4);
-					c2 = ((e2 & 15) << 4) | (e3 >> 2);
-					c3 = ((e3 & 3) << 6) | e4;
-					
-					decoded += String.fromCharCode(c1);
-					
-					if (e3 != 64) {
-						decoded += String.fromCharCode(c2);
-					}
-					if (e4 != 64) {
-						decoded += String.fromCharCode(c3);
-					}
-				}
-				
-				return decoded;
-			};
+// invalidateChanged drops the compiled pages and components built from the
+// changed files or from components importing them, and the disk cache
+// entries of the changed files and of the components depending on them
+func (sh *SvelteHandler) invalidateChanged(changed []string) {
+	stale := make(map[string]bool)
+	for _, file := range changed {
+		stale[file] = true
+		for _, dependent := range sh.deps.Dependents(file) {
+			stale[dependent] = true
 		}
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to setup polyfills: %w", err)
-	}
-
-	// Load the Svelte compiler
-	_, err = sh.vm.RunString(svelteCompilerJS)
-	if err != nil {
-		return fmt.Errorf("failed to load Svelte compiler: %w", err)
 	}
 
-	// Check if svelte object exists
-	svelteObj := sh.vm.Get("svelte")
-	if svelteObj == nil {
-		return fmt.Errorf("svelte object not found")
+	sh.registryMu.Lock()
+	for path := range stale {
+		delete(sh.componentRegistry, path)
 	}
+	sh.registryMu.Unlock()
 
-	// Get the compile function
-	svelteObjValue := svelteObj.ToObject(sh.vm)
-	if svelteObjValue == nil {
-		return fmt.Errorf("svelte is not an object")
+	sh.cacheMu.Lock()
+	for path := range stale {
+		delete(sh.cache, path)
 	}
+	sh.cacheMu.Unlock()
 
-	compileFunc := svelteObjValue.Get("compile")
-	if compileFunc == nil {
-		return fmt.Errorf("svelte.compile not found")
+	if sh.persistentCache != nil {
+		for _, file := range changed {
+			if err := sh.persistentCache.InvalidatePath(file); err != nil {
+				logging.Warn("Failed to invalidate cached component", "component", file, "error", err)
+			}
+			if err := sh.persistentCache.InvalidateDependents(file); err != nil {
+				logging.Warn("Failed to invalidate components depending on a changed file", "file", file, "error", err)
+			}
+		}
 	}
+	logging.Debug("Invalidated changed Svelte dependencies", "changed", len(changed), "stale", len(stale))
+}
 
-	callable, ok := goja.AssertFunction(compileFunc)
-	if !ok {
-		return fmt.Errorf("svelte.compile is not a function")
+// initializeCompiler loads the first compiler runtime, so that a broken
+// compiler is reported before any component is compiled
+func (sh *SvelteHandler) initializeCompiler() error {
+	compiler, err := sh.compilers.acquire()
+	if err != nil {
+		return err
 	}
-	sh.compileFunc = callable
-
-	sh.initialized = true
+	sh.compilers.release(compiler)
 	return nil
 }
 
-func (sh *SvelteHandler) compileSvelte(source string, filename string) (*SvelteCompileResult, error) {
-	sh.mu.Lock()
-	defer sh.mu.Unlock()
+// CompilerStats returns the usage of the compiler runtime pool
+func (sh *SvelteHandler) CompilerStats() CompilerPoolStats {
+	return sh.compilers.stats()
+}
+
+func (sh *SvelteHandler) compileSvelte(source string, filename string) (compiled *SvelteCompileResult, err error) {
+	start := time.Now()
+	defer func() { observeSvelteCompile(start, err) }()
 
-	if err := sh.initializeCompiler(); err != nil {
+	compiler, err := sh.compilers.acquire()
+	if err != nil {
 		return nil, err
 	}
+	defer sh.compilers.release(compiler)
+	vm := compiler.vm
 
 	// Compile options - use minimal required options
 	options := map[string]interface{}{
@@ -966,20 +932,20 @@ func (sh *SvelteHandler) compileSvelte(source string, filename string) (*SvelteC
 	}
 
 	// Call compile function
-	result, err := sh.compileFunc(goja.Undefined(), sh.vm.ToValue(source), sh.vm.ToValue(options))
+	result, err := compiler.compile(goja.Undefined(), vm.ToValue(source), vm.ToValue(options))
 	if err != nil {
-		return nil, fmt.Errorf("compilation failed: %w", err)
+		return nil, newSvelteCompileError(filename, err, vm)
 	}
 
 	// Extract result
-	resultObj := result.ToObject(sh.vm)
+	resultObj := result.ToObject(vm)
 	if resultObj == nil {
 		return nil, fmt.Errorf("compilation returned nil result")
 	}
 
 	js := ""
 	if jsValue := resultObj.Get("js"); jsValue != nil {
-		if jsObj := jsValue.ToObject(sh.vm); jsObj != nil {
+		if jsObj := jsValue.ToObject(vm); jsObj != nil {
 			if code := jsObj.Get("code"); code != nil {
 				js = code.String()
 			}
@@ -988,7 +954,7 @@ func (sh *SvelteHandler) compileSvelte(source string, filename string) (*SvelteC
 
 	css := ""
 	if cssValue := resultObj.Get("css"); cssValue != nil {
-		if cssObj := cssValue.ToObject(sh.vm); cssObj != nil {
+		if cssObj := cssValue.ToObject(vm); cssObj != nil {
 			if code := cssObj.Get("code"); code != nil {
 				css = code.String()
 			}
@@ -1013,10 +979,29 @@ func (sh *SvelteHandler) Handle(route Route) http.HandlerFunc {
 		contentHash := sh.calculateMD5(contentStr)
 		configHash := sh.calculateConfigHash()
 
+		// The dependency graph finds changed components and assets with a
+		// stat per file, so an unchanged page is served without walking and
+		// resolving its dependencies
+		changed, known := sh.deps.Changed(route.FilePath)
+		if len(changed) > 0 {
+			sh.invalidateChanged(changed)
+		}
+
+		sh.cacheMu.RLock()
+		cached, exists := sh.cache[route.FilePath]
+		sh.cacheMu.RUnlock()
+		if known && len(changed) == 0 && exists && cached.ContentHash == contentHash && cached.ConfigHash == configHash {
+			log.Printf("Serving cached Svelte component: %s (hash: %s)", route.FilePath, contentHash)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("X-Svelte-Cached", "true")
+			w.Write([]byte(withCSPNonce(cached.HTML, r)))
+			return
+		}
+
 		// Collect all dependencies
 		allComponents, err := sh.collectAllDependencies(route.FilePath, nil)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to collect dependencies: %v", err), http.StatusInternalServerError)
+			sh.serveError(w, r, "Failed to collect dependencies", err)
 			return
 		}
 
@@ -1035,7 +1020,7 @@ func (sh *SvelteHandler) Handle(route Route) http.HandlerFunc {
 
 		// Check cache first
 		sh.cacheMu.RLock()
-		cached, exists := sh.cache[route.FilePath]
+		cached, exists = sh.cache[route.FilePath]
 		sh.cacheMu.RUnlock()
 
 		// If cached and both content hash and config match, and no dependencies changed
@@ -1055,7 +1040,7 @@ func (sh *SvelteHandler) Handle(route Route) http.HandlerFunc {
 				log.Printf("Serving cached Svelte component: %s (hash: %s)", route.FilePath, contentHash)
 				w.Header().Set("Content-Type", "text/html; charset=utf-8")
 				w.Header().Set("X-Svelte-Cached", "true")
-				w.Write([]byte(cached.HTML))
+				w.Write([]byte(withCSPNonce(cached.HTML, r)))
 				return
 			}
 		}
@@ -1069,7 +1054,7 @@ func (sh *SvelteHandler) Handle(route Route) http.HandlerFunc {
 			// Use persistent cache
 			cacheEntry, err := sh.compileWithCache(route.FilePath, contentStr)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Svelte compilation error: %v", err), http.StatusInternalServerError)
+				sh.serveError(w, r, "Svelte compilation error", err)
 				return
 			}
 			result = &SvelteCompileResult{
@@ -1081,7 +1066,7 @@ func (sh *SvelteHandler) Handle(route Route) http.HandlerFunc {
 			// No persistent cache, compile directly
 			result, err = sh.compileSvelte(contentStr, route.FilePath)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Svelte compilation error: %v", err), http.StatusInternalServerError)
+				sh.serveError(w, r, "Svelte compilation error", err)
 				return
 			}
 			wasCompiledFromCache = false
@@ -1107,7 +1092,7 @@ func (sh *SvelteHandler) Handle(route Route) http.HandlerFunc {
 		} else {
 			w.Header().Set("X-Svelte-Cached", "false")
 		}
-		w.Write([]byte(html))
+		w.Write([]byte(withCSPNonce(html, r)))
 	}
 }
 
@@ -1214,6 +1199,20 @@ func (sh *SvelteHandler) transformToIIFE(jsCode string, componentClassName strin
 	return jsCode
 }
 
+// cspNonceAttr marks the tags of generated pages that get the request's
+// Content-Security-Policy nonce; pages are cached, nonces are per request
+const cspNonceAttr = ` nonce="__REDI_CSP_NONCE__"`
+
+// withCSPNonce fills in the request's CSP nonce, or drops the nonce
+// attributes when CSP is disabled
+func withCSPNonce(html string, r *http.Request) string {
+	nonce := middleware.CSPNonce(r.Context())
+	if nonce == "" {
+		return strings.ReplaceAll(html, cspNonceAttr, "")
+	}
+	return strings.ReplaceAll(html, cspNonceAttr, ` nonce="`+nonce+`"`)
+}
+
 func (sh *SvelteHandler) generateHTMLWithRuntime(result *SvelteCompileResult, componentName string, svelteSource string, allComponents []*ComponentInfo, componentPath string) string {
 	// Remove .svelte extension
 	componentName = strings.TrimSuffix(componentName, ".svelte")
@@ -1253,22 +1252,22 @@ func (sh *SvelteHandler) generateHTMLWithRuntime(result *SvelteCompileResult, co
 		if err != nil {
 			log.Printf("Failed to extract Vimesh Style CSS: %v", err)
 		} else if extractedCSS != "" {
-			vimeshCSS = fmt.Sprintf(`<style id="vimesh-styles">%s</style>`, extractedCSS)
+			vimeshCSS = fmt.Sprintf(`<style id="vimesh-styles"%s>%s</style>`, cspNonceAttr, extractedCSS)
 			// Add Vimesh Style runtime script
-			vimeshScript = fmt.Sprintf(`<script src="%s"></script>`, sh.config.VimeshStylePath)
+			vimeshScript = fmt.Sprintf(`<script src="%s"%s></script>`, sh.config.VimeshStylePath, cspNonceAttr)
 		}
 	}
 
 	// Add async library script if enabled
 	var asyncScript string
 	if sh.config.EnableAsyncLoading {
-		asyncScript = fmt.Sprintf(`<script src="%s"></script>`, sh.config.AsyncLibraryPath)
+		asyncScript = fmt.Sprintf(`<script src="%s"%s></script>`, sh.config.AsyncLibraryPath, cspNonceAttr)
 	}
 
 	var runtimeScript string
 	if sh.config.UseExternalRuntime {
 		// Use external runtime script
-		runtimeScript = fmt.Sprintf(`<script src="%s"></script>`, sh.config.RuntimePath)
+		runtimeScript = fmt.Sprintf(`<script src="%s"%s></script>`, sh.config.RuntimePath, cspNonceAttr)
 	} else {
 		// Inline runtime script
 		runtime := sh.getMinifiedRuntime()
@@ -1276,10 +1275,10 @@ func (sh *SvelteHandler) generateHTMLWithRuntime(result *SvelteCompileResult, co
 		if sh.config.MinifyRuntime && !sh.config.DevMode {
 			runtimeComment += " (minified)"
 		}
-		runtimeScript = fmt.Sprintf(`<script>
+		runtimeScript = fmt.Sprintf(`<script%s>
         %s
         %s
-    </script>`, runtimeComment, runtime)
+    </script>`, cspNonceAttr, runtimeComment, runtime)
 	}
 
 	// Collect all CSS from dependencies
@@ -1336,7 +1335,7 @@ func (sh *SvelteHandler) generateHTMLWithRuntime(result *SvelteCompileResult, co
 <head>
     <meta charset="utf-8">
     <title>` + componentName + `</title>
-    <style>` + allCSS.String() + `</style>
+    <style` + cspNonceAttr + `>` + allCSS.String() + `</style>
     ` + vimeshCSS + `
     ` + vimeshScript + `
     ` + asyncScript + `
@@ -1344,7 +1343,7 @@ func (sh *SvelteHandler) generateHTMLWithRuntime(result *SvelteCompileResult, co
 <body>
     <div id="app"></div>
     ` + runtimeScript + `
-    <script>
+    <script` + cspNonceAttr + `>
         ` + componentRegistry.String() + `
         ` + allJS.String() + `
         ` + componentComment + `
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dop251/goja"
+)
+
+// svelteCompilerPolyfills provides the browser globals the Svelte compiler
+// expects
+const svelteCompilerPolyfills = `
+	// Polyfill performance.now() for Svelte compiler
+	if (typeof performance === 'undefined') {
+		performance = {
+			now: function() {
+				return Date.now();
+			}
+		};
+	}
+	
+	// Polyfill console if needed
+	if (typeof console === 'undefined') {
+		console = {
+			log: function() {},
+			warn: function() {},
+			error: function() {}
+		};
+	}
+	
+	// Polyfill btoa for base64 encoding
+	if (typeof btoa === 'undefined') {
+		btoa = function(str) {
+			var chars = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=';
+			var encoded = '';
+			var c1, c2, c3;
+			var e1, e2, e3, e4;
+			
+			for (var i = 0; i < str.length; ) {
+				c1 = str.charCodeAt(i++);
+				c2 = str.charCodeAt(i++);
+				c3 = str.charCodeAt(i++);
+				
+				e1 = c1 >> 2;
+				e2 = ((c1 & 3) << 4) | (c2 >> 4);
+				e3 = ((c2 & 15) << 2) | (c3 >> 6);
+				e4 = c3 & 63;
+				
+				if (isNaN(c2)) {
+					e3 = e4 = 64;
+				} else if (isNaN(c3)) {
+					e4 = 64;
+				}
+				
+				encoded += chars.charAt(e1) + chars.charAt(e2) + chars.charAt(e3) + chars.charAt(e4);
+			}
+			
+			return encoded;
+		};
+	}
+	
+	// Polyfill atob for base64 decoding
+	if (typeof atob === 'undefined') {
+		atob = function(str) {
+			var chars = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=';
+			var decoded = '';
+			var c1, c2, c3;
+			var e1, e2, e3, e4;
+			
+			str = str.replace(/[^A-Za-z0-9\+\/\=]/g, '');
+			
+			for (var i = 0; i < str.length; ) {
+				e1 = chars.indexOf(str.charAt(i++));
+				e2 = chars.indexOf(str.charAt(i++));
+				e3 = chars.indexOf(str.charAt(i++));
+				e4 = chars.indexOf(str.charAt(i++));
+				
+				c1 = (e1 << 2) | (e2 >> 4);
+				c2 = ((e2 & 15) << 4) | (e3 >> 2);
+				c3 = ((e3 & 3) << 6) | e4;
+				
+				decoded += String.fromCharCode(c1);
+				
+				if (e3 != 64) {
+					decoded += String.fromCharCode(c2);
+				}
+				if (e4 != 64) {
+					decoded += String.fromCharCode(c3);
+				}
+			}
+			
+			return decoded;
+		};
+	}
+`
+
+var (
+	svelteCompilerOnce    sync.Once
+	svelteCompilerProgram *goja.Program
+	svelteCompilerErr     error
+)
+
+// compiledSvelteCompiler parses the compiler bundle once; the program is
+// shared by every compiler runtime
+func compiledSvelteCompiler() (*goja.Program, error) {
+	svelteCompilerOnce.Do(func() {
+		svelteCompilerProgram, svelteCompilerErr = goja.Compile("svelte-compiler.js", svelteCompilerJS, false)
+	})
+	return svelteCompilerProgram, svelteCompilerErr
+}
+
+// svelteCompiler is a runtime with the Svelte compiler loaded. A runtime
+// can only be used by one goroutine at a time.
+type svelteCompiler struct {
+	vm      *goja.Runtime
+	compile goja.Callable
+}
+
+// newSvelteCompiler creates a runtime and loads the Svelte compiler into it
+func newSvelteCompiler() (*svelteCompiler, error) {
+	program, err := compiledSvelteCompiler()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Svelte compiler: %w", err)
+	}
+
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+
+	// Provide required globals for Svelte compiler
+	vm.Set("global", vm.GlobalObject())
+	vm.Set("window", vm.GlobalObject())
+
+	if _, err := vm.RunString(svelteCompilerPolyfills); err != nil {
+		return nil, fmt.Errorf("failed to setup polyfills: %w", err)
+	}
+
+	// Load the Svelte compiler
+	if _, err := vm.RunProgram(program); err != nil {
+		return nil, fmt.Errorf("failed to load Svelte compiler: %w", err)
+	}
+
+	// Check if svelte object exists
+	svelteObj := vm.Get("svelte")
+	if svelteObj == nil {
+		return nil, fmt.Errorf("svelte object not found")
+	}
+
+	// Get the compile function
+	svelteObjValue := svelteObj.ToObject(vm)
+	if svelteObjValue == nil {
+		return nil, fmt.Errorf("svelte is not an object")
+	}
+
+	compileFunc := svelteObjValue.Get("compile")
+	if compileFunc == nil {
+		return nil, fmt.Errorf("svelte.compile not found")
+	}
+
+	callable, ok := goja.AssertFunction(compileFunc)
+	if !ok {
+		return nil, fmt.Errorf("svelte.compile is not a function")
+	}
+	return &svelteCompiler{vm: vm, compile: callable}, nil
+}
+
+// svelteCompilerPool lends compiler runtimes to concurrent compilations.
+// Loading the compiler is expensive, so runtimes are only created when every
+// existing one is busy, up to the size of the pool; further compilations
+// wait for a runtime to be returned.
+type svelteCompilerPool struct {
+	size    int
+	idle    chan *svelteCompiler
+	mu      sync.Mutex
+	created int
+	waits   atomic.Int64
+}
+
+// CompilerPoolStats is a snapshot of Svelte compiler pool usage
+type CompilerPoolStats struct {
+	Size    int   `json:"size"`    // Maximum number of compiler runtimes
+	Created int   `json:"created"` // Runtimes loaded so far
+	Idle    int   `json:"idle"`    // Runtimes waiting for a compilation
+	Waits   int64 `json:"waits"`   // Compilations that waited for a busy runtime
+}
+
+// newSvelteCompilerPool creates an empty pool of at most size runtimes,
+// one per CPU if size isn't positive
+func newSvelteCompilerPool(size int) *svelteCompilerPool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	return &svelteCompilerPool{
+		size: size,
+		idle: make(chan *svelteCompiler, size),
+	}
+}
+
+// acquire returns an idle compiler, loads a new one if all are busy and the
+// pool isn't full, or else waits for one; release returns it
+func (p *svelteCompilerPool) acquire() (*svelteCompiler, error) {
+	select {
+	case compiler := <-p.idle:
+		return compiler, nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.created < p.size {
+		p.created++
+		p.mu.Unlock()
+		compiler, err := newSvelteCompiler()
+		if err != nil {
+			p.mu.Lock()
+			p.created--
+			p.mu.Unlock()
+			return nil, err
+		}
+		return compiler, nil
+	}
+	p.mu.Unlock()
+
+	p.waits.Add(1)
+	return <-p.idle, nil
+}
+
+// release returns a compiler to the pool
+func (p *svelteCompilerPool) release(compiler *svelteCompiler) {
+	p.idle <- compiler
+}
+
+// stats returns a snapshot of the pool usage
+func (p *svelteCompilerPool) stats() CompilerPoolStats {
+	p.mu.Lock()
+	created := p.created
+	p.mu.Unlock()
+	return CompilerPoolStats{
+		Size:    p.size,
+		Created: created,
+		Idle:    len(p.idle),
+		Waits:   p.waits.Load(),
+	}
+}
@@ -1,14 +1,24 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/rediwo/redi/cache"
-	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
+)
+
+// Outcomes of precompiling a component
+const (
+	PrecompileCompiled = "compiled" // Compiled and stored in the cache
+	PrecompileCached   = "cached"   // Already in the cache
+	PrecompileFailed   = "failed"
 )
 
 // PrecompilePriority represents the priority of a file for precompilation
@@ -18,227 +28,260 @@ type PrecompilePriority struct {
 	Size     int64
 }
 
-// SveltePrecompiler handles background precompilation of Svelte components
+// SveltePrecompiler compiles every Svelte component of the routes directory
+// into the persistent cache, most important first: shared and layout
+// components, components close to the root and the ones used most according
+// to the cache. It runs in the background after startup with Start, or as a
+// build step with Run, and records the outcome of each component in a
+// report.
 type SveltePrecompiler struct {
-	fs              filesystem.FileSystem
-	cache           *cache.SvelteCache
-	handler         *SvelteHandler
-	routesDir       string
-	
-	// Precompilation queue
-	queue           []PrecompilePriority
-	queueMu         sync.Mutex
-	
-	// Worker management
-	workers         int
-	workerWG        sync.WaitGroup
-	stopCh          chan struct{}
-	
-	// Statistics
-	stats           PrecompileStats
-	statsMu         sync.RWMutex
+	handler *SvelteHandler
+	workers int
+
+	mu      sync.Mutex
+	queue   []PrecompilePriority
+	report  *PrecompileReport
+	started bool
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// PrecompileReport is the machine-readable outcome of a precompilation
+type PrecompileReport struct {
+	StartedAt  time.Time          `json:"startedAt"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+	DurationMs float64            `json:"durationMs"`
+	Workers    int                `json:"workers"`
+	Total      int                `json:"total"`
+	Compiled   int                `json:"compiled"`
+	Cached     int                `json:"cached"`
+	Failed     int                `json:"failed"`
+	Progress   float64            `json:"progress"` // Percentage of the components processed
+	Done       bool               `json:"done"`
+	Components []PrecompileResult `json:"components"`
 }
 
-// PrecompileStats tracks precompilation statistics
-type PrecompileStats struct {
-	TotalFiles      int
-	ProcessedFiles  int
-	FailedFiles     int
-	SkippedFiles    int
-	TotalTime       time.Duration
-	StartTime       time.Time
+// PrecompileResult is the outcome for one component
+type PrecompileResult struct {
+	Path       string  `json:"path"`
+	Priority   float64 `json:"priority"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	JSSize     int     `json:"jsSize"`
+	CSSSize    int     `json:"cssSize"`
+	Error      string  `json:"error,omitempty"`
 }
 
-// NewSveltePrecompiler creates a new precompiler instance
-func NewSveltePrecompiler(fs filesystem.FileSystem, cache *cache.SvelteCache, handler *SvelteHandler, routesDir string, workers int) *SveltePrecompiler {
+// NewSveltePrecompiler creates a precompiler for the components of handler
+func NewSveltePrecompiler(handler *SvelteHandler, workers int) *SveltePrecompiler {
 	if workers <= 0 {
-		workers = 2 // Default to 2 workers
+		workers = 4
 	}
-	
 	return &SveltePrecompiler{
-		fs:        fs,
-		cache:     cache,
-		handler:   handler,
-		routesDir: routesDir,
-		workers:   workers,
-		stopCh:    make(chan struct{}),
-		queue:     make([]PrecompilePriority, 0),
+		handler: handler,
+		workers: workers,
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 }
 
-// Start begins the precompilation process
+// Start precompiles in the background; Wait waits for it to finish
 func (sp *SveltePrecompiler) Start() error {
-	sp.statsMu.Lock()
-	sp.stats.StartTime = time.Now()
-	sp.statsMu.Unlock()
-
-	// Scan for Svelte files
-	if err := sp.scanFiles(); err != nil {
-		return fmt.Errorf("failed to scan files: %w", err)
+	if err := sp.begin(); err != nil {
+		return err
 	}
+	go sp.process()
+	return nil
+}
 
-	// Sort queue by priority
-	sp.sortQueue()
-
-	// Start worker goroutines
-	for i := 0; i < sp.workers; i++ {
-		sp.workerWG.Add(1)
-		go sp.worker(i)
+// Run precompiles every component and returns the report. It fails when
+// any component failed to compile.
+func (sp *SveltePrecompiler) Run() (*PrecompileReport, error) {
+	if err := sp.begin(); err != nil {
+		return nil, err
 	}
-
-	return nil
+	sp.process()
+	report := sp.Report()
+	if report.Failed > 0 {
+		return report, fmt.Errorf("pre-build completed with %d errors", report.Failed)
+	}
+	return report, nil
 }
 
-// Stop stops the precompilation process
+// Stop stops a running precompilation after the components being compiled
 func (sp *SveltePrecompiler) Stop() {
-	close(sp.stopCh)
-	sp.workerWG.Wait()
-	
-	sp.statsMu.Lock()
-	sp.stats.TotalTime = time.Since(sp.stats.StartTime)
-	sp.statsMu.Unlock()
+	sp.mu.Lock()
+	started := sp.started
+	select {
+	case <-sp.stopCh:
+	default:
+		close(sp.stopCh)
+	}
+	sp.mu.Unlock()
+	if started {
+		<-sp.done
+	}
+}
+
+// Wait waits for a precompilation started with Start
+func (sp *SveltePrecompiler) Wait() {
+	<-sp.done
 }
 
-// scanFiles scans the routes directory for Svelte files
-func (sp *SveltePrecompiler) scanFiles() error {
-	sp.queueMu.Lock()
-	defer sp.queueMu.Unlock()
+// Report returns a snapshot of the report, complete once Done is set
+func (sp *SveltePrecompiler) Report() *PrecompileReport {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 
-	return sp.scanDirectory(sp.routesDir, 0)
+	if sp.report == nil {
+		return &PrecompileReport{Workers: sp.workers, Components: []PrecompileResult{}}
+	}
+	report := *sp.report
+	report.Components = append([]PrecompileResult{}, sp.report.Components...)
+	if report.FinishedAt == nil {
+		report.DurationMs = durationMs(time.Since(report.StartedAt))
+	}
+	if report.Total > 0 {
+		report.Progress = math.Round(float64(len(report.Components))/float64(report.Total)*1000) / 10
+	} else if report.Done {
+		report.Progress = 100
+	}
+	return &report
 }
 
-// scanDirectory recursively scans a directory for Svelte files
-func (sp *SveltePrecompiler) scanDirectory(dir string, depth int) error {
-	entries, err := sp.fs.ReadDir(dir)
+// WriteReport writes the report as JSON to path
+func (sp *SveltePrecompiler) WriteReport(path string) error {
+	data, err := json.MarshalIndent(sp.Report(), "", "  ")
 	if err != nil {
 		return err
 	}
-
-	for _, entry := range entries {
-		// Skip hidden files and directories
-		if entry.Name()[0] == '.' || entry.Name()[0] == '_' {
-			continue
-		}
-
-		path := filepath.Join(dir, entry.Name())
-
-		if entry.IsDir() {
-			// Recursively scan subdirectory
-			if err := sp.scanDirectory(path, depth+1); err != nil {
-				return err
-			}
-		} else if filepath.Ext(entry.Name()) == ".svelte" {
-			// Calculate priority
-			priority := sp.calculatePriority(path, depth)
-			
-			// Get file size
-			info, err := sp.fs.Stat(path)
-			if err != nil {
-				continue
-			}
-
-			// Add to queue
-			sp.queue = append(sp.queue, PrecompilePriority{
-				Path:     path,
-				Priority: priority,
-				Size:     info.Size(),
-			})
-			
-			sp.statsMu.Lock()
-			sp.stats.TotalFiles++
-			sp.statsMu.Unlock()
-		}
-	}
-
-	return nil
+	return os.WriteFile(path, append(data, '\n'), 0644)
 }
 
-// calculatePriority calculates the precompilation priority for a file
-func (sp *SveltePrecompiler) calculatePriority(path string, depth int) float64 {
-	priority := 10.0
-
-	// Shared components get highest priority
-	if filepath.Base(filepath.Dir(path)) == "_lib" {
-		priority += 50.0
+// begin scans the components and queues them by priority
+func (sp *SveltePrecompiler) begin() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.started {
+		return fmt.Errorf("precompilation already started")
 	}
 
-	// Layout components get high priority
-	if filepath.Base(filepath.Dir(path)) == "_layout" {
-		priority += 30.0
+	logging.Info("Scanning for Svelte components")
+	files, err := sp.handler.GetAllSvelteFiles()
+	if err != nil {
+		return fmt.Errorf("failed to scan components: %w", err)
 	}
 
-	// Index files get higher priority
-	if filepath.Base(path) == "index.svelte" {
-		priority += 20.0
+	var accessCounts map[string]int
+	if sp.handler.persistentCache != nil {
+		accessCounts = sp.handler.persistentCache.AccessCounts()
 	}
-
-	// Files closer to root get higher priority
-	priority -= float64(depth) * 2.0
-
-	// Common component names get higher priority
-	basename := filepath.Base(path)
-	commonNames := []string{"App", "Layout", "Header", "Footer", "Nav", "Menu", "Button", "Card", "Modal", "Form"}
-	for _, name := range commonNames {
-		if basename == name+".svelte" {
-			priority += 10.0
-			break
+	sp.queue = make([]PrecompilePriority, 0, len(files))
+	for _, path := range files {
+		var size int64
+		if info, err := sp.handler.fs.Stat(path); err == nil {
+			size = info.Size()
 		}
+		sp.queue = append(sp.queue, PrecompilePriority{
+			Path:     path,
+			Priority: sp.calculatePriority(path, accessCounts[path]),
+			Size:     size,
+		})
 	}
+	sp.sortQueue()
 
-	return priority
+	sp.report = &PrecompileReport{
+		StartedAt:  time.Now(),
+		Workers:    sp.workers,
+		Total:      len(sp.queue),
+		Components: make([]PrecompileResult, 0, len(sp.queue)),
+	}
+	sp.started = true
+	return nil
 }
 
-// sortQueue sorts the precompilation queue by priority
-func (sp *SveltePrecompiler) sortQueue() {
-	sp.queueMu.Lock()
-	defer sp.queueMu.Unlock()
+// process compiles the queued components with the workers
+func (sp *SveltePrecompiler) process() {
+	defer close(sp.done)
 
-	sort.Slice(sp.queue, func(i, j int) bool {
-		// Sort by priority (descending), then by size (ascending)
-		if sp.queue[i].Priority != sp.queue[j].Priority {
-			return sp.queue[i].Priority > sp.queue[j].Priority
+	if total := len(sp.queue); total == 0 {
+		logging.Info("No Svelte components found to pre-build")
+	} else {
+		logging.Info("Starting pre-build", "components", total, "workers", sp.workers)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < sp.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sp.worker()
+		}()
+	}
+	wg.Wait()
+
+	sp.mu.Lock()
+	finishedAt := time.Now()
+	elapsed := finishedAt.Sub(sp.report.StartedAt)
+	sp.report.FinishedAt = &finishedAt
+	sp.report.DurationMs = durationMs(elapsed)
+	sp.report.Done = true
+	report := *sp.report
+	failures := make([]PrecompileResult, 0, report.Failed)
+	for _, result := range report.Components {
+		if result.Status == PrecompileFailed {
+			failures = append(failures, result)
 		}
-		return sp.queue[i].Size < sp.queue[j].Size
-	})
+	}
+	sp.mu.Unlock()
+
+	logging.Info("Pre-build completed",
+		"duration", elapsed.Round(time.Millisecond).String(),
+		"compiled", report.Compiled,
+		"cached", report.Cached,
+		"errors", report.Failed)
+	for _, failure := range failures {
+		logging.Error("Compilation error", "file", failure.Path, "error", failure.Error)
+	}
 }
 
-// worker is the precompilation worker goroutine
-func (sp *SveltePrecompiler) worker(id int) {
-	defer sp.workerWG.Done()
-
+// worker compiles components from the queue until it is empty or stopped
+func (sp *SveltePrecompiler) worker() {
 	for {
 		select {
 		case <-sp.stopCh:
 			return
 		default:
-			// Get next file from queue
-			file, ok := sp.getNextFile()
-			if !ok {
-				// No more files, worker can exit
-				return
-			}
-
-			// Precompile the file
-			if err := sp.precompileFile(file.Path); err != nil {
-				sp.statsMu.Lock()
-				sp.stats.FailedFiles++
-				sp.statsMu.Unlock()
-				
-				// Log error but continue
-				fmt.Printf("Precompiler worker %d: failed to compile %s: %v\n", id, file.Path, err)
-			} else {
-				sp.statsMu.Lock()
-				sp.stats.ProcessedFiles++
-				sp.statsMu.Unlock()
-			}
 		}
+		file, ok := sp.getNextFile()
+		if !ok {
+			return
+		}
+		result := sp.precompileFile(file)
+
+		sp.mu.Lock()
+		switch result.Status {
+		case PrecompileCompiled:
+			sp.report.Compiled++
+		case PrecompileCached:
+			sp.report.Cached++
+		case PrecompileFailed:
+			sp.report.Failed++
+		}
+		sp.report.Components = append(sp.report.Components, result)
+		current, total := len(sp.report.Components), sp.report.Total
+		sp.mu.Unlock()
+
+		// Errors are listed once the pre-build completes
+		relativePath := strings.TrimPrefix(file.Path, sp.handler.routesDir+"/")
+		logging.Info("Compiling", "progress", fmt.Sprintf("%d/%d", current, total), "file", relativePath, "status", result.Status)
 	}
 }
 
 // getNextFile gets the next file from the queue
 func (sp *SveltePrecompiler) getNextFile() (PrecompilePriority, bool) {
-	sp.queueMu.Lock()
-	defer sp.queueMu.Unlock()
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 
 	if len(sp.queue) == 0 {
 		return PrecompilePriority{}, false
@@ -251,76 +294,88 @@ func (sp *SveltePrecompiler) getNextFile() (PrecompilePriority, bool) {
 	return file, true
 }
 
-// precompileFile precompiles a single Svelte file
-func (sp *SveltePrecompiler) precompileFile(path string) error {
-	// Read file content
-	content, err := sp.fs.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
+// precompileFile compiles a single component into the cache
+func (sp *SveltePrecompiler) precompileFile(file PrecompilePriority) (result PrecompileResult) {
+	start := time.Now()
+	result = PrecompileResult{Path: file.Path, Priority: file.Priority}
+	defer func() {
+		result.DurationMs = durationMs(time.Since(start))
+	}()
 
-	// Generate config hash for current configuration
-	configHash := sp.handler.generateConfigHash()
-
-	// Check if already cached
-	if _, found := sp.cache.Get(path, content, configHash); found {
-		sp.statsMu.Lock()
-		sp.stats.SkippedFiles++
-		sp.stats.ProcessedFiles--  // Adjust count since we're skipping
-		sp.statsMu.Unlock()
-		return nil
+	content, err := sp.handler.fs.ReadFile(file.Path)
+	if err != nil {
+		result.Status = PrecompileFailed
+		result.Error = fmt.Sprintf("failed to read file: %v", err)
+		return result
 	}
-
-	// Compile using the handler's compile function
-	// This will automatically cache the result
-	_, err = sp.handler.compileWithCache(path, string(content))
+	entry, err := sp.handler.compileWithCache(file.Path, string(content))
 	if err != nil {
-		return fmt.Errorf("compilation failed: %w", err)
+		result.Status = PrecompileFailed
+		result.Error = err.Error()
+		return result
 	}
 
-	return nil
+	result.Status = PrecompileCompiled
+	if entry.WasFromCache {
+		result.Status = PrecompileCached
+	}
+	result.JSSize = len(entry.JavaScript)
+	result.CSSSize = len(entry.CSS)
+	return result
 }
 
-// GetStats returns current precompilation statistics
-func (sp *SveltePrecompiler) GetStats() PrecompileStats {
-	sp.statsMu.RLock()
-	defer sp.statsMu.RUnlock()
-	
-	stats := sp.stats
-	if stats.StartTime.IsZero() {
-		return stats
-	}
-	
-	// Update total time if still running
-	if stats.TotalTime == 0 {
-		stats.TotalTime = time.Since(stats.StartTime)
+// calculatePriority calculates the precompilation priority for a file from
+// where it is and how often it was used
+func (sp *SveltePrecompiler) calculatePriority(path string, accessCount int) float64 {
+	priority := 10.0
+
+	// Shared components get highest priority
+	if filepath.Base(filepath.Dir(path)) == "_lib" {
+		priority += 50.0
 	}
-	
-	return stats
-}
 
-// GetProgress returns the current progress percentage
-func (sp *SveltePrecompiler) GetProgress() float64 {
-	sp.statsMu.RLock()
-	defer sp.statsMu.RUnlock()
+	// Layout components get high priority
+	if filepath.Base(filepath.Dir(path)) == "_layout" {
+		priority += 30.0
+	}
 
-	if sp.stats.TotalFiles == 0 {
-		return 0
+	// Index files get higher priority
+	if filepath.Base(path) == "index.svelte" {
+		priority += 20.0
 	}
 
-	processed := sp.stats.ProcessedFiles + sp.stats.FailedFiles + sp.stats.SkippedFiles
-	return float64(processed) / float64(sp.stats.TotalFiles) * 100
-}
+	// Files closer to root get higher priority
+	relativePath := strings.TrimPrefix(filepath.ToSlash(path), sp.handler.routesDir+"/")
+	priority -= float64(strings.Count(relativePath, "/")) * 2.0
 
-// IsComplete returns whether precompilation is complete
-func (sp *SveltePrecompiler) IsComplete() bool {
-	sp.statsMu.RLock()
-	defer sp.statsMu.RUnlock()
+	// Components used often get higher priority
+	priority += 5.0 * math.Log2(1+float64(accessCount))
 
-	if sp.stats.TotalFiles == 0 {
-		return true
+	// Common component names get higher priority
+	basename := filepath.Base(path)
+	commonNames := []string{"App", "Layout", "Header", "Footer", "Nav", "Menu", "Button", "Card", "Modal", "Form"}
+	for _, name := range commonNames {
+		if basename == name+".svelte" {
+			priority += 10.0
+			break
+		}
 	}
 
-	processed := sp.stats.ProcessedFiles + sp.stats.FailedFiles + sp.stats.SkippedFiles
-	return processed >= sp.stats.TotalFiles
-}
\ No newline at end of file
+	return priority
+}
+
+// sortQueue sorts the precompilation queue by priority
+func (sp *SveltePrecompiler) sortQueue() {
+	sort.SliceStable(sp.queue, func(i, j int) bool {
+		// Sort by priority (descending), then by size (ascending)
+		if sp.queue[i].Priority != sp.queue[j].Priority {
+			return sp.queue[i].Priority > sp.queue[j].Priority
+		}
+		return sp.queue[i].Size < sp.queue[j].Size
+	})
+}
+
+// durationMs returns d in milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rediwo/redi/cache"
+	"github.com/rediwo/redi/filesystem"
+)
+
+func newPrecompilerHandler(t *testing.T) *SvelteHandler {
+	t.Helper()
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("routes/index.svelte", []byte(`<h1>Home</h1>`))
+	fs.WriteFile("routes/_lib/Button.svelte", []byte(`<button><slot /></button>`))
+	fs.WriteFile("routes/blog/posts/detail.svelte", []byte(`<p>Post</p>`))
+	fs.WriteFile("routes/broken.svelte", []byte(`<script>let x = </script>`))
+
+	manager := cache.NewCacheManager(&cache.CacheConfig{
+		RootDir: t.TempDir(),
+		Enabled: true,
+		Backend: cache.NewMemoryBackend(),
+	})
+	manager.SetFileSystem(fs)
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+
+	handler := NewSvelteHandler(fs)
+	handler.SetPersistentCache(cache.NewSvelteCache(manager, fs))
+	return handler
+}
+
+func TestSveltePrecompiler(t *testing.T) {
+	handler := newPrecompilerHandler(t)
+
+	report, err := NewSveltePrecompiler(handler, 2).Run()
+	if err == nil {
+		t.Error("Expected the broken component to fail the pre-build")
+	}
+	if report.Total != 4 || report.Compiled != 3 || report.Failed != 1 || !report.Done || report.Progress != 100 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for _, result := range report.Components {
+		switch {
+		case result.Path == "routes/broken.svelte":
+			if result.Status != PrecompileFailed || result.Error == "" {
+				t.Errorf("Expected a compilation error for %s, got %+v", result.Path, result)
+			}
+		case result.Status != PrecompileCompiled || result.JSSize == 0 || result.DurationMs <= 0:
+			t.Errorf("Expected %s to be compiled, got %+v", result.Path, result)
+		}
+	}
+
+	// The second run finds the components in the cache
+	report, _ = NewSveltePrecompiler(handler, 2).Run()
+	if report.Cached != 3 || report.Compiled != 0 {
+		t.Errorf("Expected 3 cached components, got %+v", report)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	precompiler := NewSveltePrecompiler(handler, 1)
+	precompiler.Run()
+	if err := precompiler.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written PrecompileReport
+	if err := json.Unmarshal(data, &written); err != nil || len(written.Components) != 4 {
+		t.Errorf("Expected a JSON report of 4 components, got %s", data)
+	}
+}
+
+func TestSveltePrecompilerPriority(t *testing.T) {
+	handler := newPrecompilerHandler(t)
+	precompiler := NewSveltePrecompiler(handler, 1)
+	if err := precompiler.begin(); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, file := range precompiler.queue {
+		order = append(order, file.Path)
+	}
+	if order[0] != "routes/_lib/Button.svelte" || order[1] != "routes/index.svelte" || order[3] != "routes/blog/posts/detail.svelte" {
+		t.Errorf("Unexpected precompilation order: %v", order)
+	}
+
+	// Components used often move up
+	if precompiler.calculatePriority("routes/about.svelte", 100) <= precompiler.calculatePriority("routes/about.svelte", 0) {
+		t.Error("Expected access counts to raise the priority")
+	}
+}
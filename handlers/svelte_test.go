@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rediwo/redi/filesystem"
@@ -22,14 +25,17 @@ func TestSvelteHandler_CompilerLoad(t *testing.T) {
 	}
 
 	// Verify compiler is loaded
-	if !handler.initialized {
-		t.Error("Compiler should be initialized")
+	stats := handler.CompilerStats()
+	if stats.Created != 1 || stats.Idle != 1 {
+		t.Errorf("Compiler should be initialized, got %+v", stats)
 	}
 
 	// Verify compile function exists
-	if handler.compileFunc == nil {
+	compiler, err := handler.compilers.acquire()
+	if err != nil || compiler.compile == nil {
 		t.Error("Compile function should be available")
 	}
+	handler.compilers.release(compiler)
 }
 
 func TestSvelteHandler_CompileSimpleComponent(t *testing.T) {
@@ -666,3 +672,143 @@ func TestVimeshStyleMinification(t *testing.T) {
 		})
 	}
 }
+
+func TestSvelteHandler_DependencyChanges(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fs.WriteFile("routes/page.svelte", []byte(`<script>
+    import Card from './Card.svelte';
+</script>
+
+<Card />`))
+	fs.WriteFile("routes/Card.svelte", []byte(`<script>
+    import data from './data.json';
+</script>
+
+<p>{data.title}</p>`))
+	fs.WriteFile("routes/data.json", []byte(`{"title": "First"}`))
+
+	handler := NewSvelteHandler(fs)
+	route := Route{Path: "/page", FilePath: "routes/page.svelte", FileType: "svelte"}
+	request := func() (string, string) {
+		w := httptest.NewRecorder()
+		handler.Handle(route)(w, httptest.NewRequest("GET", "/page", nil))
+		if w.Code != 200 {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String(), w.Header().Get("X-Svelte-Cached")
+	}
+
+	if body, _ := request(); !strings.Contains(body, "First") {
+		t.Fatalf("Expected the JSON import to be inlined, got %s", body)
+	}
+	if deps := handler.deps.Dependencies("routes/Card.svelte"); len(deps) != 1 || deps[0] != "routes/data.json" {
+		t.Errorf("Expected the asset import to be recorded, got %v", deps)
+	}
+	if dependents := handler.deps.Dependents("routes/data.json"); len(dependents) != 2 {
+		t.Errorf("Expected Card and page to depend on data.json, got %v", dependents)
+	}
+	if _, cached := request(); cached != "true" {
+		t.Errorf("Expected an unchanged page to be served from cache, got %q", cached)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	fs.WriteFile("routes/data.json", []byte(`{"title": "Second"}`))
+	body, cached := request()
+	if !strings.Contains(body, "Second") || strings.Contains(body, "First") {
+		t.Errorf("Expected a changed asset to invalidate its importers, got %s", body)
+	}
+	if cached != "false" {
+		t.Errorf("Expected the page to be rebuilt, got X-Svelte-Cached %q", cached)
+	}
+}
+
+func TestSvelteHandler_ParallelCompile(t *testing.T) {
+	config := DefaultSvelteConfig()
+	config.CompilerPoolSize = 2
+	handler := NewSvelteHandlerWithConfig(filesystem.NewMemoryFileSystem(), config)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			source := fmt.Sprintf(`<h1>Component %d</h1>`, i)
+			result, err := handler.compileSvelte(source, fmt.Sprintf("Component%d.svelte", i))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !strings.Contains(result.JS, fmt.Sprintf("Component %d", i)) {
+				errs <- fmt.Errorf("component %d compiled to the wrong output", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Runtimes are created on demand, up to the pool size
+	stats := handler.CompilerStats()
+	if stats.Created < 1 || stats.Created > 2 || stats.Idle != stats.Created {
+		t.Errorf("Expected at most 2 idle compilers, got %+v", stats)
+	}
+}
+
+// benchmarkSvelteCompile compiles a component from parallel goroutines with
+// a pool of poolSize compilers
+func benchmarkSvelteCompile(b *testing.B, poolSize int) {
+	config := DefaultSvelteConfig()
+	config.CompilerPoolSize = poolSize
+	handler := NewSvelteHandlerWithConfig(filesystem.NewMemoryFileSystem(), config)
+	source := `<script>
+    export let items = [];
+    let count = 0;
+    $: doubled = count * 2;
+</script>
+
+<button on:click={() => count++}>Clicked {count} times, doubled {doubled}</button>
+<ul>
+    {#each items as item}
+        <li>{item}</li>
+    {/each}
+</ul>
+
+<style>
+    button { color: red; }
+</style>`
+
+	// Load every compiler before timing
+	compilers := make([]*svelteCompiler, 0, handler.compilers.size)
+	for i := 0; i < handler.compilers.size; i++ {
+		compiler, err := handler.compilers.acquire()
+		if err != nil {
+			b.Fatal(err)
+		}
+		compilers = append(compilers, compiler)
+	}
+	for _, compiler := range compilers {
+		handler.compilers.release(compiler)
+	}
+
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := handler.compileSvelte(source, "Counter.svelte"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkSvelteCompileSingleCompiler(b *testing.B) {
+	benchmarkSvelteCompile(b, 1)
+}
+
+func BenchmarkSvelteCompileCompilerPool(b *testing.B) {
+	benchmarkSvelteCompile(b, 0)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
@@ -16,6 +17,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/i18n"
+	"github.com/rediwo/redi/middleware"
 	"github.com/rediwo/redi/utils"
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/js"
@@ -91,7 +94,7 @@ func (th *TemplateHandler) Handle(route Route) http.HandlerFunc {
 		}
 
 		// Render the template with no data (direct asset access)
-		err = th.RenderTemplate(route.FilePath, string(content), nil, w)
+		err = th.RenderTemplateWithContext(r.Context(), route.FilePath, string(content), nil, w)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Template rendering error: %v", err), http.StatusInternalServerError)
 		}
@@ -100,6 +103,23 @@ func (th *TemplateHandler) Handle(route Route) http.HandlerFunc {
 
 // RenderTemplate renders a template file with the given data
 func (th *TemplateHandler) RenderTemplate(templatePath, templateContent string, data interface{}, w http.ResponseWriter) error {
+	return th.RenderTemplateWithLocale(templatePath, templateContent, data, w, "")
+}
+
+// RenderTemplateWithLocale renders a template file with the given data, using
+// locale for the {{t}} translation function (empty means the default locale)
+func (th *TemplateHandler) RenderTemplateWithLocale(templatePath, templateContent string, data interface{}, w http.ResponseWriter, locale string) error {
+	return th.renderTemplate(context.Background(), templatePath, templateContent, data, w, locale)
+}
+
+// RenderTemplateWithContext renders a template file for a request: the
+// locale, CSRF token and CSP nonce are taken from the request context
+func (th *TemplateHandler) RenderTemplateWithContext(ctx context.Context, templatePath, templateContent string, data interface{}, w http.ResponseWriter) error {
+	return th.renderTemplate(ctx, templatePath, templateContent, data, w, i18n.LocaleFromContext(ctx))
+}
+
+// renderTemplate renders a template file with the given data and locale
+func (th *TemplateHandler) renderTemplate(ctx context.Context, templatePath, templateContent string, data interface{}, w http.ResponseWriter, locale string) error {
 	ext := strings.ToLower(filepath.Ext(templatePath))
 
 	// Process layouts for HTML templates
@@ -112,27 +132,54 @@ func (th *TemplateHandler) RenderTemplate(templatePath, templateContent string,
 	}
 
 	// Choose template engine based on file extension
+	funcs := th.templateFuncs(ctx, locale)
 	switch ext {
 	case ".html":
-		return th.renderHTMLTemplate(templateContent, data, w)
+		return th.renderHTMLTemplate(templateContent, data, w, funcs)
 	case ".md":
-		return th.renderMarkdownTemplate(templateContent, data, w)
+		return th.renderMarkdownTemplate(templateContent, data, w, funcs)
 	case ".json", ".txt", ".css", ".js":
-		return th.renderTextTemplate(templateContent, data, w)
+		return th.renderTextTemplate(templateContent, data, w, funcs)
 	default:
 		// Default to text template for unknown extensions
-		return th.renderTextTemplate(templateContent, data, w)
+		return th.renderTextTemplate(templateContent, data, w, funcs)
+	}
+}
+
+// templateFuncs returns the functions available to all templates
+func (th *TemplateHandler) templateFuncs(ctx context.Context, locale string) map[string]interface{} {
+	translator := i18n.ForFileSystem(th.fs)
+	if locale == "" {
+		locale = translator.DefaultLocale()
+	}
+
+	return map[string]interface{}{
+		// {{t "cart.items" "count" 3}} translates a key for the request locale
+		"t": func(key string, args ...interface{}) string {
+			return translator.T(locale, key, args...)
+		},
+		"locale": func() string {
+			return locale
+		},
+		// <input type="hidden" name="_csrf" value="{{csrfToken}}"> for forms
+		"csrfToken": func() string {
+			return middleware.CSRFToken(ctx)
+		},
+		// <script nonce="{{cspNonce}}"> for inline scripts allowed by the CSP
+		"cspNonce": func() string {
+			return middleware.CSPNonce(ctx)
+		},
 	}
 }
 
 // renderHTMLTemplate renders using html/template
-func (th *TemplateHandler) renderHTMLTemplate(content string, data interface{}, w http.ResponseWriter) error {
+func (th *TemplateHandler) renderHTMLTemplate(content string, data interface{}, w http.ResponseWriter, funcs map[string]interface{}) error {
 	// Process Vimesh Style if enabled
 	if th.config.VimeshStyle != nil && th.config.VimeshStyle.Enable {
 		content = th.processVimeshStyle(content)
 	}
 
-	tmpl, err := htmltemplate.New("template").Parse(content)
+	tmpl, err := htmltemplate.New("template").Funcs(funcs).Parse(content)
 	if err != nil {
 		return fmt.Errorf("HTML template parsing error: %v", err)
 	}
@@ -142,8 +189,8 @@ func (th *TemplateHandler) renderHTMLTemplate(content string, data interface{},
 }
 
 // renderTextTemplate renders using text/template
-func (th *TemplateHandler) renderTextTemplate(content string, data interface{}, w http.ResponseWriter) error {
-	tmpl, err := texttemplate.New("template").Parse(content)
+func (th *TemplateHandler) renderTextTemplate(content string, data interface{}, w http.ResponseWriter, funcs map[string]interface{}) error {
+	tmpl, err := texttemplate.New("template").Funcs(funcs).Parse(content)
 	if err != nil {
 		return fmt.Errorf("text template parsing error: %v", err)
 	}
@@ -156,13 +203,13 @@ func (th *TemplateHandler) renderTextTemplate(content string, data interface{},
 }
 
 // renderMarkdownTemplate converts markdown to HTML and renders it
-func (th *TemplateHandler) renderMarkdownTemplate(content string, data interface{}, w http.ResponseWriter) error {
+func (th *TemplateHandler) renderMarkdownTemplate(content string, data interface{}, w http.ResponseWriter, funcs map[string]interface{}) error {
 	var contentToConvert []byte
 
 	// Only process as template if data is provided
 	if data != nil {
 		// Process as text template to handle Go template variables
-		tmpl, err := texttemplate.New("template").Parse(content)
+		tmpl, err := texttemplate.New("template").Funcs(funcs).Parse(content)
 		if err != nil {
 			return fmt.Errorf("markdown template parsing error: %v", err)
 		}
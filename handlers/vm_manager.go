@@ -57,60 +57,71 @@ func (vm *VMManager) SetupRegistry(loop *eventloop.EventLoop, jsVM *js.Runtime,
 // createModuleLoader creates a module loader function for the require system
 func (vm *VMManager) createModuleLoader(basePath string) func(string) ([]byte, error) {
 	return func(name string) ([]byte, error) {
-		// The name parameter is already resolved by the PathResolver
-		// If it's an absolute path, use it directly
-		var filePath string
-		if filepath.IsAbs(name) {
+		filePath, err := vm.resolveModuleFile(basePath, name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Read the file using unified filesystem interface
+		return vm.fs.ReadFile(filePath)
+	}
+}
+
+// resolveModuleFile returns the file a resolved module name refers to,
+// adding the .js or .json extension or the index file of a directory
+func (vm *VMManager) resolveModuleFile(basePath, name string) (string, error) {
+	// The name parameter is already resolved by the PathResolver
+	// If it's an absolute path, use it directly
+	var filePath string
+	if filepath.IsAbs(name) {
+		filePath = name
+	} else {
+		// Check if name already contains basePath (already resolved by path resolver)
+		if strings.HasPrefix(name, basePath+"/") || name == basePath {
+			// Already resolved path, use as-is
 			filePath = name
 		} else {
-			// Check if name already contains basePath (already resolved by path resolver)
-			if strings.HasPrefix(name, basePath+"/") || name == basePath {
-				// Already resolved path, use as-is
-				filePath = name
+			// For relative paths, resolve from basePath
+			if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+				filePath = filepath.Join(basePath, name)
 			} else {
-				// For relative paths, resolve from basePath
-				if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
-					filePath = filepath.Join(basePath, name)
-				} else {
-					filePath = filepath.Join(basePath, name)
-				}
+				filePath = filepath.Join(basePath, name)
 			}
 		}
+	}
 
-		// Check if this is a directory and look for index.js
-		if info, err := vm.fs.Stat(filePath); err == nil && info.IsDir() {
-			// Try index.js in the directory
-			indexPath := filepath.Join(filePath, "index.js")
+	// Check if this is a directory and look for index.js
+	if info, err := vm.fs.Stat(filePath); err == nil && info.IsDir() {
+		// Try index.js in the directory
+		indexPath := filepath.Join(filePath, "index.js")
+		if _, err := vm.fs.Stat(indexPath); err == nil {
+			filePath = indexPath
+		} else {
+			// Try index.json
+			indexPath = filepath.Join(filePath, "index.json")
 			if _, err := vm.fs.Stat(indexPath); err == nil {
 				filePath = indexPath
 			} else {
-				// Try index.json
-				indexPath = filepath.Join(filePath, "index.json")
-				if _, err := vm.fs.Stat(indexPath); err == nil {
-					filePath = indexPath
-				} else {
-					return nil, require.ModuleFileDoesNotExistError
-				}
+				return "", require.ModuleFileDoesNotExistError
 			}
-		} else {
-			// Add .js extension if not present and file doesn't exist as-is
-			if !strings.HasSuffix(filePath, ".js") && !strings.HasSuffix(filePath, ".json") {
-				if _, err := vm.fs.Stat(filePath); err != nil {
-					// File doesn't exist as-is, try with extensions
-					if _, err := vm.fs.Stat(filePath + ".js"); err == nil {
-						filePath += ".js"
-					} else if _, err := vm.fs.Stat(filePath + ".json"); err == nil {
-						filePath += ".json"
-					} else {
-						return nil, require.ModuleFileDoesNotExistError
-					}
+		}
+	} else {
+		// Add .js extension if not present and file doesn't exist as-is
+		if !strings.HasSuffix(filePath, ".js") && !strings.HasSuffix(filePath, ".json") {
+			if _, err := vm.fs.Stat(filePath); err != nil {
+				// File doesn't exist as-is, try with extensions
+				if _, err := vm.fs.Stat(filePath + ".js"); err == nil {
+					filePath += ".js"
+				} else if _, err := vm.fs.Stat(filePath + ".json"); err == nil {
+					filePath += ".json"
+				} else {
+					return "", require.ModuleFileDoesNotExistError
 				}
 			}
 		}
-
-		// Read the file using unified filesystem interface
-		return vm.fs.ReadFile(filePath)
 	}
+
+	return filePath, nil
 }
 
 // createPathResolver creates a path resolver function that returns absolute paths
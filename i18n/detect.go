@@ -0,0 +1,117 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CookieName is the cookie consulted for an explicit locale choice
+const CookieName = "locale"
+
+type contextKey struct{}
+
+// WithLocale returns a copy of ctx carrying the request locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// LocaleFromContext returns the locale stored in ctx, or "" if none
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok {
+		return locale
+	}
+	return ""
+}
+
+// PathLocale returns the locale prefix of a URL path such as /de/about
+// and the remaining path, if the prefix is a configured locale
+func (t *Translator) PathLocale(path string) (string, string, bool) {
+	trimmed := strings.TrimPrefix(path, "/")
+	segment, rest, _ := strings.Cut(trimmed, "/")
+	if segment == "" || !t.HasLocale(segment) {
+		return "", path, false
+	}
+	return NormalizeLocale(segment), "/" + rest, true
+}
+
+// Detect determines the locale for a request, in order of preference:
+// URL prefix, locale cookie, Accept-Language header, default locale
+func (t *Translator) Detect(r *http.Request) string {
+	if locale, _, ok := t.PathLocale(r.URL.Path); ok {
+		return locale
+	}
+
+	if cookie, err := r.Cookie(CookieName); err == nil && t.HasLocale(cookie.Value) {
+		return NormalizeLocale(cookie.Value)
+	}
+
+	if locale := t.MatchAcceptLanguage(r.Header.Get("Accept-Language")); locale != "" {
+		return locale
+	}
+
+	return t.DefaultLocale()
+}
+
+// MatchAcceptLanguage returns the best configured locale for an
+// Accept-Language header value, or "" if none of them match. Each tag is
+// matched exactly, then on its base language, then against the first
+// regional catalog of that language.
+func (t *Translator) MatchAcceptLanguage(header string) string {
+	for _, tag := range parseAcceptLanguage(header) {
+		if t.HasLocale(tag) {
+			return NormalizeLocale(tag)
+		}
+		base := baseLanguage(NormalizeLocale(tag))
+		if t.HasLocale(base) {
+			return base
+		}
+		// pt matches a pt-BR catalog when there is no pt catalog
+		for _, locale := range t.Locales() {
+			if baseLanguage(locale) == base {
+				return locale
+			}
+		}
+	}
+	return ""
+}
+
+type weightedTag struct {
+	tag     string
+	quality float64
+}
+
+// parseAcceptLanguage returns language tags ordered by quality
+func parseAcceptLanguage(header string) []string {
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		tag, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if tag == "*" || quality <= 0 {
+			continue
+		}
+		tags = append(tags, weightedTag{tag: strings.TrimSpace(tag), quality: quality})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+
+	result := make([]string, len(tags))
+	for i, wt := range tags {
+		result[i] = wt.tag
+	}
+	return result
+}
@@ -0,0 +1,379 @@
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLocalesDir is the directory scanned for message catalogs
+const DefaultLocalesDir = "locales"
+
+// Message represents a single translatable message. Simple messages only
+// have an "other" form, plural messages carry one entry per plural category.
+type Message struct {
+	Forms map[PluralCategory]string
+}
+
+// Catalog holds all messages for a single locale
+type Catalog struct {
+	Locale   string
+	Messages map[string]*Message
+}
+
+// Translator loads message catalogs and translates keys for a locale
+type Translator struct {
+	fs            filesystem.FileSystem
+	localesDir    string
+	catalogs      map[string]*Catalog
+	locales       []string
+	defaultLocale string
+	mu            sync.RWMutex
+}
+
+var (
+	globalTranslators = make(map[string]*Translator)
+	translatorMutex   sync.RWMutex
+)
+
+// NewTranslator creates a translator that reads catalogs from localesDir
+func NewTranslator(fs filesystem.FileSystem, localesDir string) *Translator {
+	if localesDir == "" {
+		localesDir = DefaultLocalesDir
+	}
+	return &Translator{
+		fs:         fs,
+		localesDir: localesDir,
+		catalogs:   make(map[string]*Catalog),
+	}
+}
+
+// ForFileSystem returns the shared translator for the given filesystem,
+// loading its catalogs on first use. Translators are keyed by filesystem
+// instance so that HTTP handlers and JavaScript modules see the same catalogs.
+func ForFileSystem(fs filesystem.FileSystem) *Translator {
+	key := fmt.Sprintf("%T-%p", fs, fs)
+
+	translatorMutex.RLock()
+	if t, exists := globalTranslators[key]; exists {
+		translatorMutex.RUnlock()
+		return t
+	}
+	translatorMutex.RUnlock()
+
+	translatorMutex.Lock()
+	defer translatorMutex.Unlock()
+
+	// Double-check after acquiring write lock
+	if t, exists := globalTranslators[key]; exists {
+		return t
+	}
+
+	t := NewTranslator(fs, DefaultLocalesDir)
+	// A missing locales directory simply means i18n is not used
+	if err := t.Load(); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		logging.Warn("Failed to load locale catalogs", "error", err)
+	}
+	globalTranslators[key] = t
+	return t
+}
+
+// Load (re)loads all catalogs from the locales directory. Each file is named
+// after its locale, e.g. locales/de.json or locales/pt-BR.yaml.
+func (t *Translator) Load() error {
+	entries, err := t.fs.ReadDir(t.localesDir)
+	if err != nil {
+		return err
+	}
+
+	catalogs := make(map[string]*Catalog)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		locale := NormalizeLocale(strings.TrimSuffix(name, filepath.Ext(name)))
+		catalog, err := t.loadCatalog(filepath.Join(t.localesDir, name), locale, ext)
+		if err != nil {
+			return err
+		}
+
+		// Allow a locale to be split across .json and .yaml files
+		if existing, ok := catalogs[locale]; ok {
+			for key, msg := range catalog.Messages {
+				existing.Messages[key] = msg
+			}
+			continue
+		}
+		catalogs[locale] = catalog
+	}
+
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.catalogs = catalogs
+	t.locales = locales
+	if _, ok := catalogs[t.defaultLocale]; !ok {
+		t.defaultLocale = t.pickDefaultLocale()
+	}
+	return nil
+}
+
+// loadCatalog parses a single catalog file
+func (t *Translator) loadCatalog(path, locale, ext string) (*Catalog, error) {
+	data, err := t.fs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog %s: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+	if ext == ".json" {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+	}
+
+	catalog := &Catalog{
+		Locale:   locale,
+		Messages: make(map[string]*Message),
+	}
+	flattenMessages("", raw, catalog.Messages)
+	return catalog, nil
+}
+
+// flattenMessages converts nested catalog objects into dotted keys.
+// Objects whose keys are all plural categories become plural messages.
+func flattenMessages(prefix string, raw map[string]interface{}, out map[string]*Message) {
+	for key, value := range raw {
+		fullKey := key
+		if prefix != "" {
+			fullKey = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if forms, ok := pluralForms(v); ok {
+				out[fullKey] = &Message{Forms: forms}
+			} else {
+				flattenMessages(fullKey, v, out)
+			}
+		case nil:
+			continue
+		default:
+			out[fullKey] = &Message{Forms: map[PluralCategory]string{Other: fmt.Sprint(v)}}
+		}
+	}
+}
+
+// pluralForms returns the plural forms if every key of v is a plural category
+func pluralForms(v map[string]interface{}) (map[PluralCategory]string, bool) {
+	if _, ok := v[string(Other)]; !ok {
+		return nil, false
+	}
+
+	forms := make(map[PluralCategory]string, len(v))
+	for key, value := range v {
+		category := PluralCategory(key)
+		if !category.IsValid() {
+			return nil, false
+		}
+		if _, isMap := value.(map[string]interface{}); isMap {
+			return nil, false
+		}
+		forms[category] = fmt.Sprint(value)
+	}
+	return forms, true
+}
+
+// pickDefaultLocale chooses "en" when available, otherwise the first locale.
+// Caller must hold t.mu.
+func (t *Translator) pickDefaultLocale() string {
+	if _, ok := t.catalogs["en"]; ok {
+		return "en"
+	}
+	if len(t.locales) > 0 {
+		return t.locales[0]
+	}
+	return ""
+}
+
+// Enabled reports whether any catalogs were loaded
+func (t *Translator) Enabled() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.locales) > 0
+}
+
+// Locales returns the configured locales in sorted order
+func (t *Translator) Locales() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	locales := make([]string, len(t.locales))
+	copy(locales, t.locales)
+	return locales
+}
+
+// HasLocale reports whether a catalog exists for the locale
+func (t *Translator) HasLocale(locale string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.catalogs[NormalizeLocale(locale)]
+	return ok
+}
+
+// DefaultLocale returns the fallback locale
+func (t *Translator) DefaultLocale() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.defaultLocale
+}
+
+// SetDefaultLocale sets the fallback locale used when no other locale matches
+func (t *Translator) SetDefaultLocale(locale string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.defaultLocale = NormalizeLocale(locale)
+}
+
+// Translate looks up key for locale and interpolates {name} placeholders
+// from params. A "count" parameter selects the plural form. Lookups fall back
+// from the region locale (de-AT) to the language (de) and then to the default
+// locale; when nothing matches, the key itself is returned.
+func (t *Translator) Translate(locale, key string, params map[string]interface{}) string {
+	msg, resolved := t.lookup(NormalizeLocale(locale), key)
+	if msg == nil {
+		return key
+	}
+
+	text := msg.Forms[Other]
+	if count, ok := params["count"]; ok && len(msg.Forms) > 1 {
+		category := PluralCategoryFor(resolved, toNumber(count))
+		if form, ok := msg.Forms[category]; ok {
+			text = form
+		}
+	}
+
+	return interpolate(text, params)
+}
+
+// T is a convenience wrapper around Translate taking alternating
+// name/value pairs, as used by the template function.
+func (t *Translator) T(locale, key string, pairs ...interface{}) string {
+	return t.Translate(locale, key, pairsToParams(pairs))
+}
+
+// lookup finds a message following the locale fallback chain
+func (t *Translator) lookup(locale, key string) (*Message, string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	candidates := []string{locale}
+	if base := baseLanguage(locale); base != locale {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, candidate := range candidates {
+		if catalog, ok := t.catalogs[candidate]; ok {
+			if msg, ok := catalog.Messages[key]; ok {
+				return msg, candidate
+			}
+		}
+	}
+	return nil, ""
+}
+
+// interpolate replaces {name} placeholders with values from params
+func interpolate(text string, params map[string]interface{}) string {
+	if len(params) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+	for name, value := range params {
+		text = strings.ReplaceAll(text, "{"+name+"}", fmt.Sprint(value))
+	}
+	return text
+}
+
+// pairsToParams converts alternating name/value arguments into a map.
+// A single map argument is used as-is.
+func pairsToParams(pairs []interface{}) map[string]interface{} {
+	if len(pairs) == 1 {
+		if m, ok := pairs[0].(map[string]interface{}); ok {
+			return m
+		}
+	}
+
+	params := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		params[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return params
+}
+
+// toNumber converts a count parameter to an integer
+func toNumber(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		var n int64
+		fmt.Sscan(v, &n)
+		return n
+	default:
+		return 0
+	}
+}
+
+// NormalizeLocale converts locale identifiers to the form used for catalog
+// names: lower-case language with an upper-case region, e.g. "pt_br" -> "pt-BR"
+func NormalizeLocale(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	if locale == "" {
+		return ""
+	}
+	parts := strings.SplitN(locale, "-", 2)
+	if len(parts) == 1 {
+		return strings.ToLower(parts[0])
+	}
+	return strings.ToLower(parts[0]) + "-" + strings.ToUpper(parts[1])
+}
+
+// baseLanguage returns the language part of a locale, e.g. "de-AT" -> "de"
+func baseLanguage(locale string) string {
+	if idx := strings.Index(locale, "-"); idx != -1 {
+		return locale[:idx]
+	}
+	return locale
+}
@@ -0,0 +1,169 @@
+package i18n
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rediwo/redi/filesystem"
+)
+
+func setupTranslator(t *testing.T) *Translator {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("locales/en.json", []byte(`{
+		"greeting": "Hello, {name}!",
+		"nav": { "home": "Home", "about": "About" },
+		"cart": { "items": { "one": "{count} item", "other": "{count} items" } }
+	}`))
+	memFS.WriteFile("locales/de.yaml", []byte(`
+greeting: "Hallo, {name}!"
+nav:
+  home: Startseite
+cart:
+  items:
+    one: "{count} Artikel"
+    other: "{count} Artikel"
+`))
+	memFS.WriteFile("locales/ru.json", []byte(`{
+		"files": { "one": "{count} файл", "few": "{count} файла", "many": "{count} файлов", "other": "{count} файла" }
+	}`))
+
+	translator := NewTranslator(memFS, DefaultLocalesDir)
+	if err := translator.Load(); err != nil {
+		t.Fatalf("Failed to load catalogs: %v", err)
+	}
+	return translator
+}
+
+func TestTranslatorLoad(t *testing.T) {
+	translator := setupTranslator(t)
+
+	locales := translator.Locales()
+	expected := []string{"de", "en", "ru"}
+	if len(locales) != len(expected) {
+		t.Fatalf("Expected locales %v, got %v", expected, locales)
+	}
+	for i, locale := range expected {
+		if locales[i] != locale {
+			t.Errorf("Expected locale %s at %d, got %s", locale, i, locales[i])
+		}
+	}
+
+	if translator.DefaultLocale() != "en" {
+		t.Errorf("Expected default locale en, got %s", translator.DefaultLocale())
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	translator := setupTranslator(t)
+
+	tests := []struct {
+		name     string
+		locale   string
+		key      string
+		params   map[string]interface{}
+		expected string
+	}{
+		{"interpolation", "en", "greeting", map[string]interface{}{"name": "Ada"}, "Hello, Ada!"},
+		{"yaml catalog", "de", "greeting", map[string]interface{}{"name": "Ada"}, "Hallo, Ada!"},
+		{"nested key", "de", "nav.home", nil, "Startseite"},
+		{"fallback to default locale", "de", "nav.about", nil, "About"},
+		{"region falls back to language", "de-AT", "nav.home", nil, "Startseite"},
+		{"missing key", "en", "missing.key", nil, "missing.key"},
+		{"plural one", "en", "cart.items", map[string]interface{}{"count": 1}, "1 item"},
+		{"plural other", "en", "cart.items", map[string]interface{}{"count": 5}, "5 items"},
+		{"russian one", "ru", "files", map[string]interface{}{"count": 21}, "21 файл"},
+		{"russian few", "ru", "files", map[string]interface{}{"count": 3}, "3 файла"},
+		{"russian many", "ru", "files", map[string]interface{}{"count": 11}, "11 файлов"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := translator.Translate(tt.locale, tt.key, tt.params)
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPluralCategoryFor(t *testing.T) {
+	tests := []struct {
+		locale   string
+		n        int64
+		expected PluralCategory
+	}{
+		{"en", 0, Other},
+		{"en", 1, One},
+		{"fr", 0, One},
+		{"ja", 1, Other},
+		{"pl", 22, Few},
+		{"pl", 25, Many},
+		{"ar", 2, Two},
+	}
+
+	for _, tt := range tests {
+		if result := PluralCategoryFor(tt.locale, tt.n); result != tt.expected {
+			t.Errorf("PluralCategoryFor(%s, %d) = %s, expected %s", tt.locale, tt.n, result, tt.expected)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	translator := setupTranslator(t)
+
+	// URL prefix wins
+	req := httptest.NewRequest("GET", "/de/about", nil)
+	req.Header.Set("Accept-Language", "ru")
+	if locale := translator.Detect(req); locale != "de" {
+		t.Errorf("Expected de from URL prefix, got %s", locale)
+	}
+
+	// Cookie before Accept-Language
+	req = httptest.NewRequest("GET", "/about", nil)
+	req.Header.Set("Cookie", CookieName+"=ru")
+	req.Header.Set("Accept-Language", "de")
+	if locale := translator.Detect(req); locale != "ru" {
+		t.Errorf("Expected ru from cookie, got %s", locale)
+	}
+
+	// Accept-Language with quality values and regions
+	req = httptest.NewRequest("GET", "/about", nil)
+	req.Header.Set("Accept-Language", "fr-CH;q=0.9, de-AT;q=0.95, en;q=0.5")
+	if locale := translator.Detect(req); locale != "de" {
+		t.Errorf("Expected de from Accept-Language, got %s", locale)
+	}
+
+	// Default locale
+	req = httptest.NewRequest("GET", "/about", nil)
+	if locale := translator.Detect(req); locale != "en" {
+		t.Errorf("Expected default locale en, got %s", locale)
+	}
+}
+
+func TestMatchAcceptLanguageRegionalCatalog(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("locales/en.json", []byte(`{"greeting": "Hello"}`))
+	memFS.WriteFile("locales/pt-BR.json", []byte(`{"greeting": "Olá"}`))
+	memFS.WriteFile("locales/pt-PT.json", []byte(`{"greeting": "Olá"}`))
+	translator := NewTranslator(memFS, DefaultLocalesDir)
+	if err := translator.Load(); err != nil {
+		t.Fatalf("Failed to load catalogs: %v", err)
+	}
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"pt", "pt-BR"},
+		{"pt-PT", "pt-PT"},
+		{"pt-AO, en;q=0.5", "pt-BR"},
+		{"fr, pt;q=0.8, en;q=0.5", "pt-BR"},
+		{"en, pt;q=0.8", "en"},
+		{"fr", ""},
+	}
+	for _, tt := range tests {
+		if result := translator.MatchAcceptLanguage(tt.header); result != tt.expected {
+			t.Errorf("MatchAcceptLanguage(%q) = %q, expected %q", tt.header, result, tt.expected)
+		}
+	}
+}
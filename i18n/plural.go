@@ -0,0 +1,145 @@
+package i18n
+
+// PluralCategory is a CLDR plural category
+type PluralCategory string
+
+const (
+	Zero  PluralCategory = "zero"
+	One   PluralCategory = "one"
+	Two   PluralCategory = "two"
+	Few   PluralCategory = "few"
+	Many  PluralCategory = "many"
+	Other PluralCategory = "other"
+)
+
+// IsValid checks if the category is one of the CLDR plural categories
+func (c PluralCategory) IsValid() bool {
+	switch c {
+	case Zero, One, Two, Few, Many, Other:
+		return true
+	default:
+		return false
+	}
+}
+
+// PluralRule selects the plural category for an integer count
+type PluralRule func(n int64) PluralCategory
+
+// pluralRules maps base languages to their integer plural rules.
+// Languages not listed use the English one/other rule.
+var pluralRules = map[string]PluralRule{
+	// No plural distinction
+	"ja": ruleOther,
+	"zh": ruleOther,
+	"ko": ruleOther,
+	"vi": ruleOther,
+	"th": ruleOther,
+	"id": ruleOther,
+	"tr": ruleOneOther,
+
+	// 0 and 1 are singular
+	"fr": ruleZeroOneSingular,
+	"pt": ruleZeroOneSingular,
+	"hi": ruleZeroOneSingular,
+
+	// Slavic rules
+	"ru": ruleEastSlavic,
+	"uk": ruleEastSlavic,
+	"be": ruleEastSlavic,
+	"pl": rulePolish,
+	"cs": ruleCzech,
+	"sk": ruleCzech,
+
+	"ar": ruleArabic,
+}
+
+// RegisterPluralRule registers or overrides the plural rule for a language
+func RegisterPluralRule(language string, rule PluralRule) {
+	pluralRules[baseLanguage(NormalizeLocale(language))] = rule
+}
+
+// PluralCategoryFor returns the plural category of n for the given locale
+func PluralCategoryFor(locale string, n int64) PluralCategory {
+	if rule, ok := pluralRules[baseLanguage(NormalizeLocale(locale))]; ok {
+		return rule(abs(n))
+	}
+	return ruleOneOther(abs(n))
+}
+
+func ruleOther(n int64) PluralCategory {
+	return Other
+}
+
+func ruleOneOther(n int64) PluralCategory {
+	if n == 1 {
+		return One
+	}
+	return Other
+}
+
+func ruleZeroOneSingular(n int64) PluralCategory {
+	if n == 0 || n == 1 {
+		return One
+	}
+	return Other
+}
+
+func ruleEastSlavic(n int64) PluralCategory {
+	mod10, mod100 := n%10, n%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return One
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return Few
+	default:
+		return Many
+	}
+}
+
+func rulePolish(n int64) PluralCategory {
+	mod10, mod100 := n%10, n%100
+	switch {
+	case n == 1:
+		return One
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return Few
+	default:
+		return Many
+	}
+}
+
+func ruleCzech(n int64) PluralCategory {
+	switch {
+	case n == 1:
+		return One
+	case n >= 2 && n <= 4:
+		return Few
+	default:
+		return Other
+	}
+}
+
+func ruleArabic(n int64) PluralCategory {
+	mod100 := n % 100
+	switch {
+	case n == 0:
+		return Zero
+	case n == 1:
+		return One
+	case n == 2:
+		return Two
+	case mod100 >= 3 && mod100 <= 10:
+		return Few
+	case mod100 >= 11:
+		return Many
+	default:
+		return Other
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
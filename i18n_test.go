@@ -0,0 +1,84 @@
+package redi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+)
+
+func setupLocalizedFileSystem() *filesystem.MemoryFileSystem {
+	memFS := filesystem.NewMemoryFileSystem()
+
+	memFS.WriteFile("locales/en.json", []byte(`{"title": "Welcome", "items": {"one": "{count} item", "other": "{count} items"}}`))
+	memFS.WriteFile("locales/de.json", []byte(`{"title": "Willkommen", "items": {"one": "{count} Artikel", "other": "{count} Artikel"}}`))
+
+	memFS.WriteFile("routes/index.html", []byte(`<h1>{{t "title"}}</h1><p>{{t "items" "count" 2}}</p>`))
+	memFS.WriteFile("routes/about.html", []byte(`<html lang="{{locale}}"><h1>{{t "title"}}</h1></html>`))
+	memFS.WriteFile("routes/api/hello.js", []byte(`var i18n = require('i18n');
+
+exports.get = function(req, res, next) {
+    res.json({ locale: req.locale, title: i18n.forLocale(req.locale).t('title') });
+};`))
+
+	return memFS
+}
+
+func TestLocalizedRoutes(t *testing.T) {
+	server := &Server{
+		router:    mux.NewRouter(),
+		port:      8080,
+		fs:        setupLocalizedFileSystem(),
+		routesDir: "routes",
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		expected       []string
+	}{
+		{"default locale", "/about", "", []string{`lang="en"`, "Welcome"}},
+		{"locale prefix", "/de/about", "", []string{`lang="de"`, "Willkommen"}},
+		{"localized index", "/de", "", []string{"Willkommen", "2 Artikel"}},
+		{"accept-language", "/", "de-DE,de;q=0.9", []string{"Willkommen"}},
+		{"plural", "/en/", "", []string{"2 items"}},
+		{"javascript route", "/de/api/hello", "", []string{`"locale":"de"`, `"title":"Willkommen"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rr := httptest.NewRecorder()
+			server.router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200 for %s, got %d: %s", tt.path, rr.Code, rr.Body.String())
+			}
+			body := rr.Body.String()
+			for _, expected := range tt.expected {
+				if !strings.Contains(body, expected) {
+					t.Errorf("Expected %q in response for %s, got %s", expected, tt.path, body)
+				}
+			}
+		})
+	}
+
+	// Detected locales come from the locale cookie or Accept-Language
+	for path, want := range map[string]string{"/about": "Cookie,Accept-Language", "/de/about": ""} {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if got := strings.Join(rr.Header().Values("Vary"), ","); got != want {
+			t.Errorf("Expected Vary %q for %s, got %q", want, path, got)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package filelock provides an exclusive lock on a file shared by the
+// processes using the same directory, such as the cache and the kv store
+package filelock
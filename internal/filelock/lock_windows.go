@@ -0,0 +1,37 @@
+//go:build windows
+
+package filelock
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// staleLockAge is how old a lock file must be before it is considered left
+// behind by a process that died while holding it
+const staleLockAge = 30 * time.Second
+
+// Lock takes an exclusive lock on path by creating it, waiting for other
+// processes holding it, and returns the function releasing it
+func Lock(path string) (func(), error) {
+	deadline := time.Now().Add(2 * staleLockAge)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
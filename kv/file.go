@@ -0,0 +1,297 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rediwo/redi/internal/filelock"
+	"github.com/rediwo/redi/logging"
+)
+
+const (
+	logFileName  = "data.log"
+	lockFileName = "data.lock"
+
+	// expireInterval is how many transactions pass between removals of
+	// expired keys from memory
+	expireInterval = 1000
+
+	// minCompactRecords is how many records the log holds before it may be
+	// compacted; it is compacted once it holds twice as many as live keys
+	minCompactRecords = 1000
+)
+
+// FileStore keeps the data in an append-only log in a directory, with one
+// line per transaction, and all of it in memory. Several processes may
+// open the same directory: every transaction takes a file lock and first
+// reads what the others appended; reads skip the lock while the log is
+// unchanged. The log is rewritten with only the live keys when most of its
+// records are outdated.
+type FileStore struct {
+	dir string
+
+	mu      sync.Mutex
+	data    table
+	log     *os.File
+	info    os.FileInfo // Of the log as last read, to notice compactions
+	offset  int64       // Bytes of the log applied to data
+	records int         // Records in the log
+	updates int
+	closed  bool
+}
+
+// OpenFileStore opens the store in dir, creating it if needed
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, data: make(table)}
+	unlock, err := filelock.Lock(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := s.sync(); err != nil {
+		s.closeLog()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Dir returns the directory of the store
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+func (s *FileStore) Get(key string) (json.RawMessage, bool, error) {
+	return get(s, key)
+}
+
+func (s *FileStore) Set(key string, value json.RawMessage, ttl time.Duration) error {
+	return set(s, key, value, ttl)
+}
+
+func (s *FileStore) Delete(key string) (bool, error) {
+	return del(s, key)
+}
+
+func (s *FileStore) List(prefix string) ([]Entry, error) {
+	return list(s, prefix)
+}
+
+func (s *FileStore) Update(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	unlock, err := filelock.Lock(filepath.Join(s.dir, lockFileName))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.sync(); err != nil {
+		return err
+	}
+
+	tx := newTx(s.data)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.changes) == 0 {
+		return nil
+	}
+	if err := s.append(tx.changes); err != nil {
+		return err
+	}
+	s.data.apply(tx.changes)
+
+	if s.updates++; s.updates%expireInterval == 0 {
+		s.data.expire(tx.now)
+	}
+	if s.records >= minCompactRecords && s.records > 2*len(s.data) {
+		// The transaction is durable already; a log that stays long is
+		// compacted by a later one
+		if err := s.compact(); err != nil {
+			logging.Warn("Failed to compact kv store", "dir", s.dir, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) View(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	// Other processes only change the log under the lock, by appending to
+	// it or replacing it, so an unchanged log means the data is current
+	info, err := os.Stat(filepath.Join(s.dir, logFileName))
+	if err != nil || !os.SameFile(s.info, info) || info.Size() != s.offset {
+		unlock, err := filelock.Lock(filepath.Join(s.dir, lockFileName))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := s.sync(); err != nil {
+			return err
+		}
+	}
+	return fn(newTx(s.data))
+}
+
+// Close closes the log; the data stays on disk
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.closeLog()
+}
+
+func (s *FileStore) closeLog() error {
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+// sync applies what other processes appended to the log since it was last
+// read, reading it again from the start if it was compacted. The file lock
+// must be held.
+func (s *FileStore) sync() error {
+	path := filepath.Join(s.dir, logFileName)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		info, err = s.create(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.info == nil || !os.SameFile(s.info, info) || info.Size() < s.offset {
+		// Compacted, or opened for the first time
+		if err := s.closeLog(); err != nil {
+			return err
+		}
+		if s.log, err = os.OpenFile(path, os.O_RDWR, 0644); err != nil {
+			return err
+		}
+		s.data, s.offset, s.records = make(table), 0, 0
+	}
+	s.info = info
+	if info.Size() == s.offset {
+		return nil
+	}
+
+	if _, err := s.log.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(s.log)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// The last transaction was cut off by a crash. Drop it so
+				// the next one starts on a line of its own.
+				if err := s.log.Truncate(s.offset); err != nil {
+					return err
+				}
+				s.info, _ = s.log.Stat()
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var changes []change
+		if err := json.Unmarshal(line, &changes); err != nil {
+			return fmt.Errorf("corrupt kv log %s at byte %d: %w", path, s.offset, err)
+		}
+		s.data.apply(changes)
+		s.offset += int64(len(line))
+		s.records += len(changes)
+	}
+}
+
+// create creates an empty log
+func (s *FileStore) create(path string) (os.FileInfo, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// append writes a transaction to the log as one line
+func (s *FileStore) append(changes []change) error {
+	line, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := s.log.WriteAt(line, s.offset); err != nil {
+		return err
+	}
+	if err := s.log.Sync(); err != nil {
+		return err
+	}
+	s.offset += int64(len(line))
+	s.records += len(changes)
+	s.info, err = s.log.Stat()
+	return err
+}
+
+// compact replaces the log with one holding only the live keys
+func (s *FileStore) compact() error {
+	s.data.expire(time.Now().UnixMilli())
+
+	var buf bytes.Buffer
+	records := 0
+	for key, r := range s.data {
+		line, err := json.Marshal([]change{{Key: key, Value: r.value, Expires: r.expires}})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		records++
+	}
+
+	path := filepath.Join(s.dir, logFileName)
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	if err := s.closeLog(); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := log.Stat()
+	if err != nil {
+		log.Close()
+		return err
+	}
+	s.log, s.info, s.offset, s.records = log, info, info.Size(), records
+	return nil
+}
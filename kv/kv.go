@@ -0,0 +1,209 @@
+// Package kv is a key-value store of JSON values for server-side
+// JavaScript. Keys may expire, and several changes can be applied together
+// in a transaction. FileStore keeps the data on disk, usually in .redi/kv
+// under the project root, and can be shared by several processes;
+// MemoryStore keeps it in memory for tests and read-only sites.
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrClosed is returned when using a store after Close
+var ErrClosed = errors.New("kv store is closed")
+
+// Store is a key-value store of JSON values
+type Store interface {
+	// Get returns the value of key, and false if it isn't set or expired
+	Get(key string) (json.RawMessage, bool, error)
+	// Set sets key to value; a positive ttl makes it expire
+	Set(key string, value json.RawMessage, ttl time.Duration) error
+	// Delete removes key and reports whether it was set
+	Delete(key string) (bool, error)
+	// List returns the entries whose key starts with prefix, sorted by key
+	List(prefix string) ([]Entry, error)
+	// Update runs fn in a transaction. Nothing else reads or writes the
+	// store until fn returns; its changes are applied together when it
+	// returns nil and discarded when it returns an error.
+	Update(fn func(tx *Tx) error) error
+	// View runs fn in a transaction that only reads; changes it makes are
+	// discarded. It may see the store as it was just before a change made
+	// by another process.
+	View(fn func(tx *Tx) error) error
+	Close() error
+}
+
+// Entry is a key and its value
+type Entry struct {
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires,omitzero"` // Zero when the key doesn't expire
+}
+
+// record is the stored value of a key
+type record struct {
+	value   json.RawMessage
+	expires int64 // Unix milliseconds, 0 without a TTL
+}
+
+func (r record) expired(now int64) bool {
+	return r.expires != 0 && r.expires <= now
+}
+
+// change is a write of a transaction; a nil value deletes the key
+type change struct {
+	Key     string          `json:"k"`
+	Value   json.RawMessage `json:"v,omitempty"`
+	Expires int64           `json:"e,omitempty"`
+}
+
+// table is the data of a store
+type table map[string]record
+
+// apply applies the changes of a committed transaction
+func (t table) apply(changes []change) {
+	for _, c := range changes {
+		if c.Value == nil {
+			delete(t, c.Key)
+		} else {
+			t[c.Key] = record{value: c.Value, expires: c.Expires}
+		}
+	}
+}
+
+// expire removes the keys that expired before now
+func (t table) expire(now int64) {
+	for key, r := range t {
+		if r.expired(now) {
+			delete(t, key)
+		}
+	}
+}
+
+// Tx is a transaction. Its reads see the changes it made.
+type Tx struct {
+	data    table
+	now     int64
+	pending map[string]int // Index in changes by key
+	changes []change
+}
+
+func newTx(data table) *Tx {
+	return &Tx{data: data, now: time.Now().UnixMilli(), pending: make(map[string]int)}
+}
+
+// lookup returns the record of key as seen by the transaction
+func (tx *Tx) lookup(key string) (record, bool) {
+	if i, ok := tx.pending[key]; ok {
+		c := tx.changes[i]
+		return record{value: c.Value, expires: c.Expires}, c.Value != nil
+	}
+	r, ok := tx.data[key]
+	if !ok || r.expired(tx.now) {
+		return record{}, false
+	}
+	return r, true
+}
+
+func (tx *Tx) write(c change) {
+	if i, ok := tx.pending[c.Key]; ok {
+		tx.changes[i] = c
+		return
+	}
+	tx.pending[c.Key] = len(tx.changes)
+	tx.changes = append(tx.changes, c)
+}
+
+// Get returns the value of key, and false if it isn't set or expired
+func (tx *Tx) Get(key string) (json.RawMessage, bool) {
+	r, ok := tx.lookup(key)
+	return r.value, ok
+}
+
+// Set sets key to value; a positive ttl makes it expire
+func (tx *Tx) Set(key string, value json.RawMessage, ttl time.Duration) error {
+	if !json.Valid(value) {
+		return errors.New("kv value must be valid JSON")
+	}
+	c := change{Key: key, Value: append(json.RawMessage(nil), value...)}
+	if ttl > 0 {
+		c.Expires = tx.now + ttl.Milliseconds()
+	}
+	tx.write(c)
+	return nil
+}
+
+// Delete removes key and reports whether it was set
+func (tx *Tx) Delete(key string) bool {
+	_, ok := tx.lookup(key)
+	if ok {
+		tx.write(change{Key: key})
+	}
+	return ok
+}
+
+// List returns the entries whose key starts with prefix, sorted by key
+func (tx *Tx) List(prefix string) []Entry {
+	keys := []string{}
+	for key := range tx.data {
+		if _, pending := tx.pending[key]; !pending && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range tx.pending {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	entries := []Entry{}
+	for _, key := range keys {
+		r, ok := tx.lookup(key)
+		if !ok {
+			continue
+		}
+		entry := Entry{Key: key, Value: r.value}
+		if r.expires != 0 {
+			entry.Expires = time.UnixMilli(r.expires)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// The single operations of a store are transactions of one change
+
+func get(s Store, key string) (value json.RawMessage, found bool, err error) {
+	err = s.View(func(tx *Tx) error {
+		value, found = tx.Get(key)
+		return nil
+	})
+	return value, found, err
+}
+
+func set(s Store, key string, value json.RawMessage, ttl time.Duration) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Set(key, value, ttl)
+	})
+}
+
+func del(s Store, key string) (deleted bool, err error) {
+	err = s.Update(func(tx *Tx) error {
+		deleted = tx.Delete(key)
+		return nil
+	})
+	return deleted, err
+}
+
+func list(s Store, prefix string) (entries []Entry, err error) {
+	err = s.View(func(tx *Tx) error {
+		entries = tx.List(prefix)
+		return nil
+	})
+	return entries, err
+}
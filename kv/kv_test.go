@@ -0,0 +1,237 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rediwo/redi/internal/filelock"
+)
+
+func openStores(t *testing.T) map[string]Store {
+	t.Helper()
+	fileStore, err := OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	t.Cleanup(func() { fileStore.Close() })
+	return map[string]Store{"memory": NewMemoryStore(), "file": fileStore}
+}
+
+func TestStore_Operations(t *testing.T) {
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, found, err := store.Get("missing"); found || err != nil {
+				t.Errorf("Expected a missing key, got found=%v err=%v", found, err)
+			}
+			for key, value := range map[string]string{"user:1": `{"name":"a"}`, "user:2": `null`, "post:1": `[1,2]`} {
+				if err := store.Set(key, json.RawMessage(value), 0); err != nil {
+					t.Fatalf("Set %s: %v", key, err)
+				}
+			}
+			if value, found, _ := store.Get("user:2"); !found || string(value) != "null" {
+				t.Errorf("Expected a null value to be stored, got %q found=%v", value, found)
+			}
+			if err := store.Set("bad", json.RawMessage(`{`), 0); err == nil {
+				t.Error("Expected invalid JSON to be refused")
+			}
+
+			entries, _ := store.List("user:")
+			if len(entries) != 2 || entries[0].Key != "user:1" || entries[1].Key != "user:2" {
+				t.Errorf("Expected the two users in key order, got %+v", entries)
+			}
+
+			if deleted, _ := store.Delete("user:1"); !deleted {
+				t.Error("Expected user:1 to be deleted")
+			}
+			if deleted, _ := store.Delete("user:1"); deleted {
+				t.Error("Expected a second delete to report nothing deleted")
+			}
+			if entries, _ := store.List(""); len(entries) != 2 {
+				t.Errorf("Expected two keys left, got %+v", entries)
+			}
+		})
+	}
+}
+
+func TestStore_TTL(t *testing.T) {
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Set("session", json.RawMessage(`"abc"`), 20*time.Millisecond)
+			entries, _ := store.List("")
+			if len(entries) != 1 || entries[0].Expires.IsZero() {
+				t.Fatalf("Expected an entry with an expiry, got %+v", entries)
+			}
+			time.Sleep(30 * time.Millisecond)
+			if _, found, _ := store.Get("session"); found {
+				t.Error("Expected the key to expire")
+			}
+			if entries, _ := store.List(""); len(entries) != 0 {
+				t.Errorf("Expected expired keys not to be listed, got %+v", entries)
+			}
+		})
+	}
+}
+
+func TestStore_Transaction(t *testing.T) {
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Set("balance:a", json.RawMessage(`10`), 0)
+
+			err := store.Update(func(tx *Tx) error {
+				tx.Set("balance:a", json.RawMessage(`5`), 0)
+				tx.Set("balance:b", json.RawMessage(`5`), 0)
+				if value, _ := tx.Get("balance:a"); string(value) != "5" {
+					t.Errorf("Expected the transaction to read its own write, got %s", value)
+				}
+				if entries := tx.List("balance:"); len(entries) != 2 {
+					t.Errorf("Expected the transaction to list its new key, got %+v", entries)
+				}
+				return errors.New("abort")
+			})
+			if err == nil || err.Error() != "abort" {
+				t.Fatalf("Expected the transaction error, got %v", err)
+			}
+			if value, _, _ := store.Get("balance:a"); string(value) != "10" {
+				t.Errorf("Expected an aborted transaction to change nothing, got %s", value)
+			}
+			if _, found, _ := store.Get("balance:b"); found {
+				t.Error("Expected an aborted transaction not to create keys")
+			}
+
+			store.Update(func(tx *Tx) error {
+				tx.Set("balance:a", json.RawMessage(`5`), 0)
+				tx.Set("balance:b", json.RawMessage(`5`), 0)
+				return nil
+			})
+			if entries, _ := store.List("balance:"); len(entries) != 2 || string(entries[0].Value) != "5" {
+				t.Errorf("Expected the committed transaction to apply both writes, got %+v", entries)
+			}
+		})
+	}
+}
+
+func TestFileStore_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("a", json.RawMessage(`1`), 0)
+	store.Set("b", json.RawMessage(`2`), 0)
+	store.Delete("a")
+
+	// Another process sees the changes of the first on its next operation
+	other, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, found, _ := other.Get("a"); found {
+		t.Error("Expected the deleted key to stay deleted")
+	}
+	other.Set("c", json.RawMessage(`3`), 0)
+	if value, _, _ := store.Get("c"); string(value) != "3" {
+		t.Errorf("Expected a write of another store to be read, got %q", value)
+	}
+	store.Close()
+	if _, _, err := store.Get("b"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+
+	// A transaction cut off by a crash is dropped
+	file, _ := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`[{"k":"d","v":`)
+	file.Close()
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Expected a torn write to be dropped, got %v", err)
+	}
+	defer reopened.Close()
+	reopened.Set("e", json.RawMessage(`5`), 0)
+	if entries, _ := reopened.List(""); len(entries) != 3 {
+		t.Errorf("Expected b, c and e, got %+v", entries)
+	}
+}
+
+func TestFileStore_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	other, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	for i := 0; i < 2*minCompactRecords; i++ {
+		store.Set("counter", json.RawMessage(`1`), 0)
+	}
+	store.Set("counter", json.RawMessage(`2`), 0)
+
+	info, _ := os.Stat(filepath.Join(dir, logFileName))
+	if info.Size() > 1000 {
+		t.Errorf("Expected the log to be compacted, got %d bytes", info.Size())
+	}
+	if value, _, _ := other.Get("counter"); string(value) != "2" {
+		t.Errorf("Expected another store to read the compacted log, got %q", value)
+	}
+}
+
+func TestFileStore_CompactionFailure(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// The compacted log can't be written, but the writes themselves are
+	os.Mkdir(filepath.Join(dir, logFileName+".tmp"), 0755)
+	for i := 0; i < 2*minCompactRecords+1; i++ {
+		if err := store.Set("counter", json.RawMessage(strconv.Itoa(i)), 0); err != nil {
+			t.Fatalf("Expected a failed compaction not to fail the write, got %v", err)
+		}
+	}
+	if value, _, _ := store.Get("counter"); string(value) != strconv.Itoa(2*minCompactRecords) {
+		t.Errorf("Expected the last write, got %q", value)
+	}
+}
+
+func TestFileStore_ReadsWithoutLock(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.Set("a", json.RawMessage(`1`), 0)
+
+	// Another process holding the lock doesn't block reads of an
+	// unchanged log
+	unlock, err := filelock.Lock(filepath.Join(dir, lockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	done := make(chan string)
+	go func() {
+		value, _, _ := store.Get("a")
+		done <- string(value)
+	}()
+	select {
+	case value := <-done:
+		if value != "1" {
+			t.Errorf("Expected 1, got %q", value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the read not to wait for the lock")
+	}
+}
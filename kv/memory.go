@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the data in memory. It is used in tests and for sites
+// that have no directory to write to.
+type MemoryStore struct {
+	mu      sync.Mutex
+	data    table
+	updates int
+	closed  bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(table)}
+}
+
+func (s *MemoryStore) Get(key string) (json.RawMessage, bool, error) {
+	return get(s, key)
+}
+
+func (s *MemoryStore) Set(key string, value json.RawMessage, ttl time.Duration) error {
+	return set(s, key, value, ttl)
+}
+
+func (s *MemoryStore) Delete(key string) (bool, error) {
+	return del(s, key)
+}
+
+func (s *MemoryStore) List(prefix string) ([]Entry, error) {
+	return list(s, prefix)
+}
+
+func (s *MemoryStore) Update(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	tx := newTx(s.data)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.data.apply(tx.changes)
+	if s.updates++; s.updates%expireInterval == 0 {
+		s.data.expire(tx.now)
+	}
+	return nil
+}
+
+func (s *MemoryStore) View(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return fn(newTx(s.data))
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
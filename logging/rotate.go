@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeFormat is appended to the log file name of rotated files
+const rotateTimeFormat = "20060102-150405"
+
+// RotateConfig configures log file rotation
+type RotateConfig struct {
+	// MaxSize rotates the log once it grows beyond this many bytes (0 disables)
+	MaxSize int64
+	// MaxAge rotates the log once it has been written to for this long (0 disables)
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep (0 keeps all)
+	MaxBackups int
+}
+
+// Enabled reports whether any rotation limit is set
+func (c RotateConfig) Enabled() bool {
+	return c.MaxSize > 0 || c.MaxAge > 0
+}
+
+// Rotator rotates a log file by size and age. Rotation copies the file to
+// "<file>.<timestamp>" and truncates it in place, so processes that keep the
+// file open in append mode (such as a daemon's redirected stdout) keep
+// writing to the live log.
+type Rotator struct {
+	path    string
+	config  RotateConfig
+	since   time.Time
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewRotator creates a rotator for the log file at path
+func NewRotator(path string, config RotateConfig) *Rotator {
+	r := &Rotator{
+		path:   path,
+		config: config,
+		since:  time.Now(),
+	}
+	// The live log has been collecting since the last rotation
+	if backups := r.backups(); len(backups) > 0 {
+		if info, err := os.Stat(backups[len(backups)-1]); err == nil {
+			r.since = info.ModTime()
+		}
+	}
+	return r
+}
+
+// Start checks the log file at the given interval until Stop is called
+func (r *Rotator) Start(interval time.Duration) {
+	r.stop = make(chan struct{})
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.Check(); err != nil {
+					Warn("Log rotation failed", "file", r.path, "error", err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic checks
+func (r *Rotator) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stopped.Wait()
+		r.stop = nil
+	}
+}
+
+// Check rotates the log file if it exceeds the size or age limit and reports
+// whether it did
+func (r *Rotator) Check() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == 0 {
+		return false, nil
+	}
+
+	r.mu.Lock()
+	due := (r.config.MaxSize > 0 && info.Size() >= r.config.MaxSize) ||
+		(r.config.MaxAge > 0 && time.Since(r.since) >= r.config.MaxAge)
+	r.mu.Unlock()
+	if !due {
+		return false, nil
+	}
+	return true, r.Rotate()
+}
+
+// Rotate copies the log file to a timestamped backup, truncates it and
+// removes backups beyond MaxBackups
+func (r *Rotator) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	backup := r.path + "." + now.Format(rotateTimeFormat)
+	if _, err := os.Stat(backup); err == nil {
+		backup += "-" + now.Format(".000000000")[1:]
+	}
+
+	if err := copyFile(r.path, backup); err != nil {
+		return err
+	}
+	if err := os.Truncate(r.path, 0); err != nil {
+		return err
+	}
+	r.since = now
+
+	if r.config.MaxBackups > 0 {
+		backups := r.backups()
+		for len(backups) > r.config.MaxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return nil
+}
+
+// backups returns the rotated files, oldest first
+func (r *Rotator) backups() []string {
+	matches, _ := filepath.Glob(r.path + ".*")
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, r.path+".")
+		if len(suffix) < len(rotateTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(rotateTimeFormat, suffix[:len(rotateTimeFormat)]); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// Timestamps sort chronologically
+	sort.Strings(backups)
+	return backups
+}
+
+// copyFile copies src to a new file dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatorBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rotator := NewRotator(path, RotateConfig{MaxSize: 10, MaxBackups: 2})
+
+	file.WriteString("short\n")
+	if rotated, err := rotator.Check(); err != nil || rotated {
+		t.Fatalf("Expected no rotation below MaxSize, got %v, %v", rotated, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		file.WriteString("a line longer than ten bytes\n")
+		if rotated, err := rotator.Check(); err != nil || !rotated {
+			t.Fatalf("Expected rotation above MaxSize, got %v, %v", rotated, err)
+		}
+		// Distinct backup timestamps
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Writes through the already open file continue in the live log
+	file.WriteString("after\n")
+	data, _ := os.ReadFile(path)
+	if string(data) != "after\n" {
+		t.Errorf("Expected truncated live log, got %q", data)
+	}
+
+	if backups := rotator.backups(); len(backups) != 2 {
+		t.Errorf("Expected 2 backups after pruning, got %v", backups)
+	}
+}
+
+func TestRotatorByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	os.WriteFile(path, []byte("old entry\n"), 0644)
+
+	rotator := NewRotator(path, RotateConfig{MaxAge: time.Hour})
+	if rotated, _ := rotator.Check(); rotated {
+		t.Fatal("Expected no rotation before MaxAge")
+	}
+
+	rotator.since = time.Now().Add(-2 * time.Hour)
+	if rotated, err := rotator.Check(); err != nil || !rotated {
+		t.Fatalf("Expected rotation after MaxAge, got %v, %v", rotated, err)
+	}
+	if rotated, _ := rotator.Check(); rotated {
+		t.Error("Expected an empty log not to rotate again")
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rediwo/redi/middleware"
+)
+
+// HTTPMetrics records request counts and latencies by route pattern and
+// handler type
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// NewHTTPMetrics creates request metrics and registers them with registry
+func NewHTTPMetrics(registry *Registry) *HTTPMetrics {
+	m := &HTTPMetrics{
+		requests: NewCounterVec("redi_http_requests_total",
+			"Total number of HTTP requests.", "route", "handler", "method", "status"),
+		duration: NewHistogramVec("redi_http_request_duration_seconds",
+			"HTTP request latency in seconds.", nil, "route", "handler"),
+	}
+	registry.Register(m.requests, m.duration)
+	return m
+}
+
+// Middleware instruments every request passing through next
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, info := middleware.WithRouteInfo(r)
+		recorder := middleware.NewResponseRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		route, handler := info.Pattern, info.Handler
+		if route == "" {
+			route = "unmatched"
+		}
+		if handler == "" {
+			handler = "none"
+		}
+		m.requests.WithLabelValues(route, handler, r.Method, strconv.Itoa(recorder.Status())).Inc()
+		m.duration.WithLabelValues(route, handler).Observe(time.Since(start).Seconds())
+	})
+}
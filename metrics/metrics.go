@@ -0,0 +1,376 @@
+// Package metrics implements a small Prometheus-compatible metrics registry
+// that writes the text exposition format without external dependencies.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format content type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds, matching the Prometheus client defaults
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector writes one or more metric families
+type Collector interface {
+	Collect(w io.Writer)
+}
+
+// Registry holds collectors and writes them in registration order
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the process-wide registry with Go runtime metrics and metrics
+// from packages that instrument themselves
+var Default = NewRegistry()
+
+// Register adds collectors to the registry
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// WriteTo writes all metrics in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	counter := &countingWriter{w: w}
+	buf := bufio.NewWriter(counter)
+	for _, collector := range collectors {
+		collector.Collect(buf)
+	}
+	err := buf.Flush()
+	return counter.n, err
+}
+
+// Handler serves the metrics of the given registries
+func Handler(registries ...*Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		for _, registry := range registries {
+			registry.WriteTo(w)
+		}
+	})
+}
+
+// Sample is a single value of a metric family with its label values
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v to the counter; negative values are ignored
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+// Value returns the current count
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	name       string
+	help       string
+	labelNames []string
+	mu         sync.RWMutex
+	counters   map[string]*labeledCounter
+}
+
+type labeledCounter struct {
+	labelValues []string
+	counter     *Counter
+}
+
+// NewCounterVec creates a counter family
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		counters:   make(map[string]*labeledCounter),
+	}
+}
+
+// WithLabelValues returns the counter for the label values, creating it if needed
+func (cv *CounterVec) WithLabelValues(values ...string) *Counter {
+	key := labelKey(values)
+	cv.mu.RLock()
+	entry, ok := cv.counters[key]
+	cv.mu.RUnlock()
+	if ok {
+		return entry.counter
+	}
+
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if entry, ok := cv.counters[key]; ok {
+		return entry.counter
+	}
+	entry = &labeledCounter{labelValues: append([]string(nil), values...), counter: &Counter{}}
+	cv.counters[key] = entry
+	return entry.counter
+}
+
+// Collect implements Collector
+func (cv *CounterVec) Collect(w io.Writer) {
+	cv.mu.RLock()
+	samples := make([]Sample, 0, len(cv.counters))
+	for _, entry := range cv.counters {
+		samples = append(samples, Sample{LabelValues: entry.labelValues, Value: entry.counter.Value()})
+	}
+	cv.mu.RUnlock()
+	writeFamily(w, cv.name, cv.help, "counter", cv.labelNames, samples)
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+	mu         sync.RWMutex
+	histograms map[string]*labeledHistogram
+}
+
+type labeledHistogram struct {
+	labelValues []string
+	histogram   *Histogram
+}
+
+// NewHistogramVec creates a histogram family. nil buckets means DefaultBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    sorted,
+		histograms: make(map[string]*labeledHistogram),
+	}
+}
+
+// WithLabelValues returns the histogram for the label values, creating it if needed
+func (hv *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	key := labelKey(values)
+	hv.mu.RLock()
+	entry, ok := hv.histograms[key]
+	hv.mu.RUnlock()
+	if ok {
+		return entry.histogram
+	}
+
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	if entry, ok := hv.histograms[key]; ok {
+		return entry.histogram
+	}
+	entry = &labeledHistogram{labelValues: append([]string(nil), values...), histogram: newHistogram(hv.buckets)}
+	hv.histograms[key] = entry
+	return entry.histogram
+}
+
+// Collect implements Collector
+func (hv *HistogramVec) Collect(w io.Writer) {
+	hv.mu.RLock()
+	entries := make([]*labeledHistogram, 0, len(hv.histograms))
+	for _, entry := range hv.histograms {
+		entries = append(entries, entry)
+	}
+	hv.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return labelKey(entries[i].labelValues) < labelKey(entries[j].labelValues)
+	})
+
+	writeHeader(w, hv.name, hv.help, "histogram")
+	bucketLabels := append(append([]string(nil), hv.labelNames...), "le")
+	for _, entry := range entries {
+		h := entry.histogram
+		h.mu.Lock()
+		for i, upper := range h.buckets {
+			values := append(append([]string(nil), entry.labelValues...), formatFloat(upper))
+			writeSample(w, hv.name+"_bucket", bucketLabels, values, float64(h.counts[i]))
+		}
+		values := append(append([]string(nil), entry.labelValues...), "+Inf")
+		writeSample(w, hv.name+"_bucket", bucketLabels, values, float64(h.count))
+		writeSample(w, hv.name+"_sum", hv.labelNames, entry.labelValues, h.sum)
+		writeSample(w, hv.name+"_count", hv.labelNames, entry.labelValues, float64(h.count))
+		h.mu.Unlock()
+	}
+}
+
+// FuncCollector reports values computed at scrape time, e.g. pool sizes or
+// stats kept by another component
+type FuncCollector struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	fn         func() []Sample
+}
+
+// NewGaugeFunc creates a gauge family whose samples are computed by fn
+func NewGaugeFunc(name, help string, fn func() []Sample, labelNames ...string) *FuncCollector {
+	return &FuncCollector{name: name, help: help, metricType: "gauge", labelNames: labelNames, fn: fn}
+}
+
+// NewCounterFunc creates a counter family whose samples are computed by fn
+func NewCounterFunc(name, help string, fn func() []Sample, labelNames ...string) *FuncCollector {
+	return &FuncCollector{name: name, help: help, metricType: "counter", labelNames: labelNames, fn: fn}
+}
+
+// Collect implements Collector
+func (fc *FuncCollector) Collect(w io.Writer) {
+	writeFamily(w, fc.name, fc.help, fc.metricType, fc.labelNames, fc.fn())
+}
+
+// writeFamily writes a metric family with samples sorted by label values
+func writeFamily(w io.Writer, name, help, metricType string, labelNames []string, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return labelKey(samples[i].LabelValues) < labelKey(samples[j].LabelValues)
+	})
+	writeHeader(w, name, help, metricType)
+	for _, sample := range samples {
+		writeSample(w, name, labelNames, sample.LabelValues, sample.Value)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeSample(w io.Writer, name string, labelNames, labelValues []string, value float64) {
+	io.WriteString(w, name)
+	if len(labelNames) > 0 {
+		io.WriteString(w, "{")
+		for i, labelName := range labelNames {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			labelValue := ""
+			if i < len(labelValues) {
+				labelValue = labelValues[i]
+			}
+			fmt.Fprintf(w, `%s="%s"`, labelName, escapeLabelValue(labelValue))
+		}
+		io.WriteString(w, "}")
+	}
+	io.WriteString(w, " "+formatFloat(value)+"\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
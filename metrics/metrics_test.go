@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rediwo/redi/middleware"
+)
+
+func TestRegistryTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	counter := NewCounterVec("test_requests_total", "Test requests.", "path")
+	histogram := NewHistogramVec("test_duration_seconds", "Test duration.", []float64{0.1, 1}, "path")
+	gauge := NewGaugeFunc("test_gauge", "Test gauge.", func() []Sample {
+		return []Sample{{LabelValues: []string{`quote"d`}, Value: 2.5}}
+	}, "name")
+	registry.Register(counter, histogram, gauge)
+
+	counter.WithLabelValues("/b").Inc()
+	counter.WithLabelValues("/a").Add(2)
+	histogram.WithLabelValues("/a").Observe(0.05)
+	histogram.WithLabelValues("/a").Observe(0.5)
+
+	var buf bytes.Buffer
+	if _, err := registry.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	output := buf.String()
+
+	expected := `# HELP test_requests_total Test requests.
+# TYPE test_requests_total counter
+test_requests_total{path="/a"} 2
+test_requests_total{path="/b"} 1
+# HELP test_duration_seconds Test duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{path="/a",le="0.1"} 1
+test_duration_seconds_bucket{path="/a",le="1"} 2
+test_duration_seconds_bucket{path="/a",le="+Inf"} 2
+test_duration_seconds_sum{path="/a"} 0.55
+test_duration_seconds_count{path="/a"} 2
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge{name="quote\"d"} 2.5
+`
+	if output != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
+
+func TestHTTPMetricsMiddleware(t *testing.T) {
+	registry := NewRegistry()
+	httpMetrics := NewHTTPMetrics(registry)
+
+	handler := httpMetrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetRoute(r, "/blog/{id}", "js")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/blog/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/blog/2", nil))
+
+	w := httptest.NewRecorder()
+	Handler(registry).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Expected content type %s, got %s", ContentType, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, text := range []string{
+		`redi_http_requests_total{route="/blog/{id}",handler="js",method="GET",status="404"} 2`,
+		`redi_http_request_duration_seconds_count{route="/blog/{id}",handler="js"} 2`,
+	} {
+		if !strings.Contains(body, text) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", text, body)
+		}
+	}
+}
+
+func TestDefaultRegistryRuntimeMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	Default.WriteTo(&buf)
+	for _, name := range []string{"go_goroutines ", "go_memstats_alloc_bytes ", "go_gc_cycles_total "} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("Expected runtime metric %s", name)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+var processStartTime = time.Now()
+
+func init() {
+	Default.Register(runtimeCollectors()...)
+}
+
+// runtimeCollectors reports Go runtime and process metrics
+func runtimeCollectors() []Collector {
+	return []Collector{
+		NewGaugeFunc("go_info", "Information about the Go environment.", func() []Sample {
+			return []Sample{{LabelValues: []string{runtime.Version()}, Value: 1}}
+		}, "version"),
+		NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() []Sample {
+			return []Sample{{Value: float64(runtime.NumGoroutine())}}
+		}),
+		memStatsCollector{},
+		NewGaugeFunc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", func() []Sample {
+			return []Sample{{Value: float64(processStartTime.Unix())}}
+		}),
+	}
+}
+
+// memStatsCollector reports the memory and GC metrics from a single
+// ReadMemStats per scrape, as it stops the world
+type memStatsCollector struct{}
+
+// Collect implements Collector
+func (memStatsCollector) Collect(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	families := []struct {
+		name, help, metricType string
+		value                  float64
+	}{
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(stats.Alloc)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(stats.HeapObjects)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge", float64(stats.Sys)},
+		{"go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(stats.NumGC)},
+		{"go_gc_pause_seconds_total", "Total GC pause time in seconds.", "counter", time.Duration(stats.PauseTotalNs).Seconds()},
+	}
+	for _, family := range families {
+		writeFamily(w, family.name, family.help, family.metricType, nil, []Sample{{Value: family.value}})
+	}
+}
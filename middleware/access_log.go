@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rediwo/redi/logging"
+)
+
+// AccessLogFormat selects the layout of access log entries
+type AccessLogFormat string
+
+const (
+	// AccessLogOff disables the access log
+	AccessLogOff AccessLogFormat = "off"
+	// AccessLogCommon uses the NCSA Common Log Format
+	AccessLogCommon AccessLogFormat = "common"
+	// AccessLogCombined adds referer and user agent to the Common Log Format
+	AccessLogCombined AccessLogFormat = "combined"
+	// AccessLogJSON logs every request field as a structured field
+	AccessLogJSON AccessLogFormat = "json"
+)
+
+// ParseAccessLogFormat parses an access log format name
+func ParseAccessLogFormat(format string) (AccessLogFormat, error) {
+	switch AccessLogFormat(strings.ToLower(format)) {
+	case "", AccessLogOff, "none":
+		return AccessLogOff, nil
+	case AccessLogCommon:
+		return AccessLogCommon, nil
+	case AccessLogCombined:
+		return AccessLogCombined, nil
+	case AccessLogJSON:
+		return AccessLogJSON, nil
+	default:
+		return AccessLogOff, fmt.Errorf("unknown access log format %q (expected common, combined, json or off)", format)
+	}
+}
+
+// RouteInfo describes the route that served a request. Handlers fill it in
+// through SetRoute so the access log can report it.
+type RouteInfo struct {
+	Pattern string // Route pattern, e.g. /blog/{id}
+	Handler string // Handler type, e.g. js, svelte, html, static
+}
+
+type routeInfoKey struct{}
+
+// SetRoute records the route pattern and handler type for the access log
+func SetRoute(r *http.Request, pattern, handler string) {
+	if info, ok := r.Context().Value(routeInfoKey{}).(*RouteInfo); ok {
+		info.Pattern = pattern
+		info.Handler = handler
+	}
+}
+
+// RouteFromContext returns the route info recorded for the request, if any
+func RouteFromContext(ctx context.Context) *RouteInfo {
+	info, _ := ctx.Value(routeInfoKey{}).(*RouteInfo)
+	return info
+}
+
+// WithRouteInfo makes sure the request carries a RouteInfo that handlers can
+// fill in, reusing one installed by an outer middleware
+func WithRouteInfo(r *http.Request) (*http.Request, *RouteInfo) {
+	if info := RouteFromContext(r.Context()); info != nil {
+		return r, info
+	}
+	info := &RouteInfo{}
+	return r.WithContext(context.WithValue(r.Context(), routeInfoKey{}, info)), info
+}
+
+// AccessLog returns middleware that writes one log entry per request through
+// the logging package
+func AccessLog(format AccessLogFormat) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if format == AccessLogOff {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, info := WithRouteInfo(r)
+			recorder := NewResponseRecorder(w)
+
+			next.ServeHTTP(recorder, r)
+
+			writeAccessLog(format, r, recorder, info, start)
+		})
+	}
+}
+
+// writeAccessLog formats and writes a single access log entry
+func writeAccessLog(format AccessLogFormat, r *http.Request, recorder *ResponseRecorder, info *RouteInfo, start time.Time) {
+	latency := time.Since(start)
+	requestID := RequestIDFromContext(r.Context())
+
+	if format == AccessLogJSON {
+		logging.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query", r.URL.RawQuery,
+			"proto", r.Proto,
+			"status", recorder.Status(),
+			"bytes", recorder.BytesWritten(),
+			"latency_ms", float64(latency.Microseconds())/1000,
+			"route", info.Pattern,
+			"handler", info.Handler,
+			"remote_addr", clientHost(r),
+			"user_agent", r.UserAgent(),
+			"referer", r.Referer(),
+			"request_id", requestID,
+		)
+		return
+	}
+
+	bytes := "-"
+	if recorder.BytesWritten() > 0 {
+		bytes = fmt.Sprintf("%d", recorder.BytesWritten())
+	}
+	user := "-"
+	if r.URL.User != nil && r.URL.User.Username() != "" {
+		user = r.URL.User.Username()
+	} else if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = username
+	}
+
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		clientHost(r),
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method,
+		r.RequestURI,
+		r.Proto,
+		recorder.Status(),
+		bytes,
+	)
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, quoteOrDash(r.Referer()), quoteOrDash(r.UserAgent()))
+	}
+
+	logging.Info(line,
+		"latency", latency.Round(time.Microsecond),
+		"route", info.Pattern,
+		"handler", info.Handler,
+		"request_id", requestID,
+	)
+}
+
+// clientHost returns the remote address without the port
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// quoteOrDash escapes quotes for log fields and uses "-" for empty values
+func quoteOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
@@ -0,0 +1,545 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings supported by Compress
+const (
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+	EncodingGzip   = "gzip"
+)
+
+// CompressConfig configures response compression
+type CompressConfig struct {
+	// Encodings in order of preference when the client accepts several with
+	// the same quality
+	Encodings []string
+	// GzipLevel is the gzip compression level (-1 to 9)
+	GzipLevel int
+	// BrotliLevel is the brotli quality (0 to 11)
+	BrotliLevel int
+	// MinSize is the smallest body that is compressed, in bytes
+	MinSize int
+	// ContentTypes lists the compressible media types. Entries ending in
+	// "/" match a whole type, e.g. "text/".
+	ContentTypes []string
+	// CacheSize bounds the bytes of compressed responses kept in memory
+	// (0 disables the cache). Only responses with a strong ETag are cached,
+	// since the ETag identifies their content.
+	CacheSize int64
+	// MaxCachedSize is the largest uncompressed body that is cached
+	MaxCachedSize int
+}
+
+// DefaultCompressConfig returns the default compression settings
+func DefaultCompressConfig() CompressConfig {
+	return CompressConfig{
+		Encodings:   []string{EncodingBrotli, EncodingZstd, EncodingGzip},
+		GzipLevel:   gzip.DefaultCompression,
+		BrotliLevel: 5,
+		MinSize:     1024,
+		ContentTypes: []string{
+			"text/",
+			"application/javascript",
+			"application/json",
+			"application/xml",
+			"application/xhtml+xml",
+			"application/rss+xml",
+			"application/atom+xml",
+			"application/ld+json",
+			"application/manifest+json",
+			"application/wasm",
+			"image/svg+xml",
+			"font/ttf",
+			"font/otf",
+		},
+		CacheSize:     32 << 20,
+		MaxCachedSize: 4 << 20,
+	}
+}
+
+// compressor creates encoders and caches compressed bodies
+type compressor struct {
+	config CompressConfig
+	cache  *compressedCache
+
+	gzipPool   sync.Pool
+	brotliPool sync.Pool
+	zstdPool   sync.Pool
+}
+
+// Compress returns middleware compressing responses with the best encoding
+// the client accepts. Small bodies, media types outside the allowlist,
+// streaming responses (text/event-stream), partial content and responses that
+// already have a Content-Encoding are sent as they are.
+func Compress(config CompressConfig) func(http.Handler) http.Handler {
+	if len(config.Encodings) == 0 {
+		config.Encodings = DefaultCompressConfig().Encodings
+	}
+	if config.GzipLevel < gzip.HuffmanOnly || config.GzipLevel > gzip.BestCompression {
+		config.GzipLevel = gzip.DefaultCompression
+	}
+	if config.BrotliLevel < brotli.BestSpeed || config.BrotliLevel > brotli.BestCompression {
+		config.BrotliLevel = DefaultCompressConfig().BrotliLevel
+	}
+	c := &compressor{config: config}
+	if config.CacheSize > 0 {
+		c.cache = newCompressedCache(config.CacheSize)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"), config.Encodings)
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding, url: r.Host + r.URL.Path}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// NegotiateEncoding picks the coding with the highest quality in an
+// Accept-Encoding header among the supported ones, preferring earlier
+// supported codings on ties. It returns "" when nothing matches.
+func NegotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, coding := range supported {
+		quality, ok := qualities[coding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+	return best
+}
+
+// compressible reports whether a media type is in the allowlist
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	for _, allowed := range c.config.ContentTypes {
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed) || mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// encoder returns a pooled encoder for the coding writing to w
+func (c *compressor) encoder(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case EncodingBrotli:
+		if bw, ok := c.brotliPool.Get().(*brotli.Writer); ok {
+			bw.Reset(w)
+			return bw
+		}
+		return brotli.NewWriterLevel(w, c.config.BrotliLevel)
+	case EncodingZstd:
+		if zw, ok := c.zstdPool.Get().(*zstd.Encoder); ok {
+			zw.Reset(w)
+			return zw
+		}
+		zw, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return zw
+	default:
+		if gw, ok := c.gzipPool.Get().(*gzip.Writer); ok {
+			gw.Reset(w)
+			return gw
+		}
+		gw, _ := gzip.NewWriterLevel(w, c.config.GzipLevel)
+		return gw
+	}
+}
+
+// release returns an encoder to its pool
+func (c *compressor) release(encoding string, encoder io.WriteCloser) {
+	switch encoding {
+	case EncodingBrotli:
+		c.brotliPool.Put(encoder)
+	case EncodingZstd:
+		c.zstdPool.Put(encoder)
+	default:
+		c.gzipPool.Put(encoder)
+	}
+}
+
+// compress encodes a whole body
+func (c *compressor) compress(encoding string, body []byte) []byte {
+	var buf bytes.Buffer
+	encoder := c.encoder(encoding, &buf)
+	encoder.Write(body)
+	encoder.Close()
+	c.release(encoding, encoder)
+	return buf.Bytes()
+}
+
+// compressWriter decides at the first write whether to compress. Bodies are
+// buffered until MinSize bytes have been written, or until the handler
+// returns or flushes.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *compressor
+	encoding   string
+	url        string // Host and path, so equal ETags of other URLs don't collide
+
+	status      int
+	wroteHeader bool // WriteHeader was called by the handler
+	decided     bool
+	compressing bool
+	cacheKey    string // Set while buffering a whole body for the cache
+	buf         []byte
+	encoder     io.WriteCloser
+	hijacked    bool
+}
+
+// WriteHeader records the status; the header is sent once the body is
+// known to be compressible or not
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+	if status < 200 && status != http.StatusSwitchingProtocols {
+		// Informational responses such as 103 Early Hints pass through
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	cw.wroteHeader = true
+
+	if !cw.eligible() {
+		cw.passThrough()
+	}
+}
+
+// eligible checks everything that is known before the body
+func (cw *compressWriter) eligible() bool {
+	header := cw.Header()
+	switch {
+	case cw.status == http.StatusNoContent || cw.status == http.StatusPartialContent || (cw.status >= 300 && cw.status < 400):
+		return false
+	case header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "":
+		return false
+	case strings.Contains(header.Get("Cache-Control"), "no-transform"):
+		return false
+	}
+	if length := header.Get("Content-Length"); length != "" {
+		if n, err := strconv.Atoi(length); err == nil && n < cw.compressor.config.MinSize {
+			return false
+		}
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" && !cw.compressor.compressible(contentType) {
+		return false
+	}
+	return true
+}
+
+// Write buffers the start of the body to decide whether to compress it
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.compressing {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if cw.cacheKey != "" || (len(cw.buf) >= cw.compressor.config.MinSize && cw.startCache()) {
+		// Buffer the whole body for the cache, unless it grows too large
+		if len(cw.buf) > cw.compressor.config.MaxCachedSize {
+			cw.cacheKey = ""
+			return len(b), cw.startCompression()
+		}
+		return len(b), nil
+	}
+	if len(cw.buf) >= cw.compressor.config.MinSize {
+		return len(b), cw.startCompression()
+	}
+	return len(b), nil
+}
+
+// startCache starts buffering a whole body for the compressed cache when
+// the response has a strong ETag
+func (cw *compressWriter) startCache() bool {
+	etag := cw.Header().Get("ETag")
+	if cw.compressor.cache == nil || etag == "" || strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	if !cw.sniffContentType() {
+		return false
+	}
+	cw.cacheKey = cw.encoding + " " + cw.url + " " + cw.Header().Get("Content-Type") + " " + etag
+	return true
+}
+
+// sniffContentType sets a missing Content-Type from the buffered body, as
+// net/http would, and reports whether it is compressible
+func (cw *compressWriter) sniffContentType() bool {
+	header := cw.Header()
+	if _, ok := header["Content-Type"]; !ok {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	return cw.compressor.compressible(header.Get("Content-Type"))
+}
+
+// startCompression sends the header and starts encoding the buffered body
+func (cw *compressWriter) startCompression() error {
+	if !cw.sniffContentType() {
+		return cw.passThrough()
+	}
+	cw.decided = true
+	cw.compressing = true
+	header := cw.Header()
+	header.Set("Content-Encoding", cw.encoding)
+	header.Del("Content-Length")
+	weakenETag(header)
+	cw.ResponseWriter.WriteHeader(cw.statusCode())
+
+	cw.encoder = cw.compressor.encoder(cw.encoding, cw.ResponseWriter)
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.encoder.Write(buf)
+	return err
+}
+
+// passThrough sends the header and buffered body uncompressed
+func (cw *compressWriter) passThrough() error {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.statusCode())
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// writeCompressed sends a whole compressed body
+func (cw *compressWriter) writeCompressed(body []byte) {
+	cw.decided = true
+	header := cw.Header()
+	header.Set("Content-Encoding", cw.encoding)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	weakenETag(header)
+	cw.ResponseWriter.WriteHeader(cw.statusCode())
+	cw.ResponseWriter.Write(body)
+}
+
+// weakenETag makes a strong ETag weak. A strong ETag names the exact bytes
+// of the uncompressed body, which a compressed body doesn't have; the weak
+// one still matches If-None-Match with the weak comparison.
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+func (cw *compressWriter) statusCode() int {
+	if cw.status == 0 {
+		return http.StatusOK
+	}
+	return cw.status
+}
+
+// Flush sends what has been buffered. A response flushed before MinSize
+// bytes is treated as a stream and sent uncompressed.
+func (cw *compressWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		cw.cacheKey = ""
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+		if !cw.decided {
+			if len(cw.buf) >= cw.compressor.config.MinSize {
+				cw.startCompression()
+			} else {
+				cw.passThrough()
+			}
+		}
+	}
+	if cw.compressing {
+		if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+			flusher.Flush()
+		}
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the response once the handler has returned
+func (cw *compressWriter) Close() error {
+	if cw.hijacked {
+		return nil
+	}
+	if !cw.decided {
+		if !cw.wroteHeader && len(cw.buf) == 0 {
+			// The handler wrote nothing; let net/http send its defaults
+			return nil
+		}
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+	}
+	if !cw.decided {
+		switch {
+		case cw.cacheKey != "":
+			cw.finishCached()
+		case len(cw.buf) >= cw.compressor.config.MinSize:
+			cw.startCompression()
+		default:
+			cw.passThrough()
+		}
+	}
+	if cw.compressing {
+		err := cw.encoder.Close()
+		cw.compressor.release(cw.encoding, cw.encoder)
+		cw.encoder = nil
+		return err
+	}
+	return nil
+}
+
+// finishCached sends a fully buffered body, compressing it only if the
+// cache doesn't hold it yet
+func (cw *compressWriter) finishCached() {
+	cache := cw.compressor.cache
+	body, ok := cache.get(cw.cacheKey)
+	if !ok {
+		body = cw.compressor.compress(cw.encoding, cw.buf)
+		cache.put(cw.cacheKey, body)
+	}
+	cw.buf = nil
+	cw.writeCompressed(body)
+}
+
+// Hijack implements http.Hijacker for WebSocket upgrades
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressedCache is an LRU cache of compressed bodies bounded by total size
+type compressedCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type compressedEntry struct {
+	key  string
+	body []byte
+}
+
+func newCompressedCache(maxSize int64) *compressedCache {
+	return &compressedCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (cc *compressedCache) get(key string) ([]byte, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	element, ok := cc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cc.order.MoveToFront(element)
+	return element.Value.(*compressedEntry).body, true
+}
+
+func (cc *compressedCache) put(key string, body []byte) {
+	if int64(len(body)) > cc.maxSize {
+		return
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if _, ok := cc.entries[key]; ok {
+		return
+	}
+	cc.entries[key] = cc.order.PushFront(&compressedEntry{key: key, body: body})
+	cc.size += int64(len(body))
+	for cc.size > cc.maxSize {
+		oldest := cc.order.Back()
+		entry := oldest.Value.(*compressedEntry)
+		cc.order.Remove(oldest)
+		delete(cc.entries, entry.key)
+		cc.size -= int64(len(entry.body))
+	}
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var compressBody = strings.Repeat("<p>Hello, compressed world!</p>\n", 100)
+
+func serveCompressed(handler http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var reader io.Reader
+	switch encoding {
+	case EncodingBrotli:
+		reader = brotli.NewReader(bytes.NewReader(body))
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		reader = decoder
+	case EncodingGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gzipReader
+	default:
+		return string(body)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decode %s body: %v", encoding, err)
+	}
+	return string(data)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := DefaultCompressConfig().Encodings
+	tests := map[string]string{
+		"gzip, deflate, br, zstd": EncodingBrotli,
+		"gzip, zstd":              EncodingZstd,
+		"gzip;q=1.0, br;q=0.5":    EncodingGzip,
+		"br;q=0, gzip":            EncodingGzip,
+		"*":                       EncodingBrotli,
+		"identity":                "",
+		"deflate":                 "",
+	}
+	for header, want := range tests {
+		if got := NegotiateEncoding(header, supported); got != want {
+			t.Errorf("NegotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressEncodings(t *testing.T) {
+	handler := Compress(DefaultCompressConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, compressBody)
+	}))
+
+	for _, encoding := range []string{EncodingBrotli, EncodingZstd, EncodingGzip} {
+		rec := serveCompressed(handler, encoding)
+		if got := rec.Header().Get("Content-Encoding"); got != encoding {
+			t.Errorf("Expected Content-Encoding %q, got %q", encoding, got)
+			continue
+		}
+		if rec.Body.Len() >= len(compressBody) {
+			t.Errorf("%s: expected a smaller body, got %d bytes", encoding, rec.Body.Len())
+		}
+		if body := decode(t, encoding, rec.Body.Bytes()); body != compressBody {
+			t.Errorf("%s: decoded body differs", encoding)
+		}
+	}
+
+	rec := serveCompressed(handler, "")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != compressBody {
+		t.Error("Expected an uncompressed body without Accept-Encoding")
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"small body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "tiny")
+		}},
+		{"image", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, compressBody)
+		}},
+		{"already encoded", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Header().Set("Content-Encoding", "br")
+			io.WriteString(w, compressBody)
+		}},
+		{"server-sent events", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, compressBody)
+		}},
+		{"partial content", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, compressBody)
+		}},
+		{"early flush", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "data: 1\n\n")
+			w.(http.Flusher).Flush()
+			io.WriteString(w, compressBody)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveCompressed(Compress(DefaultCompressConfig())(tt.handler), "gzip, br")
+			if encoding := rec.Header().Get("Content-Encoding"); encoding != "" && tt.name != "already encoded" {
+				t.Errorf("Expected no compression, got %q", encoding)
+			}
+			if !strings.Contains(rec.Body.String(), "tiny") && !strings.Contains(rec.Body.String(), "Hello") {
+				t.Errorf("Expected the body unchanged, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressSniffsContentType(t *testing.T) {
+	handler := Compress(DefaultCompressConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<!DOCTYPE html>"+compressBody)
+	}))
+	rec := serveCompressed(handler, "gzip")
+	if rec.Header().Get("Content-Encoding") != EncodingGzip || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected sniffed HTML to be compressed, got %q %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestCompressCache(t *testing.T) {
+	etag := `"runtime-v1"`
+	handler := Compress(DefaultCompressConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, compressBody)
+	}))
+
+	first := serveCompressed(handler, "br")
+	second := serveCompressed(handler, "br")
+	if !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) {
+		t.Error("Expected identical bodies from the cache")
+	}
+	if first.Header().Get("Content-Length") == "" || first.Header().Get("ETag") != "W/"+etag {
+		t.Errorf("Expected Content-Length and the weakened ETag on cached responses, got %v", first.Header())
+	}
+	if body := decode(t, EncodingBrotli, second.Body.Bytes()); body != compressBody {
+		t.Error("Cached body differs after decoding")
+	}
+
+	// Another URL with the same ETag gets its own body
+	other := Compress(DefaultCompressConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, r.URL.Path+compressBody)
+	}))
+	for _, target := range []string{"/a.js", "/b.js"} {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rec := httptest.NewRecorder()
+		other.ServeHTTP(rec, req)
+		if body := decode(t, EncodingBrotli, rec.Body.Bytes()); body != target+compressBody {
+			t.Errorf("Expected the body of %s, got another URL's", target)
+		}
+	}
+
+	// Without the cache the compressed body is streamed, with a weak ETag
+	config := DefaultCompressConfig()
+	config.CacheSize = 0
+	streamed := Compress(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, compressBody)
+	}))
+	if rec := serveCompressed(streamed, "gzip"); rec.Header().Get("ETag") != "W/"+etag {
+		t.Errorf("Expected a weak ETag on a compressed body, got %q", rec.Header().Get("ETag"))
+	}
+
+	cache := newCompressedCache(10)
+	cache.put("a", []byte("12345"))
+	cache.put("b", []byte("12345"))
+	cache.get("a")
+	cache.put("c", []byte("12345"))
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Error("Expected the recently used entry to stay cached")
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy is the cross-origin policy for paths below PathPrefix
+type CORSPolicy struct {
+	PathPrefix string
+	// AllowedOrigins lists origins such as https://app.example.com;
+	// "*" allows any origin and https://*.example.com any subdomain
+	AllowedOrigins []string
+	// AllowedMethods for preflight requests (default: GET, HEAD, POST)
+	AllowedMethods []string
+	// AllowedHeaders for preflight requests (default: the requested ones)
+	AllowedHeaders []string
+	// ExposedHeaders are readable by the calling script
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// allowsOrigin reports whether origin matches the policy
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if strings.Contains(allowed, "*") {
+			if matched, _ := path.Match(strings.ToLower(allowed), strings.ToLower(origin)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsAnyOrigin reports whether the policy uses the "*" wildcard
+func (p *CORSPolicy) allowsAnyOrigin() bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHandler applies the policy with the longest matching prefix
+type corsHandler struct {
+	policies []CORSPolicy
+}
+
+func newCORS(policies []CORSPolicy) *corsHandler {
+	if len(policies) == 0 {
+		return nil
+	}
+	sorted := append([]CORSPolicy{}, policies...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix)
+	})
+	return &corsHandler{policies: sorted}
+}
+
+// policy returns the policy for a path
+func (c *corsHandler) policy(urlPath string) *CORSPolicy {
+	for i := range c.policies {
+		prefix := c.policies[i].PathPrefix
+		if prefix == "" || prefix == "/" || urlPath == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(urlPath, prefix) {
+			return &c.policies[i]
+		}
+	}
+	return nil
+}
+
+// handle adds CORS headers for cross-origin requests. Preflight requests are
+// answered here, before routing, because routes don't accept OPTIONS; it
+// returns true when the response has been written.
+func (c *corsHandler) handle(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	policy := c.policy(r.URL.Path)
+	if origin == "" || policy == nil {
+		return false
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if !policy.allowsOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+
+	if policy.allowsAnyOrigin() && !policy.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if policy.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(policy.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	methods := policy.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	requestedMethod := r.Header.Get("Access-Control-Request-Method")
+	allowed := false
+	for _, method := range methods {
+		if strings.EqualFold(method, requestedMethod) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(policy.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+	} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		header.Set("Access-Control-Allow-Headers", requested)
+	}
+	if policy.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
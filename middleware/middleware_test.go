@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rediwo/redi/logging"
+)
+
+func captureLogs(t *testing.T, format logging.Format) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger, err := logging.New(&logging.Config{Level: logging.INFO, Format: format, Output: &buf})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	previous := logging.GetGlobalLogger()
+	logging.SetGlobalLogger(logger)
+	t.Cleanup(func() { logging.SetGlobalLogger(previous) })
+	return &buf
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	// Generated when missing
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(seen) != 32 {
+		t.Errorf("Expected generated 32 character ID, got %q", seen)
+	}
+	if w.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Expected response header %q, got %q", seen, w.Header().Get(RequestIDHeader))
+	}
+
+	// Propagated when valid
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "upstream-123")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if seen != "upstream-123" || w.Header().Get(RequestIDHeader) != "upstream-123" {
+		t.Errorf("Expected propagated ID upstream-123, got %q", seen)
+	}
+
+	// Replaced when invalid
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\x01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen == "bad id\x01" || len(seen) != 32 {
+		t.Errorf("Expected invalid ID to be replaced, got %q", seen)
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	logs := captureLogs(t, logging.TextFormat)
+
+	handler := RequestID(AccessLog(AccessLogCombined)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r, "/blog/{id}", "js")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})))
+
+	req := httptest.NewRequest("POST", "/blog/42?x=1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set(RequestIDHeader, "abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := logs.String()
+	expected := []string{
+		`192.0.2.1 - - [`,
+		`"POST /blog/42?x=1 HTTP/1.1" 201 5 "http://example.com/" "test-agent"`,
+		"route=/blog/{id}",
+		"handler=js",
+		"request_id=abc",
+		"latency=",
+	}
+	for _, text := range expected {
+		if !strings.Contains(line, text) {
+			t.Errorf("Expected access log to contain %q, got: %s", text, line)
+		}
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	logs := captureLogs(t, logging.JSONFormat)
+
+	handler := AccessLog(AccessLogJSON)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+
+	line := logs.String()
+	for _, text := range []string{`"status":200`, `"bytes":2`, `"path":"/status"`, `"latency_ms":`} {
+		if !strings.Contains(line, text) {
+			t.Errorf("Expected JSON access log to contain %s, got: %s", text, line)
+		}
+	}
+}
+
+func TestParseAccessLogFormat(t *testing.T) {
+	for _, name := range []string{"", "off", "common", "combined", "json", "JSON"} {
+		if _, err := ParseAccessLogFormat(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+	if _, err := ParseAccessLogFormat("apache"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
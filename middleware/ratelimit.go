@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit keys: requests are counted per client IP, per session (client IP
+// and User-Agent, as used for JavaScript engine sessions) or per value of a
+// header, written "header:X-API-Key"
+const (
+	RateLimitKeyIP      = "ip"
+	RateLimitKeySession = "session"
+	rateLimitKeyHeader  = "header:"
+)
+
+// Rate is a number of requests allowed per period
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRate parses rates such as "10/m", "100/hour", "5/s" or "20/30s"
+func ParseRate(s string) (Rate, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q (use e.g. 10/m)", s)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || requests <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: request count must be a positive integer", s)
+	}
+
+	var per time.Duration
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "s", "sec", "second":
+		per = time.Second
+	case "m", "min", "minute":
+		per = time.Minute
+	case "h", "hour":
+		per = time.Hour
+	case "d", "day":
+		per = 24 * time.Hour
+	default:
+		per, err = time.ParseDuration(strings.TrimSpace(unit))
+		if err != nil || per <= 0 {
+			return Rate{}, fmt.Errorf("invalid rate %q: unknown period %q", s, unit)
+		}
+	}
+	return Rate{Requests: requests, Per: per}, nil
+}
+
+// String formats the rate as ParseRate accepts it
+func (r Rate) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	switch r.Per {
+	case time.Second:
+		return fmt.Sprintf("%d/s", r.Requests)
+	case time.Minute:
+		return fmt.Sprintf("%d/m", r.Requests)
+	case time.Hour:
+		return fmt.Sprintf("%d/h", r.Requests)
+	case 24 * time.Hour:
+		return fmt.Sprintf("%d/d", r.Requests)
+	}
+	return fmt.Sprintf("%d/%s", r.Requests, r.Per)
+}
+
+// IsZero reports whether the rate is unset
+func (r Rate) IsZero() bool {
+	return r.Requests <= 0 || r.Per <= 0
+}
+
+// ParseByteSize parses sizes such as "1048576", "512KB" or "10MB"
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512KB or 10MB)", s)
+	}
+	return size * multiplier, nil
+}
+
+// RateLimitConfig configures request rate and body size limits. Rules are
+// checked in addition to the global rate, so a request must pass both.
+type RateLimitConfig struct {
+	Rate  Rate // Global rate per key; zero disables it
+	Burst int  // Requests allowed at once (default: Rate.Requests)
+	// Key selects what requests are counted by: ip (default), session or
+	// header:Name
+	Key string
+	// TrustProxy takes the client IP from X-Forwarded-For and X-Real-IP
+	TrustProxy bool
+	// MaxBodySize limits request bodies in bytes; zero leaves them unlimited
+	MaxBodySize int64
+	Routes      []RateLimitRule
+}
+
+// RateLimitRule limits the requests to matching paths. Path is an exact
+// path, a prefix ending in "/" or a glob such as /api/*/login.
+type RateLimitRule struct {
+	Path        string
+	Methods     []string // Default: all methods
+	Rate        Rate
+	Burst       int
+	Key         string // Default: the global key
+	MaxBodySize int64  // Overrides the global body size limit
+}
+
+// Enabled reports whether the configuration limits anything
+func (c *RateLimitConfig) Enabled() bool {
+	return c != nil && (!c.Rate.IsZero() || c.MaxBodySize > 0 || len(c.Routes) > 0)
+}
+
+// matches reports whether the rule applies to a request
+func (rule *RateLimitRule) matches(r *http.Request) bool {
+	if len(rule.Methods) > 0 {
+		allowed := false
+		for _, method := range rule.Methods {
+			if strings.EqualFold(method, r.Method) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	switch {
+	case strings.HasSuffix(rule.Path, "/"):
+		return strings.HasPrefix(r.URL.Path, rule.Path) || r.URL.Path == strings.TrimSuffix(rule.Path, "/")
+	case strings.ContainsAny(rule.Path, "*?["):
+		matched, _ := path.Match(rule.Path, r.URL.Path)
+		return matched
+	default:
+		return r.URL.Path == rule.Path
+	}
+}
+
+// RateLimiter is a set of token buckets, one per key. Buckets hold up to
+// burst tokens and refill at the configured rate; idle full buckets are
+// dropped periodically.
+type RateLimiter struct {
+	rate      Rate
+	burst     float64
+	perToken  time.Duration
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate per key with the given
+// burst (default: rate.Requests)
+func NewRateLimiter(rate Rate, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = rate.Requests
+	}
+	return &RateLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		perToken: rate.Per / time.Duration(rate.Requests),
+		buckets:  make(map[string]*tokenBucket),
+		now:      time.Now,
+	}
+}
+
+// Rate returns the limiter's rate
+func (l *RateLimiter) Rate() Rate {
+	return l.rate
+}
+
+// Allow takes a token from key's bucket. It returns whether the request is
+// allowed, the tokens left and, when refused, how long until one is free.
+func (l *RateLimiter) Allow(key string) (bool, int, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	} else {
+		elapsed := now.Sub(bucket.last)
+		bucket.tokens = math.Min(l.burst, bucket.tokens+float64(elapsed)/float64(l.perToken))
+		bucket.last = now
+	}
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) * float64(l.perToken))
+		return false, 0, wait
+	}
+	bucket.tokens--
+	return true, int(bucket.tokens), 0
+}
+
+// sweep drops buckets that have refilled completely
+func (l *RateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst * float64(l.perToken))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// ClientIP returns the request's client address. Forwarding headers are
+// only trusted behind a proxy.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return realIP
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitKey returns the value requests are counted by: the client IP,
+// a session hash of IP and User-Agent, or a header value. Requests without
+// the header are counted by IP.
+func RateLimitKey(r *http.Request, key string, trustProxy bool) string {
+	switch {
+	case key == RateLimitKeySession:
+		sum := sha256.Sum256([]byte(ClientIP(r, trustProxy) + "|" + r.Header.Get("User-Agent")))
+		return "session:" + hex.EncodeToString(sum[:16])
+	case strings.HasPrefix(key, rateLimitKeyHeader):
+		if value := r.Header.Get(strings.TrimPrefix(key, rateLimitKeyHeader)); value != "" {
+			return key + ":" + value
+		}
+	}
+	return "ip:" + ClientIP(r, trustProxy)
+}
+
+// ValidRateLimitKey reports whether key is ip, session or header:Name
+func ValidRateLimitKey(key string) bool {
+	return key == "" || key == RateLimitKeyIP || key == RateLimitKeySession ||
+		(strings.HasPrefix(key, rateLimitKeyHeader) && len(key) > len(rateLimitKeyHeader))
+}
+
+// AllowRequest checks a request against a limiter and sets the
+// X-RateLimit-* headers. When the request is refused it also sets
+// Retry-After and returns false; the caller writes the 429 response.
+func AllowRequest(w http.ResponseWriter, r *http.Request, limiter *RateLimiter, key string, trustProxy bool) bool {
+	ok, remaining, retryAfter := limiter.Allow(RateLimitKey(r, key, trustProxy))
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(limiter.rate.Requests))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !ok {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	return ok
+}
+
+// RateLimit returns middleware enforcing the global and per-route rates and
+// body size limits. Refused requests get 429 Too Many Requests with
+// Retry-After.
+func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
+	var global *RateLimiter
+	if !config.Rate.IsZero() {
+		global = NewRateLimiter(config.Rate, config.Burst)
+	}
+	limiters := make([]*RateLimiter, len(config.Routes))
+	for i, rule := range config.Routes {
+		if !rule.Rate.IsZero() {
+			limiters[i] = NewRateLimiter(rule.Rate, rule.Burst)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxBodySize := config.MaxBodySize
+			for i := range config.Routes {
+				rule := &config.Routes[i]
+				if !rule.matches(r) {
+					continue
+				}
+				if rule.MaxBodySize > 0 {
+					maxBodySize = rule.MaxBodySize
+				}
+				if limiters[i] == nil {
+					continue
+				}
+				key := rule.Key
+				if key == "" {
+					key = config.Key
+				}
+				if !AllowRequest(w, r, limiters[i], key, config.TrustProxy) {
+					http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+					return
+				}
+			}
+			if global != nil && !AllowRequest(w, r, global, config.Key, config.TrustProxy) {
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+
+			if maxBodySize > 0 && r.Body != nil && r.Body != http.NoBody {
+				if r.ContentLength > maxBodySize {
+					http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]Rate{
+		"10/m":     {10, time.Minute},
+		"5/s":      {5, time.Second},
+		"100/hour": {100, time.Hour},
+		"20/30s":   {20, 30 * time.Second},
+		"1000/day": {1000, 24 * time.Hour},
+	}
+	for input, want := range tests {
+		got, err := ParseRate(input)
+		if err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"10", "0/m", "x/m", "10/fortnight"} {
+		if _, err := ParseRate(input); err == nil {
+			t.Errorf("Expected ParseRate(%q) to fail", input)
+		}
+	}
+
+	sizes := map[string]int64{"1024": 1024, "512KB": 512 << 10, "10mb": 10 << 20, "1G": 1 << 30}
+	for input, want := range sizes {
+		if got, err := ParseByteSize(input); err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(Rate{Requests: 2, Per: time.Minute}, 0)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	ok, _, retryAfter := limiter.Allow("a")
+	if ok || retryAfter != 30*time.Second {
+		t.Errorf("Expected refusal with a 30s wait, got %v %s", ok, retryAfter)
+	}
+	if ok, _, _ := limiter.Allow("b"); !ok {
+		t.Error("Expected keys to have separate buckets")
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, _, _ := limiter.Allow("a"); !ok {
+		t.Error("Expected a token after 30s")
+	}
+
+	now = now.Add(10 * time.Minute)
+	limiter.Allow("c")
+	if _, exists := limiter.buckets["b"]; exists {
+		t.Error("Expected idle full buckets to be swept")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := RateLimit(RateLimitConfig{
+		Rate:        Rate{Requests: 100, Per: time.Minute},
+		MaxBodySize: 1024,
+		Routes: []RateLimitRule{
+			{Path: "/api/login", Methods: []string{"POST"}, Rate: Rate{Requests: 1, Per: time.Minute}},
+			{Path: "/upload/", MaxBodySize: 4096},
+			{Path: "/keys/*", Rate: Rate{Requests: 1, Per: time.Minute}, Key: "header:X-API-Key"},
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	serve := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("POST", "/api/login", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the first login to pass, got %d", rec.Code)
+	}
+	rec := serve("POST", "/api/login", "", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After: 60, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("GET", "/api/login", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the rule to apply to POST only, got %d", rec.Code)
+	}
+
+	if rec := serve("POST", "/form", strings.Repeat("x", 2000), nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the global body limit, got %d", rec.Code)
+	}
+	if rec := serve("POST", "/upload/file", strings.Repeat("x", 2000), nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the route to raise the body limit, got %d", rec.Code)
+	}
+
+	if rec := serve("GET", "/keys/a", "", map[string]string{"X-API-Key": "one"}); rec.Code != http.StatusOK {
+		t.Errorf("Expected the first key to pass, got %d", rec.Code)
+	}
+	if rec := serve("GET", "/keys/a", "", map[string]string{"X-API-Key": "two"}); rec.Code != http.StatusOK {
+		t.Errorf("Expected a different key to have its own bucket, got %d", rec.Code)
+	}
+	if rec := serve("GET", "/keys/a", "", map[string]string{"X-API-Key": "one"}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the repeated key to be limited, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	if key := RateLimitKey(req, RateLimitKeyIP, false); key != "ip:192.0.2.1" {
+		t.Errorf("Expected the remote address without trusting proxies, got %q", key)
+	}
+	if key := RateLimitKey(req, RateLimitKeyIP, true); key != "ip:203.0.113.9" {
+		t.Errorf("Expected the forwarded client behind a proxy, got %q", key)
+	}
+	if key := RateLimitKey(req, "header:X-API-Key", false); key != "ip:192.0.2.1" {
+		t.Errorf("Expected requests without the header to fall back to the IP, got %q", key)
+	}
+	other := req.Clone(req.Context())
+	other.Header.Set("User-Agent", "other")
+	if RateLimitKey(req, RateLimitKeySession, false) == RateLimitKey(other, RateLimitKeySession, false) {
+		t.Error("Expected sessions to differ by User-Agent")
+	}
+}
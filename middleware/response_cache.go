@@ -0,0 +1,652 @@
+package middleware
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResponseCachePolicy says how long a response may be served from the
+// response cache
+type ResponseCachePolicy struct {
+	MaxAge time.Duration // How long the response is fresh
+	// StaleWhileRevalidate is how long after MaxAge the stale response is
+	// still served while it is rendered again in the background
+	StaleWhileRevalidate time.Duration
+	Tags                 []string // Names to purge the response by
+}
+
+// ResponseCacheConfig configures the in-process cache of rendered responses.
+// Responses are only cached for routes matching a rule, or whose handler
+// asks for it with CacheResponse.
+type ResponseCacheConfig struct {
+	// MaxSize bounds the bytes of response bodies kept in memory; the least
+	// recently used responses are dropped first
+	MaxSize int64
+	// MaxEntrySize is the largest body that is cached
+	MaxEntrySize int64
+	Routes       []ResponseCacheRule
+}
+
+// ResponseCacheRule caches the responses of matching paths. Path is an exact
+// path, a prefix ending in "/" or a glob such as /blog/*.
+type ResponseCacheRule struct {
+	Path string
+	ResponseCachePolicy
+}
+
+// DefaultResponseCacheConfig returns the default response cache settings
+func DefaultResponseCacheConfig() ResponseCacheConfig {
+	return ResponseCacheConfig{
+		MaxSize:      64 << 20,
+		MaxEntrySize: 4 << 20,
+	}
+}
+
+// ResponseCacheStats is a snapshot of response cache usage
+type ResponseCacheStats struct {
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`  // Bytes of cached bodies
+	Hits    int64 `json:"hits"`  // Fresh responses served from the cache
+	Stale   int64 `json:"stale"` // Stale responses served while revalidating
+	Misses  int64 `json:"misses"`
+	Purged  int64 `json:"purged"` // Responses removed by tag or cleared
+}
+
+// ResponseCache keeps rendered GET responses in memory. A response is
+// stored per URL and per value of the request headers named by its Vary
+// header, gets an ETag and a Cache-Control header unless it has them, and
+// is answered with 304 Not Modified when the client has it already.
+type ResponseCache struct {
+	config ResponseCacheConfig
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element // By URL and Vary values
+	urls    map[string]*urlVariants
+	tags    map[string]map[string]bool
+
+	hits   atomic.Int64
+	stale  atomic.Int64
+	misses atomic.Int64
+	purged atomic.Int64
+}
+
+// urlVariants are the Vary header names of a URL and how many of its
+// responses are stored
+type urlVariants struct {
+	names []string
+	count int
+}
+
+// cachedResponse is a stored response
+type cachedResponse struct {
+	key          string
+	url          string
+	varyNames    []string
+	status       int
+	header       http.Header
+	body         []byte
+	storedAt     time.Time
+	policy       ResponseCachePolicy
+	route        RouteInfo
+	revalidating bool
+}
+
+// responseCacheState is the cache and policy of a request, shared with the
+// handler through the request context
+type responseCacheState struct {
+	cache  *ResponseCache
+	mu     sync.Mutex
+	policy *ResponseCachePolicy
+}
+
+type responseCacheKey struct{}
+
+// NewResponseCache creates an empty response cache
+func NewResponseCache(config ResponseCacheConfig) *ResponseCache {
+	defaults := DefaultResponseCacheConfig()
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaults.MaxSize
+	}
+	if config.MaxEntrySize <= 0 {
+		config.MaxEntrySize = defaults.MaxEntrySize
+	}
+	return &ResponseCache{
+		config:  config,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		urls:    make(map[string]*urlVariants),
+		tags:    make(map[string]map[string]bool),
+	}
+}
+
+// CacheResponse asks the response cache to store the response to r with
+// policy. It must be called before the response header is written, and
+// overrides a matching rule. It returns false when no cache serves r.
+func CacheResponse(r *http.Request, policy ResponseCachePolicy) bool {
+	state, ok := r.Context().Value(responseCacheKey{}).(*responseCacheState)
+	if !ok {
+		return false
+	}
+	state.mu.Lock()
+	state.policy = &policy
+	state.mu.Unlock()
+	return true
+}
+
+// PurgeResponses removes the responses tagged with any of tags from the
+// cache serving r and returns how many were removed
+func PurgeResponses(r *http.Request, tags ...string) int {
+	state, ok := r.Context().Value(responseCacheKey{}).(*responseCacheState)
+	if !ok {
+		return 0
+	}
+	return state.cache.Purge(tags...)
+}
+
+// Middleware serves cached responses and stores the ones that may be cached
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Upgrade") != "" {
+			// Handlers of other methods may still purge
+			r, _ = c.withState(r)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		url := responseURL(r)
+		if entry, fresh, usable := c.lookup(url, r); usable {
+			SetRoute(r, entry.route.Pattern, entry.route.Handler)
+			if fresh {
+				c.hits.Add(1)
+				c.serve(w, r, entry, "HIT")
+				return
+			}
+			c.stale.Add(1)
+			c.serve(w, r, entry, "STALE")
+			c.revalidate(entry, next, r)
+			return
+		}
+
+		c.misses.Add(1)
+		c.render(w, r, next, url)
+	})
+}
+
+// withState returns r carrying a state the handler can set a policy on,
+// starting with the policy of the first matching rule
+func (c *ResponseCache) withState(r *http.Request) (*http.Request, *responseCacheState) {
+	state := &responseCacheState{cache: c}
+	for i := range c.config.Routes {
+		if c.config.Routes[i].matches(r.URL.Path) {
+			policy := c.config.Routes[i].ResponseCachePolicy
+			state.policy = &policy
+			break
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), responseCacheKey{}, state)), state
+}
+
+// render runs the handler, storing its response if it may be cached
+func (c *ResponseCache) render(w http.ResponseWriter, r *http.Request, next http.Handler, url string) {
+	r, state := c.withState(r)
+	// Headers set by outer middleware, such as X-Request-ID and the CSP
+	// with its nonce, belong to this request and aren't stored
+	cw := &cacheWriter{ResponseWriter: w, cache: c, state: state, request: r, preset: w.Header().Clone()}
+	next.ServeHTTP(cw, r)
+	if entry := cw.finish(url); entry != nil {
+		c.store(entry)
+	}
+}
+
+// revalidate renders a stale response again in the background, once at a
+// time per response
+func (c *ResponseCache) revalidate(entry *cachedResponse, next http.Handler, r *http.Request) {
+	c.mu.Lock()
+	if entry.revalidating {
+		c.mu.Unlock()
+		return
+	}
+	entry.revalidating = true
+	c.mu.Unlock()
+
+	// The request outlives the client's, and gets its own route info so the
+	// access log of the client's request isn't written to concurrently
+	ctx := context.WithValue(context.WithoutCancel(r.Context()), routeInfoKey{}, &RouteInfo{})
+	req := r.Clone(ctx)
+	req.Method = http.MethodGet
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			entry.revalidating = false
+			c.mu.Unlock()
+		}()
+		c.render(&discardWriter{header: make(http.Header)}, req, next, entry.url)
+	}()
+}
+
+// lookup finds the response for url matching the request's Vary headers.
+// It reports whether it is fresh, and whether it can be served at all.
+func (c *ResponseCache) lookup(url string, r *http.Request) (*cachedResponse, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	variants, ok := c.urls[url]
+	if !ok {
+		return nil, false, false
+	}
+	element, ok := c.entries[variantKey(url, variants.names, r.Header)]
+	if !ok {
+		return nil, false, false
+	}
+	entry := element.Value.(*cachedResponse)
+	age := time.Since(entry.storedAt)
+	if age > entry.policy.MaxAge+entry.policy.StaleWhileRevalidate {
+		c.remove(element)
+		return nil, false, false
+	}
+	c.order.MoveToFront(element)
+	return entry, age <= entry.policy.MaxAge, true
+}
+
+// store adds a response, replacing the previous one for its URL and Vary
+// values, and drops the least recently used responses beyond MaxSize
+func (c *ResponseCache) store(entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+	variants := c.urls[entry.url]
+	if variants == nil {
+		variants = &urlVariants{}
+		c.urls[entry.url] = variants
+	}
+	// The latest response says which headers the URL varies on
+	variants.names = entry.varyNames
+	variants.count++
+	c.entries[entry.key] = c.order.PushFront(entry)
+	c.size += int64(len(entry.body))
+	for _, tag := range entry.policy.Tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]bool)
+		}
+		c.tags[tag][entry.key] = true
+	}
+	for c.size > c.config.MaxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops a response; c.mu must be held
+func (c *ResponseCache) remove(element *list.Element) {
+	entry := element.Value.(*cachedResponse)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.body))
+	if variants := c.urls[entry.url]; variants != nil {
+		if variants.count--; variants.count <= 0 {
+			delete(c.urls, entry.url)
+		}
+	}
+	for _, tag := range entry.policy.Tags {
+		delete(c.tags[tag], entry.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// Purge removes the responses tagged with any of tags and returns how many
+// were removed
+func (c *ResponseCache) Purge(tags ...string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if element, ok := c.entries[key]; ok {
+				c.remove(element)
+				removed++
+			}
+		}
+	}
+	c.purged.Add(int64(removed))
+	return removed
+}
+
+// Clear removes every response and returns how many were removed
+func (c *ResponseCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := len(c.entries)
+	c.size = 0
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.urls = make(map[string]*urlVariants)
+	c.tags = make(map[string]map[string]bool)
+	c.purged.Add(int64(removed))
+	return removed
+}
+
+// Stats returns a snapshot of the cache usage
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	c.mu.Lock()
+	entries, size := len(c.entries), c.size
+	c.mu.Unlock()
+	return ResponseCacheStats{
+		Entries: entries,
+		Size:    size,
+		Hits:    c.hits.Load(),
+		Stale:   c.stale.Load(),
+		Misses:  c.misses.Load(),
+		Purged:  c.purged.Load(),
+	}
+}
+
+// serve writes a cached response, or 304 if the client has it
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, entry *cachedResponse, status string) {
+	header := w.Header()
+	for name, values := range entry.header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.storedAt).Seconds())))
+	header.Set("X-Cache", status)
+	if etagMatches(r.Header.Get("If-None-Match"), header.Get("ETag")) {
+		writeNotModified(w)
+		return
+	}
+	header.Set("Content-Length", strconv.Itoa(len(entry.body)))
+	w.WriteHeader(entry.status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.body)
+	}
+}
+
+// matches reports whether the rule applies to a path
+func (rule *ResponseCacheRule) matches(urlPath string) bool {
+	switch {
+	case strings.HasSuffix(rule.Path, "/"):
+		return strings.HasPrefix(urlPath, rule.Path) || urlPath == strings.TrimSuffix(rule.Path, "/")
+	case strings.ContainsAny(rule.Path, "*?["):
+		matched, _ := path.Match(rule.Path, urlPath)
+		return matched
+	default:
+		return urlPath == rule.Path
+	}
+}
+
+// cacheWriter buffers a response whose handler asked for it to be cached.
+// Whether to buffer is decided when the header is written; other responses
+// pass through unchanged.
+type cacheWriter struct {
+	http.ResponseWriter
+	cache   *ResponseCache
+	state   *responseCacheState
+	request *http.Request
+	preset  http.Header // Headers set before the handler ran
+
+	status      int
+	wroteHeader bool
+	buffering   bool
+	policy      ResponseCachePolicy
+	buf         []byte
+	hijacked    bool
+}
+
+// WriteHeader decides whether the response is cached
+func (cw *cacheWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	if status < 200 && status != http.StatusSwitchingProtocols {
+		// Informational responses such as 103 Early Hints pass through
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	cw.wroteHeader = true
+
+	cw.state.mu.Lock()
+	policy := cw.state.policy
+	cw.state.mu.Unlock()
+	if policy != nil && cw.cacheable(*policy) {
+		cw.buffering = true
+		cw.policy = *policy
+		return
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// cacheable checks everything that is known before the body
+func (cw *cacheWriter) cacheable(policy ResponseCachePolicy) bool {
+	header := cw.Header()
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	switch {
+	case policy.MaxAge <= 0 || cw.request.Method != http.MethodGet || cw.status != http.StatusOK:
+		return false
+	case header.Get("Set-Cookie") != "" || slices.Contains(varyNames(header), "*") || cw.request.Header.Get("Authorization") != "":
+		return false
+	case strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private"):
+		return false
+	}
+	return true
+}
+
+// Write buffers the body of a cached response, unless it grows too large
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if cw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.buffering {
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if int64(len(cw.buf)) > cw.cache.config.MaxEntrySize {
+		return len(b), cw.passThrough()
+	}
+	return len(b), nil
+}
+
+// passThrough stops buffering and sends what was buffered
+func (cw *cacheWriter) passThrough() error {
+	cw.buffering = false
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish sends a buffered response, with an ETag and Cache-Control header,
+// and returns it for the cache
+func (cw *cacheWriter) finish(url string) *cachedResponse {
+	if !cw.buffering {
+		return nil
+	}
+	if securityValuesRead(cw.request.Context()) {
+		// The body holds this request's CSP nonce or CSRF token
+		cw.passThrough()
+		return nil
+	}
+	header := cw.Header()
+	if _, ok := header["Content-Type"]; !ok {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if header.Get("ETag") == "" {
+		sum := sha256.Sum256(cw.buf)
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	if header.Get("Cache-Control") == "" {
+		cacheControl := fmt.Sprintf("public, max-age=%d", int(cw.policy.MaxAge.Seconds()))
+		if cw.policy.StaleWhileRevalidate > 0 {
+			cacheControl += fmt.Sprintf(", stale-while-revalidate=%d", int(cw.policy.StaleWhileRevalidate.Seconds()))
+		}
+		header.Set("Cache-Control", cacheControl)
+	}
+
+	entry := &cachedResponse{
+		url:      url,
+		status:   cw.status,
+		header:   cw.handlerHeader(),
+		body:     cw.buf,
+		storedAt: time.Now(),
+		policy:   cw.policy,
+	}
+	if info := RouteFromContext(cw.request.Context()); info != nil {
+		entry.route = *info
+	}
+	entry.varyNames = varyNames(header)
+	entry.key = variantKey(url, entry.varyNames, cw.request.Header)
+
+	header.Set("X-Cache", "MISS")
+	if etagMatches(cw.request.Header.Get("If-None-Match"), header.Get("ETag")) {
+		writeNotModified(cw.ResponseWriter)
+	} else {
+		header.Set("Content-Length", strconv.Itoa(len(cw.buf)))
+		cw.ResponseWriter.WriteHeader(cw.status)
+		cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return entry
+}
+
+// handlerHeader returns the headers the handler added or changed
+func (cw *cacheWriter) handlerHeader() http.Header {
+	header := make(http.Header)
+	for name, values := range cw.Header() {
+		if preset, ok := cw.preset[name]; ok && slices.Equal(preset, values) {
+			continue
+		}
+		header[name] = append([]string(nil), values...)
+	}
+	return header
+}
+
+// Flush sends what has been buffered; a flushed response is a stream and
+// isn't cached
+func (cw *cacheWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.buffering {
+		cw.passThrough()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for WebSocket upgrades
+func (cw *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// discardWriter receives responses rendered in the background
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+// responseURL identifies the resource requested: host, path and query
+func responseURL(r *http.Request) string {
+	return strings.ToLower(r.Host) + r.URL.RequestURI()
+}
+
+// varyNames returns the request headers named by a response's Vary header,
+// canonical and sorted. Accept-Encoding is left out: bodies are cached
+// uncompressed and compressed for each client.
+func varyNames(header http.Header) []string {
+	names := []string{}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && name != "Accept-Encoding" {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variantKey identifies a response by URL and the request headers it
+// varies on
+func variantKey(url string, names []string, header http.Header) string {
+	var key strings.Builder
+	key.WriteString(url)
+	for _, name := range names {
+		key.WriteString("\n" + name + ": " + strings.Join(header.Values(name), ","))
+	}
+	return key.String()
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// the weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified answers with 304, keeping only the headers it may carry
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Encoding", "Content-Language", "Content-Range", "X-Content-Type-Options"} {
+		header.Del(name)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
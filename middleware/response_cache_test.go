@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler renders the number of times it ran, asking to be cached
+// with policy when it is set
+func countingHandler(policy *ResponseCachePolicy) (http.Handler, *atomic.Int64) {
+	renders := &atomic.Int64{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := renders.Add(1)
+		if policy != nil {
+			CacheResponse(r, *policy)
+		}
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "render %d %s", n, r.Header.Get("Accept-Language"))
+	}), renders
+}
+
+func get(handler http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCache_HitAndNotModified(t *testing.T) {
+	next, renders := countingHandler(&ResponseCachePolicy{MaxAge: time.Minute})
+	handler := NewResponseCache(DefaultResponseCacheConfig()).Middleware(next)
+
+	first := get(handler, "/page", nil)
+	if first.Header().Get("X-Cache") != "MISS" || first.Body.String() != "render 1 " {
+		t.Fatalf("Expected a rendered miss, got %s: %q", first.Header().Get("X-Cache"), first.Body.String())
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("Expected an ETag and Cache-Control, got %v", first.Header())
+	}
+
+	second := get(handler, "/page", nil)
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != "render 1 " {
+		t.Errorf("Expected a cached hit, got %s: %q", second.Header().Get("X-Cache"), second.Body.String())
+	}
+	if second.Header().Get("ETag") != etag || second.Header().Get("Age") == "" {
+		t.Errorf("Expected the stored ETag and an Age header, got %v", second.Header())
+	}
+
+	notModified := get(handler, "/page", map[string]string{"If-None-Match": etag})
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching ETag, got %d: %q", notModified.Code, notModified.Body.String())
+	}
+	if renders.Load() != 1 {
+		t.Errorf("Expected one render, got %d", renders.Load())
+	}
+}
+
+func TestResponseCache_Vary(t *testing.T) {
+	next, renders := countingHandler(&ResponseCachePolicy{MaxAge: time.Minute})
+	handler := NewResponseCache(DefaultResponseCacheConfig()).Middleware(next)
+
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		rec := get(handler, "/page", map[string]string{"Accept-Language": lang})
+		if got := rec.Body.String(); got != "render 1 en" && got != "render 2 fr" {
+			t.Errorf("Expected the %s variant, got %q", lang, got)
+		}
+	}
+	if renders.Load() != 2 {
+		t.Errorf("Expected one render per language, got %d", renders.Load())
+	}
+}
+
+func TestResponseCache_Uncacheable(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"no policy": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		},
+		"cookie": func(w http.ResponseWriter, r *http.Request) {
+			CacheResponse(r, ResponseCachePolicy{MaxAge: time.Minute})
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			w.Write([]byte("ok"))
+		},
+		"no-store": func(w http.ResponseWriter, r *http.Request) {
+			CacheResponse(r, ResponseCachePolicy{MaxAge: time.Minute})
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("ok"))
+		},
+		"error": func(w http.ResponseWriter, r *http.Request) {
+			CacheResponse(r, ResponseCachePolicy{MaxAge: time.Minute})
+			http.Error(w, "oops", http.StatusInternalServerError)
+		},
+		"vary *": func(w http.ResponseWriter, r *http.Request) {
+			CacheResponse(r, ResponseCachePolicy{MaxAge: time.Minute})
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Add("Vary", "Cookie, *")
+			w.Write([]byte("ok"))
+		},
+	}
+	for name, next := range tests {
+		t.Run(name, func(t *testing.T) {
+			cache := NewResponseCache(DefaultResponseCacheConfig())
+			handler := cache.Middleware(next)
+			get(handler, "/page", nil)
+			if rec := get(handler, "/page", nil); rec.Header().Get("X-Cache") != "" {
+				t.Errorf("Expected the response not to be cached, got X-Cache %q", rec.Header().Get("X-Cache"))
+			}
+			if stats := cache.Stats(); stats.Entries != 0 {
+				t.Errorf("Expected no entries, got %d", stats.Entries)
+			}
+		})
+	}
+}
+
+func TestResponseCache_RulesAndPurge(t *testing.T) {
+	config := DefaultResponseCacheConfig()
+	config.Routes = []ResponseCacheRule{
+		{Path: "/blog/", ResponseCachePolicy: ResponseCachePolicy{MaxAge: time.Minute, Tags: []string{"blog"}}},
+		{Path: "/docs/*", ResponseCachePolicy: ResponseCachePolicy{MaxAge: time.Minute, Tags: []string{"docs"}}},
+	}
+	cache := NewResponseCache(config)
+	next, renders := countingHandler(nil)
+	handler := cache.Middleware(next)
+
+	for _, target := range []string{"/blog/a", "/blog/b", "/docs/intro", "/about"} {
+		get(handler, target, nil)
+		get(handler, target, nil)
+	}
+	if renders.Load() != 5 {
+		t.Fatalf("Expected the three matching pages to render once and /about twice, got %d renders", renders.Load())
+	}
+
+	if purged := cache.Purge("blog"); purged != 2 {
+		t.Errorf("Expected two blog pages purged, got %d", purged)
+	}
+	if rec := get(handler, "/blog/a", nil); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected a purged page to render again, got %q", rec.Header().Get("X-Cache"))
+	}
+	if rec := get(handler, "/docs/intro", nil); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected other tags to stay cached, got %q", rec.Header().Get("X-Cache"))
+	}
+
+	purger := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, PurgeResponses(r, "docs"))
+	}))
+	req := httptest.NewRequest("POST", "/publish", nil)
+	rec := httptest.NewRecorder()
+	purger.ServeHTTP(rec, req)
+	if rec.Body.String() != "1" {
+		t.Errorf("Expected PurgeResponses to remove the docs page, got %q", rec.Body.String())
+	}
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Purged != 3 {
+		t.Errorf("Expected 1 entry and 3 purged, got %+v", stats)
+	}
+	if len(cache.urls) != 1 {
+		t.Errorf("Expected purged URLs to be forgotten, got %d", len(cache.urls))
+	}
+}
+
+func TestResponseCache_StaleWhileRevalidate(t *testing.T) {
+	next, renders := countingHandler(&ResponseCachePolicy{MaxAge: 20 * time.Millisecond, StaleWhileRevalidate: time.Minute})
+	cache := NewResponseCache(DefaultResponseCacheConfig())
+	handler := cache.Middleware(next)
+
+	get(handler, "/page", nil)
+	time.Sleep(30 * time.Millisecond)
+
+	stale := get(handler, "/page", nil)
+	if stale.Header().Get("X-Cache") != "STALE" || stale.Body.String() != "render 1 " {
+		t.Fatalf("Expected the stale response, got %s: %q", stale.Header().Get("X-Cache"), stale.Body.String())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for renders.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// The new response is stored after the render returns
+	for time.Now().Before(deadline) {
+		if rec := get(handler, "/page", nil); rec.Body.String() == "render 2 " {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("Expected the response to be revalidated in the background, got %d renders", renders.Load())
+}
+
+func TestResponseCache_Eviction(t *testing.T) {
+	config := DefaultResponseCacheConfig()
+	config.MaxSize = 20
+	cache := NewResponseCache(config)
+	next, _ := countingHandler(&ResponseCachePolicy{MaxAge: time.Minute})
+	handler := cache.Middleware(next)
+
+	for i := 0; i < 5; i++ {
+		get(handler, fmt.Sprintf("/page/%d", i), nil)
+	}
+	if stats := cache.Stats(); stats.Size > config.MaxSize || stats.Entries != 2 {
+		t.Errorf("Expected the cache to stay within %d bytes, got %+v", config.MaxSize, stats)
+	}
+	if rec := get(handler, "/page/4", nil); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected the most recent page to stay cached, got %q", rec.Header().Get("X-Cache"))
+	}
+	if len(cache.urls) != 2 {
+		t.Errorf("Expected evicted URLs to be forgotten, got %d", len(cache.urls))
+	}
+}
+
+func TestResponseCache_RequestHeaders(t *testing.T) {
+	cache := NewResponseCache(DefaultResponseCacheConfig())
+	next, _ := countingHandler(&ResponseCachePolicy{MaxAge: time.Minute})
+	handler := RequestID(Security(SecurityConfig{CSP: DefaultCSP})(cache.Middleware(next)))
+
+	first := get(handler, "/page", nil)
+	second := get(handler, "/page", nil)
+	if second.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected a hit, got %q", second.Header().Get("X-Cache"))
+	}
+	for _, name := range []string{RequestIDHeader, "Content-Security-Policy"} {
+		if first.Header().Get(name) == second.Header().Get(name) {
+			t.Errorf("Expected a fresh %s on a hit, got the stored %q", name, second.Header().Get(name))
+		}
+	}
+}
+
+func TestResponseCache_SecurityValues(t *testing.T) {
+	tests := map[string]struct {
+		config SecurityConfig
+		read   func(r *http.Request) string
+	}{
+		"nonce": {SecurityConfig{CSP: DefaultCSP}, func(r *http.Request) string { return CSPNonce(r.Context()) }},
+		"csrf":  {SecurityConfig{CSRF: &CSRFConfig{}}, func(r *http.Request) string { return CSRFToken(r.Context()) }},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cache := NewResponseCache(DefaultResponseCacheConfig())
+			handler := Security(tt.config)(cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				CacheResponse(r, ResponseCachePolicy{MaxAge: time.Minute})
+				fmt.Fprintf(w, "<form>%s</form>", tt.read(r))
+			})))
+
+			// A returning visitor has the CSRF cookie and gets no Set-Cookie
+			header := map[string]string{"Cookie": "redi_csrf=" + strings.Repeat("a", 43)}
+			first := get(handler, "/form", header)
+			if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "" || first.Header().Get("ETag") != "" {
+				t.Errorf("Expected a plain response, got %d %v", first.Code, first.Header())
+			}
+			if stats := cache.Stats(); stats.Entries != 0 {
+				t.Errorf("Expected a page with the %s not to be stored, got %d entries", name, stats.Entries)
+			}
+		})
+	}
+}
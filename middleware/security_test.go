@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, "nonce="+CSPNonce(r.Context())+" csrf="+CSRFToken(r.Context())+" body="+string(body))
+	})
+}
+
+func TestSecurityCORS(t *testing.T) {
+	handler := Security(SecurityConfig{CORS: []CORSPolicy{
+		{PathPrefix: "/api/", AllowedOrigins: []string{"https://*.example.com"}, AllowedMethods: []string{"GET", "PUT"}, MaxAge: time.Hour},
+		{PathPrefix: "/api/public/", AllowedOrigins: []string{"*"}},
+	}})(echoHandler())
+
+	req := httptest.NewRequest("OPTIONS", "/api/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected preflight 204, got %d", rec.Code)
+	}
+	header := rec.Header()
+	if header.Get("Access-Control-Allow-Origin") != "https://app.example.com" || header.Get("Access-Control-Allow-Methods") != "GET, PUT" ||
+		header.Get("Access-Control-Allow-Headers") != "Content-Type" || header.Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("Unexpected preflight headers %v", header)
+	}
+
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a disallowed method to be rejected, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Code != http.StatusOK {
+		t.Errorf("Expected no CORS headers for a foreign origin, got %d %v", rec.Code, rec.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/api/public/feed", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected the longest prefix to allow any origin, got %v", rec.Header())
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := Security(SecurityConfig{
+		CSP:                DefaultCSP,
+		HSTSMaxAge:         365 * 24 * time.Hour,
+		HSTSPreload:        true,
+		FrameOptions:       "DENY",
+		ContentTypeNosniff: true,
+	})(echoHandler())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	header := rec.Header()
+	if header.Get("Strict-Transport-Security") != "" {
+		t.Error("Expected no HSTS header over plain HTTP")
+	}
+	if header.Get("X-Frame-Options") != "DENY" || header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Unexpected headers %v", header)
+	}
+	nonce := strings.TrimPrefix(strings.Fields(rec.Body.String())[0], "nonce=")
+	if nonce == "" || !strings.Contains(header.Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("Expected the policy to carry the handler's nonce %q, got %q", nonce, header.Get("Content-Security-Policy"))
+	}
+
+	again := httptest.NewRecorder()
+	handler.ServeHTTP(again, httptest.NewRequest("GET", "/", nil))
+	if again.Header().Get("Content-Security-Policy") == header.Get("Content-Security-Policy") {
+		t.Error("Expected a fresh nonce per request")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; preload" {
+		t.Errorf("Unexpected HSTS header %q", got)
+	}
+}
+
+func TestSecurityCSRF(t *testing.T) {
+	handler := Security(SecurityConfig{CSRF: &CSRFConfig{ExemptPaths: []string{"/hooks/"}}})(echoHandler())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCSRFCookie {
+		t.Fatalf("Expected a CSRF cookie, got %v", cookies)
+	}
+	token := cookies[0].Value
+	if !strings.Contains(rec.Body.String(), "csrf="+token) {
+		t.Errorf("Expected the handler to see the token, got %q", rec.Body.String())
+	}
+
+	post := func(body, headerToken string, withCookie bool, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if headerToken != "" {
+			req.Header.Set(DefaultCSRFHeader, headerToken)
+		}
+		if withCookie {
+			req.AddCookie(&http.Cookie{Name: DefaultCSRFCookie, Value: token})
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("name=a", "", true, "/form"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a missing token to be rejected, got %d", rec.Code)
+	}
+	if rec := post("name=a", token, false, "/form"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a missing cookie to be rejected, got %d", rec.Code)
+	}
+	if rec := post("name=a", "wrong"+token, true, "/form"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong token to be rejected, got %d", rec.Code)
+	}
+	if rec := post("name=a", token, true, "/form"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the header token to be accepted, got %d", rec.Code)
+	}
+	form := url.Values{"name": {"a"}, DefaultCSRFField: {token}}.Encode()
+	rec = post(form, "", true, "/form")
+	if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Body.String(), "body="+form) {
+		t.Errorf("Expected the form token to be accepted with the body intact, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("{}", "", false, "/hooks/github"); rec.Code != http.StatusOK {
+		t.Errorf("Expected exempt paths to skip the check, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/item", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected bearer requests to skip the check, got %d", rec.Code)
+	}
+}
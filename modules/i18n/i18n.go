@@ -0,0 +1,114 @@
+package i18n
+
+import (
+	js "github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/require"
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/i18n"
+	"github.com/rediwo/redi/registry"
+)
+
+const ModuleName = "i18n"
+
+// init registers the i18n module automatically
+func init() {
+	registry.RegisterModule(ModuleName, initI18nModule)
+}
+
+// initI18nModule initializes the i18n module
+func initI18nModule(config registry.ModuleConfig) error {
+	if config.FileSystem == nil {
+		return nil
+	}
+	registerI18nModule(config.Registry, config.FileSystem)
+	return nil
+}
+
+// registerI18nModule registers the i18n native module backed by the shared
+// translator of the filesystem, so routes see the same catalogs as templates
+func registerI18nModule(registry *require.Registry, fs filesystem.FileSystem) {
+	registry.RegisterNativeModule(ModuleName, func(runtime *js.Runtime, module *js.Object) {
+		exports := module.Get("exports").(*js.Object)
+		translator := i18n.ForFileSystem(fs)
+
+		bindTranslator(runtime, exports, func() *i18n.Translator { return translator }, "")
+
+		// load(dir) - use catalogs from another directory (e.g. in rejs scripts)
+		exports.Set("load", func(call js.FunctionCall) js.Value {
+			if len(call.Arguments) == 0 {
+				panic(runtime.NewTypeError("locales directory is required"))
+			}
+			loaded := i18n.NewTranslator(fs, call.Arguments[0].String())
+			if err := loaded.Load(); err != nil {
+				panic(runtime.NewGoError(err))
+			}
+			translator = loaded
+			return js.Undefined()
+		})
+	})
+}
+
+// bindTranslator sets the translation functions on obj. When locale is
+// empty the functions take the locale as their last argument.
+func bindTranslator(runtime *js.Runtime, obj *js.Object, current func() *i18n.Translator, locale string) {
+	resolveLocale := func(call js.FunctionCall, index int) string {
+		if locale != "" {
+			return locale
+		}
+		if len(call.Arguments) > index && !js.IsUndefined(call.Arguments[index]) && !js.IsNull(call.Arguments[index]) {
+			return call.Arguments[index].String()
+		}
+		return current().DefaultLocale()
+	}
+
+	// t(key, params?, locale?) - translate a key
+	obj.Set("t", func(call js.FunctionCall) js.Value {
+		if len(call.Arguments) == 0 {
+			panic(runtime.NewTypeError("key is required"))
+		}
+		key := call.Arguments[0].String()
+
+		var params map[string]interface{}
+		if len(call.Arguments) > 1 {
+			if exported, ok := call.Arguments[1].Export().(map[string]interface{}); ok {
+				params = exported
+			}
+		}
+
+		return runtime.ToValue(current().Translate(resolveLocale(call, 2), key, params))
+	})
+
+	// plural(count, locale?) - CLDR plural category for a count
+	obj.Set("plural", func(call js.FunctionCall) js.Value {
+		if len(call.Arguments) == 0 {
+			panic(runtime.NewTypeError("count is required"))
+		}
+		category := i18n.PluralCategoryFor(resolveLocale(call, 1), call.Arguments[0].ToInteger())
+		return runtime.ToValue(string(category))
+	})
+
+	// locales() - configured locales
+	obj.Set("locales", func(call js.FunctionCall) js.Value {
+		return runtime.ToValue(current().Locales())
+	})
+
+	// defaultLocale() - fallback locale
+	obj.Set("defaultLocale", func(call js.FunctionCall) js.Value {
+		return runtime.ToValue(current().DefaultLocale())
+	})
+
+	if locale != "" {
+		obj.Set("locale", locale)
+		return
+	}
+
+	// forLocale(locale) - translator bound to a locale, e.g. i18n.forLocale(req.locale)
+	obj.Set("forLocale", func(call js.FunctionCall) js.Value {
+		if len(call.Arguments) == 0 {
+			panic(runtime.NewTypeError("locale is required"))
+		}
+		bound := runtime.NewObject()
+		bindTranslator(runtime, bound, current, i18n.NormalizeLocale(call.Arguments[0].String()))
+		return bound
+	})
+}
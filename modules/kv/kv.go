@@ -0,0 +1,292 @@
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	js "github.com/dop251/goja"
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/kv"
+	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/registry"
+)
+
+const ModuleName = "kv"
+
+var (
+	storesMutex sync.Mutex
+	stores      = make(map[string]*sharedStore)
+)
+
+// sharedStore is a store and the filesystems whose engines use it
+type sharedStore struct {
+	store kv.Store
+	users map[string]bool
+}
+
+// init registers the kv module automatically
+func init() {
+	registry.RegisterModule(ModuleName, initKVModule)
+	registry.RegisterShutdown(ModuleName, closeStores)
+}
+
+// initKVModule initializes the kv module
+func initKVModule(config registry.ModuleConfig) error {
+	config.Registry.RegisterNativeModule(ModuleName, func(runtime *js.Runtime, module *js.Object) {
+		exports := module.Get("exports").(*js.Object)
+		// The store is opened on first use, so projects without it get no
+		// .redi/kv directory
+		registerFunctions(runtime, exports, storeFor(config.FileSystem, config.BasePath))
+	})
+	return nil
+}
+
+// storeFor returns the store of a project, shared by every engine of the
+// process. Sites on disk keep it in .redi/kv under the root; rejs scripts,
+// whose base path is absolute, keep it next to the script. In-memory and
+// embedded filesystems get an in-memory store.
+func storeFor(fs filesystem.FileSystem, basePath string) kv.Store {
+	dir := ""
+	if _, ok := fs.(*filesystem.OSFileSystem); ok {
+		root := fs.GetRoot()
+		if filepath.IsAbs(basePath) {
+			root = basePath
+		}
+		dir = filepath.Join(root, ".redi", "kv")
+	}
+	user := fmt.Sprintf("%T-%p", fs, fs)
+	key := dir
+	if dir == "" {
+		key = user
+	}
+
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+	if shared, exists := stores[key]; exists {
+		shared.users[user] = true
+		return shared.store
+	}
+
+	var store kv.Store = kv.NewMemoryStore()
+	if dir != "" {
+		fileStore, err := kv.OpenFileStore(dir)
+		if err != nil {
+			logging.Warn("Failed to open kv store, keeping it in memory", "dir", dir, "error", err)
+		} else {
+			store = fileStore
+		}
+	}
+	stores[key] = &sharedStore{store: store, users: map[string]bool{user: true}}
+	return store
+}
+
+// closeStores closes the stores no filesystem uses once the engines of fs
+// are stopped
+func closeStores(fs filesystem.FileSystem) {
+	user := fmt.Sprintf("%T-%p", fs, fs)
+
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+	for key, shared := range stores {
+		if !shared.users[user] {
+			continue
+		}
+		delete(shared.users, user)
+		if len(shared.users) == 0 {
+			shared.store.Close()
+			delete(stores, key)
+		}
+	}
+}
+
+// registerFunctions registers the kv functions on exports
+func registerFunctions(runtime *js.Runtime, exports *js.Object, store kv.Store) {
+	jsonObject := runtime.Get("JSON").ToObject(runtime)
+	stringify, _ := js.AssertFunction(jsonObject.Get("stringify"))
+	parse, _ := js.AssertFunction(jsonObject.Get("parse"))
+
+	toJSON := func(value js.Value) json.RawMessage {
+		encoded, err := stringify(jsonObject, value)
+		if err != nil {
+			panic(err)
+		}
+		if js.IsUndefined(encoded) {
+			panic(runtime.NewTypeError("value must be JSON-serializable"))
+		}
+		return json.RawMessage(encoded.String())
+	}
+	fromJSON := func(value json.RawMessage) js.Value {
+		decoded, err := parse(jsonObject, runtime.ToValue(string(value)))
+		if err != nil {
+			panic(err)
+		}
+		return decoded
+	}
+	check := func(err error) {
+		if err != nil {
+			panic(runtime.NewGoError(err))
+		}
+	}
+
+	// A transaction holds the store, so the functions of the module can't
+	// be used until it ends
+	var active *kv.Tx
+	checkIdle := func() {
+		if active != nil {
+			panic(runtime.NewTypeError("use the methods of the transaction inside kv.transaction"))
+		}
+	}
+
+	bindFunctions(runtime, exports, func(fn func(tx *kv.Tx)) {
+		checkIdle()
+		check(store.Update(func(tx *kv.Tx) error {
+			fn(tx)
+			return nil
+		}))
+	}, toJSON, fromJSON)
+
+	// transaction(fn) - run fn(tx) with tx.get/set/delete/list; its changes
+	// are applied together when it returns, and discarded when it throws
+	exports.Set("transaction", func(call js.FunctionCall) js.Value {
+		fn, ok := js.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(runtime.NewTypeError("transaction requires a function"))
+		}
+		checkIdle()
+
+		var result js.Value
+		var thrown *js.Exception
+		err := store.Update(func(tx *kv.Tx) error {
+			active = tx
+			defer func() { active = nil }()
+
+			txObject := runtime.NewObject()
+			ended := false
+			bindFunctions(runtime, txObject, func(fn func(tx *kv.Tx)) {
+				if ended {
+					panic(runtime.NewTypeError("the transaction has ended"))
+				}
+				fn(tx)
+			}, toJSON, fromJSON)
+			defer func() { ended = true }()
+
+			var err error
+			result, err = fn(js.Undefined(), txObject)
+			if exception, ok := err.(*js.Exception); ok {
+				thrown = exception
+			}
+			return err
+		})
+		if thrown != nil {
+			// Rethrow what the function threw, not a wrapped error
+			panic(thrown.Value())
+		}
+		check(err)
+		return result
+	})
+}
+
+// bindFunctions sets get, set, delete and list on obj, running each of them
+// in a transaction given by do
+func bindFunctions(runtime *js.Runtime, obj *js.Object, do func(func(tx *kv.Tx)), toJSON func(js.Value) json.RawMessage, fromJSON func(json.RawMessage) js.Value) {
+	key := func(call js.FunctionCall) string {
+		if len(call.Arguments) == 0 || js.IsUndefined(call.Arguments[0]) || js.IsNull(call.Arguments[0]) {
+			panic(runtime.NewTypeError("key is required"))
+		}
+		return call.Arguments[0].String()
+	}
+
+	// get(key) - the value of key, or undefined
+	obj.Set("get", func(call js.FunctionCall) js.Value {
+		name := key(call)
+		result := js.Undefined()
+		do(func(tx *kv.Tx) {
+			if value, found := tx.Get(name); found {
+				result = fromJSON(value)
+			}
+		})
+		return result
+	})
+
+	// set(key, value, { ttl }) - store a JSON value; ttl is in seconds or a
+	// duration such as '10m'
+	obj.Set("set", func(call js.FunctionCall) js.Value {
+		name := key(call)
+		value := toJSON(call.Argument(1))
+		ttl, err := parseTTL(call.Argument(2))
+		if err != nil {
+			panic(runtime.NewTypeError(err.Error()))
+		}
+		do(func(tx *kv.Tx) {
+			if err := tx.Set(name, value, ttl); err != nil {
+				panic(runtime.NewGoError(err))
+			}
+		})
+		return js.Undefined()
+	})
+
+	// delete(key) - remove key, returning whether it was set
+	obj.Set("delete", func(call js.FunctionCall) js.Value {
+		name := key(call)
+		deleted := false
+		do(func(tx *kv.Tx) {
+			deleted = tx.Delete(name)
+		})
+		return runtime.ToValue(deleted)
+	})
+
+	// list(prefix) - [{ key, value, expires? }] sorted by key
+	obj.Set("list", func(call js.FunctionCall) js.Value {
+		prefix := ""
+		if argument := call.Argument(0); !js.IsUndefined(argument) && !js.IsNull(argument) {
+			prefix = argument.String()
+		}
+		var entries []kv.Entry
+		do(func(tx *kv.Tx) {
+			entries = tx.List(prefix)
+		})
+
+		result := make([]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			item := runtime.NewObject()
+			item.Set("key", entry.Key)
+			item.Set("value", fromJSON(entry.Value))
+			if !entry.Expires.IsZero() {
+				item.Set("expires", entry.Expires.UnixMilli())
+			}
+			result = append(result, item)
+		}
+		return runtime.ToValue(result)
+	})
+}
+
+// parseTTL reads the options of set: { ttl } or a number of seconds
+func parseTTL(options js.Value) (time.Duration, error) {
+	if options == nil || js.IsUndefined(options) || js.IsNull(options) {
+		return 0, nil
+	}
+	value := options.Export()
+	if settings, ok := value.(map[string]interface{}); ok {
+		value = settings["ttl"]
+	}
+	switch ttl := value.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if ttl >= 0 {
+			return time.Duration(ttl) * time.Second, nil
+		}
+	case float64:
+		if ttl >= 0 {
+			return time.Duration(ttl * float64(time.Second)), nil
+		}
+	case string:
+		if d, err := time.ParseDuration(ttl); err == nil && d >= 0 {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("ttl must be a number of seconds or a duration such as '10m'")
+}
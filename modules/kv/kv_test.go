@@ -0,0 +1,182 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/require"
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/kv"
+	"github.com/rediwo/redi/registry"
+)
+
+func newKVRuntime(t *testing.T, fs filesystem.FileSystem, basePath string) *goja.Runtime {
+	t.Helper()
+	vm := goja.New()
+	requireRegistry := require.NewRegistry()
+	config := registry.ModuleConfig{
+		Registry:   requireRegistry,
+		FileSystem: fs,
+		BasePath:   basePath,
+		VM:         vm,
+	}
+	if err := initKVModule(config); err != nil {
+		t.Fatalf("Failed to initialize kv module: %v", err)
+	}
+	requireRegistry.Enable(vm)
+	return vm
+}
+
+func TestKVModule(t *testing.T) {
+	vm := newKVRuntime(t, filesystem.NewMemoryFileSystem(), "routes")
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{
+			name: "JSON values",
+			script: `
+				var kv = require('kv');
+				kv.set('user:1', { name: 'Ann', tags: ['a'] });
+				kv.set('user:2', 42, { ttl: '1h' });
+				JSON.stringify([kv.get('user:1'), kv.get('user:2'), kv.get('missing') === undefined]);
+			`,
+			expected: `[{"name":"Ann","tags":["a"]},42,true]`,
+		},
+		{
+			name: "list and delete",
+			script: `
+				var kv = require('kv');
+				var deleted = kv.delete('user:1');
+				var entries = kv.list('user:');
+				JSON.stringify([deleted, kv.delete('user:1'), entries.length, entries[0].key, entries[0].expires > Date.now()]);
+			`,
+			expected: `[true,false,1,"user:2",true]`,
+		},
+		{
+			name: "transaction",
+			script: `
+				var kv = require('kv');
+				kv.set('stock', 3);
+				var left = kv.transaction(function(tx) {
+					var stock = tx.get('stock');
+					tx.set('stock', stock - 1);
+					tx.set('order:1', { item: 'book' });
+					return tx.get('stock');
+				});
+				JSON.stringify([left, kv.get('stock'), kv.get('order:1').item]);
+			`,
+			expected: `[2,2,"book"]`,
+		},
+		{
+			name: "rolled back transaction",
+			script: `
+				var kv = require('kv');
+				var message;
+				try {
+					kv.transaction(function(tx) {
+						tx.set('stock', 0);
+						throw new Error('out of stock');
+					});
+				} catch (e) {
+					message = e.message;
+				}
+				JSON.stringify([message, kv.get('stock')]);
+			`,
+			expected: `["out of stock",2]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := vm.RunString(tt.script)
+			if err != nil {
+				t.Fatalf("Script error: %v", err)
+			}
+			if result.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result.String())
+			}
+		})
+	}
+}
+
+func TestKVModule_Errors(t *testing.T) {
+	vm := newKVRuntime(t, filesystem.NewMemoryFileSystem(), "routes")
+
+	tests := map[string]string{
+		"missing key":        `require('kv').get()`,
+		"undefined value":    `require('kv').set('a', undefined)`,
+		"invalid ttl":        `require('kv').set('a', 1, { ttl: 'soon' })`,
+		"nested transaction": `var kv = require('kv'); kv.transaction(function(tx) { kv.get('a'); })`,
+	}
+	for name, script := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := vm.RunString(script); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestKVModule_SharedStore(t *testing.T) {
+	dir := t.TempDir()
+	fs := filesystem.NewOSFileSystem(dir)
+
+	// Engines of a site share its store, which persists in .redi/kv
+	first := newKVRuntime(t, fs, "routes")
+	second := newKVRuntime(t, fs, "routes")
+	if _, err := first.RunString(`require('kv').set('visits', 7)`); err != nil {
+		t.Fatal(err)
+	}
+	result, err := second.RunString(`require('kv').get('visits')`)
+	if err != nil || result.ToInteger() != 7 {
+		t.Errorf("Expected the second engine to read 7, got %v (%v)", result, err)
+	}
+	if store, ok := storeFor(fs, "routes").(*kv.FileStore); !ok || store.Dir() != filepath.Join(dir, ".redi", "kv") {
+		t.Errorf("Expected a file store in %s/.redi/kv, got %v", dir, store)
+	}
+
+	// rejs scripts keep their store next to the script
+	script := newKVRuntime(t, filesystem.NewOSFileSystem("/"), dir)
+	result, err = script.RunString(`require('kv').get('visits')`)
+	if err != nil || result.ToInteger() != 7 {
+		t.Errorf("Expected a script in the site root to read 7, got %v (%v)", result, err)
+	}
+}
+
+func TestKVModule_CloseStores(t *testing.T) {
+	dir := t.TempDir()
+	fs := filesystem.NewOSFileSystem(dir)
+	other := filesystem.NewOSFileSystem(dir)
+	memFS := filesystem.NewMemoryFileSystem()
+
+	store := storeFor(fs, "routes")
+	storeFor(other, "routes")
+	storeFor(memFS, "routes")
+
+	// A store stays open while another filesystem's engines use it
+	closeStores(fs)
+	if _, _, err := store.Get("visits"); err != nil {
+		t.Errorf("Expected the store to stay open, got %v", err)
+	}
+	closeStores(other)
+	if _, _, err := store.Get("visits"); !errors.Is(err, kv.ErrClosed) {
+		t.Errorf("Expected the store to be closed, got %v", err)
+	}
+	if reopened := storeFor(fs, "routes"); reopened == store {
+		t.Error("Expected a closed store to be opened again")
+	}
+	closeStores(fs)
+
+	closeStores(memFS)
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+	if _, kept := stores[fmt.Sprintf("%T-%p", memFS, memFS)]; kept {
+		t.Error("Expected the store of an in-memory filesystem to be forgotten")
+	}
+}
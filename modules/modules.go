@@ -4,7 +4,7 @@
 //	import _ "github.com/rediwo/redi/modules"
 //
 // This will register all available modules including:
-// buffer, child_process, console, crypto, fetch, fs, path, process, stream, url, util
+// buffer, child_process, console, crypto, fetch, fs, i18n, kv, path, process, stream, url, util
 package modules
 
 import (
@@ -15,6 +15,8 @@ import (
 	_ "github.com/rediwo/redi/modules/crypto"
 	_ "github.com/rediwo/redi/modules/fetch"
 	_ "github.com/rediwo/redi/modules/fs"
+	_ "github.com/rediwo/redi/modules/i18n"
+	_ "github.com/rediwo/redi/modules/kv"
 	_ "github.com/rediwo/redi/modules/path"
 	_ "github.com/rediwo/redi/modules/process"
 	_ "github.com/rediwo/redi/modules/stream"
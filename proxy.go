@@ -0,0 +1,406 @@
+package redi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	rediHandlers "github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/logging"
+)
+
+// ProxyFileName is the name of proxy rule files in the routes directory.
+// Paths in a rule file are relative to its directory.
+const ProxyFileName = "_proxy.json"
+
+// DefaultProxyTimeout bounds connecting to a backend and waiting for its
+// response headers
+const DefaultProxyTimeout = 30 * time.Second
+
+// ProxyRule forwards requests to a backend service
+type ProxyRule struct {
+	// Path is an exact path or a prefix written /api/*
+	Path   string
+	Target string // Backend URL, e.g. http://localhost:9000
+	// StripPrefix is removed from the path before Rewrite is applied
+	StripPrefix string
+	// Rewrite rules are applied to the path in order
+	Rewrite []ProxyRewrite
+	// Headers are set on the backend request; an empty value removes one
+	Headers map[string]string
+	// ResponseHeaders are set on the response to the client
+	ResponseHeaders map[string]string
+	// PreserveHost sends the client's Host header instead of the target's
+	PreserveHost bool
+	// DisableWebSockets refuses Upgrade requests instead of passing them on
+	DisableWebSockets bool
+	// Timeout for connecting and for the response headers (default 30s).
+	// Streaming bodies and WebSocket connections are not cut off.
+	Timeout time.Duration
+	// Hook is a JavaScript file, relative to the root, exporting
+	// onRequest(req) to modify or answer requests before they are proxied
+	Hook string
+}
+
+// ProxyRewrite replaces the part of the path matching From, a regular
+// expression, with To, which may refer to groups as $1
+type ProxyRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// proxyFileRule is a rule as written in _proxy.json
+type proxyFileRule struct {
+	Path              string            `json:"path"`
+	Target            string            `json:"target"`
+	StripPrefix       string            `json:"stripPrefix"`
+	Rewrite           []ProxyRewrite    `json:"rewrite"`
+	Headers           map[string]string `json:"headers"`
+	ResponseHeaders   map[string]string `json:"responseHeaders"`
+	PreserveHost      bool              `json:"preserveHost"`
+	DisableWebSockets bool              `json:"disableWebSockets"`
+	Timeout           string            `json:"timeout"`
+	Hook              string            `json:"hook"`
+}
+
+// proxyHandler serves the requests matching a rule
+type proxyHandler struct {
+	rule     ProxyRule
+	target   *url.URL
+	rewrites []*regexp.Regexp
+	proxy    *httputil.ReverseProxy
+	server   *Server
+	// handlerManager renders error pages; it belongs to the routes the
+	// proxy is mounted with
+	handlerManager *HandlerManager
+}
+
+// newProxyHandler validates a rule and sets up its reverse proxy
+func (s *Server) newProxyHandler(rule ProxyRule) (*proxyHandler, error) {
+	if !strings.HasPrefix(rule.Path, "/") {
+		return nil, fmt.Errorf("proxy path %q must start with /", rule.Path)
+	}
+	target, err := url.Parse(rule.Target)
+	if err != nil || target.Host == "" {
+		return nil, fmt.Errorf("invalid proxy target %q for %s", rule.Target, rule.Path)
+	}
+	switch target.Scheme {
+	case "http", "https":
+	case "ws":
+		target.Scheme = "http"
+	case "wss":
+		target.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("proxy target %q for %s must be an http or https URL", rule.Target, rule.Path)
+	}
+	if rule.Timeout <= 0 {
+		rule.Timeout = DefaultProxyTimeout
+	}
+
+	h := &proxyHandler{rule: rule, target: target, server: s, handlerManager: s.handlerManager}
+	for _, rewrite := range rule.Rewrite {
+		pattern, err := regexp.Compile(rewrite.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite %q for %s: %w", rewrite.From, rule.Path, err)
+		}
+		h.rewrites = append(h.rewrites, pattern)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: rule.Timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = rule.Timeout
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite:        h.rewrite,
+		Transport:      transport,
+		ModifyResponse: h.modifyResponse,
+		ErrorHandler:   h.handleError,
+	}
+	return h, nil
+}
+
+// upstreamPath applies StripPrefix and the rewrite rules to a path
+func (h *proxyHandler) upstreamPath(urlPath string) string {
+	if h.rule.StripPrefix != "" && strings.HasPrefix(urlPath, h.rule.StripPrefix) {
+		urlPath = strings.TrimPrefix(urlPath, h.rule.StripPrefix)
+		if !strings.HasPrefix(urlPath, "/") {
+			urlPath = "/" + urlPath
+		}
+	}
+	for i, pattern := range h.rewrites {
+		urlPath = pattern.ReplaceAllString(urlPath, h.rule.Rewrite[i].To)
+	}
+	return urlPath
+}
+
+func (h *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.rule.DisableWebSockets && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "WebSocket connections are not proxied", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.URL.Path = h.upstreamPath(r.URL.Path)
+	out.URL.RawPath = ""
+
+	if h.rule.Hook != "" {
+		if handled := h.runHook(w, out); handled {
+			return
+		}
+	}
+	h.proxy.ServeHTTP(w, out)
+}
+
+// rewrite points the outgoing request at the target
+func (h *proxyHandler) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetURL(h.target)
+	pr.SetXForwarded()
+	if h.rule.PreserveHost {
+		pr.Out.Host = pr.In.Host
+	}
+	for name, value := range h.rule.Headers {
+		if value == "" {
+			pr.Out.Header.Del(name)
+		} else {
+			pr.Out.Header.Set(name, value)
+		}
+	}
+}
+
+// modifyResponse adds the configured response headers
+func (h *proxyHandler) modifyResponse(resp *http.Response) error {
+	for name, value := range h.rule.ResponseHeaders {
+		if value == "" {
+			resp.Header.Del(name)
+		} else {
+			resp.Header.Set(name, value)
+		}
+	}
+	return nil
+}
+
+// handleError answers 504 when the backend timed out and 502 otherwise
+func (h *proxyHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		status = http.StatusGatewayTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		// The client went away
+		return
+	}
+	logging.Warn("Proxy request failed", "path", r.URL.Path, "target", h.rule.Target, "status", status, "error", err)
+	h.serveError(w, r, status, fmt.Sprintf("Backend %s is unavailable", h.target.Host))
+}
+
+func (h *proxyHandler) serveError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if h.handlerManager != nil && h.handlerManager.errorHandler != nil {
+		h.handlerManager.errorHandler.ServeError(w, r, status, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// runHook calls the rule's onRequest(req) hook. The hook may change the
+// method, path, query and headers of req and return it, or return
+// { status, headers, body } to answer without proxying. It reports whether
+// the response has been written.
+func (h *proxyHandler) runHook(w http.ResponseWriter, r *http.Request) bool {
+	headers := make(map[string]interface{}, len(r.Header))
+	for name := range r.Header {
+		headers[name] = r.Header.Get(name)
+	}
+	req := map[string]interface{}{
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"query":      r.URL.RawQuery,
+		"headers":    headers,
+		"remoteAddr": r.RemoteAddr,
+		"target":     h.rule.Target,
+	}
+
+	engine, err := rediHandlers.GetJSEnginePool(h.server.fs, h.server.version).HookEngine()
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to get JavaScript engine: %v", err))
+		return true
+	}
+	result, err := engine.CallExport(h.rule.Hook, "onRequest", req)
+	if err != nil {
+		logging.Error("Proxy hook failed", "hook", h.rule.Hook, "error", err)
+		h.serveError(w, r, rediHandlers.StatusForError(err), err.Error())
+		return true
+	}
+
+	changes, ok := result.(map[string]interface{})
+	if !ok {
+		// Returning nothing proxies the request as it is
+		return false
+	}
+	if status, ok := changes["status"]; ok {
+		writeHookResponse(w, status, changes)
+		return true
+	}
+
+	if method, ok := changes["method"].(string); ok && method != "" {
+		r.Method = strings.ToUpper(method)
+	}
+	if urlPath, ok := changes["path"].(string); ok && urlPath != "" {
+		r.URL.Path = urlPath
+	}
+	if query, ok := changes["query"].(string); ok {
+		r.URL.RawQuery = query
+	}
+	if changed, ok := changes["headers"].(map[string]interface{}); ok {
+		for name := range headers {
+			if _, kept := changed[name]; !kept {
+				r.Header.Del(name)
+			}
+		}
+		for name, value := range changed {
+			if value == nil || value == "" {
+				r.Header.Del(name)
+			} else {
+				r.Header.Set(name, fmt.Sprint(value))
+			}
+		}
+	}
+	return false
+}
+
+// writeHookResponse writes the { status, headers, body } a hook returned;
+// bodies that aren't strings are sent as JSON
+func writeHookResponse(w http.ResponseWriter, status interface{}, response map[string]interface{}) {
+	code, ok := status.(int64)
+	if !ok || code < 100 || code > 999 {
+		code = http.StatusInternalServerError
+	}
+	if headers, ok := response["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			w.Header().Set(name, fmt.Sprint(value))
+		}
+	}
+	switch body := response["body"].(type) {
+	case nil:
+		w.WriteHeader(int(code))
+	case string:
+		w.WriteHeader(int(code))
+		w.Write([]byte(body))
+	default:
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(int(code))
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// loadProxyFiles reads the _proxy.json files below the routes directory
+func (s *Server) loadProxyFiles() ([]ProxyRule, error) {
+	var rules []ProxyRule
+	err := s.fs.WalkDir(s.routesDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != ProxyFileName {
+			return nil
+		}
+		fileRules, err := s.parseProxyFile(filePath)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return rules, err
+}
+
+// parseProxyFile parses a _proxy.json file: a rule or a list of rules whose
+// paths and hooks are relative to the file's directory
+func (s *Server) parseProxyFile(filePath string) ([]ProxyRule, error) {
+	content, err := s.fs.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var fileRules []proxyFileRule
+	if trimmed := strings.TrimSpace(string(content)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(content, &fileRules)
+	} else {
+		var rule proxyFileRule
+		err = json.Unmarshal(content, &rule)
+		fileRules = append(fileRules, rule)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	dir := filepath.ToSlash(filepath.Dir(filePath))
+	base := "/" + strings.Trim(strings.TrimPrefix(dir, strings.TrimSuffix(filepath.ToSlash(s.routesDir), "/")), "/")
+	var rules []ProxyRule
+	for _, fileRule := range fileRules {
+		rulePath := fileRule.Path
+		if rulePath == "" {
+			rulePath = "/*"
+		}
+		rule := ProxyRule{
+			Path:              strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(rulePath, "/"),
+			Target:            fileRule.Target,
+			StripPrefix:       fileRule.StripPrefix,
+			Rewrite:           fileRule.Rewrite,
+			Headers:           fileRule.Headers,
+			ResponseHeaders:   fileRule.ResponseHeaders,
+			PreserveHost:      fileRule.PreserveHost,
+			DisableWebSockets: fileRule.DisableWebSockets,
+		}
+		if fileRule.Timeout != "" {
+			if rule.Timeout, err = time.ParseDuration(fileRule.Timeout); err != nil {
+				return nil, fmt.Errorf("%s: invalid timeout %q", filePath, fileRule.Timeout)
+			}
+		}
+		if fileRule.Hook != "" {
+			rule.Hook = path.Join(dir, fileRule.Hook)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// setupProxies registers the proxy rules from the server config and the
+// routes directory. They are registered before the route handlers so they
+// take precedence, and accept every method.
+func (s *Server) setupProxies() {
+	rules := append([]ProxyRule{}, s.proxyRules...)
+	fileRules, err := s.loadProxyFiles()
+	if err != nil {
+		logging.Error("Failed to load proxy rules", "error", err)
+	}
+	rules = append(rules, fileRules...)
+
+	for _, rule := range rules {
+		handler, err := s.newProxyHandler(rule)
+		if err != nil {
+			logging.Error("Skipping proxy rule", "error", err)
+			continue
+		}
+		serve := withRouteInfo("proxy", handler.ServeHTTP)
+		if prefix, ok := strings.CutSuffix(rule.Path, "*"); ok {
+			s.router.PathPrefix(prefix).HandlerFunc(serve)
+		} else {
+			s.router.Path(rule.Path).HandlerFunc(serve)
+		}
+		logging.Info("Registered proxy", "path", rule.Path, "target", rule.Target)
+	}
+}
@@ -0,0 +1,194 @@
+package redi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+)
+
+func newProxyTestServer(t *testing.T, files map[string]string, rules []ProxyRule) *httptest.Server {
+	t.Helper()
+	memFS := filesystem.NewMemoryFileSystem()
+	for name, content := range files {
+		memFS.WriteFile(name, []byte(content))
+	}
+	server := &Server{
+		router:     mux.NewRouter(),
+		fs:         memFS,
+		routesDir:  "routes",
+		version:    "test",
+		proxyRules: rules,
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	frontend := httptest.NewServer(server.router)
+	t.Cleanup(frontend.Close)
+	return frontend
+}
+
+func newEchoBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Header().Set("X-Backend", "yes")
+		fmt.Fprintf(w, "%s %s?%s token=%s user=%s forwarded=%s", r.Method, r.URL.Path, r.URL.RawQuery,
+			r.Header.Get("X-Token"), r.Header.Get("X-User"), r.Header.Get("X-Forwarded-Host"))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func get(t *testing.T, target string) (int, string, http.Header) {
+	t.Helper()
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), resp.Header
+}
+
+func TestProxyFile(t *testing.T) {
+	backend := newEchoBackend(t)
+	frontend := newProxyTestServer(t, map[string]string{
+		"routes/index.html": "<h1>Home</h1>",
+		"routes/api/users.js": `exports.get = function(req, res) { res.send('route'); };`,
+		"routes/api/_proxy.json": `{
+			"target": "` + backend.URL + `",
+			"stripPrefix": "/api",
+			"rewrite": [{"from": "^/v1/(.*)", "to": "/v2/$1"}],
+			"headers": {"X-Token": "secret"},
+			"responseHeaders": {"X-Proxied": "redi"},
+			"timeout": "100ms"
+		}`,
+	}, nil)
+
+	status, body, header := get(t, frontend.URL+"/api/users?page=2")
+	if status != http.StatusOK || !strings.HasPrefix(body, "GET /users?page=2 token=secret") {
+		t.Errorf("Expected the proxy to take precedence over routes, got %d %q", status, body)
+	}
+	if header.Get("X-Proxied") != "redi" || header.Get("X-Backend") != "yes" {
+		t.Errorf("Expected backend and injected response headers, got %v", header)
+	}
+	if !strings.Contains(body, "forwarded=127.0.0.1") {
+		t.Errorf("Expected X-Forwarded-Host, got %q", body)
+	}
+
+	if _, body, _ := get(t, frontend.URL+"/api/v1/items"); !strings.HasPrefix(body, "GET /v2/items?") {
+		t.Errorf("Expected the rewritten path, got %q", body)
+	}
+	if status, _, _ := get(t, frontend.URL+"/api/slow"); status != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 from a slow backend, got %d", status)
+	}
+	if status, body, _ := get(t, frontend.URL+"/"); status != http.StatusOK || !strings.Contains(body, "Home") {
+		t.Errorf("Expected other routes to be unaffected, got %d %q", status, body)
+	}
+
+	req, _ := http.NewRequest("DELETE", frontend.URL+"/api/items/1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected every method to be proxied, got %d", resp.StatusCode)
+	}
+}
+
+func TestProxyUnavailableBackend(t *testing.T) {
+	frontend := newProxyTestServer(t, map[string]string{"routes/index.html": "home"},
+		[]ProxyRule{{Path: "/down/*", Target: "http://127.0.0.1:1"}})
+	if status, _, _ := get(t, frontend.URL+"/down/x"); status != http.StatusBadGateway {
+		t.Errorf("Expected 502 for an unreachable backend, got %d", status)
+	}
+}
+
+func TestProxyHook(t *testing.T) {
+	backend := newEchoBackend(t)
+	frontend := newProxyTestServer(t, map[string]string{
+		"routes/index.html": "home",
+		"proxy/auth.js": `exports.onRequest = function(req) {
+			if (!req.headers['Authorization']) {
+				return { status: 401, body: { error: 'login required' } };
+			}
+			req.headers['X-User'] = req.headers['Authorization'].replace('User ', '');
+			delete req.headers['Authorization'];
+			req.path = '/hooked' + req.path;
+			return req;
+		};`,
+	}, []ProxyRule{{Path: "/svc/*", Target: backend.URL, StripPrefix: "/svc", Hook: "proxy/auth.js"}})
+
+	status, body, header := get(t, frontend.URL+"/svc/me")
+	if status != http.StatusUnauthorized || !strings.Contains(body, "login required") || header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the hook to answer 401 JSON, got %d %q", status, body)
+	}
+
+	req, _ := http.NewRequest("GET", frontend.URL+"/svc/me", nil)
+	req.Header.Set("Authorization", "User alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(string(data), "GET /hooked/me?") || !strings.Contains(string(data), "user=alice") {
+		t.Errorf("Expected the hook's changes to reach the backend, got %q", data)
+	}
+}
+
+func TestProxyWebSocket(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString("echo: " + line)
+		rw.Flush()
+	}))
+	defer backend.Close()
+
+	frontend := newProxyTestServer(t, map[string]string{"routes/index.html": "home"},
+		[]ProxyRule{{Path: "/ws", Target: strings.Replace(backend.URL, "http://", "ws://", 1)}})
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(frontend.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101 Switching Protocols, got %d", resp.StatusCode)
+	}
+	fmt.Fprintf(conn, "hello\n")
+	if line, _ := reader.ReadString('\n'); line != "echo: hello\n" {
+		t.Errorf("Expected the upgraded connection to be relayed, got %q", line)
+	}
+}
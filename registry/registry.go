@@ -22,14 +22,34 @@ type ModuleConfig struct {
 	VM         *js.Runtime
 }
 
+// ModuleShutdown releases what a module holds for the engines of a
+// filesystem, once they are stopped
+type ModuleShutdown func(fs filesystem.FileSystem)
+
 // registeredModules holds all registered module initializers
 var registeredModules = make(map[string]ModuleInitializer)
 
+// registeredShutdowns holds the shutdown functions of the modules having one
+var registeredShutdowns = make(map[string]ModuleShutdown)
+
 // RegisterModule registers a module initializer with the given name
 func RegisterModule(name string, initializer ModuleInitializer) {
 	registeredModules[name] = initializer
 }
 
+// RegisterShutdown registers the shutdown function of a module
+func RegisterShutdown(name string, shutdown ModuleShutdown) {
+	registeredShutdowns[name] = shutdown
+}
+
+// ShutdownAllModules runs the shutdown functions of all modules for the
+// engines of fs
+func ShutdownAllModules(fs filesystem.FileSystem) {
+	for _, shutdown := range registeredShutdowns {
+		shutdown(fs)
+	}
+}
+
 // InitializeAllModules initializes all registered modules with the given configuration
 func InitializeAllModules(config ModuleConfig) error {
 	for name, init := range registeredModules {
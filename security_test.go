@@ -0,0 +1,54 @@
+package redi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/middleware"
+)
+
+func TestSecurityTemplateFuncs(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/form.html", []byte(`<form method="post"><input name="_csrf" value="{{csrfToken}}"></form><script nonce="{{cspNonce}}">go()</script>`))
+
+	server := &Server{
+		router:    mux.NewRouter(),
+		fs:        memFS,
+		routesDir: "routes",
+		version:   "test",
+		securityConfig: &middleware.SecurityConfig{
+			CSP:  middleware.DefaultCSP,
+			CSRF: &middleware.CSRFConfig{},
+		},
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	handler := server.applyMiddleware(server.router)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !strings.Contains(rec.Body.String(), `value="`+cookies[0].Value+`"`) {
+		t.Errorf("Expected the CSRF token in the form, got %q", rec.Body.String())
+	}
+	csp := rec.Header().Get("Content-Security-Policy")
+	start := strings.Index(rec.Body.String(), `nonce="`) + len(`nonce="`)
+	nonce := rec.Body.String()[start : start+strings.Index(rec.Body.String()[start:], `"`)]
+	if nonce == "" || !strings.Contains(csp, "'nonce-"+nonce+"'") {
+		t.Errorf("Expected the script nonce %q in the policy %q", nonce, csp)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/form", strings.NewReader("_csrf=x")))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a POST without the cookie to be rejected, got %d", rec.Code)
+	}
+}
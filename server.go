@@ -5,16 +5,21 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
-	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/rediwo/redi/cache"
+	"github.com/rediwo/redi/certs"
 	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/i18n"
 	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/metrics"
+	"github.com/rediwo/redi/middleware"
 	rediHandlers "github.com/rediwo/redi/handlers"
 )
 
@@ -31,6 +36,53 @@ type Server struct {
 	cacheManager   *cache.CacheManager
 	svelteCache    *cache.SvelteCache
 	enableCache    bool
+	defaultLocale  string
+	devMode        bool
+	accessLog      middleware.AccessLogFormat
+	enableMetrics  bool
+	metrics        *metrics.Registry
+	httpMetrics    *metrics.HTTPMetrics
+	adminToken     string
+	// TLS settings
+	tlsPairs         []certs.Pair
+	devTLS           bool
+	httpRedirectPort int
+	redirectServer   *http.Server
+	routes         []Route
+	startTime      time.Time
+	// Handler settings (nil selects the defaults)
+	templateConfig   *rediHandlers.TemplateConfig
+	svelteConfig     *rediHandlers.SvelteConfig
+	compressConfig   *middleware.CompressConfig
+	securityConfig   *middleware.SecurityConfig
+	rateLimitConfig  *middleware.RateLimitConfig
+	responseCacheConfig *middleware.ResponseCacheConfig
+	responseCache    atomic.Pointer[middleware.ResponseCache]
+	cacheConfig      *cache.CacheConfig
+	cacheBackend     cache.CacheBackend
+	proxyRules       []ProxyRule
+	// Virtual hosts sharing the listener (nil without any)
+	virtualHosts     []VirtualHost
+	sites            *sites
+	// Static file settings (nil selects the defaults)
+	staticConfig     *StaticConfig
+	staticFiles      atomic.Pointer[staticFileServer]
+	// Lifecycle state
+	shutdownTimeout  time.Duration
+	active           atomic.Pointer[siteState]
+	// chain is the middleware in front of the sites; Reload rebuilds it
+	chain            atomic.Pointer[http.Handler]
+	reloadMu         sync.Mutex
+	listener         net.Listener
+	redirectListener net.Listener
+	// Readiness state
+	routesReady     atomic.Bool
+	prebuildOnStart bool
+	prebuildWorkers int
+	prebuildDone    atomic.Bool
+	prebuildErr     atomic.Value
+	prebuildReport  string
+	precompiler     atomic.Pointer[rediHandlers.SveltePrecompiler]
 }
 
 func NewServer(root string, port int) *Server {
@@ -51,6 +103,7 @@ func NewServerWithVersion(root string, port int, version string) *Server {
 		gzipLevel:   gzip.DefaultCompression,
 		routesDir:   "routes",
 		enableCache: true,
+		shutdownTimeout: DefaultShutdownTimeout,
 	}
 }
 
@@ -64,6 +117,7 @@ func NewServerWithFSAndVersion(embedFS fs.FS, port int, version string) *Server
 		gzipLevel:   gzip.DefaultCompression,
 		routesDir:   "routes",
 		enableCache: true,
+		shutdownTimeout: DefaultShutdownTimeout,
 	}
 }
 
@@ -89,12 +143,120 @@ func (s *Server) SetCacheEnabled(enabled bool) {
 	s.enableCache = enabled
 }
 
-// initializeCache initializes the cache system if enabled
+// SetDefaultLocale sets the fallback locale used when a request matches no
+// configured locale (defaults to "en" when a catalog for it exists)
+func (s *Server) SetDefaultLocale(locale string) {
+	s.defaultLocale = locale
+}
+
+// SetDevMode enables development error pages with stack traces and source
+// excerpts. In production mode server errors are shown with a generic message.
+func (s *Server) SetDevMode(devMode bool) {
+	s.devMode = devMode
+}
+
+// SetAccessLogFormat sets the access log format (common, combined, json or off)
+func (s *Server) SetAccessLogFormat(format middleware.AccessLogFormat) {
+	s.accessLog = format
+}
+
+// SetMetricsEnabled configures whether the Prometheus /metrics endpoint is served
+func (s *Server) SetMetricsEnabled(enabled bool) {
+	s.enableMetrics = enabled
+}
+
+// SetAdminToken enables the /_redi/admin API, authenticated with the given
+// bearer token. An empty token disables the API.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// SetPrebuildOnStart pre-compiles all Svelte components in the background
+// once the server is listening; /readyz reports ready when it has finished
+func (s *Server) SetPrebuildOnStart(enabled bool, parallelWorkers int) {
+	s.prebuildOnStart = enabled
+	s.prebuildWorkers = parallelWorkers
+}
+
+// SetPrebuildReport writes a JSON report of each pre-build, with the
+// timings, sizes and errors of every component, to path
+func (s *Server) SetPrebuildReport(path string) {
+	s.prebuildReport = path
+}
+
+// SetTemplateConfig sets the template settings, such as Vimesh Style options
+func (s *Server) SetTemplateConfig(config *rediHandlers.TemplateConfig) {
+	s.templateConfig = config
+}
+
+// SetSvelteConfig sets the Svelte settings, such as minification, async
+// loading and cache durations
+func (s *Server) SetSvelteConfig(config *rediHandlers.SvelteConfig) {
+	s.svelteConfig = config
+}
+
+// SetCompressConfig sets the response compression settings: encodings,
+// minimum size, compressible content types and the compressed cache size.
+// The gzip level set with SetGzipLevel still applies.
+func (s *Server) SetCompressConfig(config *middleware.CompressConfig) {
+	s.compressConfig = config
+}
+
+// SetSecurityConfig sets CORS policies, security headers, the CSP and CSRF
+// protection. It must be called before Start.
+func (s *Server) SetSecurityConfig(config *middleware.SecurityConfig) {
+	s.securityConfig = config
+}
+
+// SetRateLimitConfig sets the global and per-route rate limits and request
+// body size limits. It must be called before Start.
+func (s *Server) SetRateLimitConfig(config *middleware.RateLimitConfig) {
+	s.rateLimitConfig = config
+}
+
+// SetResponseCacheConfig sets the size of the rendered response cache and
+// the routes it caches. It must be called before Start.
+func (s *Server) SetResponseCacheConfig(config *middleware.ResponseCacheConfig) {
+	s.responseCacheConfig = config
+}
+
+// SetCacheConfig sets the compilation cache size limit, TTL, compression
+// and janitor interval. RootDir and Enabled are set by the server.
+func (s *Server) SetCacheConfig(config *cache.CacheConfig) {
+	s.cacheConfig = config
+}
+
+// SetCacheBackend sets where the compilation cache is stored. By default it
+// is stored in .redi under the root directory, or for an embedded
+// filesystem read from its .redi directory when it was prebuilt and kept in
+// memory otherwise.
+func (s *Server) SetCacheBackend(backend cache.CacheBackend) {
+	s.cacheBackend = backend
+}
+
+// SetProxyRules sets reverse proxy rules in addition to the _proxy.json
+// files in the routes directory
+func (s *Server) SetProxyRules(rules []ProxyRule) {
+	s.proxyRules = rules
+}
+
+// SetStaticConfig sets how files in public/ are served: index files,
+// directory listing, Cache-Control rules and precompressed variants
+func (s *Server) SetStaticConfig(config *StaticConfig) {
+	s.staticConfig = config
+}
+
+// initializeCache initializes the cache system if enabled. A manager that
+// is already running is kept, so its janitor isn't left behind; reloads
+// clear it first to start a new one.
 func (s *Server) initializeCache() error {
 	if !s.enableCache {
 		logging.Info("Cache is disabled")
 		return nil
 	}
+	if s.cacheManager != nil {
+		return nil
+	}
 
 	logging.Info("Initializing cache system")
 	
@@ -104,11 +266,20 @@ func (s *Server) initializeCache() error {
 
 	// Create cache configuration
 	cacheConfig := &cache.CacheConfig{
-		RootDir:       rootDir,
-		Enabled:       true,
-		MaxSize:       500 * 1024 * 1024, // 500MB default
-		TTL:           0,                  // No expiration by default
-		CompressCache: false,
+		MaxSize:         cache.DefaultMaxSize,
+		TTL:             0, // No expiration by default
+		CompressCache:   false,
+		JanitorInterval: cache.DefaultJanitorInterval,
+	}
+	if s.cacheConfig != nil {
+		*cacheConfig = *s.cacheConfig
+	}
+	cacheConfig.RootDir = rootDir
+	cacheConfig.Enabled = true
+	if s.cacheBackend != nil {
+		cacheConfig.Backend = s.cacheBackend
+	} else if cacheConfig.Backend == nil && s.fs.IsReadOnly() {
+		cacheConfig.Backend = s.readOnlyCacheBackend()
 	}
 
 	// Initialize cache manager
@@ -122,36 +293,145 @@ func (s *Server) initializeCache() error {
 	// Create Svelte cache
 	s.svelteCache = cache.NewSvelteCache(s.cacheManager, s.fs)
 
-	logging.Info("Cache system initialized", "location", rootDir+"/.redi")
+	if s.cacheManager.ReadOnly() {
+		logging.Info("Cache system initialized", "location", "embedded", "entries", s.cacheManager.GetStats().TotalEntries)
+	} else if _, ok := cacheConfig.Backend.(*cache.MemoryBackend); ok {
+		logging.Info("Cache system initialized", "location", "memory")
+	} else {
+		logging.Info("Cache system initialized", "location", rootDir+"/.redi")
+	}
 	return nil
 }
 
+// readOnlyCacheBackend returns the backend for a site served from a
+// read-only filesystem: the .redi directory built into it by
+// redi-build --prebuild, or memory when there is none
+func (s *Server) readOnlyCacheBackend() cache.CacheBackend {
+	if stat, err := s.fs.Stat(".redi/cache"); err == nil && stat.IsDir() {
+		if sub, err := fs.Sub(s.fs.GetFS(), ".redi"); err == nil {
+			return cache.NewEmbeddedBackend(sub)
+		}
+	}
+	return cache.NewMemoryBackend()
+}
+
 func (s *Server) Start() error {
 	if err := s.setupRoutes(); err != nil {
 		return fmt.Errorf("failed to setup routes: %w", err)
 	}
+	if err := s.startSites(); err != nil {
+		return err
+	}
 
-	// Apply middleware
-	handler := http.Handler(s.router)
-	
-	// Apply gzip compression if enabled
-	if s.enableGzip {
-		if s.gzipLevel == gzip.DefaultCompression {
-			handler = handlers.CompressHandler(handler)
-		} else {
-			handler = handlers.CompressHandlerLevel(handler, s.gzipLevel)
-		}
-		logging.Info("Gzip compression enabled", "level", s.gzipLevel)
+	// Requests go through the active state of their site so Reload can
+	// swap it
+	s.publish()
+	s.buildChain()
+	s.startTime = time.Now()
+
+	if s.prebuildOnStart {
+		go s.backgroundPreBuild()
+	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
 	}
 
 	addr := fmt.Sprintf(":%d", s.port)
 	s.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: handler,
+		Addr:      addr,
+		Handler:   http.HandlerFunc(s.serveChain),
+		TLSConfig: tlsConfig,
 	}
 	
-	logging.Info("Server listening", "address", addr)
-	return s.httpServer.ListenAndServe()
+	// The listener may be inherited from the process being restarted
+	s.listener, err = listen(addr)
+	if err != nil {
+		return err
+	}
+	
+	if tlsConfig == nil {
+		logging.Info("Server listening", "address", addr)
+		notifyReady()
+		return s.httpServer.Serve(s.listener)
+	}
+
+	if s.httpRedirectPort > 0 {
+		if err := s.startHTTPRedirect(); err != nil {
+			s.listener.Close()
+			return err
+		}
+	}
+	logging.Info("Server listening", "address", addr, "tls", true, "certificates", len(tlsConfig.Certificates))
+	notifyReady()
+	// HTTP/2 is negotiated automatically over TLS
+	return s.httpServer.ServeTLS(s.listener, "", "")
+}
+
+// buildChain sets up the middleware chain with the current settings
+func (s *Server) buildChain() {
+	handler := s.applyMiddleware(http.HandlerFunc(s.serveSite))
+	s.chain.Store(&handler)
+}
+
+// serveChain passes a request to the middleware chain
+func (s *Server) serveChain(w http.ResponseWriter, r *http.Request) {
+	(*s.chain.Load()).ServeHTTP(w, r)
+}
+
+// applyMiddleware wraps the router with the middleware chain. Request IDs are
+// assigned first so the access log and all handlers can see them.
+func (s *Server) applyMiddleware(router http.Handler) http.Handler {
+	handler := router
+
+	// Cached responses are stored as rendered, and still get security
+	// headers, limits and compression on the way out
+	responseCacheConfig := middleware.DefaultResponseCacheConfig()
+	if s.responseCacheConfig != nil {
+		responseCacheConfig = *s.responseCacheConfig
+	}
+	responseCache := middleware.NewResponseCache(responseCacheConfig)
+	s.responseCache.Store(responseCache)
+	handler = responseCache.Middleware(handler)
+	if len(responseCacheConfig.Routes) > 0 {
+		logging.Info("Response cache enabled", "routes", len(responseCacheConfig.Routes), "maxSize", responseCacheConfig.MaxSize)
+	}
+
+	// Security runs inside compression so CORS preflights and CSRF
+	// rejections are small, and before the router so OPTIONS reaches it
+	if s.securityConfig.Enabled() {
+		handler = middleware.Security(*s.securityConfig)(handler)
+		logging.Info("Security middleware enabled", "cors", len(s.securityConfig.CORS), "csp", s.securityConfig.CSP != "", "csrf", s.securityConfig.CSRF != nil)
+	}
+
+	// Limits run before security checks so rejected floods stay cheap
+	if s.rateLimitConfig.Enabled() {
+		handler = middleware.RateLimit(*s.rateLimitConfig)(handler)
+		logging.Info("Rate limiting enabled", "rate", s.rateLimitConfig.Rate.String(), "routes", len(s.rateLimitConfig.Routes), "maxBodySize", s.rateLimitConfig.MaxBodySize)
+	}
+	
+	// Apply compression if enabled
+	if s.enableGzip {
+		config := middleware.DefaultCompressConfig()
+		if s.compressConfig != nil {
+			config = *s.compressConfig
+		}
+		config.GzipLevel = s.gzipLevel
+		handler = middleware.Compress(config)(handler)
+		logging.Info("Compression enabled", "encodings", strings.Join(config.Encodings, ","), "gzipLevel", s.gzipLevel, "minSize", config.MinSize)
+	}
+
+	if s.httpMetrics != nil {
+		handler = s.httpMetrics.Middleware(handler)
+	}
+
+	if s.accessLog != "" && s.accessLog != middleware.AccessLogOff {
+		handler = middleware.AccessLog(s.accessLog)(handler)
+		logging.Info("Access log enabled", "format", string(s.accessLog))
+	}
+
+	return middleware.RequestID(handler)
 }
 
 func (s *Server) setupRoutes() error {
@@ -162,7 +442,9 @@ func (s *Server) setupRoutes() error {
 	}
 
 	routeScanner := NewRouteScanner(s.fs, s.routesDir)
-	s.handlerManager = NewHandlerManagerWithServer(s.fs, s.version, s.router, s.routesDir)
+	s.handlerManager = NewHandlerManagerWithConfig(s.fs, s.version, s.router, s.routesDir, s.templateConfig, s.svelteConfig)
+	s.handlerManager.SetDevMode(s.devMode)
+	s.handlerManager.SetRateLimitConfig(s.rateLimitConfig)
 
 	// Set persistent cache on Svelte handler if available
 	if s.svelteCache != nil && s.handlerManager.svelteHandler != nil {
@@ -170,17 +452,54 @@ func (s *Server) setupRoutes() error {
 	}
 
 	// Set custom 404 handler using the error handler
+	handlerManager := s.handlerManager
 	s.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		s.handlerManager.errorHandler.Handle404(w, r)
+		handlerManager.errorHandler.Handle404(w, r)
 	})
 
+	s.setupHealthChecks()
+	if s.adminToken != "" {
+		s.setupAdmin()
+	}
+	if s.enableMetrics {
+		s.setupMetrics()
+	}
+	s.setupProxies()
+
 	routes, err := routeScanner.ScanRoutes()
 	if err != nil {
 		return fmt.Errorf("failed to scan routes: %w", err)
 	}
+	s.routes = routes
 
+	// Compile the JavaScript routes in the background, so that the first
+	// request to each only runs it
+	var scripts []string
 	for _, route := range routes {
-		handler := s.handlerManager.GetHandler(route)
+		if route.FileType == "js" {
+			scripts = append(scripts, route.FilePath)
+		}
+	}
+	go rediHandlers.WarmRoutePrograms(s.fs, scripts)
+
+	// Mount every route under each locale prefix first, so that dynamic
+	// top-level routes such as /{slug} don't swallow /de
+	translator := i18n.ForFileSystem(s.fs)
+	if s.defaultLocale != "" {
+		translator.SetDefaultLocale(s.defaultLocale)
+	}
+	if translator.Enabled() {
+		for _, route := range routes {
+			s.registerLocalizedRoute(route, translator)
+		}
+		logging.Info("Internationalization enabled", "locales", strings.Join(translator.Locales(), ","), "default", translator.DefaultLocale())
+	}
+
+	for _, route := range routes {
+		handler := withRouteInfo(route.FileType, s.handlerManager.GetHandler(route))
+		if translator.Enabled() {
+			handler = withLocale(translator, "", handler)
+		}
 		s.router.HandleFunc(route.Path, handler).Methods("GET", "POST", "PUT", "DELETE", "HEAD")
 		logging.Debug("Registered route", "path", route.Path, "file", route.FilePath, "type", route.FileType)
 		
@@ -198,64 +517,150 @@ func (s *Server) setupRoutes() error {
 	componentHandler := NewComponentRequestHandler([]rediHandlers.ComponentHandler{
 		s.handlerManager.svelteHandler,
 	})
-	s.router.MatcherFunc(componentHandler.Match).HandlerFunc(componentHandler.ServeHTTP).Methods("GET", "HEAD")
+	// Matched by a function, so every component shares one route pattern
+	s.router.MatcherFunc(componentHandler.Match).HandlerFunc(withRoutePattern("/{component}", "component", componentHandler.ServeHTTP)).Methods("GET", "HEAD")
 
 	// Setup static file server last - catches remaining requests
 	s.setupStaticFileServer()
 
+	s.routesReady.Store(true)
 	return nil
 }
 
+// registerLocalizedRoute registers a route under every configured locale
+// prefix, e.g. /about becomes /de/about and /fr/about
+func (s *Server) registerLocalizedRoute(route Route, translator *i18n.Translator) {
+	handler := withRouteInfo(route.FileType, s.handlerManager.GetHandler(route))
 
-func (s *Server) setupStaticFileServer() {
-	publicFS, err := s.fs.Sub("public")
-	if err != nil {
-		log.Printf("Warning: No public directory found in filesystem")
-		return
+	for _, locale := range translator.Locales() {
+		prefix := "/" + locale
+		localizedHandler := withLocale(translator, locale, handler)
+
+		if route.Path == "/" {
+			s.router.HandleFunc(prefix, localizedHandler).Methods("GET", "POST", "PUT", "DELETE", "HEAD")
+			s.router.HandleFunc(prefix+"/", localizedHandler).Methods("GET", "POST", "PUT", "DELETE", "HEAD")
+			continue
+		}
+
+		s.router.HandleFunc(prefix+route.Path, localizedHandler).Methods("GET", "POST", "PUT", "DELETE", "HEAD")
+		if route.IsIndex {
+			s.router.HandleFunc(prefix+route.Path+"/", localizedHandler).Methods("GET", "POST", "PUT", "DELETE", "HEAD")
+		}
+		logging.Debug("Registered localized route", "path", prefix+route.Path, "file", route.FilePath, "locale", locale)
 	}
-	
-	// Custom handler that checks file existence before serving
-	staticHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Don't handle component paths (containing /_)
-		if strings.Contains(r.URL.Path, "/_") {
-			s.handlerManager.errorHandler.Handle404(w, r)
-			return
+}
+
+// withLocale stores the request locale in the request context. An empty
+// locale means the route has no prefix and the locale is detected from the
+// cookie or Accept-Language header, which the response then varies on.
+func withLocale(translator *i18n.Translator, locale string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestLocale := locale
+		if requestLocale == "" {
+			requestLocale = translator.Detect(r)
+			w.Header().Add("Vary", "Cookie")
+			w.Header().Add("Vary", "Accept-Language")
 		}
-		
-		// Clean the path and check if file exists
-		cleanPath := strings.TrimPrefix(r.URL.Path, "/")
-		if cleanPath == "" {
-			cleanPath = "index.html"
+		w.Header().Set("Content-Language", requestLocale)
+		next(w, r.WithContext(i18n.WithLocale(r.Context(), requestLocale)))
+	}
+}
+
+// setupMetrics registers the server's collectors and the /metrics endpoint
+func (s *Server) setupMetrics() {
+	// Collectors are registered once; a reload only re-mounts the endpoint
+	if s.metrics == nil {
+		s.registerMetrics()
+	}
+
+	s.router.Handle("/metrics", withRouteInfo("metrics", metrics.Handler(s.metrics, metrics.Default).ServeHTTP)).Methods("GET", "HEAD")
+	logging.Info("Metrics endpoint enabled", "path", "/metrics")
+}
+
+// registerMetrics creates the server's registry and collectors
+func (s *Server) registerMetrics() {
+	s.metrics = metrics.NewRegistry()
+	s.httpMetrics = metrics.NewHTTPMetrics(s.metrics)
+
+	// The pool is looked up at scrape time, as a shutdown replaces it
+	poolStats := func() rediHandlers.PoolStats {
+		return rediHandlers.GetJSEnginePool(s.fs, s.version).Stats()
+	}
+	poolStat := func(value func(rediHandlers.PoolStats) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			return []metrics.Sample{{Value: value(poolStats())}}
 		}
-		
-		// Check if file exists in public directory
-		file, err := publicFS.GetFS().Open(cleanPath)
-		if err != nil {
-			// File not found, use our custom 404 handler
-			s.handlerManager.errorHandler.Handle404(w, r)
-			return
+	}
+	s.metrics.Register(
+		metrics.NewGaugeFunc("redi_js_pool_size", "Configured number of pooled JavaScript engines.",
+			poolStat(func(stats rediHandlers.PoolStats) float64 { return float64(stats.Size) })),
+		metrics.NewGaugeFunc("redi_js_pool_engines", "JavaScript engines by state.", func() []metrics.Sample {
+			stats := poolStats()
+			return []metrics.Sample{
+				{LabelValues: []string{"available"}, Value: float64(stats.Available)},
+				{LabelValues: []string{"in_use"}, Value: float64(stats.InUse)},
+				{LabelValues: []string{"session_bound"}, Value: float64(stats.SessionBound)},
+			}
+		}, "state"),
+		metrics.NewCounterFunc("redi_js_pool_temporary_engines_total", "JavaScript engines created because the pool was empty.",
+			poolStat(func(stats rediHandlers.PoolStats) float64 { return float64(stats.TemporaryCreated) })),
+	)
+
+	if s.svelteCache != nil {
+		// Reloads replace the cache, so the active one is read at scrape time
+		cacheStats := func() map[string]interface{} {
+			if svelteCache := s.current().svelteCache; svelteCache != nil {
+				return svelteCache.GetStats()
+			}
+			return nil
 		}
-		file.Close()
-		
-		// File exists, serve it using the file server
-		fileServer := http.FileServer(http.FS(publicFS.GetFS()))
-		http.StripPrefix("/", fileServer).ServeHTTP(w, r)
-	})
-	
-	s.router.PathPrefix("/").Handler(staticHandler)
-	logging.Debug("Static file server enabled", "directory", "public")
+		cacheStat := func(key string) func() []metrics.Sample {
+			return func() []metrics.Sample {
+				value, _ := cacheStats()[key].(int64)
+				return []metrics.Sample{{Value: float64(value)}}
+			}
+		}
+		s.metrics.Register(
+			metrics.NewCounterFunc("redi_svelte_cache_hits_total", "Persistent Svelte cache hits.", cacheStat("hits")),
+			metrics.NewCounterFunc("redi_svelte_cache_misses_total", "Persistent Svelte cache misses.", cacheStat("misses")),
+			metrics.NewGaugeFunc("redi_svelte_cache_hit_ratio", "Persistent Svelte cache hit ratio (0-1).", func() []metrics.Sample {
+				hitRate, _ := cacheStats()["hitRate"].(float64)
+				return []metrics.Sample{{Value: hitRate / 100}}
+			}),
+		)
+	}
+}
+
+// withRouteInfo records the matched route pattern and handler type for the
+// access log
+func withRouteInfo(handlerType string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pattern := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				pattern = template
+			}
+		}
+		middleware.SetRoute(r, pattern, handlerType)
+		next(w, r)
+	}
+}
+
+// withRoutePattern records a fixed route pattern, for routes without a path
+// template whose URLs would otherwise each be a pattern of their own
+func withRoutePattern(pattern, handlerType string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetRoute(r, pattern, handlerType)
+		next(w, r)
+	}
 }
 
 // Stop gracefully shuts down the server
 func (s *Server) Stop() error {
-	if s.httpServer == nil {
-		return nil
-	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 	
-	return s.httpServer.Shutdown(ctx)
+	return s.Shutdown(ctx)
 }
 
 // PreBuild pre-compiles all Svelte components
@@ -265,11 +670,10 @@ func (s *Server) PreBuild(parallelWorkers int) error {
 		return fmt.Errorf("cache must be enabled for pre-building (use --cache flag)")
 	}
 	
-	// Initialize cache if not already done
-	if s.cacheManager == nil {
-		if err := s.initializeCache(); err != nil {
-			return fmt.Errorf("failed to initialize cache: %w", err)
-		}
+	// Initialize cache here so a failure stops the pre-build; setupRoutes
+	// keeps the manager
+	if err := s.initializeCache(); err != nil {
+		return fmt.Errorf("failed to initialize cache: %w", err)
 	}
 	
 	// Setup handlers to get the SvelteHandler
@@ -277,14 +681,58 @@ func (s *Server) PreBuild(parallelWorkers int) error {
 		return fmt.Errorf("failed to setup routes: %w", err)
 	}
 	
+	if err := s.runPreBuilder(s.handlerManager, parallelWorkers); err != nil {
+		return err
+	}
+	// Save the index snapshot along with the compiled components
+	if s.cacheManager != nil {
+		return s.cacheManager.Close()
+	}
+	return nil
+}
+
+// backgroundPreBuild runs the pre-builder while the server is already
+// serving requests and marks the server ready when it is done
+func (s *Server) backgroundPreBuild() {
+	defer s.prebuildDone.Store(true)
+
+	// Keep the cache open until the pre-build is done, even if a reload
+	// replaces it meanwhile
+	state := s.acquire()
+	defer state.release()
+	if state.svelteCache == nil {
+		logging.Warn("Skipping pre-build: cache must be enabled for pre-building")
+		return
+	}
+
+	logging.Info("Starting background pre-build", "workers", s.prebuildWorkers)
+	if err := s.runPreBuilder(state.handlerManager, s.prebuildWorkers); err != nil {
+		logging.Error("Pre-build failed", "error", err)
+		s.prebuildErr.Store(err.Error())
+		return
+	}
+	logging.Info("Background pre-build finished")
+}
+
+// runPreBuilder pre-compiles all Svelte components with the routes already
+// set up; its progress is reported by the admin API
+func (s *Server) runPreBuilder(handlerManager *HandlerManager, parallelWorkers int) error {
 	// Get the SvelteHandler from the handler manager
-	svelteHandler := s.handlerManager.GetSvelteHandler()
+	svelteHandler := handlerManager.GetSvelteHandler()
 	if svelteHandler == nil {
 		return fmt.Errorf("Svelte handler not initialized")
 	}
 	
-	// Create and run the pre-builder
-	preBuilder := NewServerPreBuilder(s.fs, svelteHandler, s.routesDir, parallelWorkers)
-	return preBuilder.Build()
+	precompiler := rediHandlers.NewSveltePrecompiler(svelteHandler, parallelWorkers)
+	s.precompiler.Store(precompiler)
+	_, err := precompiler.Run()
+	if s.prebuildReport != "" {
+		if writeErr := precompiler.WriteReport(s.prebuildReport); writeErr != nil {
+			logging.Warn("Failed to write pre-build report", "path", s.prebuildReport, "error", writeErr)
+		} else {
+			logging.Info("Wrote pre-build report", "path", s.prebuildReport)
+		}
+	}
+	return err
 }
 
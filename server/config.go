@@ -1,10 +1,17 @@
 package server
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
+	"strings"
+	"time"
 	
+	"github.com/rediwo/redi"
+	"github.com/rediwo/redi/cache"
+	"github.com/rediwo/redi/handlers"
 	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
 )
 
 // Config represents server configuration
@@ -24,14 +31,62 @@ type Config struct {
 	EnableCache bool // Enable compilation cache (default: false)
 	
 	// Prebuild settings
-	Prebuild         bool // Pre-compile all Svelte components before starting
-	PrebuildParallel int  // Number of parallel workers for pre-building
-	OnlyPrebuild     bool // Only run prebuild without starting server
+	Prebuild         bool   // Pre-compile all Svelte components before starting
+	PrebuildParallel int    // Number of parallel workers for pre-building
+	OnlyPrebuild     bool   // Only run prebuild without starting server
+	PrebuildReport   string // Write a JSON report of the pre-build to this file
+	
+	// Internationalization settings
+	DefaultLocale string // Fallback locale for locales/ catalogs (default: "en" if present)
+	
+	// Development settings
+	DevMode bool // Show stack traces and source excerpts on error pages
+	
+	// Access log settings
+	AccessLog string // Access log format: common, combined, json or off (default: off)
+	
+	// Metrics settings
+	EnableMetrics bool // Serve Prometheus metrics at /metrics (default: false)
+	
+	// Admin API settings
+	AdminToken string // Bearer token for the /_redi/admin API (empty disables it)
+	
+	// TLS settings
+	TLSCert          string // Certificate file(s), comma-separated for SNI with several certificates
+	TLSKey           string // Key file(s) matching TLSCert
+	DevTLS           bool   // Serve HTTPS with a cached self-signed certificate for localhost
+	HTTPRedirectPort int    // Plain HTTP port redirecting to HTTPS (0 disables)
+	
+	// Shutdown settings
+	ShutdownTimeout time.Duration // How long to drain in-flight requests on shutdown (default: 10s)
 	
 	// Logging settings
 	LogLevel    string // Log level (debug, info, warn, error)
 	LogFormat   string // Log format (text, json)
 	LogQuiet    bool   // Quiet mode (only ERROR and FATAL)
+	
+	// Log rotation settings for the --log file of a background server
+	LogMaxSize    int64         // Rotate when the log exceeds this many bytes (0 disables)
+	LogMaxAge     time.Duration // Rotate when the log has been written to for this long (0 disables)
+	LogMaxBackups int           // Number of rotated logs to keep (0 keeps all)
+	
+	// Project config settings
+	ConfigFile     string          // Project config file (default: redi.yaml, redi.yml or redi.json in Root)
+	Environment    string          // Section of the project config to apply (default: $REDI_ENV, else development with DevMode, else production)
+	ExplicitFlags  map[string]bool // Flags given on the command line; they take precedence over the project config
+	SvelteConfig   *handlers.SvelteConfig   // Svelte handler settings (nil uses the defaults)
+	TemplateConfig *handlers.TemplateConfig // Template handler settings (nil uses the defaults)
+	StaticConfig   *redi.StaticConfig       // Static file settings for public/ (nil uses the defaults)
+	CompressConfig *middleware.CompressConfig // Response compression settings (nil uses the defaults)
+	SecurityConfig *middleware.SecurityConfig // CORS, security headers, CSP and CSRF (nil disables them)
+	RateLimitConfig *middleware.RateLimitConfig // Rate and request body size limits (nil disables them)
+	ResponseCacheConfig *middleware.ResponseCacheConfig // Rendered response cache size and cached routes (nil uses the defaults)
+	CacheConfig    *cache.CacheConfig       // Compilation cache size limit, TTL, compression and janitor (nil uses the defaults)
+	CacheBackend   cache.CacheBackend       // Where the compilation cache is stored (nil uses .redi under Root)
+	ProxyRules     []redi.ProxyRule         // Reverse proxy rules, in addition to routes/**/_proxy.json
+	VirtualHosts   []redi.VirtualHost       // Other sites served from this process, chosen by Host header
+	
+	loadedConfigFile string
 }
 
 // NewConfig creates a new server configuration
@@ -45,6 +100,7 @@ func NewConfig() *Config {
 		EnableCache:      false,
 		Prebuild:         false,
 		PrebuildParallel: 4,
+		ShutdownTimeout:  redi.DefaultShutdownTimeout,
 		LogLevel:         "info",
 		LogFormat:        "text",
 		LogQuiet:         false,
@@ -69,9 +125,30 @@ func (c *Config) Validate() error {
 		return ConfigError{Message: "gzip level must be between -1 and 9"}
 	}
 	
+	if _, err := middleware.ParseAccessLogFormat(c.AccessLog); err != nil {
+		return ConfigError{Message: "invalid access log format", Err: err}
+	}
+	
+	if err := validateTLS(c.TLSCert, c.TLSKey, c.DevTLS, c.HTTPRedirectPort, c.Port); err != nil {
+		return err
+	}
+	
+	if c.LogMaxSize < 0 || c.LogMaxAge < 0 || c.LogMaxBackups < 0 {
+		return ConfigError{Message: "log rotation limits must not be negative"}
+	}
+	
 	return nil
 }
 
+// LogRotateConfig returns the rotation settings for the log file
+func (c *Config) LogRotateConfig() logging.RotateConfig {
+	return logging.RotateConfig{
+		MaxSize:    c.LogMaxSize,
+		MaxAge:     c.LogMaxAge,
+		MaxBackups: c.LogMaxBackups,
+	}
+}
+
 // CreateLoggingConfig creates a logging configuration from server config
 func (c *Config) CreateLoggingConfig() *logging.Config {
 	logConfig := logging.DefaultConfig()
@@ -101,6 +178,48 @@ type EmbedConfig struct {
 	
 	// Cache settings
 	EnableCache bool // Enable compilation cache (default: false)
+	
+	// Internationalization settings
+	DefaultLocale string // Fallback locale for locales/ catalogs (default: "en" if present)
+	
+	// Development settings
+	DevMode bool // Show stack traces and source excerpts on error pages
+	
+	// Access log settings
+	AccessLog string // Access log format: common, combined, json or off (default: off)
+	
+	// Metrics settings
+	EnableMetrics bool // Serve Prometheus metrics at /metrics (default: false)
+	
+	// Admin API settings
+	AdminToken string // Bearer token for the /_redi/admin API (empty disables it)
+	
+	// TLS settings
+	TLSCert          string // Certificate file(s), comma-separated for SNI with several certificates
+	TLSKey           string // Key file(s) matching TLSCert
+	DevTLS           bool   // Serve HTTPS with a cached self-signed certificate for localhost
+	HTTPRedirectPort int    // Plain HTTP port redirecting to HTTPS (0 disables)
+	
+	// Shutdown settings
+	ShutdownTimeout time.Duration // How long to drain in-flight requests on shutdown (default: 10s)
+	
+	// Static file settings for public/ (nil uses the defaults)
+	StaticConfig *redi.StaticConfig
+	
+	// Response compression settings (nil uses the defaults)
+	CompressConfig *middleware.CompressConfig
+	
+	// CORS, security headers, CSP and CSRF (nil disables them)
+	SecurityConfig *middleware.SecurityConfig
+	
+	// Rate and request body size limits (nil disables them)
+	RateLimitConfig *middleware.RateLimitConfig
+	
+	// Rendered response cache size and cached routes (nil uses the defaults)
+	ResponseCacheConfig *middleware.ResponseCacheConfig
+	
+	// Reverse proxy rules, in addition to routes/**/_proxy.json
+	ProxyRules []redi.ProxyRule
 }
 
 // NewEmbedConfig creates a new embedded server configuration
@@ -113,6 +232,7 @@ func NewEmbedConfig(embedFS fs.FS) *EmbedConfig {
 		EnableGzip:  true,
 		GzipLevel:   -1, // Use gzip.DefaultCompression
 		EnableCache: false,
+		ShutdownTimeout: redi.DefaultShutdownTimeout,
 	}
 }
 
@@ -130,9 +250,63 @@ func (c *EmbedConfig) Validate() error {
 		return ConfigError{Message: "gzip level must be between -1 and 9"}
 	}
 	
+	if _, err := middleware.ParseAccessLogFormat(c.AccessLog); err != nil {
+		return ConfigError{Message: "invalid access log format", Err: err}
+	}
+	
+	if err := validateTLS(c.TLSCert, c.TLSKey, c.DevTLS, c.HTTPRedirectPort, c.Port); err != nil {
+		return err
+	}
+	
+	return nil
+}
+
+// TLSPairs splits comma-separated certificate and key lists into pairs
+func TLSPairs(certList, keyList string) [][2]string {
+	var pairs [][2]string
+	certFiles := splitList(certList)
+	keyFiles := splitList(keyList)
+	for i := 0; i < len(certFiles) && i < len(keyFiles); i++ {
+		pairs = append(pairs, [2]string{certFiles[i], keyFiles[i]})
+	}
+	return pairs
+}
+
+// validateTLS checks that certificates and keys come in existing pairs
+func validateTLS(certList, keyList string, devTLS bool, redirectPort, port int) error {
+	certFiles := splitList(certList)
+	keyFiles := splitList(keyList)
+	if len(certFiles) != len(keyFiles) {
+		return ConfigError{Message: fmt.Sprintf("got %d TLS certificates but %d keys", len(certFiles), len(keyFiles))}
+	}
+	for _, file := range append(certFiles, keyFiles...) {
+		if _, err := os.Stat(file); err != nil {
+			return ConfigError{Message: "TLS file not found: " + file, Err: err}
+		}
+	}
+	
+	if redirectPort != 0 {
+		if len(certFiles) == 0 && !devTLS {
+			return ConfigError{Message: "HTTP redirect port requires TLS (--tls-cert or --dev-tls)"}
+		}
+		if redirectPort < 0 || redirectPort > 65535 || redirectPort == port {
+			return ConfigError{Message: "HTTP redirect port must be between 1 and 65535 and differ from the server port"}
+		}
+	}
 	return nil
 }
 
+// splitList splits a comma-separated list, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // ConfigError represents a configuration error
 type ConfigError struct {
 	Message string
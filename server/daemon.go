@@ -0,0 +1,339 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotRunning is returned when no redi daemon is running for a log file
+var ErrNotRunning = errors.New("server is not running")
+
+// DaemonStatus describes a background server, as recorded in its status file
+// next to the PID file
+type DaemonStatus struct {
+	PID        int       `json:"pid"`
+	Port       int       `json:"port"`
+	Root       string    `json:"root"`
+	Version    string    `json:"version"`
+	TLS        bool      `json:"tls"`
+	Executable string    `json:"executable"`
+	StartTime  time.Time `json:"startTime"`
+	LogFile    string    `json:"-"`
+	// Stale is set when the PID file pointed at a process that is gone or
+	// isn't redi; the PID and status files have been removed
+	Stale bool `json:"-"`
+}
+
+// Uptime returns how long the daemon has been running
+func (s *DaemonStatus) Uptime() time.Duration {
+	if s.StartTime.IsZero() {
+		return 0
+	}
+	return time.Since(s.StartTime).Round(time.Second)
+}
+
+// URL returns the address the daemon serves on
+func (s *DaemonStatus) URL() string {
+	scheme := "http"
+	if s.TLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, s.Port)
+}
+
+// PIDFile returns the PID file of a daemon logging to logFile
+func PIDFile(logFile string) string {
+	return logFile + ".pid"
+}
+
+// statusFile returns the status file of a daemon logging to logFile
+func statusFile(logFile string) string {
+	return logFile + ".status"
+}
+
+// newDaemonStatus describes the current process
+func newDaemonStatus(config *Config) *DaemonStatus {
+	executable, _ := os.Executable()
+	return &DaemonStatus{
+		PID:        os.Getpid(),
+		Port:       config.Port,
+		Root:       config.Root,
+		Version:    config.Version,
+		TLS:        config.TLSCert != "" || config.DevTLS,
+		Executable: filepath.Base(executable),
+		StartTime:  time.Now(),
+		LogFile:    config.LogFile,
+	}
+}
+
+// writeDaemonFiles atomically writes the PID and status files
+func writeDaemonFiles(status *DaemonStatus) error {
+	if err := writeFileAtomic(PIDFile(status.LogFile), []byte(strconv.Itoa(status.PID))); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(statusFile(status.LogFile), data)
+}
+
+// removeDaemonFiles removes the PID and status files if they still belong to
+// the current process; after a restart they belong to the new process
+func removeDaemonFiles(logFile string) {
+	data, err := os.ReadFile(PIDFile(logFile))
+	if err != nil {
+		return
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil || pid != os.Getpid() {
+		return
+	}
+	os.Remove(PIDFile(logFile))
+	os.Remove(statusFile(logFile))
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
+// ReadDaemonStatus returns the status of the daemon logging to logFile. A PID
+// file left behind by a crashed daemon, or pointing at a process that isn't
+// redi, is removed and ErrNotRunning is returned with Stale set.
+func ReadDaemonStatus(logFile string) (*DaemonStatus, error) {
+	data, err := os.ReadFile(PIDFile(logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &DaemonStatus{LogFile: logFile}, ErrNotRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &DaemonStatus{LogFile: logFile}
+	// The status file is optional: daemons of older versions only write a PID
+	if data, err := os.ReadFile(statusFile(logFile)); err == nil {
+		json.Unmarshal(data, status)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return removeStale(status)
+	}
+	if status.PID != pid {
+		// The status file belongs to another process
+		status = &DaemonStatus{LogFile: logFile}
+	}
+	status.PID = pid
+
+	if !processAlive(pid) || !isRediProcess(pid, status.Executable) {
+		return removeStale(status)
+	}
+	return status, nil
+}
+
+// removeStale removes PID and status files that don't point at a running daemon
+func removeStale(status *DaemonStatus) (*DaemonStatus, error) {
+	os.Remove(PIDFile(status.LogFile))
+	os.Remove(statusFile(status.LogFile))
+	status.Stale = true
+	return status, ErrNotRunning
+}
+
+// isRediProcess reports whether pid runs the given executable, or a redi
+// binary if the executable is unknown, guarding against recycled PIDs
+func isRediProcess(pid int, executable string) bool {
+	name, err := processName(pid)
+	if err != nil {
+		return false
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	if executable != "" {
+		return name == strings.TrimSuffix(strings.ToLower(executable), ".exe")
+	}
+	return strings.HasPrefix(name, "redi")
+}
+
+// StopDaemon asks the daemon logging to logFile to shut down gracefully and
+// waits for it to exit. If it is still running after timeout it is killed.
+func StopDaemon(logFile string, timeout time.Duration) (*DaemonStatus, error) {
+	status, err := ReadDaemonStatus(logFile)
+	if err != nil {
+		return status, err
+	}
+
+	if err := terminateProcess(status.PID); err != nil {
+		return status, fmt.Errorf("failed to signal process %d: %w", status.PID, err)
+	}
+	if waitFor(timeout, func() bool { return !processAlive(status.PID) }) {
+		removeStale(status)
+		status.Stale = false
+		return status, nil
+	}
+
+	killProcess(status.PID)
+	removeStale(status)
+	status.Stale = false
+	return status, fmt.Errorf("process %d did not stop within %s and was killed", status.PID, timeout)
+}
+
+// RestartDaemon asks the daemon logging to logFile to restart without closing
+// its listening sockets and waits until the new process has taken over
+func RestartDaemon(logFile string, timeout time.Duration) (*DaemonStatus, error) {
+	status, err := ReadDaemonStatus(logFile)
+	if err != nil {
+		return status, err
+	}
+	if restartSignal == nil {
+		return status, fmt.Errorf("restart is not supported on this platform; use stop and start")
+	}
+
+	oldPID := status.PID
+	if err := signalProcess(oldPID, restartSignal); err != nil {
+		return status, fmt.Errorf("failed to signal process %d: %w", oldPID, err)
+	}
+
+	var newStatus *DaemonStatus
+	restarted := waitFor(timeout, func() bool {
+		current, err := ReadDaemonStatus(logFile)
+		if err != nil || current.PID == oldPID {
+			return false
+		}
+		newStatus = current
+		return true
+	})
+	if !restarted {
+		return status, fmt.Errorf("process %d did not restart within %s", oldPID, timeout)
+	}
+	return newStatus, nil
+}
+
+// waitFor polls condition until it holds or timeout passes
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// logPollInterval is how often a followed log file is checked for output
+const logPollInterval = 250 * time.Millisecond
+
+// TailLog writes the last lines of the daemon log logFile to w. With
+// follow it keeps writing what the daemon logs until ctx is done, and
+// continues with the new file when the log is rotated.
+func TailLog(ctx context.Context, w io.Writer, logFile string, lines int, follow bool) error {
+	file, err := os.Open(logFile)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	offset, err := lastLines(file, lines)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, file); err != nil || !follow {
+		return err
+	}
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := io.Copy(w, file); err != nil {
+			return err
+		}
+
+		// A rotated log is renamed and a new file is created in its
+		// place; a truncated one shrinks below what was read
+		current, err := os.Stat(logFile)
+		if err != nil {
+			continue
+		}
+		opened, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		position, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if os.SameFile(current, opened) && current.Size() >= position {
+			continue
+		}
+		next, err := os.Open(logFile)
+		if err != nil {
+			continue
+		}
+		if _, err := io.Copy(w, file); err != nil {
+			next.Close()
+			return err
+		}
+		file.Close()
+		file = next
+	}
+}
+
+// lastLines returns the offset of the last n lines of file
+func lastLines(file *os.File, n int) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := info.Size()
+	if n <= 0 || offset == 0 {
+		return offset, nil
+	}
+
+	// The newline ending the last line doesn't start another one
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, offset-1); err != nil {
+		return 0, err
+	}
+	if last[0] == '\n' {
+		offset--
+	}
+
+	buf := make([]byte, 64*1024)
+	for offset > 0 {
+		chunk := buf[:min(int64(len(buf)), offset)]
+		offset -= int64(len(chunk))
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] == '\n' {
+				if n--; n == 0 {
+					return offset + int64(i) + 1, nil
+				}
+			}
+		}
+	}
+	return 0, nil
+}
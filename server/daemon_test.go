@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadDaemonStatus(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "server.log")
+
+	if _, err := ReadDaemonStatus(logFile); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Expected ErrNotRunning without a PID file, got %v", err)
+	}
+
+	// The test binary stands in for a running daemon
+	status := newDaemonStatus(&Config{Port: 8080, Root: "site", LogFile: logFile})
+	if err := writeDaemonFiles(status); err != nil {
+		t.Fatalf("Failed to write daemon files: %v", err)
+	}
+
+	current, err := ReadDaemonStatus(logFile)
+	if err != nil {
+		t.Fatalf("Expected running daemon, got %v", err)
+	}
+	if current.PID != os.Getpid() || current.Port != 8080 || current.Root != "site" {
+		t.Errorf("Unexpected status %+v", current)
+	}
+
+	removeDaemonFiles(logFile)
+	if _, err := os.Stat(PIDFile(logFile)); !os.IsNotExist(err) {
+		t.Error("Expected PID file to be removed")
+	}
+}
+
+func TestReadDaemonStatusStale(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "server.log")
+
+	// The parent of the test process is alive but is not this executable
+	status := newDaemonStatus(&Config{Port: 8080, LogFile: logFile})
+	status.PID = os.Getppid()
+	if err := writeDaemonFiles(status); err != nil {
+		t.Fatalf("Failed to write daemon files: %v", err)
+	}
+
+	current, err := ReadDaemonStatus(logFile)
+	if !errors.Is(err, ErrNotRunning) || !current.Stale {
+		t.Fatalf("Expected stale PID file, got %+v, %v", current, err)
+	}
+	for _, file := range []string{PIDFile(logFile), statusFile(logFile)} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", file)
+		}
+	}
+}
+
+func TestTailLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "server.log")
+	os.WriteFile(logFile, []byte("one\ntwo\nthree\n"), 0644)
+
+	for lines, want := range map[int]string{
+		0:  "",
+		2:  "two\nthree\n",
+		10: "one\ntwo\nthree\n",
+	} {
+		var out bytes.Buffer
+		if err := TailLog(context.Background(), &out, logFile, lines, false); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("Expected the last %d lines to be %q, got %q", lines, want, out.String())
+		}
+	}
+
+	// Following picks up new output and the file that replaces a rotated log
+	ctx, cancel := context.WithCancel(context.Background())
+	var out syncBuffer
+	done := make(chan error)
+	go func() { done <- TailLog(ctx, &out, logFile, 1, true) }()
+
+	appendLog := func(text string) {
+		file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(text)
+		file.Close()
+	}
+	if !waitFor(5*time.Second, func() bool { return out.String() == "three\n" }) {
+		t.Fatalf("Expected the last line, got %q", out.String())
+	}
+	appendLog("four\n")
+	if !waitFor(5*time.Second, func() bool { return out.String() == "three\nfour\n" }) {
+		t.Fatalf("Expected the appended line, got %q", out.String())
+	}
+	os.Rename(logFile, logFile+".1")
+	appendLog("five\n")
+	if !waitFor(5*time.Second, func() bool { return out.String() == "three\nfour\nfive\n" }) {
+		t.Fatalf("Expected the line of the new log, got %q", out.String())
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a writer and a reader goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
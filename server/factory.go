@@ -4,6 +4,7 @@ import (
 	"io/fs"
 
 	"github.com/rediwo/redi"
+	"github.com/rediwo/redi/middleware"
 )
 
 // Factory creates redi servers with various configurations
@@ -27,6 +28,37 @@ func (f *Factory) CreateServer(config *Config) (*redi.Server, error) {
 		server.SetRoutesDir(config.RoutesDir)
 	}
 	server.SetCacheEnabled(config.EnableCache)
+	server.SetDefaultLocale(config.DefaultLocale)
+	server.SetDevMode(config.DevMode)
+	server.SetPrebuildOnStart(config.Prebuild && !config.OnlyPrebuild, config.PrebuildParallel)
+	if config.PrebuildReport != "" {
+		server.SetPrebuildReport(config.PrebuildReport)
+	}
+	accessLog, _ := middleware.ParseAccessLogFormat(config.AccessLog)
+	server.SetAccessLogFormat(accessLog)
+	server.SetMetricsEnabled(config.EnableMetrics)
+	server.SetAdminToken(config.AdminToken)
+	for _, pair := range TLSPairs(config.TLSCert, config.TLSKey) {
+		server.AddTLSCertificate(pair[0], pair[1])
+	}
+	server.SetDevTLS(config.DevTLS)
+	server.SetHTTPRedirectPort(config.HTTPRedirectPort)
+	server.SetShutdownTimeout(config.ShutdownTimeout)
+	server.SetSvelteConfig(config.SvelteConfig)
+	server.SetTemplateConfig(config.TemplateConfig)
+	server.SetStaticConfig(config.StaticConfig)
+	server.SetCompressConfig(config.CompressConfig)
+	server.SetSecurityConfig(config.SecurityConfig)
+	server.SetRateLimitConfig(config.RateLimitConfig)
+	server.SetResponseCacheConfig(config.ResponseCacheConfig)
+	server.SetCacheConfig(config.CacheConfig)
+	server.SetCacheBackend(config.CacheBackend)
+	server.SetProxyRules(config.ProxyRules)
+	for _, vhost := range config.VirtualHosts {
+		if err := server.AddVirtualHost(vhost); err != nil {
+			return nil, err
+		}
+	}
 	
 	return server, nil
 }
@@ -44,6 +76,24 @@ func (f *Factory) CreateEmbeddedServer(config *EmbedConfig) (*redi.Server, error
 		server.SetRoutesDir(config.RoutesDir)
 	}
 	server.SetCacheEnabled(config.EnableCache)
+	server.SetDefaultLocale(config.DefaultLocale)
+	server.SetDevMode(config.DevMode)
+	accessLog, _ := middleware.ParseAccessLogFormat(config.AccessLog)
+	server.SetAccessLogFormat(accessLog)
+	server.SetMetricsEnabled(config.EnableMetrics)
+	server.SetAdminToken(config.AdminToken)
+	for _, pair := range TLSPairs(config.TLSCert, config.TLSKey) {
+		server.AddTLSCertificate(pair[0], pair[1])
+	}
+	server.SetDevTLS(config.DevTLS)
+	server.SetHTTPRedirectPort(config.HTTPRedirectPort)
+	server.SetShutdownTimeout(config.ShutdownTimeout)
+	server.SetStaticConfig(config.StaticConfig)
+	server.SetCompressConfig(config.CompressConfig)
+	server.SetSecurityConfig(config.SecurityConfig)
+	server.SetRateLimitConfig(config.RateLimitConfig)
+	server.SetResponseCacheConfig(config.ResponseCacheConfig)
+	server.SetProxyRules(config.ProxyRules)
 	
 	return server, nil
 }
@@ -5,16 +5,23 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"strings"
+	"path/filepath"
 	"time"
 
 	"github.com/rediwo/redi"
 	"github.com/rediwo/redi/logging"
 )
 
+// logRotateInterval is how often a daemon checks its log file for rotation
+const logRotateInterval = time.Minute
+
 // Launcher handles server startup modes
 type Launcher struct {
 	factory *Factory
+	
+	// config holds the flags given to Start before the project config was
+	// applied, so SIGHUP can re-apply a changed project config on top of them
+	config *Config
 }
 
 // NewLauncher creates a new server launcher
@@ -26,10 +33,18 @@ func NewLauncher() *Launcher {
 
 // Start starts the server based on configuration
 func (l *Launcher) Start(config *Config) error {
+	// Apply redi.yaml and REDI_* environment variables under the flags
+	base := *config
+	l.config = &base
+	if err := config.LoadProjectConfig(); err != nil {
+		return err
+	}
+	
 	// Initialize logging system
 	if err := l.initializeLogging(config); err != nil {
 		return fmt.Errorf("failed to initialize logging: %v", err)
 	}
+	config.logProjectConfig()
 	
 	if config.Daemon {
 		return l.startDaemon(config)
@@ -61,25 +76,19 @@ func (l *Launcher) startForeground(config *Config) error {
 		return fmt.Errorf("failed to create server: %v", err)
 	}
 	
-	// Run prebuild if requested
-	if config.Prebuild {
+	// Run only the prebuild if requested; otherwise the server pre-builds
+	// in the background once it is listening
+	if config.OnlyPrebuild {
 		logging.Info("Starting pre-build process")
 		if err := server.PreBuild(config.PrebuildParallel); err != nil {
 			return fmt.Errorf("pre-build failed: %v", err)
 		}
-		// If only prebuild was requested, exit
-		if config.OnlyPrebuild {
-			return nil
-		}
+		return nil
 	}
 	
 	logging.Info("Starting redi server", "version", config.Version, "port", config.Port, "root", config.Root)
 	
-	if err := server.Start(); err != nil {
-		return fmt.Errorf("server failed to start: %v", err)
-	}
-	
-	return nil
+	return l.serve(server, nil)
 }
 
 // startBackground starts the server in background mode
@@ -87,23 +96,9 @@ func (l *Launcher) startBackground(config *Config) error {
 	// Create a new process group and detach from terminal
 	cmd := exec.Command(os.Args[0])
 	
-	// Copy all arguments except --log to the new process, add --daemon
-	newArgs := []string{}
-	skipNext := false
-	for _, arg := range os.Args[1:] {
-		if skipNext {
-			skipNext = false
-			continue
-		}
-		if arg == "--log" {
-			skipNext = true
-			continue
-		}
-		if strings.HasPrefix(arg, "--log=") {
-			continue
-		}
-		newArgs = append(newArgs, arg)
-	}
+	// Copy all arguments to the new process and add --daemon. The daemon keeps
+	// --log so it knows its PID file; --daemon takes precedence in Start.
+	newArgs := append([]string{}, os.Args[1:]...)
 	newArgs = append(newArgs, "--daemon")
 	cmd.Args = append([]string{os.Args[0]}, newArgs...)
 
@@ -140,10 +135,14 @@ func (l *Launcher) startBackground(config *Config) error {
 	fmt.Printf("Root: %s\n", config.Root)
 	fmt.Printf("Log file: %s\n", config.LogFile)
 	fmt.Printf("PID: %d\n", cmd.Process.Pid)
-	fmt.Printf("Server URL: http://localhost:%d\n", config.Port)
+	scheme := "http"
+	if config.TLSCert != "" || config.DevTLS {
+		scheme = "https"
+	}
+	fmt.Printf("Server URL: %s://localhost:%d\n", scheme, config.Port)
 	
-	// Write PID file
-	pidFile := config.LogFile + ".pid"
+	// Write PID file; the daemon rewrites it together with its status file
+	pidFile := PIDFile(config.LogFile)
 	pidContent := fmt.Sprintf("%d", cmd.Process.Pid)
 	err = os.WriteFile(pidFile, []byte(pidContent), 0644)
 	if err != nil {
@@ -151,6 +150,7 @@ func (l *Launcher) startBackground(config *Config) error {
 	} else {
 		fmt.Printf("PID file: %s\n", pidFile)
 	}
+	fmt.Printf("Manage with: %s status|stop|restart --log=%s\n", filepath.Base(os.Args[0]), config.LogFile)
 
 	return nil
 }
@@ -162,25 +162,29 @@ func (l *Launcher) startDaemon(config *Config) error {
 		return fmt.Errorf("failed to create server: %v", err)
 	}
 	
-	// Run prebuild if requested
-	if config.Prebuild {
+	// Run only the prebuild if requested; otherwise the server pre-builds
+	// in the background once it is listening
+	if config.OnlyPrebuild {
 		log.Printf("Starting pre-build process...")
 		if err := server.PreBuild(config.PrebuildParallel); err != nil {
 			return fmt.Errorf("pre-build failed: %v", err)
 		}
-		// If only prebuild was requested, exit
-		if config.OnlyPrebuild {
-			return nil
-		}
+		return nil
 	}
 	
 	log.Printf("Starting redi server %s on port %d, serving from %s", config.Version, config.Port, config.Root)
 
-	if err := server.Start(); err != nil {
-		return fmt.Errorf("server failed to start: %v", err)
+	if config.LogFile == "" {
+		return l.serve(server, nil)
 	}
-	
-	return nil
+
+	rotateConfig := config.LogRotateConfig()
+	if rotateConfig.Enabled() {
+		rotator := logging.NewRotator(config.LogFile, rotateConfig)
+		rotator.Start(logRotateInterval)
+		defer rotator.Stop()
+	}
+	return l.serve(server, newDaemonStatus(config))
 }
 
 // StartSimple starts a server with simple configuration
@@ -198,10 +202,38 @@ func (l *Launcher) StartSimple(root string, port int, version string) error {
 func (l *Launcher) StartEmbedded(server *redi.Server) error {
 	log.Printf("Starting embedded redi server")
 	
-	if err := server.Start(); err != nil {
-		return fmt.Errorf("server failed to start: %v", err)
+	return l.serve(server, nil)
+}
+
+// reloadProjectConfig re-reads the project config on SIGHUP and applies the
+// settings that can change without a restart, including those of the
+// middleware, which Reload rebuilds. Listener settings such as the port and
+// TLS still need a restart.
+func (l *Launcher) reloadProjectConfig(server *redi.Server) error {
+	if l.config == nil {
+		return nil
+	}
+	config := *l.config
+	if err := config.LoadProjectConfig(); err != nil {
+		return err
 	}
 	
+	server.SetDevMode(config.DevMode)
+	server.SetDefaultLocale(config.DefaultLocale)
+	server.SetAdminToken(config.AdminToken)
+	server.SetSvelteConfig(config.SvelteConfig)
+	server.SetTemplateConfig(config.TemplateConfig)
+	server.SetStaticConfig(config.StaticConfig)
+	server.SetGzipEnabled(config.EnableGzip)
+	server.SetGzipLevel(config.GzipLevel)
+	server.SetCompressConfig(config.CompressConfig)
+	server.SetSecurityConfig(config.SecurityConfig)
+	server.SetRateLimitConfig(config.RateLimitConfig)
+	server.SetResponseCacheConfig(config.ResponseCacheConfig)
+	if !config.LogQuiet {
+		logging.GetGlobalLogger().SetLevel(logging.ParseLevel(config.LogLevel))
+	}
+	config.logProjectConfig()
 	return nil
 }
 
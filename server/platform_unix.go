@@ -3,14 +3,66 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
+// Signals handled by a running server: SIGINT/SIGTERM drain and stop,
+// SIGHUP reloads and SIGUSR2 hands the sockets to a new process
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	reloadSignal    os.Signal = syscall.SIGHUP
+	restartSignal   os.Signal = syscall.SIGUSR2
+)
+
 // setPlatformSpecificAttributes sets Unix-specific process attributes
 func setPlatformSpecificAttributes(cmd *exec.Cmd) {
 	// Create new session to detach from terminal
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setsid: true,
 	}
-}
\ No newline at end of file
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processName returns the executable name of a running process
+func processName(pid int) (string, error) {
+	// Linux exposes the executable directly; " (deleted)" marks a binary
+	// that was replaced on disk since the process started
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)")), nil
+	}
+	output, err := exec.Command("ps", "-o", "comm=", "-p", fmt.Sprint(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(strings.TrimSpace(string(output))), nil
+}
+
+// signalProcess sends a signal to a process
+func signalProcess(pid int, sig os.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
+
+// terminateProcess asks a process to shut down gracefully
+func terminateProcess(pid int) error {
+	return signalProcess(pid, syscall.SIGTERM)
+}
+
+// killProcess forcibly stops a process
+func killProcess(pid int) error {
+	return signalProcess(pid, syscall.SIGKILL)
+}
@@ -3,10 +3,21 @@
 package server
 
 import (
+	"encoding/csv"
+	"fmt"
+	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 )
 
+// Windows only delivers interrupts; reload and restart are unavailable
+var (
+	shutdownSignals = []os.Signal{os.Interrupt}
+	reloadSignal    os.Signal
+	restartSignal   os.Signal
+)
+
 // setPlatformSpecificAttributes sets Windows-specific process attributes
 func setPlatformSpecificAttributes(cmd *exec.Cmd) {
 	// Detach from parent console on Windows
@@ -14,4 +25,47 @@ func setPlatformSpecificAttributes(cmd *exec.Cmd) {
 		HideWindow:    true,
 		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
 	}
-}
\ No newline at end of file
+}
+
+// processName returns the image name of a running process
+func processName(pid int) (string, error) {
+	output, err := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return "", err
+	}
+	record, err := csv.NewReader(strings.NewReader(string(output))).Read()
+	if err != nil || len(record) < 2 || record[1] != fmt.Sprint(pid) {
+		return "", fmt.Errorf("process %d not found", pid)
+	}
+	return record[0], nil
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	_, err := processName(pid)
+	return err == nil
+}
+
+// signalProcess sends a signal to a process
+func signalProcess(pid int, sig os.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
+
+// terminateProcess stops a process. Windows can't deliver an interrupt to a
+// detached process, so the daemon is stopped without draining.
+func terminateProcess(pid int) error {
+	return killProcess(pid)
+}
+
+// killProcess forcibly stops a process
+func killProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
@@ -0,0 +1,1071 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rediwo/redi"
+	"github.com/rediwo/redi/cache"
+	"github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFiles are the project config file names looked up in the root
+// directory, in order. JSON is parsed as YAML, so both report line numbers.
+var ProjectConfigFiles = []string{"redi.yaml", "redi.yml", "redi.json"}
+
+// EnvironmentVar selects the section of the project config to apply
+const EnvironmentVar = "REDI_ENV"
+
+// Environments that may have their own section in the project config
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// ProjectConfig is the content of redi.yaml. Unset fields leave the server
+// configuration unchanged; each scalar can also be set with the environment
+// variable in its env tag.
+type ProjectConfig struct {
+	Port             *int      `yaml:"port" env:"REDI_PORT"`
+	RoutesDir        *string   `yaml:"routesDir" env:"REDI_ROUTES_DIR"`
+	Gzip             *bool     `yaml:"gzip" env:"REDI_GZIP"`
+	GzipLevel        *int      `yaml:"gzipLevel" env:"REDI_GZIP_LEVEL"`
+	Cache            *bool     `yaml:"cache" env:"REDI_CACHE"`
+	Prebuild         *bool     `yaml:"prebuild" env:"REDI_PREBUILD"`
+	PrebuildParallel *int      `yaml:"prebuildParallel" env:"REDI_PREBUILD_PARALLEL"`
+	PrebuildReport   *string   `yaml:"prebuildReport" env:"REDI_PREBUILD_REPORT"`
+	DefaultLocale    *string   `yaml:"defaultLocale" env:"REDI_DEFAULT_LOCALE"`
+	Dev              *bool     `yaml:"dev" env:"REDI_DEV"`
+	AccessLog        *string   `yaml:"accessLog" env:"REDI_ACCESS_LOG"`
+	Metrics          *bool     `yaml:"metrics" env:"REDI_METRICS"`
+	AdminToken       *string   `yaml:"adminToken" env:"REDI_ADMIN_TOKEN"`
+	TLSCert          *string   `yaml:"tlsCert" env:"REDI_TLS_CERT"`
+	TLSKey           *string   `yaml:"tlsKey" env:"REDI_TLS_KEY"`
+	DevTLS           *bool     `yaml:"devTLS" env:"REDI_DEV_TLS"`
+	HTTPRedirectPort *int      `yaml:"httpRedirectPort" env:"REDI_HTTP_REDIRECT_PORT"`
+	ShutdownTimeout  *Duration `yaml:"shutdownTimeout" env:"REDI_SHUTDOWN_TIMEOUT"`
+	LogLevel         *string   `yaml:"logLevel" env:"REDI_LOG_LEVEL"`
+	LogFormat        *string   `yaml:"logFormat" env:"REDI_LOG_FORMAT"`
+	LogMaxSize       *int64    `yaml:"logMaxSize" env:"REDI_LOG_MAX_SIZE"` // Megabytes
+	LogMaxAge        *Duration `yaml:"logMaxAge" env:"REDI_LOG_MAX_AGE"`
+	LogMaxBackups    *int      `yaml:"logMaxBackups" env:"REDI_LOG_MAX_BACKUPS"`
+
+	Svelte      *SvelteSettings      `yaml:"svelte"`
+	Templates   *TemplateSettings    `yaml:"templates"`
+	Static      *StaticSettings      `yaml:"static"`
+	Compression *CompressionSettings `yaml:"compression"`
+	Security    *SecuritySettings    `yaml:"security"`
+	RateLimit   *RateLimitSettings   `yaml:"rateLimit"`
+	ResponseCache *ResponseCacheSettings `yaml:"responseCache"`
+	CacheStore  *CacheStoreSettings  `yaml:"cacheStore"`
+	Proxy       *[]ProxySetting      `yaml:"proxy"`
+	Sites       *[]SiteSetting       `yaml:"sites"`
+
+	// Per-environment overrides, selected with --env or REDI_ENV
+	Development *ProjectConfig `yaml:"development"`
+	Production  *ProjectConfig `yaml:"production"`
+}
+
+// SvelteSettings exposes the handlers.SvelteConfig knobs
+type SvelteSettings struct {
+	MinifyRuntime          *bool     `yaml:"minifyRuntime"`
+	MinifyComponents       *bool     `yaml:"minifyComponents"`
+	MinifyCSS              *bool     `yaml:"minifyCSS"`
+	ExternalRuntime        *bool     `yaml:"externalRuntime"`
+	RuntimePath            *string   `yaml:"runtimePath"`
+	RuntimeCacheDuration   *Duration `yaml:"runtimeCacheDuration"`
+	AsyncLoading           *bool     `yaml:"asyncLoading"`
+	ComponentCacheDuration *Duration `yaml:"componentCacheDuration"`
+	AsyncLibraryPath       *string   `yaml:"asyncLibraryPath"`
+	VimeshStyle            *bool     `yaml:"vimeshStyle"`
+	VimeshStylePath        *string   `yaml:"vimeshStylePath"`
+	CompilerPoolSize       *int      `yaml:"compilerPoolSize"`
+}
+
+// TemplateSettings exposes the handlers.TemplateConfig knobs
+type TemplateSettings struct {
+	VimeshStyle     *bool   `yaml:"vimeshStyle"`
+	VimeshStylePath *string `yaml:"vimeshStylePath"`
+	MinifyVimesh    *bool   `yaml:"minifyVimesh"`
+}
+
+// StaticSettings exposes the redi.StaticConfig knobs for public/
+type StaticSettings struct {
+	IndexFiles       *[]string              `yaml:"indexFiles"`
+	DirectoryListing *bool                  `yaml:"directoryListing"`
+	Precompressed    *bool                  `yaml:"precompressed"`
+	CacheControl     *[]CacheControlSetting `yaml:"cacheControl"`
+	Fingerprinted    *string                `yaml:"fingerprintedCacheControl"`
+	Default          *string                `yaml:"defaultCacheControl"`
+}
+
+// CompressionSettings exposes the middleware.CompressConfig knobs
+type CompressionSettings struct {
+	Encodings    *[]string `yaml:"encodings"`
+	BrotliLevel  *int      `yaml:"brotliLevel"`
+	MinSize      *int      `yaml:"minSize"`
+	ContentTypes *[]string `yaml:"contentTypes"`
+	CacheSize    *int64    `yaml:"cacheSize"` // Megabytes
+}
+
+// SecuritySettings exposes the middleware.SecurityConfig knobs
+type SecuritySettings struct {
+	CORS           *[]CORSSetting `yaml:"cors"`
+	CSP            *string        `yaml:"csp"` // "default" selects middleware.DefaultCSP
+	CSPReportOnly  *bool          `yaml:"cspReportOnly"`
+	HSTS           *HSTSSettings  `yaml:"hsts"`
+	FrameOptions   *string        `yaml:"frameOptions"`
+	Nosniff        *bool          `yaml:"nosniff"`
+	ReferrerPolicy *string        `yaml:"referrerPolicy"`
+	CSRF           *CSRFSettings  `yaml:"csrf"`
+}
+
+// CORSSetting is the cross-origin policy for a path prefix
+type CORSSetting struct {
+	PathPrefix     string   `yaml:"pathPrefix"`
+	Origins        []string `yaml:"origins"`
+	Methods        []string `yaml:"methods"`
+	Headers        []string `yaml:"headers"`
+	ExposedHeaders []string `yaml:"exposedHeaders"`
+	Credentials    bool     `yaml:"credentials"`
+	MaxAge         Duration `yaml:"maxAge"`
+}
+
+// HSTSSettings configures Strict-Transport-Security
+type HSTSSettings struct {
+	MaxAge            *Duration `yaml:"maxAge"`
+	IncludeSubdomains *bool     `yaml:"includeSubdomains"`
+	Preload           *bool     `yaml:"preload"`
+}
+
+// CSRFSettings configures double-submit CSRF protection
+type CSRFSettings struct {
+	Enabled     *bool     `yaml:"enabled"`
+	CookieName  *string   `yaml:"cookieName"`
+	HeaderName  *string   `yaml:"headerName"`
+	FieldName   *string   `yaml:"fieldName"`
+	ExemptPaths *[]string `yaml:"exemptPaths"`
+}
+
+// RateLimitSettings exposes the middleware.RateLimitConfig knobs
+type RateLimitSettings struct {
+	Rate        *string                 `yaml:"rate"` // e.g. 100/m
+	Burst       *int                    `yaml:"burst"`
+	Key         *string                 `yaml:"key"` // ip, session or header:Name
+	TrustProxy  *bool                   `yaml:"trustProxy"`
+	MaxBodySize *ByteSize               `yaml:"maxBodySize"`
+	Routes      *[]RateLimitRuleSetting `yaml:"routes"`
+}
+
+// RateLimitRuleSetting limits the requests to matching paths
+type RateLimitRuleSetting struct {
+	Path        string   `yaml:"path"`
+	Methods     []string `yaml:"methods"`
+	Rate        string   `yaml:"rate"`
+	Burst       int      `yaml:"burst"`
+	Key         string   `yaml:"key"`
+	MaxBodySize ByteSize `yaml:"maxBodySize"`
+}
+
+// ResponseCacheSettings exposes the middleware.ResponseCacheConfig knobs
+type ResponseCacheSettings struct {
+	MaxSize      *ByteSize                   `yaml:"maxSize"`
+	MaxEntrySize *ByteSize                   `yaml:"maxEntrySize"`
+	Routes       *[]ResponseCacheRuleSetting `yaml:"routes"`
+}
+
+// ResponseCacheRuleSetting caches the responses of matching paths
+type ResponseCacheRuleSetting struct {
+	Path                 string   `yaml:"path"`
+	MaxAge               Duration `yaml:"maxAge"`
+	StaleWhileRevalidate Duration `yaml:"staleWhileRevalidate"`
+	Tags                 []string `yaml:"tags"`
+}
+
+// CacheStoreSettings exposes the cache.CacheConfig knobs of the compilation
+// cache enabled with cache
+type CacheStoreSettings struct {
+	MaxSize         *ByteSize           `yaml:"maxSize"`
+	TTL             *Duration           `yaml:"ttl"`
+	Compression     *string             `yaml:"compression"` // zstd, gzip or none
+	JanitorInterval *Duration           `yaml:"janitorInterval"`
+	Remote          *RemoteCacheSetting `yaml:"remote"`
+}
+
+// RemoteCacheSetting is a compilation cache shared over HTTP (see
+// cache.RemoteConfig). Header values may reference environment variables as
+// ${NAME}.
+type RemoteCacheSetting struct {
+	URL      string            `yaml:"url"`
+	Headers  map[string]string `yaml:"headers"`
+	Timeout  Duration          `yaml:"timeout"`
+	ReadOnly bool              `yaml:"readOnly"`
+}
+
+// ProxySetting is a reverse proxy rule (see redi.ProxyRule)
+type ProxySetting struct {
+	Path              string                `yaml:"path"`
+	Target            string                `yaml:"target"`
+	StripPrefix       string                `yaml:"stripPrefix"`
+	Rewrite           []ProxyRewriteSetting `yaml:"rewrite"`
+	Headers           map[string]string     `yaml:"headers"`
+	ResponseHeaders   map[string]string     `yaml:"responseHeaders"`
+	PreserveHost      bool                  `yaml:"preserveHost"`
+	DisableWebSockets bool                  `yaml:"disableWebSockets"`
+	Timeout           Duration              `yaml:"timeout"`
+	Hook              string                `yaml:"hook"`
+}
+
+// ProxyRewriteSetting replaces the part of the path matching From with To
+type ProxyRewriteSetting struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// SiteSetting is a virtual host: a site directory, relative to the root,
+// served for requests to its hosts
+type SiteSetting struct {
+	Hosts []string `yaml:"hosts"`
+	Root  string   `yaml:"root"`
+}
+
+// CacheControlSetting is a Cache-Control header for files matching a glob
+type CacheControlSetting struct {
+	Pattern string `yaml:"pattern"`
+	Value   string `yaml:"value"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "24h"
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return &ProjectConfigError{Line: node.Line, Message: fmt.Sprintf("invalid duration %q (use e.g. 30s, 5m, 24h)", value)}
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ByteSize is a size in bytes written as a number or a string such as "10MB"
+type ByteSize int64
+
+// UnmarshalYAML parses a byte size
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	parsed, err := middleware.ParseByteSize(value)
+	if err != nil {
+		return &ProjectConfigError{Line: node.Line, Message: err.Error()}
+	}
+	*b = ByteSize(parsed)
+	return nil
+}
+
+// ProjectConfigError is a problem in the project config file
+type ProjectConfigError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *ProjectConfigError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if location == "" {
+		return e.Message
+	}
+	return location + ": " + e.Message
+}
+
+var (
+	yamlLinePattern     = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	unknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type .*$`)
+)
+
+// FindProjectConfig returns the project config file in root, or "" if there
+// is none
+func FindProjectConfig(root string) string {
+	for _, name := range ProjectConfigFiles {
+		path := filepath.Join(root, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadProjectConfig parses and validates a project config file
+func LoadProjectConfig(path string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProjectConfig(data, filepath.Base(path))
+}
+
+// ParseProjectConfig parses and validates project config data; name is used
+// in error messages
+func ParseProjectConfig(data []byte, name string) (*ProjectConfig, error) {
+	project := &ProjectConfig{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return project, nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(project); err != nil {
+		return nil, projectConfigErrors(err, name)
+	}
+
+	var root yaml.Node
+	yaml.Unmarshal(data, &root)
+	if err := project.validate(name, keyLines(&root)); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// projectConfigErrors converts yaml errors to ProjectConfigErrors
+func projectConfigErrors(err error, name string) error {
+	var configErr *ProjectConfigError
+	if errors.As(err, &configErr) {
+		configErr.File = name
+		return configErr
+	}
+
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	var errs []error
+	for _, message := range messages {
+		configErr := &ProjectConfigError{File: name, Message: message}
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			configErr.Line, _ = strconv.Atoi(match[1])
+			configErr.Message = match[2]
+		}
+		if match := unknownFieldPattern.FindStringSubmatch(configErr.Message); match != nil {
+			configErr.Message = fmt.Sprintf("unknown setting %q", match[1])
+		}
+		errs = append(errs, configErr)
+	}
+	return errors.Join(errs...)
+}
+
+// keyLines maps dotted key paths such as "development.port" to their line
+func keyLines(node *yaml.Node) map[string]int {
+	lines := make(map[string]int)
+	var walk func(node *yaml.Node, prefix string)
+	walk = func(node *yaml.Node, prefix string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, prefix)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := prefix + node.Content[i].Value
+				lines[key] = node.Content[i].Line
+				walk(node.Content[i+1], key+".")
+			}
+		}
+	}
+	walk(node, "")
+	return lines
+}
+
+// validate checks setting values, reporting the line of the offending key
+func (p *ProjectConfig) validate(name string, lines map[string]int) error {
+	var errs []error
+	p.validateSection(name, "", lines, &errs)
+	for section, config := range map[string]*ProjectConfig{EnvDevelopment: p.Development, EnvProduction: p.Production} {
+		if config == nil {
+			continue
+		}
+		if config.Development != nil || config.Production != nil {
+			errs = append(errs, &ProjectConfigError{File: name, Line: lines[section], Message: "environment sections cannot be nested"})
+		}
+		config.validateSection(name, section+".", lines, &errs)
+	}
+	return errors.Join(errs...)
+}
+
+// validateSection validates the settings of one section
+func (p *ProjectConfig) validateSection(name, prefix string, lines map[string]int, errs *[]error) {
+	check := func(key string, ok bool, message string) {
+		if !ok {
+			*errs = append(*errs, &ProjectConfigError{File: name, Line: lines[prefix+key], Message: key + ": " + message})
+		}
+	}
+
+	if p.Port != nil {
+		check("port", *p.Port > 0 && *p.Port <= 65535, "must be between 1 and 65535")
+	}
+	if p.GzipLevel != nil {
+		check("gzipLevel", *p.GzipLevel >= -1 && *p.GzipLevel <= 9, "must be between -1 and 9")
+	}
+	if p.PrebuildParallel != nil {
+		check("prebuildParallel", *p.PrebuildParallel > 0, "must be positive")
+	}
+	if p.AccessLog != nil {
+		_, err := middleware.ParseAccessLogFormat(*p.AccessLog)
+		check("accessLog", err == nil, "must be common, combined, json or off")
+	}
+	if p.HTTPRedirectPort != nil {
+		check("httpRedirectPort", *p.HTTPRedirectPort >= 0 && *p.HTTPRedirectPort <= 65535, "must be between 0 and 65535")
+	}
+	if p.ShutdownTimeout != nil {
+		check("shutdownTimeout", *p.ShutdownTimeout > 0, "must be positive")
+	}
+	if p.LogLevel != nil {
+		switch strings.ToLower(*p.LogLevel) {
+		case "debug", "info", "warn", "warning", "error":
+		default:
+			check("logLevel", false, "must be debug, info, warn or error")
+		}
+	}
+	if p.LogFormat != nil {
+		check("logFormat", *p.LogFormat == "text" || *p.LogFormat == "json", "must be text or json")
+	}
+	if p.LogMaxSize != nil {
+		check("logMaxSize", *p.LogMaxSize >= 0, "must not be negative")
+	}
+	if p.LogMaxAge != nil {
+		check("logMaxAge", *p.LogMaxAge >= 0, "must not be negative")
+	}
+	if p.LogMaxBackups != nil {
+		check("logMaxBackups", *p.LogMaxBackups >= 0, "must not be negative")
+	}
+	if p.Svelte != nil && p.Svelte.CompilerPoolSize != nil {
+		check("svelte.compilerPoolSize", *p.Svelte.CompilerPoolSize >= 0, "must not be negative")
+	}
+	if p.Compression != nil {
+		if p.Compression.Encodings != nil {
+			for _, encoding := range *p.Compression.Encodings {
+				switch encoding {
+				case middleware.EncodingBrotli, middleware.EncodingZstd, middleware.EncodingGzip:
+				default:
+					check("compression.encodings", false, fmt.Sprintf("unknown encoding %q (use br, zstd or gzip)", encoding))
+				}
+			}
+		}
+		if p.Compression.BrotliLevel != nil {
+			check("compression.brotliLevel", *p.Compression.BrotliLevel >= 0 && *p.Compression.BrotliLevel <= 11, "must be between 0 and 11")
+		}
+		if p.Compression.MinSize != nil {
+			check("compression.minSize", *p.Compression.MinSize >= 0, "must not be negative")
+		}
+		if p.Compression.CacheSize != nil {
+			check("compression.cacheSize", *p.Compression.CacheSize >= 0, "must not be negative")
+		}
+	}
+	if p.Security != nil {
+		if p.Security.CORS != nil {
+			for _, policy := range *p.Security.CORS {
+				check("security.cors", len(policy.Origins) > 0, fmt.Sprintf("policy for %q has no origins", policy.PathPrefix))
+				for _, origin := range policy.Origins {
+					_, err := path.Match(origin, "")
+					check("security.cors", err == nil, fmt.Sprintf("invalid origin pattern %q", origin))
+				}
+			}
+		}
+		if p.Security.FrameOptions != nil {
+			switch strings.ToUpper(*p.Security.FrameOptions) {
+			case "", "DENY", "SAMEORIGIN":
+			default:
+				check("security.frameOptions", false, "must be DENY or SAMEORIGIN")
+			}
+		}
+		if p.Security.HSTS != nil && p.Security.HSTS.MaxAge != nil {
+			check("security.hsts.maxAge", *p.Security.HSTS.MaxAge >= 0, "must not be negative")
+		}
+	}
+	if p.CacheStore != nil {
+		if p.CacheStore.MaxSize != nil {
+			check("cacheStore.maxSize", *p.CacheStore.MaxSize >= 0, "must not be negative")
+		}
+		if p.CacheStore.TTL != nil {
+			check("cacheStore.ttl", *p.CacheStore.TTL >= 0, "must not be negative")
+		}
+		if p.CacheStore.Compression != nil {
+			switch *p.CacheStore.Compression {
+			case "none", cache.CompressionZstd, cache.CompressionGzip:
+			default:
+				check("cacheStore.compression", false, "must be zstd, gzip or none")
+			}
+		}
+		if p.CacheStore.JanitorInterval != nil {
+			check("cacheStore.janitorInterval", *p.CacheStore.JanitorInterval >= 0, "must not be negative")
+		}
+		if remote := p.CacheStore.Remote; remote != nil {
+			target, err := url.Parse(remote.URL)
+			check("cacheStore.remote.url", err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != "", fmt.Sprintf("invalid URL %q", remote.URL))
+			check("cacheStore.remote.timeout", remote.Timeout >= 0, "must not be negative")
+		}
+	}
+	if p.RateLimit != nil {
+		if p.RateLimit.Rate != nil {
+			_, err := middleware.ParseRate(*p.RateLimit.Rate)
+			check("rateLimit.rate", err == nil, fmt.Sprint(err))
+		}
+		if p.RateLimit.Key != nil {
+			check("rateLimit.key", middleware.ValidRateLimitKey(*p.RateLimit.Key), "must be ip, session or header:Name")
+		}
+		if p.RateLimit.Routes != nil {
+			for _, rule := range *p.RateLimit.Routes {
+				check("rateLimit.routes", rule.Path != "", "every route needs a path")
+				if rule.Rate != "" {
+					_, err := middleware.ParseRate(rule.Rate)
+					check("rateLimit.routes", err == nil, fmt.Sprint(err))
+				}
+				check("rateLimit.routes", middleware.ValidRateLimitKey(rule.Key), fmt.Sprintf("key for %q must be ip, session or header:Name", rule.Path))
+			}
+		}
+	}
+	if p.ResponseCache != nil {
+		if p.ResponseCache.MaxSize != nil {
+			check("responseCache.maxSize", *p.ResponseCache.MaxSize >= 0, "must not be negative")
+		}
+		if p.ResponseCache.MaxEntrySize != nil {
+			check("responseCache.maxEntrySize", *p.ResponseCache.MaxEntrySize >= 0, "must not be negative")
+		}
+		if p.ResponseCache.Routes != nil {
+			for _, rule := range *p.ResponseCache.Routes {
+				check("responseCache.routes", strings.HasPrefix(rule.Path, "/"), fmt.Sprintf("path %q must start with /", rule.Path))
+				check("responseCache.routes", rule.MaxAge > 0, fmt.Sprintf("maxAge for %q must be positive", rule.Path))
+				check("responseCache.routes", rule.StaleWhileRevalidate >= 0, fmt.Sprintf("staleWhileRevalidate for %q must not be negative", rule.Path))
+			}
+		}
+	}
+	if p.Proxy != nil {
+		for _, rule := range *p.Proxy {
+			check("proxy", strings.HasPrefix(rule.Path, "/"), fmt.Sprintf("path %q must start with /", rule.Path))
+			target, err := url.Parse(rule.Target)
+			check("proxy", err == nil && target.Host != "", fmt.Sprintf("invalid target %q for %s", rule.Target, rule.Path))
+			for _, rewrite := range rule.Rewrite {
+				_, err := regexp.Compile(rewrite.From)
+				check("proxy", err == nil, fmt.Sprintf("invalid rewrite %q for %s", rewrite.From, rule.Path))
+			}
+		}
+	}
+	if p.Sites != nil {
+		for _, site := range *p.Sites {
+			check("sites", site.Root != "" && len(site.Hosts) > 0, "every site needs a root and hosts")
+			for _, host := range site.Hosts {
+				check("sites", !strings.Contains(host, "*") || (strings.HasPrefix(host, "*.") && strings.Count(host, "*") == 1),
+					fmt.Sprintf("invalid wildcard host %q (use *.example.com)", host))
+			}
+		}
+	}
+	if p.Static != nil && p.Static.CacheControl != nil {
+		for _, rule := range *p.Static.CacheControl {
+			_, err := path.Match(rule.Pattern, "")
+			check("static.cacheControl", rule.Pattern != "" && err == nil, fmt.Sprintf("invalid pattern %q", rule.Pattern))
+		}
+	}
+}
+
+// applyEnvironment overrides settings from REDI_* environment variables
+func (p *ProjectConfig) applyEnvironment(lookup func(string) (string, bool)) error {
+	value := reflect.ValueOf(p).Elem()
+	valueType := value.Type()
+	var errs []error
+	for i := 0; i < valueType.NumField(); i++ {
+		name := valueType.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := lookup(name)
+		if !ok || raw == "" {
+			continue
+		}
+		field := value.Field(i)
+		parsed := reflect.New(field.Type().Elem())
+		if err := parseEnvValue(parsed.Elem(), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		field.Set(parsed)
+	}
+	return errors.Join(errs...)
+}
+
+// parseEnvValue parses an environment variable into a setting
+func parseEnvValue(target reflect.Value, raw string) error {
+	if target.Type() == reflect.TypeOf(Duration(0)) {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		target.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		target.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		target.SetInt(parsed)
+	}
+	return nil
+}
+
+// merge overlays the settings that are set in other
+func (p *ProjectConfig) merge(other *ProjectConfig) {
+	if other == nil {
+		return
+	}
+	mergeFields(reflect.ValueOf(p).Elem(), reflect.ValueOf(other).Elem())
+}
+
+// mergeFields copies the non-nil pointer fields of src to dst, merging nested
+// settings field by field
+func mergeFields(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		name := src.Type().Field(i).Name
+		if name == "Development" || name == "Production" {
+			continue
+		}
+		field := src.Field(i)
+		if field.IsNil() {
+			continue
+		}
+		if field.Elem().Kind() == reflect.Struct {
+			if dst.Field(i).IsNil() {
+				dst.Field(i).Set(reflect.New(field.Elem().Type()))
+			}
+			mergeFields(dst.Field(i).Elem(), field.Elem())
+			continue
+		}
+		dst.Field(i).Set(field)
+	}
+}
+
+// forEnvironment returns the settings for an environment: the base settings
+// overlaid with the environment's section
+func (p *ProjectConfig) forEnvironment(environment string) *ProjectConfig {
+	result := &ProjectConfig{}
+	result.merge(p)
+	switch environment {
+	case EnvDevelopment:
+		result.merge(p.Development)
+	case EnvProduction:
+		result.merge(p.Production)
+	}
+	return result
+}
+
+// environment returns the environment whose section of the project config
+// applies: --env, then REDI_ENV, then development in --dev mode and
+// production otherwise
+func (c *Config) environment() string {
+	if c.Environment != "" {
+		return c.Environment
+	}
+	if env := os.Getenv(EnvironmentVar); env != "" {
+		return env
+	}
+	if c.DevMode {
+		return EnvDevelopment
+	}
+	return EnvProduction
+}
+
+// LoadProjectConfig applies the project config file (ConfigFile, or redi.yaml
+// in the root) and REDI_* environment variables to the configuration. Flags
+// listed in ExplicitFlags take precedence.
+func (c *Config) LoadProjectConfig() error {
+	path := c.ConfigFile
+	if path == "" && c.Root != "" {
+		path = FindProjectConfig(c.Root)
+	}
+
+	project := &ProjectConfig{}
+	if path != "" {
+		loaded, err := LoadProjectConfig(path)
+		if err != nil {
+			return err
+		}
+		project = loaded
+		// The environment may be chosen by the file's own dev setting
+		if c.Environment == "" && os.Getenv(EnvironmentVar) == "" && project.Dev != nil && !c.flagSet("dev") {
+			c.DevMode = *project.Dev
+		}
+	}
+
+	environment := c.environment()
+	if environment != EnvDevelopment && environment != EnvProduction {
+		return ConfigError{Message: fmt.Sprintf("unknown environment %q (use development or production)", environment)}
+	}
+	settings := project.forEnvironment(environment)
+	if err := settings.applyEnvironment(os.LookupEnv); err != nil {
+		return ConfigError{Message: "invalid environment variable", Err: err}
+	}
+	var errs []error
+	settings.validateSection("environment", "", nil, &errs)
+	if err := errors.Join(errs...); err != nil {
+		return ConfigError{Message: "invalid environment variable", Err: err}
+	}
+
+	c.apply(settings)
+	c.loadedConfigFile = path
+	return nil
+}
+
+// flagSet reports whether a CLI flag was set explicitly
+func (c *Config) flagSet(name string) bool {
+	return c.ExplicitFlags[name]
+}
+
+// apply copies project settings into the configuration, skipping settings
+// whose flag was given on the command line
+func (c *Config) apply(p *ProjectConfig) {
+	setInt := func(flag string, target *int, value *int) {
+		if value != nil && !c.flagSet(flag) {
+			*target = *value
+		}
+	}
+	setString := func(flag string, target *string, value *string) {
+		if value != nil && !c.flagSet(flag) {
+			*target = *value
+		}
+	}
+	setBool := func(flag string, target *bool, value *bool) {
+		if value != nil && !c.flagSet(flag) {
+			*target = *value
+		}
+	}
+
+	setInt("port", &c.Port, p.Port)
+	setString("routes", &c.RoutesDir, p.RoutesDir)
+	if p.Gzip != nil && !c.flagSet("disable-gzip") {
+		c.EnableGzip = *p.Gzip
+	}
+	setInt("gzip-level", &c.GzipLevel, p.GzipLevel)
+	setBool("cache", &c.EnableCache, p.Cache)
+	setBool("prebuild", &c.Prebuild, p.Prebuild)
+	setInt("prebuild-parallel", &c.PrebuildParallel, p.PrebuildParallel)
+	setString("prebuild-report", &c.PrebuildReport, p.PrebuildReport)
+	setString("default-locale", &c.DefaultLocale, p.DefaultLocale)
+	setBool("dev", &c.DevMode, p.Dev)
+	setString("access-log", &c.AccessLog, p.AccessLog)
+	setBool("metrics", &c.EnableMetrics, p.Metrics)
+	setString("admin-token", &c.AdminToken, p.AdminToken)
+	setString("tls-cert", &c.TLSCert, p.TLSCert)
+	setString("tls-key", &c.TLSKey, p.TLSKey)
+	setBool("dev-tls", &c.DevTLS, p.DevTLS)
+	setInt("http-redirect-port", &c.HTTPRedirectPort, p.HTTPRedirectPort)
+	if p.ShutdownTimeout != nil && !c.flagSet("shutdown-timeout") {
+		c.ShutdownTimeout = time.Duration(*p.ShutdownTimeout)
+	}
+	setString("log-level", &c.LogLevel, p.LogLevel)
+	setString("log-format", &c.LogFormat, p.LogFormat)
+	if p.LogMaxSize != nil && !c.flagSet("log-max-size") {
+		c.LogMaxSize = *p.LogMaxSize * 1024 * 1024
+	}
+	if p.LogMaxAge != nil && !c.flagSet("log-max-age") {
+		c.LogMaxAge = time.Duration(*p.LogMaxAge)
+	}
+	setInt("log-max-backups", &c.LogMaxBackups, p.LogMaxBackups)
+
+	if p.Svelte != nil {
+		c.SvelteConfig = p.Svelte.config()
+	}
+	if p.Templates != nil {
+		c.TemplateConfig = p.Templates.config()
+	}
+	if p.Static != nil {
+		c.StaticConfig = p.Static.config()
+	}
+	if p.Compression != nil {
+		c.CompressConfig = p.Compression.config()
+	}
+	if p.Security != nil {
+		c.SecurityConfig = p.Security.config()
+	}
+	if p.RateLimit != nil {
+		c.RateLimitConfig = p.RateLimit.config()
+	}
+	if p.ResponseCache != nil {
+		c.ResponseCacheConfig = p.ResponseCache.config()
+	}
+	if p.CacheStore != nil {
+		c.CacheConfig = p.CacheStore.config()
+	}
+	if p.Sites != nil && !c.flagSet("vhost") {
+		c.VirtualHosts = nil
+		for _, site := range *p.Sites {
+			root := site.Root
+			if !filepath.IsAbs(root) {
+				root = filepath.Join(c.Root, root)
+			}
+			c.VirtualHosts = append(c.VirtualHosts, redi.VirtualHost{Hosts: site.Hosts, Root: root})
+		}
+	}
+	if p.Proxy != nil {
+		c.ProxyRules = nil
+		for _, rule := range *p.Proxy {
+			c.ProxyRules = append(c.ProxyRules, rule.rule())
+		}
+	}
+}
+
+// rule returns the proxy rule
+func (s ProxySetting) rule() redi.ProxyRule {
+	rule := redi.ProxyRule{
+		Path:              s.Path,
+		Target:            s.Target,
+		StripPrefix:       s.StripPrefix,
+		Headers:           s.Headers,
+		ResponseHeaders:   s.ResponseHeaders,
+		PreserveHost:      s.PreserveHost,
+		DisableWebSockets: s.DisableWebSockets,
+		Timeout:           time.Duration(s.Timeout),
+		Hook:              s.Hook,
+	}
+	for _, rewrite := range s.Rewrite {
+		rule.Rewrite = append(rule.Rewrite, redi.ProxyRewrite{From: rewrite.From, To: rewrite.To})
+	}
+	return rule
+}
+
+// config returns the Svelte settings on top of the defaults
+func (s *SvelteSettings) config() *handlers.SvelteConfig {
+	config := handlers.DefaultSvelteConfig()
+	setIf(&config.MinifyRuntime, s.MinifyRuntime)
+	setIf(&config.MinifyComponents, s.MinifyComponents)
+	setIf(&config.MinifyCSS, s.MinifyCSS)
+	setIf(&config.UseExternalRuntime, s.ExternalRuntime)
+	setIf(&config.RuntimePath, s.RuntimePath)
+	if s.RuntimeCacheDuration != nil {
+		config.RuntimeCacheDuration = time.Duration(*s.RuntimeCacheDuration)
+	}
+	setIf(&config.EnableAsyncLoading, s.AsyncLoading)
+	if s.ComponentCacheDuration != nil {
+		config.ComponentCacheDuration = time.Duration(*s.ComponentCacheDuration)
+	}
+	setIf(&config.AsyncLibraryPath, s.AsyncLibraryPath)
+	setIf(&config.VimeshStyle.Enable, s.VimeshStyle)
+	setIf(&config.VimeshStylePath, s.VimeshStylePath)
+	setIf(&config.CompilerPoolSize, s.CompilerPoolSize)
+	return config
+}
+
+// config returns the template settings on top of the defaults
+func (t *TemplateSettings) config() *handlers.TemplateConfig {
+	config := handlers.DefaultTemplateConfig()
+	setIf(&config.VimeshStyle.Enable, t.VimeshStyle)
+	setIf(&config.VimeshStylePath, t.VimeshStylePath)
+	setIf(&config.MinifyVimesh, t.MinifyVimesh)
+	return config
+}
+
+// config returns the static file settings on top of the defaults
+func (s *StaticSettings) config() *redi.StaticConfig {
+	config := redi.DefaultStaticConfig()
+	setIf(&config.IndexFiles, s.IndexFiles)
+	setIf(&config.DirectoryListing, s.DirectoryListing)
+	setIf(&config.Precompressed, s.Precompressed)
+	setIf(&config.FingerprintedCacheControl, s.Fingerprinted)
+	setIf(&config.DefaultCacheControl, s.Default)
+	if s.CacheControl != nil {
+		for _, rule := range *s.CacheControl {
+			config.CacheControl = append(config.CacheControl, redi.CacheControlRule{Pattern: rule.Pattern, Value: rule.Value})
+		}
+	}
+	return config
+}
+
+// config returns the compression settings on top of the defaults
+func (s *CompressionSettings) config() *middleware.CompressConfig {
+	config := middleware.DefaultCompressConfig()
+	setIf(&config.Encodings, s.Encodings)
+	setIf(&config.BrotliLevel, s.BrotliLevel)
+	setIf(&config.MinSize, s.MinSize)
+	setIf(&config.ContentTypes, s.ContentTypes)
+	if s.CacheSize != nil {
+		config.CacheSize = *s.CacheSize * 1024 * 1024
+	}
+	return &config
+}
+
+// config returns the security settings; unset settings stay disabled
+func (s *SecuritySettings) config() *middleware.SecurityConfig {
+	config := &middleware.SecurityConfig{}
+	if s.CORS != nil {
+		for _, policy := range *s.CORS {
+			config.CORS = append(config.CORS, middleware.CORSPolicy{
+				PathPrefix:       policy.PathPrefix,
+				AllowedOrigins:   policy.Origins,
+				AllowedMethods:   policy.Methods,
+				AllowedHeaders:   policy.Headers,
+				ExposedHeaders:   policy.ExposedHeaders,
+				AllowCredentials: policy.Credentials,
+				MaxAge:           time.Duration(policy.MaxAge),
+			})
+		}
+	}
+	setIf(&config.CSP, s.CSP)
+	if config.CSP == "default" {
+		config.CSP = middleware.DefaultCSP
+	}
+	setIf(&config.CSPReportOnly, s.CSPReportOnly)
+	if s.HSTS != nil {
+		if s.HSTS.MaxAge != nil {
+			config.HSTSMaxAge = time.Duration(*s.HSTS.MaxAge)
+		}
+		setIf(&config.HSTSIncludeSubdomains, s.HSTS.IncludeSubdomains)
+		setIf(&config.HSTSPreload, s.HSTS.Preload)
+	}
+	if s.FrameOptions != nil {
+		config.FrameOptions = strings.ToUpper(*s.FrameOptions)
+	}
+	setIf(&config.ContentTypeNosniff, s.Nosniff)
+	setIf(&config.ReferrerPolicy, s.ReferrerPolicy)
+	if s.CSRF != nil && (s.CSRF.Enabled == nil || *s.CSRF.Enabled) {
+		csrf := &middleware.CSRFConfig{}
+		setIf(&csrf.CookieName, s.CSRF.CookieName)
+		setIf(&csrf.HeaderName, s.CSRF.HeaderName)
+		setIf(&csrf.FieldName, s.CSRF.FieldName)
+		setIf(&csrf.ExemptPaths, s.CSRF.ExemptPaths)
+		config.CSRF = csrf
+	}
+	return config
+}
+
+// config returns the rate limit settings; validate has checked the rates
+func (s *RateLimitSettings) config() *middleware.RateLimitConfig {
+	config := &middleware.RateLimitConfig{}
+	if s.Rate != nil {
+		config.Rate, _ = middleware.ParseRate(*s.Rate)
+	}
+	setIf(&config.Burst, s.Burst)
+	setIf(&config.Key, s.Key)
+	setIf(&config.TrustProxy, s.TrustProxy)
+	if s.MaxBodySize != nil {
+		config.MaxBodySize = int64(*s.MaxBodySize)
+	}
+	if s.Routes != nil {
+		for _, rule := range *s.Routes {
+			rate, _ := middleware.ParseRate(rule.Rate)
+			config.Routes = append(config.Routes, middleware.RateLimitRule{
+				Path:        rule.Path,
+				Methods:     rule.Methods,
+				Rate:        rate,
+				Burst:       rule.Burst,
+				Key:         rule.Key,
+				MaxBodySize: int64(rule.MaxBodySize),
+			})
+		}
+	}
+	return config
+}
+
+// config returns the response cache settings on top of the defaults
+func (s *ResponseCacheSettings) config() *middleware.ResponseCacheConfig {
+	config := middleware.DefaultResponseCacheConfig()
+	if s.MaxSize != nil {
+		config.MaxSize = int64(*s.MaxSize)
+	}
+	if s.MaxEntrySize != nil {
+		config.MaxEntrySize = int64(*s.MaxEntrySize)
+	}
+	if s.Routes != nil {
+		for _, rule := range *s.Routes {
+			config.Routes = append(config.Routes, middleware.ResponseCacheRule{
+				Path: rule.Path,
+				ResponseCachePolicy: middleware.ResponseCachePolicy{
+					MaxAge:               time.Duration(rule.MaxAge),
+					StaleWhileRevalidate: time.Duration(rule.StaleWhileRevalidate),
+					Tags:                 rule.Tags,
+				},
+			})
+		}
+	}
+	return &config
+}
+
+// config returns the cache settings on top of the server defaults
+func (s *CacheStoreSettings) config() *cache.CacheConfig {
+	config := &cache.CacheConfig{
+		MaxSize:         cache.DefaultMaxSize,
+		JanitorInterval: cache.DefaultJanitorInterval,
+	}
+	if s.MaxSize != nil {
+		config.MaxSize = int64(*s.MaxSize)
+	}
+	if s.TTL != nil {
+		config.TTL = time.Duration(*s.TTL)
+	}
+	if s.Compression != nil && *s.Compression != "none" {
+		config.CompressCache = true
+		config.Compression = *s.Compression
+	}
+	if s.JanitorInterval != nil {
+		config.JanitorInterval = time.Duration(*s.JanitorInterval)
+	}
+	if s.Remote != nil {
+		headers := make(map[string]string, len(s.Remote.Headers))
+		for name, value := range s.Remote.Headers {
+			headers[name] = os.ExpandEnv(value)
+		}
+		config.Remote = &cache.RemoteConfig{
+			URL:      s.Remote.URL,
+			Headers:  headers,
+			Timeout:  time.Duration(s.Remote.Timeout),
+			ReadOnly: s.Remote.ReadOnly,
+		}
+	}
+	return config
+}
+
+// setIf sets target to *value when value is set
+func setIf[T any](target *T, value *T) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// logProjectConfig reports which project config was applied
+func (c *Config) logProjectConfig() {
+	if c.loadedConfigFile != "" {
+		logging.Info("Loaded project config", "file", c.loadedConfigFile, "environment", c.environment())
+	}
+}
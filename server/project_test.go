@@ -0,0 +1,134 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProjectConfig = `port: 3000
+defaultLocale: de
+shutdownTimeout: 20s
+svelte:
+  minifyComponents: false
+  asyncLoading: true
+templates:
+  vimeshStyle: false
+
+development:
+  port: 3001
+  dev: true
+
+production:
+  accessLog: combined
+  svelte:
+    minifyCSS: false
+`
+
+func writeProjectConfig(t *testing.T, content string) string {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "redi.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestLoadProjectConfigEnvironments(t *testing.T) {
+	root := writeProjectConfig(t, testProjectConfig)
+	t.Setenv(EnvironmentVar, "")
+
+	config := NewConfig()
+	config.Root = root
+	if err := config.LoadProjectConfig(); err != nil {
+		t.Fatalf("Failed to load project config: %v", err)
+	}
+	if config.Port != 3000 || config.DefaultLocale != "de" || config.AccessLog != "combined" {
+		t.Errorf("Expected production settings, got port=%d locale=%q accessLog=%q", config.Port, config.DefaultLocale, config.AccessLog)
+	}
+	if config.ShutdownTimeout != 20*time.Second {
+		t.Errorf("Expected shutdown timeout 20s, got %s", config.ShutdownTimeout)
+	}
+	svelte := config.SvelteConfig
+	if svelte == nil || svelte.MinifyComponents || !svelte.EnableAsyncLoading || svelte.MinifyCSS || !svelte.MinifyRuntime {
+		t.Errorf("Unexpected Svelte config %+v", svelte)
+	}
+	if config.TemplateConfig == nil || config.TemplateConfig.VimeshStyle.Enable {
+		t.Errorf("Expected Vimesh Style disabled for templates")
+	}
+
+	config = NewConfig()
+	config.Root = root
+	config.Environment = EnvDevelopment
+	if err := config.LoadProjectConfig(); err != nil {
+		t.Fatalf("Failed to load project config: %v", err)
+	}
+	if config.Port != 3001 || !config.DevMode || config.AccessLog != "" {
+		t.Errorf("Expected development settings, got port=%d dev=%v accessLog=%q", config.Port, config.DevMode, config.AccessLog)
+	}
+	if !config.SvelteConfig.MinifyCSS {
+		t.Error("Expected the production Svelte override not to apply in development")
+	}
+}
+
+func TestLoadProjectConfigPrecedence(t *testing.T) {
+	root := writeProjectConfig(t, testProjectConfig)
+	t.Setenv(EnvironmentVar, EnvProduction)
+	t.Setenv("REDI_PORT", "4000")
+	t.Setenv("REDI_DEFAULT_LOCALE", "fr")
+
+	config := NewConfig()
+	config.Root = root
+	config.DefaultLocale = "es"
+	config.ExplicitFlags = map[string]bool{"default-locale": true}
+	if err := config.LoadProjectConfig(); err != nil {
+		t.Fatalf("Failed to load project config: %v", err)
+	}
+	if config.Port != 4000 {
+		t.Errorf("Expected REDI_PORT to override the file, got %d", config.Port)
+	}
+	if config.DefaultLocale != "es" {
+		t.Errorf("Expected the flag to override REDI_DEFAULT_LOCALE, got %q", config.DefaultLocale)
+	}
+
+	t.Setenv("REDI_PORT", "http")
+	if err := NewConfig().LoadProjectConfig(); err == nil || !strings.Contains(err.Error(), "REDI_PORT") {
+		t.Errorf("Expected an error naming REDI_PORT, got %v", err)
+	}
+}
+
+func TestParseProjectConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown setting", "port: 3000\nprot: 3001\n", `redi.yaml:2: unknown setting "prot"`},
+		{"wrong type", "port: 3000\ngzip: maybe\n", "redi.yaml:2:"},
+		{"invalid value", "port: 3000\n\ndevelopment:\n  port: 70000\n", "redi.yaml:4: port: must be between 1 and 65535"},
+		{"invalid duration", "shutdownTimeout: soon\n", `redi.yaml:1: invalid duration "soon"`},
+		{"syntax error", "port: 3000\n  gzip: true\n", "redi.yaml:2:"},
+		{"frame options", "security:\n  frameOptions: ALLOW\n", "redi.yaml:2: security.frameOptions: must be DENY or SAMEORIGIN"},
+		{"rate limit", "rateLimit:\n  rate: lots\n", `redi.yaml:2: rateLimit.rate: invalid rate "lots"`},
+		{"byte size", "rateLimit:\n  maxBodySize: huge\n", `redi.yaml:2: invalid size "huge"`},
+		{"response cache max age", "responseCache:\n  routes:\n    - path: /blog/\n", `redi.yaml:2: responseCache.routes: maxAge for "/blog/" must be positive`},
+		{"proxy target", "proxy:\n  - path: /api/*\n    target: localhost\n", `redi.yaml:1: proxy: invalid target "localhost" for /api/*`},
+		{"cache compression", "cacheStore:\n  compression: lz4\n", "redi.yaml:2: cacheStore.compression: must be zstd, gzip or none"},
+		{"cache remote url", "cacheStore:\n  remote:\n    url: cache.local\n", "redi.yaml:3: cacheStore.remote.url: invalid URL \"cache.local\""},
+		{"svelte compiler pool", "svelte:\n  compilerPoolSize: -1\n", "redi.yaml:2: svelte.compilerPoolSize: must not be negative"},
+		{"nested environment", "production:\n  development:\n    dev: true\n", "redi.yaml:1: environment sections cannot be nested"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseProjectConfig([]byte(tt.content), "redi.yaml")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := ParseProjectConfig([]byte(`{"port": 3000, "svelte": {"asyncLoading": true}}`), "redi.json"); err != nil {
+		t.Errorf("Expected JSON config to parse, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/rediwo/redi"
+	"github.com/rediwo/redi/logging"
+)
+
+// serve runs the server until it is stopped by a signal. SIGINT and SIGTERM
+// drain connections and stop, SIGHUP reloads routes and SIGUSR2 restarts the
+// process without closing the listening sockets. A daemon's PID and status
+// files are written on start and removed on exit.
+func (l *Launcher) serve(server *redi.Server, daemon *DaemonStatus) error {
+	signals := make(chan os.Signal, 1)
+	notify := append([]os.Signal{}, shutdownSignals...)
+	if reloadSignal != nil {
+		notify = append(notify, reloadSignal)
+	}
+	if restartSignal != nil {
+		notify = append(notify, restartSignal)
+	}
+	signal.Notify(signals, notify...)
+	defer signal.Stop(signals)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start()
+	}()
+
+	if daemon != nil {
+		// A restarted process replaces the files written by its predecessor
+		if err := writeDaemonFiles(daemon); err != nil {
+			logging.Warn("Failed to write PID file", "file", PIDFile(daemon.LogFile), "error", err)
+		}
+		defer func() {
+			if daemon != nil {
+				removeDaemonFiles(daemon.LogFile)
+			}
+		}()
+	}
+
+	for {
+		select {
+		case err := <-errCh:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("server failed to start: %v", err)
+			}
+			return nil
+
+		case sig := <-signals:
+			switch sig {
+			case reloadSignal:
+				logging.Info("Reloading configuration", "signal", sig.String())
+				if err := l.reloadProjectConfig(server); err != nil {
+					logging.Error("Reload failed, keeping previous configuration", "error", err)
+					continue
+				}
+				if err := server.Reload(); err != nil {
+					logging.Error("Reload failed, keeping previous configuration", "error", err)
+				}
+				continue
+
+			case restartSignal:
+				logging.Info("Restarting with socket handoff", "signal", sig.String())
+				if err := server.Restart(); err != nil {
+					logging.Error("Restart failed, continuing to serve", "error", err)
+					continue
+				}
+				// The new process owns the PID file now
+				daemon = nil
+
+			default:
+				logging.Info("Shutting down gracefully", "signal", sig.String())
+			}
+
+			if err := server.Stop(); err != nil {
+				logging.Error("Graceful shutdown incomplete", "error", err)
+			}
+			return nil
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	
 	"github.com/gorilla/mux"
 	"github.com/rediwo/redi/filesystem"
+	rediHandlers "github.com/rediwo/redi/handlers"
 )
 
 func setupMemoryFileSystem() *filesystem.MemoryFileSystem {
@@ -394,3 +395,99 @@ func BenchmarkJavaScriptExecution(b *testing.B) {
 		handlerFunc(rr, req)
 	}
 }
+
+func TestRequestIDMiddleware(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/api/id.js", []byte(`exports.get = function(req, res) {
+    res.json({ id: req.id });
+};`))
+	memFS.WriteFile("routes/5xx.html", []byte(`<p>Request {{.RequestID}}</p>`))
+	memFS.WriteFile("routes/api/fail.js", []byte(`exports.get = function(req, res) {
+    throw new Error('fail');
+};`))
+
+	server := &Server{
+		router:    mux.NewRouter(),
+		port:      8080,
+		fs:        memFS,
+		routesDir: "routes",
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	handler := server.applyMiddleware(server.router)
+
+	req := httptest.NewRequest("GET", "/api/id", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get("X-Request-ID") != "req-1" {
+		t.Errorf("Expected X-Request-ID req-1, got %q", w.Header().Get("X-Request-ID"))
+	}
+	if !strings.Contains(w.Body.String(), `"id":"req-1"`) {
+		t.Errorf("Expected req.id in response, got: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/fail", nil)
+	req.Header.Set("X-Request-ID", "req-2")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "Request req-2") {
+		t.Errorf("Expected request ID in error page, got: %s", w.Body.String())
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/api/hello.js", []byte(`exports.get = function(req, res) {
+    res.json({ ok: true });
+};`))
+
+	server := &Server{
+		router:        mux.NewRouter(),
+		port:          8080,
+		fs:            memFS,
+		routesDir:     "routes",
+		enableMetrics: true,
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	handler := server.applyMiddleware(server.router)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/hello", nil))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	expected := []string{
+		`redi_http_requests_total{route="/api/hello",handler="js",method="GET",status="200"} 1`,
+		`redi_http_request_duration_seconds_bucket{route="/api/hello",handler="js",le="+Inf"} 1`,
+		`redi_js_pool_size 3`,
+		`redi_js_pool_engines{state="session_bound"} 1`,
+		`# TYPE redi_svelte_compiles_total counter`,
+		`go_goroutines `,
+	}
+	for _, text := range expected {
+		if !strings.Contains(body, text) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", text, body)
+		}
+	}
+
+	// A pool created after the old one was stopped is the one reported
+	rediHandlers.StopJSEnginePool(memFS, "")
+	defer rediHandlers.StopJSEnginePool(memFS, "")
+	rediHandlers.GetJSEnginePool(memFS, "").GetEngineForSession("metrics")
+	rediHandlers.GetJSEnginePool(memFS, "").GetEngineForSession("metrics-2")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if text := `redi_js_pool_engines{state="session_bound"} 2`; !strings.Contains(w.Body.String(), text) {
+		t.Errorf("Expected metrics to contain %q, got:\n%s", text, w.Body.String())
+	}
+}
@@ -0,0 +1,392 @@
+package redi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rediwo/redi/filesystem"
+	"github.com/rediwo/redi/logging"
+	"github.com/rediwo/redi/middleware"
+)
+
+// ImmutableCacheControl is sent for fingerprinted assets such as
+// app-3f9a2c1b.js, whose content never changes under the same name
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// CacheControlRule sets the Cache-Control header for public files matching a
+// glob. Patterns without a slash match the file name, others the path below
+// public/, e.g. "*.html" or "images/*".
+type CacheControlRule struct {
+	Pattern string
+	Value   string
+}
+
+// StaticConfig configures how files in public/ are served
+type StaticConfig struct {
+	// IndexFiles are tried in order when a directory is requested
+	IndexFiles []string
+	// DirectoryListing lists directories that have no index file
+	DirectoryListing bool
+	// CacheControl rules, the first matching rule wins
+	CacheControl []CacheControlRule
+	// FingerprintedCacheControl is used for fingerprinted file names that
+	// no rule matches ("" disables fingerprint detection)
+	FingerprintedCacheControl string
+	// DefaultCacheControl is used for all other files
+	DefaultCacheControl string
+	// Precompressed serves file.br or file.gz next to file to clients that
+	// accept them
+	Precompressed bool
+}
+
+// DefaultStaticConfig returns the default static file settings: browsers
+// revalidate with the ETag, fingerprinted assets are cached for a year
+func DefaultStaticConfig() *StaticConfig {
+	return &StaticConfig{
+		IndexFiles:                []string{"index.html"},
+		FingerprintedCacheControl: ImmutableCacheControl,
+		DefaultCacheControl:       "no-cache",
+		Precompressed:             true,
+	}
+}
+
+// precompressedEncodings are the sibling files tried, in order of preference
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticFileServer serves the public directory
+type staticFileServer struct {
+	fs       filesystem.FileSystem
+	config   *StaticConfig
+	notFound http.HandlerFunc
+
+	mu    sync.Mutex
+	etags map[string]staticETag
+}
+
+// staticETag is a cached content hash, valid while the file is unchanged
+type staticETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// newStaticFileServer creates a server for publicFS
+func newStaticFileServer(publicFS filesystem.FileSystem, config *StaticConfig, notFound http.HandlerFunc) *staticFileServer {
+	if config == nil {
+		config = DefaultStaticConfig()
+	}
+	return &staticFileServer{
+		fs:       publicFS,
+		config:   config,
+		notFound: notFound,
+		etags:    make(map[string]staticETag),
+	}
+}
+
+func (sfs *staticFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	middleware.SetRoute(r, "/", "static")
+
+	// Don't handle component paths (containing /_)
+	if strings.Contains(r.URL.Path, "/_") {
+		sfs.notFound(w, r)
+		return
+	}
+
+	name := staticName(r.URL.Path)
+	info, err := fs.Stat(sfs.fs.GetFS(), name)
+	if err != nil {
+		sfs.notFound(w, r)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		for _, index := range sfs.config.IndexFiles {
+			indexName := path.Join(name, index)
+			if indexInfo, err := fs.Stat(sfs.fs.GetFS(), indexName); err == nil && !indexInfo.IsDir() {
+				sfs.serveFile(w, r, indexName, indexInfo)
+				return
+			}
+		}
+		if sfs.config.DirectoryListing {
+			sfs.serveListing(w, r, name)
+			return
+		}
+		sfs.notFound(w, r)
+		return
+	}
+
+	sfs.serveFile(w, r, name, info)
+}
+
+// staticName converts a URL path to a name in the public filesystem
+func staticName(urlPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// serveFile serves a file, or a precompressed sibling the client accepts,
+// with an ETag and Cache-Control header
+func (sfs *staticFileServer) serveFile(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo) {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	servedName, servedInfo := name, info
+
+	if sfs.config.Precompressed {
+		if encoding, siblingName, siblingInfo := sfs.precompressed(r, name); encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+			servedName, servedInfo = siblingName, siblingInfo
+		}
+		if sfs.hasPrecompressed(name) {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+	}
+
+	file, err := sfs.fs.GetFS().Open(servedName)
+	if err != nil {
+		sfs.notFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	etag, err := sfs.etag(servedName, servedInfo, content)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	if contentType == "" && servedName != name {
+		// Don't let ServeContent sniff the compressed bytes
+		contentType = "application/octet-stream"
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("ETag", etag)
+	if cacheControl := sfs.cacheControl(name); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// precompressed returns the best precompressed sibling of name the client
+// accepts
+func (sfs *staticFileServer) precompressed(r *http.Request, name string) (string, string, fs.FileInfo) {
+	if r.Header.Get("Range") != "" {
+		return "", "", nil
+	}
+	accepted := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+	for _, candidate := range precompressedEncodings {
+		if !accepted[candidate.encoding] {
+			continue
+		}
+		siblingName := name + candidate.extension
+		if info, err := fs.Stat(sfs.fs.GetFS(), siblingName); err == nil && !info.IsDir() {
+			return candidate.encoding, siblingName, info
+		}
+	}
+	return "", "", nil
+}
+
+// hasPrecompressed reports whether name has any precompressed sibling
+func (sfs *staticFileServer) hasPrecompressed(name string) bool {
+	for _, candidate := range precompressedEncodings {
+		if info, err := fs.Stat(sfs.fs.GetFS(), name+candidate.extension); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncodings parses an Accept-Encoding header, dropping codings with
+// q=0
+func acceptedEncodings(header string) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok && strings.Trim(q, "0.") == "" {
+			continue
+		}
+		accepted[coding] = true
+	}
+	if accepted["*"] {
+		accepted["br"] = true
+		accepted["gzip"] = true
+	}
+	return accepted
+}
+
+// etag returns the strong ETag of a file. Hashes are cached; read-only
+// (embedded) filesystems never change, so they are hashed once per file.
+func (sfs *staticFileServer) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	sfs.mu.Lock()
+	cached, ok := sfs.etags[name]
+	sfs.mu.Unlock()
+	if ok && (sfs.fs.IsReadOnly() || (cached.modTime.Equal(info.ModTime()) && cached.size == info.Size())) {
+		return cached.etag, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	sfs.mu.Lock()
+	sfs.etags[name] = staticETag{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	sfs.mu.Unlock()
+	return etag, nil
+}
+
+// cacheControl returns the Cache-Control header for a file
+func (sfs *staticFileServer) cacheControl(name string) string {
+	for _, rule := range sfs.config.CacheControl {
+		target := name
+		if !strings.Contains(rule.Pattern, "/") {
+			target = path.Base(name)
+		}
+		if matched, _ := path.Match(strings.TrimPrefix(rule.Pattern, "/"), target); matched {
+			return rule.Value
+		}
+	}
+	if sfs.config.FingerprintedCacheControl != "" && isFingerprinted(path.Base(name)) {
+		return sfs.config.FingerprintedCacheControl
+	}
+	return sfs.config.DefaultCacheControl
+}
+
+// isFingerprinted reports whether a file name contains a content hash, as
+// produced by bundlers: app.3f9a2c1b.js, chunk-5d41402a.js
+func isFingerprinted(name string) bool {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '.' || r == '-' })
+	// The first part is the name and the last the extension
+	for i := 1; i < len(parts)-1; i++ {
+		if isHexDigest(parts[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHexDigest reports whether s looks like a hex digest: eight to 64
+// lowercase hex characters, with at least one digit and one letter so
+// versions and words don't qualify
+func isHexDigest(s string) bool {
+	if len(s) < 8 || len(s) > 64 {
+		return false
+	}
+	var digits, letters bool
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case r >= 'a' && r <= 'f':
+			letters = true
+		default:
+			return false
+		}
+	}
+	return digits && letters
+}
+
+// serveListing renders a directory listing
+func (sfs *staticFileServer) serveListing(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(sfs.fs.GetFS(), name)
+	if err != nil {
+		if entries, err = sfs.fs.ReadDir(name); err != nil {
+			sfs.notFound(w, r)
+			return
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	title := html.EscapeString(r.URL.Path)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Index of %s</title>\n</head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if name != "." {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if strings.HasPrefix(entryName, ".") || strings.HasPrefix(entryName, "_") {
+			continue
+		}
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", (&url.URL{Path: entryName}).EscapedPath(), html.EscapeString(entryName))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method != http.MethodHead {
+		io.WriteString(w, b.String())
+	}
+}
+
+// setupStaticFileServer serves the public directory for requests no route
+// matched
+func (s *Server) setupStaticFileServer() {
+	publicFS, err := s.fs.Sub("public")
+	if err != nil {
+		logging.Warn("No public directory found in filesystem")
+		s.staticFiles.Store(nil)
+		return
+	}
+
+	handlerManager := s.handlerManager
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		handlerManager.errorHandler.Handle404(w, r)
+	}
+	staticFiles := newStaticFileServer(publicFS, s.staticConfig, notFound)
+	s.staticFiles.Store(staticFiles)
+	s.router.PathPrefix("/").Handler(staticFiles)
+	logging.Debug("Static file server enabled", "directory", "public")
+}
@@ -0,0 +1,181 @@
+package redi
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+)
+
+func newStaticTestServer(config *StaticConfig) *Server {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/index.html", []byte("<h1>Home</h1>"))
+	memFS.WriteFile("public/css/style.css", []byte(strings.Repeat("body { margin: 0; }\n", 100)))
+	memFS.WriteFile("public/js/app-3f9a2c1b.js", []byte("console.log('app');"))
+	memFS.WriteFile("public/js/app-3f9a2c1b.js.br", []byte("brotli bytes"))
+	memFS.WriteFile("public/js/app-3f9a2c1b.js.gz", []byte("gzip bytes"))
+	memFS.WriteFile("public/docs/index.htm", []byte("<p>Docs</p>"))
+	memFS.WriteFile("public/files/a.txt", []byte("a"))
+	memFS.WriteFile("public/files/b.txt", []byte("b"))
+
+	return &Server{
+		router:       mux.NewRouter(),
+		port:         8080,
+		fs:           memFS,
+		routesDir:    "routes",
+		version:      "test",
+		enableGzip:   true,
+		gzipLevel:    gzip.DefaultCompression,
+		staticConfig: config,
+	}
+}
+
+func serveStatic(t *testing.T, handler http.Handler, target string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", target, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStaticFileETag(t *testing.T) {
+	server := newStaticTestServer(nil)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+
+	rec := serveStatic(t, server.router, "/css/style.css", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Expected 200 with a strong ETag, got %d %q", rec.Code, etag)
+	}
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "no-cache" {
+		t.Errorf("Expected default Cache-Control no-cache, got %q", cacheControl)
+	}
+
+	rec = serveStatic(t, server.router, "/css/style.css", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", rec.Code)
+	}
+
+	// Cached hashes are recomputed when a writable filesystem changes
+	publicFS := filesystem.NewMemoryFileSystem()
+	publicFS.WriteFile("style.css", []byte("body { margin: 0; }"))
+	staticFiles := newStaticFileServer(publicFS, nil, http.NotFound)
+	etag = serveStatic(t, staticFiles, "/style.css", nil).Header().Get("ETag")
+	publicFS.WriteFile("style.css", []byte("body { margin: 1px; }"))
+	rec = serveStatic(t, staticFiles, "/style.css", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new ETag after the file changed, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestStaticFileCacheControl(t *testing.T) {
+	config := DefaultStaticConfig()
+	config.CacheControl = []CacheControlRule{
+		{Pattern: "css/*", Value: "public, max-age=3600"},
+	}
+	server := newStaticTestServer(config)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+
+	tests := map[string]string{
+		"/css/style.css":      "public, max-age=3600",
+		"/js/app-3f9a2c1b.js": ImmutableCacheControl,
+		"/files/a.txt":        "no-cache",
+	}
+	for target, want := range tests {
+		if got := serveStatic(t, server.router, target, nil).Header().Get("Cache-Control"); got != want {
+			t.Errorf("%s: expected Cache-Control %q, got %q", target, want, got)
+		}
+	}
+
+	for name, want := range map[string]bool{
+		"app.3f9a2c1b.js":       true,
+		"chunk-5d41402a.js":     true,
+		"chunk-DzA9b3xQ.js":     false,
+		"photo-IMG20240101.jpg": false,
+		"report-20240101.pdf":   false,
+		"style.css":             false,
+		"my-component.js":       false,
+		"jquery-3.7.1.min.js":   false,
+	} {
+		if got := isFingerprinted(name); got != want {
+			t.Errorf("isFingerprinted(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestStaticFilePrecompressed(t *testing.T) {
+	server := newStaticTestServer(nil)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	handler := server.applyMiddleware(server.router)
+
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		body           string
+	}{
+		{"gzip, deflate, br", "br", "brotli bytes"},
+		{"gzip", "gzip", "gzip bytes"},
+		{"br;q=0, gzip", "gzip", "gzip bytes"},
+		{"", "", "console.log('app');"},
+	}
+	for _, tt := range tests {
+		rec := serveStatic(t, handler, "/js/app-3f9a2c1b.js", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+		if rec.Header().Get("Content-Encoding") != tt.encoding || rec.Body.String() != tt.body {
+			t.Errorf("Accept-Encoding %q: expected %q encoding with %q, got %q with %q",
+				tt.acceptEncoding, tt.encoding, tt.body, rec.Header().Get("Content-Encoding"), rec.Body.String())
+		}
+		if !strings.Contains(rec.Header().Get("Content-Type"), "javascript") {
+			t.Errorf("Accept-Encoding %q: expected JavaScript content type, got %q", tt.acceptEncoding, rec.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: expected Vary: Accept-Encoding", tt.acceptEncoding)
+		}
+	}
+}
+
+func TestStaticFileDirectories(t *testing.T) {
+	server := newStaticTestServer(nil)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+
+	if rec := serveStatic(t, server.router, "/docs/", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a configured index file, got %d", rec.Code)
+	}
+	if rec := serveStatic(t, server.router, "/files/", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without directory listing, got %d", rec.Code)
+	}
+
+	config := DefaultStaticConfig()
+	config.IndexFiles = []string{"index.html", "index.htm"}
+	config.DirectoryListing = true
+	server = newStaticTestServer(config)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+
+	rec := serveStatic(t, server.router, "/docs", nil)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/docs/" {
+		t.Errorf("Expected redirect to /docs/, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serveStatic(t, server.router, "/docs/", nil); rec.Body.String() != "<p>Docs</p>" {
+		t.Errorf("Expected index.htm, got %q", rec.Body.String())
+	}
+	rec = serveStatic(t, server.router, "/files/", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<a href="a.txt">a.txt</a>`) {
+		t.Errorf("Expected directory listing, got %d %q", rec.Code, rec.Body.String())
+	}
+}
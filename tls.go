@@ -0,0 +1,103 @@
+package redi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rediwo/redi/certs"
+	"github.com/rediwo/redi/logging"
+)
+
+// AddTLSCertificate adds a certificate and key pair. The server switches to
+// HTTPS when at least one pair is configured; with several pairs the
+// certificate is chosen by SNI.
+func (s *Server) AddTLSCertificate(certFile, keyFile string) {
+	s.tlsPairs = append(s.tlsPairs, certs.Pair{CertFile: certFile, KeyFile: keyFile})
+}
+
+// SetDevTLS serves HTTPS with a self-signed certificate for localhost. The
+// certificate and its CA are generated once and cached under .redi/tls.
+func (s *Server) SetDevTLS(enabled bool) {
+	s.devTLS = enabled
+}
+
+// SetHTTPRedirectPort starts a plain HTTP listener on port that redirects all
+// requests to HTTPS. Zero disables it.
+func (s *Server) SetHTTPRedirectPort(port int) {
+	s.httpRedirectPort = port
+}
+
+// TLSEnabled reports whether the server serves HTTPS
+func (s *Server) TLSEnabled() bool {
+	return len(s.tlsPairs) > 0 || s.devTLS
+}
+
+// tlsConfig builds the TLS configuration, or returns nil for plain HTTP
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	pairs := s.tlsPairs
+
+	if s.devTLS {
+		dir := filepath.Join(s.fs.GetRoot(), ".redi", "tls")
+		pair, err := certs.EnsureDevCertificate(dir, certs.DevHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create development certificate: %w", err)
+		}
+		pairs = append(pairs, pair)
+		logging.Info("Using development TLS certificate", "cert", pair.CertFile,
+			"ca", filepath.Join(dir, certs.DevCAFile), "hint", "trust the CA to avoid browser warnings")
+	}
+
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	return certs.LoadTLSConfig(pairs)
+}
+
+// startHTTPRedirect starts the HTTP to HTTPS redirect listener in the background
+func (s *Server) startHTTPRedirect() error {
+	redirectServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.httpRedirectPort),
+		Handler: httpsRedirectHandler(s.port),
+	}
+	listener, err := listen(redirectServer.Addr)
+	if err != nil {
+		return err
+	}
+	s.redirectServer = redirectServer
+	s.redirectListener = listener
+
+	go func() {
+		logging.Info("HTTP to HTTPS redirect listening", "address", redirectServer.Addr)
+		if err := redirectServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logging.Error("HTTP redirect listener failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// httpsRedirectHandler redirects every request to the same URL on the HTTPS port
+func httpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		if httpsPort != 443 {
+			host += ":" + strconv.Itoa(httpsPort)
+		}
+
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// Keep the method and body for non-idempotent requests
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
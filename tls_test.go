@@ -0,0 +1,59 @@
+package redi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rediwo/redi/filesystem"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		method   string
+		host     string
+		port     int
+		expected string
+		status   int
+	}{
+		{"GET", "example.com", 443, "https://example.com/path?q=1", http.StatusMovedPermanently},
+		{"GET", "localhost:8080", 8443, "https://localhost:8443/path?q=1", http.StatusMovedPermanently},
+		{"POST", "example.com:80", 443, "https://example.com/path?q=1", http.StatusPermanentRedirect},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://"+tt.host+"/path?q=1", nil)
+		w := httptest.NewRecorder()
+		httpsRedirectHandler(tt.port).ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.host, tt.status, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != tt.expected {
+			t.Errorf("%s %s: expected Location %s, got %s", tt.method, tt.host, tt.expected, location)
+		}
+	}
+}
+
+func TestDevTLSConfig(t *testing.T) {
+	root := t.TempDir()
+	server := &Server{fs: filesystem.NewOSFileSystem(root)}
+
+	if config, err := server.tlsConfig(); err != nil || config != nil {
+		t.Fatalf("Expected no TLS config by default, got %v, %v", config, err)
+	}
+
+	server.SetDevTLS(true)
+	config, err := server.tlsConfig()
+	if err != nil {
+		t.Fatalf("Failed to build dev TLS config: %v", err)
+	}
+	if len(config.Certificates) != 1 {
+		t.Errorf("Expected 1 certificate, got %d", len(config.Certificates))
+	}
+	if _, err := os.Stat(filepath.Join(root, ".redi", "tls", "ca.pem")); err != nil {
+		t.Errorf("Expected CA to be cached under .redi/tls: %v", err)
+	}
+}
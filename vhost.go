@@ -0,0 +1,193 @@
+package redi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+	rediHandlers "github.com/rediwo/redi/handlers"
+	"github.com/rediwo/redi/logging"
+)
+
+// VirtualHost is a site served for requests whose Host header matches one of
+// Hosts. Hosts are names such as example.com or wildcards such as
+// *.example.com, which match any subdomain but not example.com itself.
+type VirtualHost struct {
+	Hosts []string
+	Root  string // Site directory with its own public/, routes/ and .redi cache
+}
+
+// ParseVirtualHost parses host[,host...]=dir as given to --vhost
+func ParseVirtualHost(value string) (VirtualHost, error) {
+	hosts, root, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(hosts) == "" || strings.TrimSpace(root) == "" {
+		return VirtualHost{}, fmt.Errorf("invalid virtual host %q (use host[,host...]=dir)", value)
+	}
+	vhost := VirtualHost{Root: strings.TrimSpace(root)}
+	for _, host := range strings.Split(hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			vhost.Hosts = append(vhost.Hosts, host)
+		}
+	}
+	return vhost, nil
+}
+
+// sites routes requests to virtual hosts by Host header. Each site is a
+// Server of its own with its filesystem, routes, handlers, JavaScript engine
+// pool and cache, sharing the listener and middleware of the main server,
+// which serves requests for any other host.
+type sites struct {
+	exact     map[string]*Server
+	wildcards []wildcardSite // Longest suffix first
+	servers   []*Server
+}
+
+type wildcardSite struct {
+	suffix string // .example.com
+	server *Server
+}
+
+// AddVirtualHost serves a site from its own root directory for the given
+// hosts. The site gets the server's handler settings as they are at Start,
+// and must be added before it.
+func (s *Server) AddVirtualHost(vhost VirtualHost) error {
+	if len(vhost.Hosts) == 0 {
+		return fmt.Errorf("virtual host %s has no hosts", vhost.Root)
+	}
+	for _, host := range vhost.Hosts {
+		if strings.Contains(host, "*") && (!strings.HasPrefix(host, "*.") || strings.Count(host, "*") > 1) {
+			return fmt.Errorf("invalid wildcard host %q (use *.example.com)", host)
+		}
+	}
+	s.virtualHosts = append(s.virtualHosts, vhost)
+	return nil
+}
+
+// buildSites creates a server for each virtual host
+func (s *Server) buildSites() error {
+	if len(s.virtualHosts) == 0 {
+		return nil
+	}
+	s.sites = &sites{exact: make(map[string]*Server)}
+	for _, vhost := range s.virtualHosts {
+		site := s.newSiteServer(filesystem.NewOSFileSystem(vhost.Root))
+		for _, host := range vhost.Hosts {
+			host = strings.ToLower(host)
+			if suffix, ok := strings.CutPrefix(host, "*"); ok {
+				s.sites.wildcards = append(s.sites.wildcards, wildcardSite{suffix: suffix, server: site})
+				continue
+			}
+			if _, exists := s.sites.exact[host]; exists {
+				return fmt.Errorf("host %s is served by more than one virtual host", host)
+			}
+			s.sites.exact[host] = site
+		}
+		s.sites.servers = append(s.sites.servers, site)
+	}
+	sort.SliceStable(s.sites.wildcards, func(i, j int) bool {
+		return len(s.sites.wildcards[i].suffix) > len(s.sites.wildcards[j].suffix)
+	})
+	return nil
+}
+
+// newSiteServer creates the server for a virtual host with this server's
+// handler settings. Admin and metrics endpoints stay on the main server.
+func (s *Server) newSiteServer(fs filesystem.FileSystem) *Server {
+	return &Server{
+		port:            s.port,
+		router:          mux.NewRouter(),
+		fs:              fs,
+		version:         s.version,
+		routesDir:       s.routesDir,
+		enableCache:     s.enableCache,
+		defaultLocale:   s.defaultLocale,
+		devMode:         s.devMode,
+		prebuildOnStart: s.prebuildOnStart,
+		prebuildWorkers: s.prebuildWorkers,
+		templateConfig:  s.templateConfig,
+		svelteConfig:    s.svelteConfig,
+		staticConfig:    s.staticConfig,
+		rateLimitConfig: s.rateLimitConfig,
+		cacheConfig:     s.cacheConfig,
+		shutdownTimeout: s.shutdownTimeout,
+	}
+}
+
+// siteFor returns the server for a request's host: an exact match, then the
+// longest matching wildcard, then the main server
+func (s *Server) siteFor(r *http.Request) *Server {
+	if s.sites == nil {
+		return s
+	}
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if site, ok := s.sites.exact[host]; ok {
+		return site
+	}
+	for _, wildcard := range s.sites.wildcards {
+		if strings.HasSuffix(host, wildcard.suffix) {
+			return wildcard.server
+		}
+	}
+	return s
+}
+
+// siteServers returns the virtual host servers
+func (s *Server) siteServers() []*Server {
+	if s.sites == nil {
+		return nil
+	}
+	return s.sites.servers
+}
+
+// serveSite dispatches a request to the active router of its site
+func (s *Server) serveSite(w http.ResponseWriter, r *http.Request) {
+	s.siteFor(r).serveActive(w, r)
+}
+
+// startSites creates the virtual hosts and sets up their routes
+func (s *Server) startSites() error {
+	if err := s.buildSites(); err != nil {
+		return err
+	}
+	for i, site := range s.siteServers() {
+		if err := site.setupRoutes(); err != nil {
+			return fmt.Errorf("failed to setup routes for %s: %w", site.fs.GetRoot(), err)
+		}
+		site.publish()
+		logging.Info("Serving virtual host", "hosts", strings.Join(s.virtualHosts[i].Hosts, ","), "root", s.virtualHosts[i].Root, "routes", len(site.routes))
+		if site.prebuildOnStart {
+			go site.backgroundPreBuild()
+		}
+	}
+	return nil
+}
+
+// closeSites stops the JavaScript engine pools of the virtual hosts and
+// persists their cache indexes
+func (s *Server) closeSites() error {
+	var firstErr error
+	for _, site := range s.siteServers() {
+		// A background pre-build stops after the components being compiled
+		if precompiler := site.precompiler.Load(); precompiler != nil {
+			precompiler.Stop()
+		}
+		rediHandlers.StopJSEnginePool(site.fs, site.version)
+		if site.cacheManager != nil {
+			if err := site.cacheManager.Close(); err != nil {
+				logging.Error("Failed to persist cache index", "root", site.fs.GetRoot(), "error", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
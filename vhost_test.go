@@ -0,0 +1,117 @@
+package redi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rediwo/redi/filesystem"
+	rediHandlers "github.com/rediwo/redi/handlers"
+)
+
+func writeSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestVirtualHosts(t *testing.T) {
+	memFS := filesystem.NewMemoryFileSystem()
+	memFS.WriteFile("routes/index.html", []byte("<h1>Main</h1>"))
+
+	blog := writeSite(t, map[string]string{
+		"routes/index.html":  "<h1>Blog</h1>",
+		"routes/api/name.js": `exports.get = function(req, res) { res.send('blog'); };`,
+		"public/style.css":   "body { color: blue; }",
+	})
+	shop := writeSite(t, map[string]string{
+		"routes/index.html":  "<h1>Shop</h1>",
+		"routes/api/name.js": `exports.get = function(req, res) { res.send('shop'); };`,
+	})
+
+	server := &Server{
+		router:    mux.NewRouter(),
+		fs:        memFS,
+		routesDir: "routes",
+		version:   "test",
+	}
+	if err := server.AddVirtualHost(VirtualHost{Hosts: []string{"blog.example.com"}, Root: blog}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddVirtualHost(VirtualHost{Hosts: []string{"*.shop.example.com", "shop.example.com"}, Root: shop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to setup routes: %v", err)
+	}
+	if err := server.startSites(); err != nil {
+		t.Fatalf("Failed to start sites: %v", err)
+	}
+	server.publish()
+	defer server.closeSites()
+
+	tests := []struct {
+		host, path, want string
+	}{
+		{"blog.example.com", "/", "Blog"},
+		{"BLOG.example.com:8080", "/api/name", "blog"},
+		{"blog.example.com", "/style.css", "color: blue"},
+		{"shop.example.com", "/api/name", "shop"},
+		{"de.shop.example.com", "/", "Shop"},
+		{"other.example.com", "/", "Main"},
+		{"localhost", "/", "Main"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		server.serveSite(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s%s: expected %q, got %d %q", tt.host, tt.path, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/style.css", nil)
+	req.Host = "shop.example.com"
+	rec := httptest.NewRecorder()
+	server.serveSite(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected sites not to share public files, got %d", rec.Code)
+	}
+
+	sites := server.siteServers()
+	if rediHandlers.GetJSEnginePool(sites[0].fs, "test") == rediHandlers.GetJSEnginePool(sites[1].fs, "test") {
+		t.Error("Expected each site to have its own JavaScript engine pool")
+	}
+}
+
+func TestVirtualHostConfig(t *testing.T) {
+	vhost, err := ParseVirtualHost("example.com, *.example.com=/srv/example")
+	if err != nil || vhost.Root != "/srv/example" || len(vhost.Hosts) != 2 || vhost.Hosts[1] != "*.example.com" {
+		t.Errorf("Unexpected virtual host %+v, %v", vhost, err)
+	}
+	if _, err := ParseVirtualHost("example.com"); err == nil {
+		t.Error("Expected a missing directory to be rejected")
+	}
+
+	server := &Server{}
+	if err := server.AddVirtualHost(VirtualHost{Hosts: []string{"*example.com"}, Root: "x"}); err == nil {
+		t.Error("Expected an invalid wildcard to be rejected")
+	}
+	server.AddVirtualHost(VirtualHost{Hosts: []string{"a.com"}, Root: "x"})
+	server.AddVirtualHost(VirtualHost{Hosts: []string{"A.com"}, Root: "y"})
+	if err := server.buildSites(); err == nil {
+		t.Error("Expected a host served twice to be rejected")
+	}
+}